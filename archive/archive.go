@@ -2,8 +2,16 @@ package archive
 
 import (
 	"context"
+	"fmt"
+	"glesha/config"
+	"glesha/database/model"
 	"glesha/database/repository"
 	"glesha/file_io"
+	"glesha/filter"
+	L "glesha/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
 )
 
 type ArchiveStatus int
@@ -28,11 +36,15 @@ type Archiver interface {
 	Plan(context.Context) error
 	Start(context.Context, repository.FileCatalogRepository, repository.TaskRepository) error
 	Pause(context.Context) error
+	Resume(context.Context) error
 	Abort(context.Context) error
 	UpdateStatus(context.Context, ArchiveStatus) error
 	GetInfo(context.Context) *file_io.FilesInfo
 	GetProgress(context.Context) (*Progress, error)
 	GetArchiveFilePath(context.Context) string
+	// reads files of each input path from the mapped path instead, e.g. a
+	// snapshot of it. entries keep the names of the input paths
+	SetSourcePaths(map[string]string)
 }
 
 func (status ArchiveStatus) String() string {
@@ -55,3 +67,189 @@ func (status ArchiveStatus) String() string {
 		return "UNKNOWN"
 	}
 }
+
+// checks that the input paths of "t" can be read and its output path can
+// be written, and returns the input paths, the absolute work dir and the
+// filter shared by archiving and hashing
+func prepareArchive(t *model.Task) ([]string, string, *filter.Filter, error) {
+	inputPaths := t.InputPaths
+	if len(inputPaths) == 0 {
+		inputPaths = []string{t.InputPath}
+	}
+	for _, inputPath := range inputPaths {
+		readable, err := file_io.IsReadable(inputPath)
+		if err != nil || !readable {
+			return nil, "", nil, fmt.Errorf("no read permission on input path: %s", inputPath)
+		}
+	}
+
+	err := os.MkdirAll(t.OutputPath, os.ModePerm)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	writable, err := file_io.IsWritable(t.OutputPath)
+
+	if err != nil || !writable {
+		return nil, "", nil, fmt.Errorf("no write permission on output path: %s", t.OutputPath)
+	}
+
+	absGleshaWorkDir, err := filepath.Abs(t.OutputPath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	ignoredPaths := map[string]bool{
+		absGleshaWorkDir: true,
+	}
+	f, err := filter.New(inputPaths, t.FilterPatterns, ignoredPaths)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return inputPaths, absGleshaWorkDir, f, nil
+}
+
+// returns where the archive file of "t" is written, it may have been
+// removed since
+func ArchiveFilePath(t *model.Task) string {
+	if t.ArchiveFormat == config.AF_REPO {
+		return filepath.Join(t.OutputPath, manifestFileName(t.Id))
+	}
+	return filepath.Join(t.OutputPath, tarFileName(t.Id))
+}
+
+// input paths are archived under their base names, like tar does. when
+// base names collide, later ones get a numeric suffix, e.g. photos-2
+func archivePrefixes(inputPaths []string) map[string]string {
+	prefixes := make(map[string]string, len(inputPaths))
+	used := make(map[string]bool, len(inputPaths))
+	for _, inputPath := range inputPaths {
+		base := filepath.Base(inputPath)
+		if base == string(filepath.Separator) {
+			// contents of / are archived without a prefix
+			prefixes[inputPath] = ""
+			continue
+		}
+		prefix := base
+		for i := 2; used[prefix]; i++ {
+			prefix = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[prefix] = true
+		prefixes[inputPath] = prefix
+	}
+	return prefixes
+}
+
+// returns the name of "path" inside the archive, "path" must be in "root"
+func entryName(prefixes map[string]string, root string, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	prefix := prefixes[root]
+	if len(prefix) == 0 {
+		return rel, nil
+	}
+	if rel == "." {
+		return prefix, nil
+	}
+	return filepath.Join(prefix, rel), nil
+}
+
+// identifies a file across its hardlinks
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// returns the entry name the content of a file is archived as if it is a
+// hardlink to a file archived before, otherwise ""
+func hardlinkTarget(seen map[inode]string, info fs.FileInfo, meta file_io.FileMetadata) string {
+	if !info.Mode().IsRegular() || !meta.IsHardlinked() {
+		return ""
+	}
+	return seen[inode{meta.Dev, meta.Ino}]
+}
+
+// remembers entry "name" as the target of later hardlinks to the same
+// file, only once its content is archived
+func addHardlinkTarget(seen map[inode]string, name string, info fs.FileInfo, meta file_io.FileMetadata) {
+	if !info.Mode().IsRegular() || !meta.IsHardlinked() {
+		return
+	}
+	seen[inode{meta.Dev, meta.Ino}] = name
+}
+
+// returns PAX records for "xattrs" of "path" in the SCHILY namespace used
+// by GNU tar and star, POSIX ACLs are stored as text so both can restore them
+func xattrPAXRecords(path string, xattrs map[string][]byte) map[string]string {
+	records := make(map[string]string, len(xattrs))
+	for name, value := range xattrs {
+		switch name {
+		case file_io.XATTR_POSIX_ACL_ACCESS, file_io.XATTR_POSIX_ACL_DEFAULT:
+			text, err := file_io.PosixACLText(value)
+			if err != nil {
+				L.Warn(fmt.Sprintf("archive: skipping %s of %s: %v", name, path, err))
+				continue
+			}
+			if name == file_io.XATTR_POSIX_ACL_ACCESS {
+				records["SCHILY.acl.access"] = text
+			} else {
+				records["SCHILY.acl.default"] = text
+			}
+		default:
+			records["SCHILY.xattr."+name] = string(value)
+		}
+	}
+	return records
+}
+
+func newCatalogRow(
+	taskId int64,
+	name string,
+	root string,
+	info fs.FileInfo,
+	meta file_io.FileMetadata,
+) model.FileCatalogRow {
+	fileType := "file"
+	if info.IsDir() {
+		fileType = "dir"
+	}
+	return model.FileCatalogRow{
+		TaskId:     taskId,
+		FullPath:   name,
+		Name:       info.Name(),
+		ParentPath: filepath.Dir(name),
+		FileType:   fileType,
+		SizeBytes:  info.Size(),
+		ModifiedAt: info.ModTime(),
+		Root:       root,
+		Uid:        meta.Uid,
+		Gid:        meta.Gid,
+		Uname:      meta.Uname,
+		Gname:      meta.Gname,
+		Mode:       uint32(info.Mode()),
+		// set by archives that record where entries are
+		ArchiveOffset: -1,
+		ArchiveMember: -1,
+	}
+}
+
+// returns the path files of input path "root" are read from
+func sourcePath(sourcePaths map[string]string, root string) string {
+	if src, ok := sourcePaths[root]; ok && len(src) > 0 {
+		return src
+	}
+	return root
+}
+
+// maps "srcPath" found under "srcRoot" back to where it is in input path "root"
+func inputPathOf(root string, srcRoot string, srcPath string) string {
+	if srcRoot == root {
+		return srcPath
+	}
+	rel, err := filepath.Rel(srcRoot, srcPath)
+	if err != nil {
+		return srcPath
+	}
+	return filepath.Join(root, rel)
+}
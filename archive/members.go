@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"glesha/database/model"
+	"io"
+)
+
+// uncompressed bytes after which tar.gz archives start a new gzip member.
+// a single entry is read by downloading the members it is in, so smaller
+// members mean smaller downloads, but compress slightly worse
+const GZIP_MEMBER_SIZE int64 = 64 * 1024 * 1024
+
+// counts bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// returns the byte range [start, end) of the compressed archive holding
+// "entry", and how many decompressed bytes of it come before the entry.
+// "archiveSize" is the size of the compressed archive
+func EntryRange(
+	members []model.ArchiveMember,
+	entry *model.FileCatalogRow,
+	archiveSize int64,
+) (start int64, end int64, skip int64, err error) {
+	if entry.ArchiveOffset < 0 || entry.ArchiveMember < 0 {
+		return 0, 0, 0, fmt.Errorf("archive offset of %s is not known", entry.FullPath)
+	}
+	if entry.ArchiveMember >= int64(len(members)) || members[entry.ArchiveMember].Index != entry.ArchiveMember {
+		return 0, 0, 0, fmt.Errorf("gzip member %d of %s is not known", entry.ArchiveMember, entry.FullPath)
+	}
+	member := members[entry.ArchiveMember]
+	start = member.CompressedOffset
+	skip = entry.ArchiveOffset - member.UncompressedOffset
+	end = archiveSize
+	entryEnd := entry.ArchiveOffset + entry.ArchiveSize
+	for _, m := range members[entry.ArchiveMember+1:] {
+		if m.UncompressedOffset >= entryEnd {
+			end = m.CompressedOffset
+			break
+		}
+	}
+	return start, end, skip, nil
+}
+
+// reads the entry found "skip" bytes into "r", which holds the compressed
+// range returned by EntryRange. hardlinks have no content, it is stored
+// with the entry in their Linkname
+func ReadEntry(r io.Reader, skip int64) (*tar.Header, io.Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read gzip member: %w", err)
+	}
+	_, err = io.CopyN(io.Discard, gz, skip)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not seek to entry: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read entry header: %w", err)
+	}
+	return hdr, tr, nil
+}
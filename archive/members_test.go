@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarGzArchive_EntryRange(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "dir"), 0755))
+	assert.NoError(t, os.Mkdir(outputPath, 0755))
+	contents := make(map[string][]byte)
+	rng := rand.New(rand.NewSource(1))
+	for i, size := range []int{10, 3000, 9000, 0, 20000, 512} {
+		data := make([]byte, size)
+		rng.Read(data)
+		name := filepath.Join("dir", string(rune('a'+i))+".bin")
+		assert.NoError(t, os.WriteFile(filepath.Join(inputPath, name), data, 0644))
+		contents["input/"+filepath.ToSlash(name)] = data
+	}
+
+	task := &model.Task{Id: 1, InputPath: inputPath, OutputPath: outputPath}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	archiver.memberSize = 4096
+	assert.NoError(t, archiver.Plan(context.Background()))
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	err = archiver.archive(context.Background(), catalogRepo, repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+
+	members, err := catalogRepo.GetArchiveMembers(context.Background(), task.Id)
+	assert.NoError(t, err)
+	assert.Greater(t, len(members), 3)
+	f, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	assert.NoError(t, err)
+
+	entries, err := catalogRepo.GetByParentPath(context.Background(), task.Id, "input/dir")
+	assert.NoError(t, err)
+	assert.Len(t, entries, len(contents))
+	for _, entry := range entries {
+		start, end, skip, err := EntryRange(members, &entry, info.Size())
+		assert.NoError(t, err)
+		hdr, r, err := ReadEntry(io.NewSectionReader(f, start, end-start), skip)
+		assert.NoError(t, err)
+		assert.Equal(t, entry.FullPath, hdr.Name)
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, contents[entry.FullPath], data, entry.FullPath)
+		sum := sha256.Sum256(data)
+		assert.Equal(t, hex.EncodeToString(sum[:]), entry.Sha256)
+	}
+
+	// the archive is still a single tar stream for regular tools
+	_, err = f.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	n := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			n++
+		}
+	}
+	assert.Equal(t, len(contents), n)
+
+	_, _, _, err = EntryRange(members, &model.FileCatalogRow{ArchiveOffset: -1, ArchiveMember: -1}, info.Size())
+	assert.Error(t, err)
+}
@@ -0,0 +1,661 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"glesha/chunker"
+	"glesha/control"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	"glesha/filter"
+	L "glesha/logger"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// packs are closed once they reach this size, small enough that a failed
+// pack upload is cheap to retry
+const PACK_TARGET_SIZE int64 = 16 * 1024 * 1024
+
+const MANIFEST_VERSION int64 = 1
+
+// Manifest lists the files of a repo archive and where their chunks are
+// stored, it is all that is needed to restore a task besides the packs
+type Manifest struct {
+	Version     int64                    `json:"version"`
+	TaskId      int64                    `json:"task_id"`
+	ContainerId string                   `json:"container_id"`
+	CreatedAt   time.Time                `json:"created_at"`
+	InputPaths  []string                 `json:"input_paths"`
+	Files       []ManifestFile           `json:"files"`
+	Chunks      map[string]ManifestChunk `json:"chunks"`
+}
+
+type ManifestFile struct {
+	// path inside the archive, same as tar entry names of targz archives
+	Name       string    `json:"name"`
+	Root       string    `json:"root"`
+	Type       string    `json:"type"`
+	Mode       uint32    `json:"mode"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Link       string    `json:"link,omitempty"`
+	// entry name of the file this is a hardlink to
+	Hardlink string            `json:"hardlink,omitempty"`
+	Uid      int               `json:"uid"`
+	Gid      int               `json:"gid"`
+	Uname    string            `json:"uname,omitempty"`
+	Gname    string            `json:"gname,omitempty"`
+	Xattrs   map[string][]byte `json:"xattrs,omitempty"`
+	// sha256 of each chunk of a regular file, in order
+	Chunks []string `json:"chunks,omitempty"`
+	// sha256 of the content of a regular file
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+type ManifestChunk struct {
+	Pack   string `json:"pack"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// returns the key pack "hash" is uploaded with, packs are shared by all
+// tasks uploading to the same container
+func PackKey(hash string) string {
+	return fmt.Sprintf("packs/%s/%s", hash[:2], hash)
+}
+
+// RepoArchive splits files into content defined chunks and stores each
+// chunk once per container in packs, the archive file is a manifest
+// referencing them
+type RepoArchive struct {
+	Id            int64
+	InputPath     string
+	InputPaths    []string
+	OutputPath    string
+	ContainerId   string
+	Info          *file_io.FilesInfo
+	Progress      *Progress
+	abortReq      chan struct{}
+	abortDone     chan struct{}
+	gate          *control.Gate
+	GleshaWorkDir string
+	Filter        *filter.Filter
+	chunkRepo     repository.ChunkRepository
+	// name of the top level directory of each input path in the archive
+	prefixes map[string]string
+	// where each input path is read from, see SetSourcePaths
+	SourcePaths map[string]string
+}
+
+func NewRepoArchiver(
+	t *model.Task,
+	chunkRepo repository.ChunkRepository,
+	containerId string,
+) (*RepoArchive, error) {
+	if len(containerId) == 0 {
+		return nil, fmt.Errorf("container id is required for repo archives")
+	}
+	inputPaths, absGleshaWorkDir, f, err := prepareArchive(t)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoArchive{
+		Id:            t.Id,
+		InputPath:     inputPaths[0],
+		InputPaths:    inputPaths,
+		OutputPath:    t.OutputPath,
+		ContainerId:   containerId,
+		Info:          nil,
+		Progress:      &Progress{0, 0, STATUS_IN_QUEUE},
+		abortReq:      make(chan struct{}),
+		abortDone:     make(chan struct{}),
+		gate:          control.NewGate(),
+		GleshaWorkDir: absGleshaWorkDir,
+		Filter:        f,
+		chunkRepo:     chunkRepo,
+		prefixes:      archivePrefixes(inputPaths)}, nil
+}
+
+func (ra *RepoArchive) UpdateStatus(ctx context.Context, newStatus ArchiveStatus) error {
+	ra.Progress.Status = newStatus
+	return nil
+}
+
+func (ra *RepoArchive) Plan(ctx context.Context) error {
+	ra.UpdateStatus(ctx, STATUS_PLANNING)
+	L.Info(fmt.Sprintf("Checking if files are changed in %s", strings.Join(ra.InputPaths, ", ")))
+	fileInfo, err := file_io.ComputeFilesInfo(ctx, ra.InputPaths, ra.Filter)
+	if err != nil {
+		return err
+	}
+	ra.Info = fileInfo
+	ra.Progress.Done = 0
+	ra.Progress.Total = fileInfo.TotalFileCount
+	ra.UpdateStatus(ctx, STATUS_PLANNED)
+	return nil
+}
+
+func (ra *RepoArchive) GetInfo(ctx context.Context) *file_io.FilesInfo {
+	return ra.Info
+}
+
+func (ra *RepoArchive) getManifestFile() string {
+	return filepath.Join(ra.GleshaWorkDir, manifestFileName(ra.Id))
+}
+
+func manifestFileName(taskId int64) string {
+	return fmt.Sprintf("glesha-%d.manifest.json.gz", taskId)
+}
+
+// packs waiting for upload are kept per container, so tasks uploading to
+// different containers do not pick up each others packs
+func (ra *RepoArchive) getPackDir() string {
+	sum := sha256.Sum256([]byte(ra.ContainerId))
+	return filepath.Join(ra.GleshaWorkDir, "packs", hex.EncodeToString(sum[:])[:16])
+}
+
+func (ra *RepoArchive) archive(
+	ctx context.Context,
+	catalogRepo repository.FileCatalogRepository,
+	taskRepo repository.TaskRepository,
+) error {
+	ra.UpdateStatus(ctx, STATUS_RUNNING)
+	// entries of an earlier archive of this task are replaced
+	err := catalogRepo.DeleteByTaskId(context.WithoutCancel(ctx), ra.Id)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(ra.getPackDir(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	pw := &packWriter{
+		dir:         ra.getPackDir(),
+		containerId: ra.ContainerId,
+		chunkRepo:   ra.chunkRepo,
+		pending:     make(map[string]bool),
+	}
+	defer pw.discard()
+	manifest := &Manifest{
+		Version:     MANIFEST_VERSION,
+		TaskId:      ra.Id,
+		ContainerId: ra.ContainerId,
+		CreatedAt:   time.Now(),
+		InputPaths:  ra.InputPaths,
+		Chunks:      make(map[string]ManifestChunk),
+	}
+	var completedBytes uint64 = 0
+	var shouldAbort bool = false
+	startTime := time.Now()
+
+	var catalogBatch []model.FileCatalogRow
+	// first entry name of each file with more than one hardlink
+	hardlinks := make(map[inode]string)
+
+	var root, srcRoot string
+	walkFn := func(srcPath string, info fs.FileInfo, walkErr error) error {
+		path := inputPathOf(root, srcRoot, srcPath)
+		// pausing happens between files, so no pack is left half written
+		if ra.gate.IsPaused() {
+			L.Footer(L.NORMAL, fmt.Sprintf("Archiving: Paused (%d/%d)", ra.Progress.Done, ra.Progress.Total))
+		}
+		if ra.gate.Wait(ctx) != nil {
+			L.Debug("Received abort signal inside filepath.Walk")
+			shouldAbort = true
+			return fs.SkipAll
+		}
+
+		if walkErr != nil {
+			return fs.SkipDir
+		}
+
+		if ra.Filter.IsExcluded(path, info.IsDir()) {
+			L.Debug(fmt.Sprintf("Archive: excluding %s", path))
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		isSpecialPath := strings.HasPrefix(path, "/proc") ||
+			strings.HasPrefix(path, "/dev") ||
+			strings.HasPrefix(path, "/sys")
+
+		if isSpecialPath {
+			if info.IsDir() {
+				L.Warn(fmt.Sprintf("Archive: skipping potentially problematic dir: %s", path))
+				return fs.SkipDir
+			} else {
+				L.Warn(fmt.Sprintf("Archive: skipping potentially problematic file: %s", path))
+				return nil
+			}
+		}
+
+		L.Debug(fmt.Sprintf("Processing: %s", L.TruncateString(path, 48, L.TRUNC_LEFT)))
+
+		relPath, err := entryName(ra.prefixes, root, path)
+		if err != nil {
+			L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
+			return nil
+		}
+
+		// Skip special file types like sockets, devices, FIFOs
+		if info.Mode()&os.ModeSocket != 0 ||
+			info.Mode()&os.ModeDevice != 0 ||
+			info.Mode()&os.ModeNamedPipe != 0 {
+			L.Warn(fmt.Sprintf("archive: skipping special file type: %s (mode: %s)", path, info.Mode().String()))
+			return nil
+		}
+
+		meta := file_io.GetFileMetadata(info)
+		entry := ManifestFile{
+			Name:       relPath,
+			Root:       root,
+			Type:       "file",
+			Mode:       uint32(info.Mode()),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+			Uid:        meta.Uid,
+			Gid:        meta.Gid,
+			Uname:      meta.Uname,
+			Gname:      meta.Gname,
+		}
+		entry.Xattrs, err = file_io.ReadXattrs(srcPath)
+		if err != nil {
+			L.Warn(fmt.Sprintf("archive: could not read extended attributes: %v", err))
+		}
+		entry.Hardlink = hardlinkTarget(hardlinks, info, meta)
+		switch {
+		case info.IsDir():
+			entry.Type = "dir"
+			entry.Size = 0
+		case info.Mode()&os.ModeSymlink == os.ModeSymlink:
+			entry.Type = "symlink"
+			entry.Link, err = os.Readlink(srcPath)
+			if err != nil {
+				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
+				return nil
+			}
+		case len(entry.Hardlink) > 0:
+			// content is stored with the entry it links to
+			ra.Progress.Done++
+			completedBytes += uint64(info.Size())
+		case info.Mode().IsRegular():
+			var progressPercentage float64 = 100.0
+			if ra.Progress.Total > 0 {
+				progressPercentage = float64(completedBytes) * 100.0 / float64(ra.Info.SizeInBytes)
+			}
+			L.Footer(L.NORMAL, fmt.Sprintf("Archiving: %.2f%% %s (%d/%d) [%s - %s]",
+				progressPercentage,
+				L.ProgressBar(progressPercentage, -1),
+				ra.Progress.Done,
+				ra.Progress.Total,
+				L.TruncateString(filepath.Base(path), 24, L.TRUNC_CENTER),
+				L.HumanReadableBytes(uint64(info.Size()), 2)))
+			entry.Chunks, entry.Sha256, err = ra.storeFile(ctx, srcPath, pw)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				// skip files that are not readable, chunks stored so far
+				// are kept and may be used by later files
+				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
+				return nil
+			}
+			addHardlinkTarget(hardlinks, relPath, info, meta)
+			ra.Progress.Done++
+			if ra.Progress.Done%10 == 0 {
+				_ = taskRepo.UpdateArchivedFileCount(ctx, ra.Id, int64(ra.Progress.Done))
+			}
+			completedBytes += uint64(info.Size())
+		}
+		manifest.Files = append(manifest.Files, entry)
+
+		row := newCatalogRow(ra.Id, relPath, root, info, meta)
+		row.Sha256 = entry.Sha256
+		catalogBatch = append(catalogBatch, row)
+		const CATALOG_BATCH_SIZE int = 1000
+		if len(catalogBatch) >= CATALOG_BATCH_SIZE {
+			err := catalogRepo.AddMany(ctx, catalogBatch)
+			if err != nil {
+				return fmt.Errorf("archive: could not add files metadata due to error: %w", err)
+			}
+			catalogBatch = nil
+		}
+		return nil
+	}
+	for _, root = range ra.InputPaths {
+		srcRoot = sourcePath(ra.SourcePaths, root)
+		err = filepath.Walk(srcRoot, walkFn)
+		if err != nil || shouldAbort {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if shouldAbort {
+		return ctx.Err()
+	}
+
+	// chunks of the last pack must be in the index before resolving
+	// their locations
+	err = pw.flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(catalogBatch) > 0 {
+		err := catalogRepo.AddMany(ctx, catalogBatch)
+		if err != nil {
+			return fmt.Errorf("archive: could not add files metadata to db due to error: %w", err)
+		}
+	}
+
+	for _, f := range manifest.Files {
+		for _, chunkHash := range f.Chunks {
+			if _, ok := manifest.Chunks[chunkHash]; ok {
+				continue
+			}
+			chunk, err := ra.chunkRepo.GetChunk(ctx, ra.ContainerId, chunkHash)
+			if err != nil {
+				return fmt.Errorf("archive: could not find chunk %s: %w", chunkHash, err)
+			}
+			manifest.Chunks[chunkHash] = ManifestChunk{
+				Pack:   chunk.PackHash,
+				Offset: chunk.Offset,
+				Size:   chunk.SizeBytes,
+			}
+		}
+	}
+
+	err = writeManifest(ra.getManifestFile(), manifest)
+	if err != nil {
+		return err
+	}
+
+	L.Footer(L.NORMAL, "")
+	L.Printf("Archiving: Done (%d/%d) (%s -> %s new in %d packs)\n",
+		ra.Progress.Done,
+		ra.Progress.Total,
+		L.HumanReadableBytes(ra.Info.SizeInBytes, 2),
+		L.HumanReadableBytes(pw.newBytes, 2),
+		pw.packCount)
+	L.Printf("Archiving took %s\n", L.HumanReadableTime(time.Now().UnixMilli()-startTime.UnixMilli()))
+	return nil
+}
+
+// stores chunks of the file at "path", and returns their hashes and the
+// hash of the whole file
+func (ra *RepoArchive) storeFile(ctx context.Context, path string, pw *packWriter) ([]string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	c := chunker.New(file)
+	fileHash := sha256.New()
+	var hashes []string
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			return hashes, hex.EncodeToString(fileHash.Sum(nil)), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		fileHash.Write(data)
+		sum := sha256.Sum256(data)
+		chunkHash := hex.EncodeToString(sum[:])
+		hashes = append(hashes, chunkHash)
+		if pw.pending[chunkHash] {
+			continue
+		}
+		_, err = ra.chunkRepo.GetChunk(ctx, ra.ContainerId, chunkHash)
+		if err == nil {
+			continue
+		}
+		if err != database.ErrDoesNotExist {
+			return nil, "", err
+		}
+		err = pw.add(ctx, chunkHash, data)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// packWriter appends new chunks to a temporary file, which becomes a
+// pack named by its sha256 once it reaches PACK_TARGET_SIZE
+type packWriter struct {
+	dir         string
+	containerId string
+	chunkRepo   repository.ChunkRepository
+	file        *os.File
+	hash        hash.Hash
+	size        int64
+	chunks      []model.Chunk
+	// chunks written to the current pack, they are not in the index yet
+	pending   map[string]bool
+	newBytes  uint64
+	packCount int
+}
+
+func (pw *packWriter) add(ctx context.Context, chunkHash string, data []byte) error {
+	if pw.file == nil {
+		file, err := os.CreateTemp(pw.dir, "pack-*.tmp")
+		if err != nil {
+			return fmt.Errorf("archive: could not create pack: %w", err)
+		}
+		pw.file = file
+		pw.hash = sha256.New()
+	}
+	_, err := io.MultiWriter(pw.file, pw.hash).Write(data)
+	if err != nil {
+		return fmt.Errorf("archive: could not write to pack %s: %w", pw.file.Name(), err)
+	}
+	pw.chunks = append(pw.chunks, model.Chunk{
+		ContainerId: pw.containerId,
+		Hash:        chunkHash,
+		Offset:      pw.size,
+		SizeBytes:   int64(len(data)),
+	})
+	pw.pending[chunkHash] = true
+	pw.size += int64(len(data))
+	pw.newBytes += uint64(len(data))
+	if pw.size >= PACK_TARGET_SIZE {
+		return pw.flush(ctx)
+	}
+	return nil
+}
+
+// closes the current pack and adds it to the index as pending upload
+func (pw *packWriter) flush(ctx context.Context) error {
+	if pw.file == nil {
+		return nil
+	}
+	tmpPath := pw.file.Name()
+	err := pw.file.Close()
+	pw.file = nil
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("archive: could not close pack %s: %w", tmpPath, err)
+	}
+	packHash := hex.EncodeToString(pw.hash.Sum(nil))
+	packPath := filepath.Join(pw.dir, packHash)
+	err = os.Rename(tmpPath, packPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("archive: could not save pack %s: %w", packHash, err)
+	}
+	_, err = pw.chunkRepo.AddPack(ctx, &model.Pack{
+		ContainerId: pw.containerId,
+		Hash:        packHash,
+		FilePath:    packPath,
+		SizeBytes:   pw.size,
+		CreatedAt:   time.Now(),
+	}, pw.chunks)
+	if err != nil {
+		os.Remove(packPath)
+		return err
+	}
+	pw.size = 0
+	pw.chunks = nil
+	pw.pending = make(map[string]bool)
+	pw.packCount++
+	return nil
+}
+
+// removes the current pack if it was not flushed, its chunks are not in
+// the index, so nothing references them
+func (pw *packWriter) discard() {
+	if pw.file == nil {
+		return
+	}
+	tmpPath := pw.file.Name()
+	pw.file.Close()
+	pw.file = nil
+	os.Remove(tmpPath)
+}
+
+// writes "manifest" to "path", replacing it only once it is complete
+func writeManifest(path string, manifest *Manifest) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("archive: could not create manifest: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	gzipWriter := gzip.NewWriter(tmpFile)
+	err = json.NewEncoder(gzipWriter).Encode(manifest)
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("archive: could not write manifest: %w", err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("archive: could not write manifest: %w", err)
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("archive: could not write manifest: %w", err)
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func ReadManifest(filePath string) (*Manifest, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	return DecodeManifest(file)
+}
+
+// reads a manifest written by a repo archive from "r", e.g. when it is
+// downloaded from a storage backend
+func DecodeManifest(r io.Reader) (*Manifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid gzip stream: %w", err)
+	}
+	defer gr.Close()
+	var manifest Manifest
+	err = json.NewDecoder(gr).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid manifest: %w", err)
+	}
+	if manifest.Version != MANIFEST_VERSION {
+		return nil, fmt.Errorf("unsupported manifest version: %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// checks that the manifest at "filePath" belongs to "containerId" and
+// that every pack it references is known to "chunkRepo"
+func IsValidManifest(
+	ctx context.Context,
+	filePath string,
+	containerId string,
+	chunkRepo repository.ChunkRepository,
+) error {
+	manifest, err := ReadManifest(filePath)
+	if err != nil {
+		return err
+	}
+	if manifest.ContainerId != containerId {
+		return fmt.Errorf("manifest was created for %s instead of %s", manifest.ContainerId, containerId)
+	}
+	checked := make(map[string]bool)
+	for chunkHash, chunk := range manifest.Chunks {
+		if checked[chunk.Pack] {
+			continue
+		}
+		_, err := chunkRepo.GetPack(ctx, containerId, chunk.Pack)
+		if err != nil {
+			return fmt.Errorf("pack %s of chunk %s is not available: %w", chunk.Pack, chunkHash, err)
+		}
+		checked[chunk.Pack] = true
+	}
+	return nil
+}
+
+func (ra *RepoArchive) Start(
+	ctx context.Context,
+	catalogRepo repository.FileCatalogRepository,
+	taskRepo repository.TaskRepository,
+) error {
+	return ra.archive(ctx, catalogRepo, taskRepo)
+}
+
+func (ra *RepoArchive) GetProgress(ctx context.Context) (*Progress, error) {
+	if ra.Progress == nil {
+		return nil, fmt.Errorf("progress is nil, this should be unreachable")
+	}
+	return ra.Progress, nil
+}
+
+func (ra *RepoArchive) Abort(ctx context.Context) error {
+	if ra.Progress.Status != STATUS_RUNNING {
+		return fmt.Errorf("Abort() called when archiver is not running")
+	}
+	ra.abortReq <- struct{}{}
+	<-ra.abortDone
+	return nil
+}
+
+func (ra *RepoArchive) Pause(ctx context.Context) error {
+	if ra.Progress.Status != STATUS_RUNNING {
+		return fmt.Errorf("Pause() called when archiver is not running")
+	}
+	ra.gate.Pause()
+	return ra.UpdateStatus(ctx, STATUS_PAUSED)
+}
+
+func (ra *RepoArchive) Resume(ctx context.Context) error {
+	if ra.Progress.Status != STATUS_PAUSED {
+		return fmt.Errorf("Resume() called when archiver is not paused")
+	}
+	ra.gate.Resume()
+	return ra.UpdateStatus(ctx, STATUS_RUNNING)
+}
+
+func (ra *RepoArchive) SetSourcePaths(sourcePaths map[string]string) {
+	ra.SourcePaths = sourcePaths
+}
+
+func (ra *RepoArchive) GetArchiveFilePath(ctx context.Context) string {
+	return filepath.Join(ra.OutputPath, filepath.Base(ra.getManifestFile()))
+}
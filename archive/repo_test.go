@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoArchive_Deduplicates(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "sub"), 0755))
+	data := make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.bin"), data, 0644))
+	// same content under another name is stored once
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "sub", "b.bin"), data, 0644))
+	createDummyFile(t, filepath.Join(inputPath, "small.txt"), "small")
+	assert.NoError(t, os.Symlink("small.txt", filepath.Join(inputPath, "link")))
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Init(ctx))
+	chunkRepo := repository.NewChunkRepository(db)
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	taskRepo := repository.NewTaskRepository(db)
+
+	_, err = NewRepoArchiver(&model.Task{Id: 1, InputPath: inputPath, OutputPath: outputPath}, chunkRepo, "")
+	assert.Error(t, err)
+
+	newArchiver := func(id int64) *RepoArchive {
+		task := &model.Task{Id: id, InputPath: inputPath, OutputPath: outputPath}
+		archiver, err := NewRepoArchiver(task, chunkRepo, "s3://test-bucket")
+		assert.NoError(t, err)
+		assert.NoError(t, archiver.Plan(ctx))
+		return archiver
+	}
+
+	archiver := newArchiver(1)
+	assert.NoError(t, archiver.archive(ctx, catalogRepo, taskRepo))
+	assert.Equal(t, uint64(3), archiver.Progress.Done)
+	packs, err := chunkRepo.ListPendingPacks(ctx, "s3://test-bucket")
+	assert.NoError(t, err)
+	assert.Len(t, packs, 1)
+	assert.Less(t, packs[0].SizeBytes, int64(len(data))*2)
+	assert.FileExists(t, packs[0].FilePath)
+
+	manifestPath := archiver.GetArchiveFilePath(ctx)
+	manifest, err := ReadManifest(manifestPath)
+	assert.NoError(t, err)
+	assert.NoError(t, IsValidManifest(ctx, manifestPath, "s3://test-bucket", chunkRepo))
+	assert.Error(t, IsValidManifest(ctx, manifestPath, "s3://other-bucket", chunkRepo))
+
+	files := make(map[string]ManifestFile)
+	for _, f := range manifest.Files {
+		files[f.Name] = f
+	}
+	assert.Equal(t, "dir", files["input/sub"].Type)
+	assert.Equal(t, "symlink", files["input/link"].Type)
+	assert.Equal(t, "small.txt", files["input/link"].Link)
+	assert.Equal(t, files["input/a.bin"].Chunks, files["input/sub/b.bin"].Chunks)
+	sum := sha256.Sum256(data)
+	assert.Equal(t, hex.EncodeToString(sum[:]), files["input/a.bin"].Sha256)
+	duplicates, err := catalogRepo.ListDuplicates(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, duplicates, 1)
+	assert.Equal(t, []string{"input/a.bin", "input/sub/b.bin"}, duplicates[0].Paths)
+	assert.Equal(t, int64(len(data)), duplicates[0].WastedBytes())
+
+	// chunks are reassembled from the pack
+	pack, err := os.ReadFile(packs[0].FilePath)
+	assert.NoError(t, err)
+	var restored []byte
+	for _, chunkHash := range files["input/sub/b.bin"].Chunks {
+		loc := manifest.Chunks[chunkHash]
+		assert.Equal(t, packs[0].Hash, loc.Pack)
+		restored = append(restored, pack[loc.Offset:loc.Offset+loc.Size]...)
+	}
+	assert.True(t, bytes.Equal(data, restored))
+
+	// archiving the same data again writes no new packs
+	assert.NoError(t, chunkRepo.MarkPackUploaded(ctx, packs[0].Id, manifest.CreatedAt))
+	archiver = newArchiver(2)
+	assert.NoError(t, archiver.archive(ctx, catalogRepo, taskRepo))
+	packs, err = chunkRepo.ListPendingPacks(ctx, "s3://test-bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, packs)
+	manifest2, err := ReadManifest(archiver.GetArchiveFilePath(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Chunks, manifest2.Chunks)
+
+	// a lost pack makes the manifest invalid
+	pack1, err := chunkRepo.GetPack(ctx, "s3://test-bucket", manifest.Chunks[files["input/a.bin"].Chunks[0]].Pack)
+	assert.NoError(t, err)
+	assert.NoError(t, chunkRepo.DeletePack(ctx, pack1.Id))
+	assert.Error(t, IsValidManifest(ctx, manifestPath, "s3://test-bucket", chunkRepo))
+}
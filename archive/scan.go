@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"glesha/database/model"
+	"glesha/file_io"
+	"glesha/filter"
+	L "glesha/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// returns the catalog "t" would have if it were archived now, entries are
+// named and excluded like the archivers do, but nothing is read or written
+func ScanCatalog(ctx context.Context, t *model.Task) ([]model.FileCatalogRow, error) {
+	inputPaths := t.InputPaths
+	if len(inputPaths) == 0 {
+		inputPaths = []string{t.InputPath}
+	}
+	absGleshaWorkDir, err := filepath.Abs(t.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := filter.New(inputPaths, t.FilterPatterns, map[string]bool{absGleshaWorkDir: true})
+	if err != nil {
+		return nil, err
+	}
+	prefixes := archivePrefixes(inputPaths)
+
+	var rows []model.FileCatalogRow
+	var root string
+	walkFn := func(path string, info fs.FileInfo, walkErr error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if walkErr != nil {
+			if path == root {
+				return walkErr
+			}
+			L.Warn(fmt.Sprintf("scan: skipping %s: %v", path, walkErr))
+			return fs.SkipDir
+		}
+		if f.IsExcluded(path, info.IsDir()) {
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		isSpecialPath := strings.HasPrefix(path, "/proc") ||
+			strings.HasPrefix(path, "/dev") ||
+			strings.HasPrefix(path, "/sys")
+		if isSpecialPath {
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSocket != 0 ||
+			info.Mode()&os.ModeDevice != 0 ||
+			info.Mode()&os.ModeNamedPipe != 0 {
+			return nil
+		}
+		name, err := entryName(prefixes, root, path)
+		if err != nil {
+			L.Warn(fmt.Errorf("scan: skipping %s due to error: %w", path, err))
+			return nil
+		}
+		rows = append(rows, newCatalogRow(t.Id, name, root, info, file_io.GetFileMetadata(info)))
+		return nil
+	}
+	for _, root = range inputPaths {
+		err = filepath.Walk(root, walkFn)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan %s: %w", root, err)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+)
+
+const TAR_BLOCK_SIZE int64 = 512
+
+// a range of a sparse file that has data, everything else reads as zeros
+type sparseRegion struct {
+	offset int64
+	length int64
+}
+
+// copies exactly "size" bytes from "r" to "w". a tar entry must have as
+// many bytes as its header says, so if "r" ends early or can not be read,
+// the rest is filled with zeros and false is returned. only errors from
+// "w" are returned, after those the archive can not be continued
+func copyEntry(w io.Writer, r io.Reader, size int64) (bool, error) {
+	n, err := io.CopyN(w, readErrorAsEOF{r}, size)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if n < size {
+		return false, writeZeros(w, size-n)
+	}
+	return true, nil
+}
+
+// hides read errors from io.CopyN, so they are not mistaken for write errors
+type readErrorAsEOF struct {
+	r io.Reader
+}
+
+func (re readErrorAsEOF) Read(p []byte) (int, error) {
+	n, err := re.r.Read(p)
+	if err != nil {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func writeZeros(w io.Writer, n int64) error {
+	var zeros [TAR_BLOCK_SIZE]byte
+	for n > 0 {
+		m := min(n, TAR_BLOCK_SIZE)
+		_, err := w.Write(zeros[:m])
+		if err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+func blockPadding(size int64) int64 {
+	return -size & (TAR_BLOCK_SIZE - 1)
+}
+
+// writes the regular file "f" described by "hdr" to "w" as a sparse entry,
+// storing only "regions". archive/tar can read sparse entries but not
+// write them, so this writes the PAX 1.0 format of GNU tar by hand after
+// flushing "tw". the full content of "f", holes included, is written to
+// "contentHash". returns false if "f" changed while being read, like
+// copyEntry
+func writeSparseEntry(
+	tw *tar.Writer,
+	w io.Writer,
+	hdr *tar.Header,
+	f *os.File,
+	regions []sparseRegion,
+	contentHash io.Writer,
+) (bool, error) {
+	err := tw.Flush()
+	if err != nil {
+		return false, err
+	}
+
+	// the map is stored at the start of the entry data, padded to a block
+	var sparseMap bytes.Buffer
+	fmt.Fprintf(&sparseMap, "%d\n", len(regions))
+	var dataSize int64
+	for _, r := range regions {
+		fmt.Fprintf(&sparseMap, "%d\n%d\n", r.offset, r.length)
+		dataSize += r.length
+	}
+	sparseMap.Write(make([]byte, blockPadding(int64(sparseMap.Len()))))
+	entrySize := int64(sparseMap.Len()) + dataSize
+
+	records := make(map[string]string, len(hdr.PAXRecords)+8)
+	for k, v := range hdr.PAXRecords {
+		records[k] = v
+	}
+	records["GNU.sparse.major"] = "1"
+	records["GNU.sparse.minor"] = "0"
+	records["GNU.sparse.name"] = hdr.Name
+	records["GNU.sparse.realsize"] = strconv.FormatInt(hdr.Size, 10)
+	records["size"] = strconv.FormatInt(entrySize, 10)
+	records["mtime"] = strconv.FormatInt(hdr.ModTime.Unix(), 10)
+	// like archive/tar, values that do not fit in the ustar header
+	if len(hdr.Uname) > 31 {
+		records["uname"] = hdr.Uname
+	}
+	if len(hdr.Gname) > 31 {
+		records["gname"] = hdr.Gname
+	}
+	if !fitsOctal(int64(hdr.Uid), 8) {
+		records["uid"] = strconv.Itoa(hdr.Uid)
+	}
+	if !fitsOctal(int64(hdr.Gid), 8) {
+		records["gid"] = strconv.Itoa(hdr.Gid)
+	}
+	dir, base := path.Split(hdr.Name)
+	sparseName := dir + "GNUSparseFile.0/" + base
+	if len(sparseName) > 100 {
+		records["path"] = sparseName
+	}
+	paxData := formatPAXRecords(records)
+
+	paxHdr := ustarHeader(dir+"PaxHeaders.0/"+base, tar.TypeXHeader, int64(len(paxData)), &tar.Header{
+		Mode:    0644,
+		ModTime: hdr.ModTime,
+	})
+	fileHdr := ustarHeader(sparseName, tar.TypeReg, entrySize, hdr)
+
+	for _, b := range [][]byte{paxHdr, paxData, make([]byte, blockPadding(int64(len(paxData)))), fileHdr, sparseMap.Bytes()} {
+		_, err = w.Write(b)
+		if err != nil {
+			return false, err
+		}
+	}
+	complete := true
+	var pos int64
+	for _, r := range regions {
+		// holes read as zeros
+		_ = writeZeros(contentHash, r.offset-pos)
+		data := io.TeeReader(io.NewSectionReader(f, r.offset, r.length), contentHash)
+		ok, err := copyEntry(w, data, r.length)
+		if err != nil {
+			return false, err
+		}
+		complete = complete && ok
+		pos = r.offset + r.length
+	}
+	_ = writeZeros(contentHash, hdr.Size-pos)
+	return complete, writeZeros(w, blockPadding(dataSize))
+}
+
+// encodes "records" like archive/tar does, sorted for reproducible archives
+func formatPAXRecords(records map[string]string) []byte {
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		// the length prefix counts its own digits
+		const padding = 3 // ' ', '=' and '\n'
+		size := len(k) + len(records[k]) + padding
+		size += len(strconv.Itoa(size))
+		record := strconv.Itoa(size) + " " + k + "=" + records[k] + "\n"
+		if len(record) != size {
+			size = len(record)
+			record = strconv.Itoa(size) + " " + k + "=" + records[k] + "\n"
+		}
+		buf.WriteString(record)
+	}
+	return buf.Bytes()
+}
+
+// returns a ustar header block, values that do not fit are left empty as
+// they are also recorded in the PAX header before it
+func ustarHeader(name string, typeflag byte, size int64, hdr *tar.Header) []byte {
+	b := make([]byte, TAR_BLOCK_SIZE)
+	copy(b[0:100], name)
+	putOctal(b[100:108], hdr.Mode&07777)
+	putOctal(b[108:116], int64(hdr.Uid))
+	putOctal(b[116:124], int64(hdr.Gid))
+	putOctal(b[124:136], size)
+	putOctal(b[136:148], hdr.ModTime.Unix())
+	b[156] = typeflag
+	copy(b[257:263], "ustar\x00")
+	copy(b[263:265], "00")
+	copy(b[265:296], hdr.Uname)
+	copy(b[297:328], hdr.Gname)
+
+	// the checksum is computed with its own field set to spaces
+	copy(b[148:156], "        ")
+	var sum int64
+	for _, c := range b {
+		sum += int64(c)
+	}
+	copy(b[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return b
+}
+
+func putOctal(field []byte, v int64) {
+	s := strconv.FormatInt(v, 8)
+	if !fitsOctal(v, len(field)) {
+		s = "0"
+	}
+	copy(field, fmt.Sprintf("%0*s\x00", len(field)-1, s))
+}
+
+// reports whether "v" fits in a NUL terminated octal field of "width" bytes
+func fitsOctal(v int64, width int) bool {
+	return v >= 0 && len(strconv.FormatInt(v, 8)) < width
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// returns the data regions of "f", or nil if it has no holes or the file
+// system can not report them
+func sparseRegions(f *os.File, info fs.FileInfo) ([]sparseRegion, error) {
+	size := info.Size()
+	st, ok := info.Sys().(*syscall.Stat_t)
+	// files with as many blocks as bytes have no holes
+	if !ok || size == 0 || st.Blocks*512 >= size {
+		return nil, nil
+	}
+	var regions []sparseRegion
+	var offset int64
+	for offset < size {
+		data, err := f.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// only a hole is left
+			break
+		}
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hole, err := f.Seek(data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		hole = min(hole, size)
+		if hole > data {
+			regions = append(regions, sparseRegion{data, hole - data})
+		}
+		offset = hole
+	}
+	_, err := f.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(regions) == 1 && regions[0] == (sparseRegion{0, size}) {
+		return nil, nil
+	}
+	// like GNU tar, a trailing hole ends with an empty region
+	if len(regions) == 0 || regions[len(regions)-1].offset+regions[len(regions)-1].length < size {
+		regions = append(regions, sparseRegion{size, 0})
+	}
+	return regions, nil
+}
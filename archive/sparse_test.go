@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSparseEntry_PAXOverflow(t *testing.T) {
+	content := make([]byte, 3*TAR_BLOCK_SIZE)
+	copy(content, "head")
+	copy(content[2*TAR_BLOCK_SIZE:], "tail")
+	filePath := filepath.Join(t.TempDir(), "disk.img")
+	assert.NoError(t, os.WriteFile(filePath, content, 0644))
+	f, err := os.Open(filePath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	hdr := &tar.Header{
+		Name:    strings.Repeat("d", 60) + "/" + strings.Repeat("f", 60) + ".img",
+		Mode:    0640,
+		Uid:     3000000,
+		Gid:     2097152,
+		Size:    int64(len(content)),
+		ModTime: time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	regions := []sparseRegion{{0, TAR_BLOCK_SIZE}, {2 * TAR_BLOCK_SIZE, TAR_BLOCK_SIZE}}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	complete, err := writeSparseEntry(tw, &buf, hdr, f, regions, io.Discard)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.NoError(t, tw.Close())
+
+	tr := tar.NewReader(&buf)
+	got, err := tr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, hdr.Name, got.Name)
+	assert.Equal(t, hdr.Uid, got.Uid)
+	assert.Equal(t, hdr.Gid, got.Gid)
+	assert.Equal(t, hdr.Size, got.Size)
+	assert.True(t, hdr.ModTime.Equal(got.ModTime))
+	data, err := io.ReadAll(tr)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+}
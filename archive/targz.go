@@ -5,10 +5,14 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"glesha/control"
 	"glesha/database/model"
 	"glesha/database/repository"
 	"glesha/file_io"
+	"glesha/filter"
 	L "glesha/logger"
 	"io"
 	"io/fs"
@@ -21,59 +25,46 @@ import (
 type TarGzArchive struct {
 	Id                   int64
 	InputPath            string
+	InputPaths           []string
 	OutputPath           string
 	Info                 *file_io.FilesInfo
 	Progress             *Progress
 	abortReq             chan struct{}
 	abortDone            chan struct{}
+	gate                 *control.Gate
 	GleshaWorkDir        string
-	IgnoredDirs          map[string]bool
+	Filter               *filter.Filter
 	archiveAlreadyExists bool
+	// name of the top level directory of each input path in the archive
+	prefixes map[string]string
+	// where each input path is read from, see SetSourcePaths
+	SourcePaths map[string]string
+	// uncompressed bytes after which a new gzip member is started
+	memberSize int64
 }
 
 func NewTarGzArchiver(t *model.Task) (*TarGzArchive, error) {
-	readable, err := file_io.IsReadable(t.InputPath)
-	if err != nil || !readable {
-		return nil, fmt.Errorf("no read permission on input path: %s", t.InputPath)
-	}
-
-	err = os.MkdirAll(t.OutputPath, os.ModePerm)
-	if err != nil {
-		return nil, err
-	}
-
-	writable, err := file_io.IsWritable(t.OutputPath)
-
-	if err != nil || !writable {
-		return nil, fmt.Errorf("no write permission on output path: %s", t.OutputPath)
-	}
-
-	GleshaWorkDir := t.OutputPath
-	err = os.MkdirAll(GleshaWorkDir, os.ModePerm)
+	inputPaths, absGleshaWorkDir, f, err := prepareArchive(t)
 	if err != nil {
 		return nil, err
 	}
-
 	progress := &Progress{0, 0, STATUS_IN_QUEUE}
 	abortReq := make(chan struct{})
 	abortDone := make(chan struct{})
-	absGleshaWorkDir, err := filepath.Abs(GleshaWorkDir)
-	if err != nil {
-		return nil, err
-	}
-	ignoredDirs := map[string]bool{
-		absGleshaWorkDir: true,
-	}
 	return &TarGzArchive{
 		Id:            t.Id,
-		InputPath:     t.InputPath,
+		InputPath:     inputPaths[0],
+		InputPaths:    inputPaths,
 		OutputPath:    t.OutputPath,
 		Info:          nil,
 		Progress:      progress,
 		abortReq:      abortReq,
 		abortDone:     abortDone,
+		gate:          control.NewGate(),
 		GleshaWorkDir: absGleshaWorkDir,
-		IgnoredDirs:   ignoredDirs}, nil
+		Filter:        f,
+		prefixes:      archivePrefixes(inputPaths),
+		memberSize:    GZIP_MEMBER_SIZE}, nil
 }
 
 func (tgz *TarGzArchive) UpdateStatus(ctx context.Context, newStatus ArchiveStatus) error {
@@ -83,8 +74,8 @@ func (tgz *TarGzArchive) UpdateStatus(ctx context.Context, newStatus ArchiveStat
 
 func (tgz *TarGzArchive) Plan(ctx context.Context) error {
 	tgz.UpdateStatus(ctx, STATUS_PLANNING)
-	L.Info(fmt.Sprintf("Checking if files are changed in %s", tgz.InputPath))
-	fileInfo, err := file_io.ComputeFilesInfo(ctx, tgz.InputPath, tgz.IgnoredDirs)
+	L.Info(fmt.Sprintf("Checking if files are changed in %s", strings.Join(tgz.InputPaths, ", ")))
+	fileInfo, err := file_io.ComputeFilesInfo(ctx, tgz.InputPaths, tgz.Filter)
 	if err != nil {
 		return err
 	}
@@ -100,8 +91,11 @@ func (tgz *TarGzArchive) GetInfo(ctx context.Context) *file_io.FilesInfo {
 }
 
 func (tgz *TarGzArchive) getTarFile() string {
-	return filepath.Join(tgz.GleshaWorkDir,
-		fmt.Sprintf("glesha-%d.tar.gz", tgz.Id))
+	return filepath.Join(tgz.GleshaWorkDir, tarFileName(tgz.Id))
+}
+
+func tarFileName(taskId int64) string {
+	return fmt.Sprintf("glesha-%d.tar.gz", taskId)
 }
 
 func (tgz *TarGzArchive) archive(
@@ -111,44 +105,103 @@ func (tgz *TarGzArchive) archive(
 ) error {
 	if tgz.archiveAlreadyExists {
 		L.Printf("Archive already exists for path %s: %s\n",
-			tgz.InputPath, tgz.getTarFile())
+			strings.Join(tgz.InputPaths, ", "), tgz.getTarFile())
 		return nil
 	}
 	tgz.UpdateStatus(ctx, STATUS_RUNNING)
-	tarFile, err := os.OpenFile(tgz.getTarFile(), os.O_RDWR|os.O_CREATE, 0644)
+	// entries of an earlier archive of this task point into the old file,
+	// which is truncated even if archiving is cancelled
+	err := catalogRepo.DeleteByTaskId(context.WithoutCancel(ctx), tgz.Id)
+	if err != nil {
+		return err
+	}
+	// offsets stored in the catalog are only valid for a fresh file
+	tarFile, err := os.OpenFile(tgz.getTarFile(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
 	var completedBytes uint64 = 0
 	var shouldAbort bool = false
-	gzipWriter := gzip.NewWriter(tarFile)
-	tarGzWriter := tar.NewWriter(gzipWriter)
+	compressed := &countingWriter{w: tarFile}
+	gzipWriter := gzip.NewWriter(compressed)
+	uncompressed := &countingWriter{w: gzipWriter}
+	tarGzWriter := tar.NewWriter(uncompressed)
 	startTime := time.Now()
+	members := []model.ArchiveMember{{TaskId: tgz.Id}}
 
-	var catalogBatch []model.FileCatalogRow
+	// pads the previous entry and starts a new gzip member once the current
+	// one is large enough, so entries can be read without the ones before
+	nextEntry := func() error {
+		err := tarGzWriter.Flush()
+		if err != nil {
+			return err
+		}
+		current := members[len(members)-1]
+		if uncompressed.n-current.UncompressedOffset < tgz.memberSize {
+			return nil
+		}
+		err = gzipWriter.Close()
+		if err != nil {
+			return err
+		}
+		gzipWriter.Reset(compressed)
+		members = append(members, model.ArchiveMember{
+			TaskId:             tgz.Id,
+			Index:              int64(len(members)),
+			CompressedOffset:   compressed.n,
+			UncompressedOffset: uncompressed.n,
+		})
+		return nil
+	}
 
-	err = filepath.Walk(tgz.InputPath, func(path string, info fs.FileInfo, walkErr error) error {
-		select {
-		case <-ctx.Done():
-			{
-				L.Debug("Received abort signal inside filepath.Walk")
-				shouldAbort = true
-				return fs.SkipAll
+	var catalogBatch []model.FileCatalogRow
+	// adds an entry after it was written, with its location in the archive
+	addToCatalog := func(row model.FileCatalogRow) error {
+		err := tarGzWriter.Flush()
+		if err != nil {
+			return err
+		}
+		row.ArchiveSize = uncompressed.n - row.ArchiveOffset
+		catalogBatch = append(catalogBatch, row)
+		// TODO: make this configurable from config.json
+		const CATALOG_BATCH_SIZE int = 1000
+		if len(catalogBatch) >= CATALOG_BATCH_SIZE {
+			err := catalogRepo.AddMany(ctx, catalogBatch)
+			if err != nil {
+				return fmt.Errorf("archive: could not add files metadata due to error: %w", err)
 			}
-		default:
+			catalogBatch = nil
 		}
-
-		_, ignore := tgz.IgnoredDirs[path]
-
-		if ignore {
-			L.Warn(fmt.Sprintf("Archive: potentially conflicting file: %s", path))
-			return fs.SkipDir
+		return nil
+	}
+	// first entry name of each file with more than one hardlink
+	hardlinks := make(map[inode]string)
+
+	var root, srcRoot string
+	walkFn := func(srcPath string, info fs.FileInfo, walkErr error) error {
+		path := inputPathOf(root, srcRoot, srcPath)
+		// pausing happens between files, so no file is left half written
+		if tgz.gate.IsPaused() {
+			L.Footer(L.NORMAL, fmt.Sprintf("Archiving: Paused (%d/%d)", tgz.Progress.Done, tgz.Progress.Total))
+		}
+		if tgz.gate.Wait(ctx) != nil {
+			L.Debug("Received abort signal inside filepath.Walk")
+			shouldAbort = true
+			return fs.SkipAll
 		}
 
 		if walkErr != nil {
 			return fs.SkipDir
 		}
 
+		if tgz.Filter.IsExcluded(path, info.IsDir()) {
+			L.Debug(fmt.Sprintf("Archive: excluding %s", path))
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
 		isSpecialPath := strings.HasPrefix(path, "/proc") ||
 			strings.HasPrefix(path, "/dev") ||
 			strings.HasPrefix(path, "/sys")
@@ -166,7 +219,7 @@ func (tgz *TarGzArchive) archive(
 		L.Debug(fmt.Sprintf("Processing: %s", L.TruncateString(path, 48, L.TRUNC_LEFT)))
 
 		var link string
-		relPath, err := filepath.Rel(filepath.Dir(tgz.InputPath), path)
+		relPath, err := entryName(tgz.prefixes, root, path)
 		if err != nil {
 			L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
 			return nil
@@ -180,7 +233,7 @@ func (tgz *TarGzArchive) archive(
 			return nil
 		}
 		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
-			link, err = os.Readlink(path)
+			link, err = os.Readlink(srcPath)
 		}
 		if err != nil {
 			L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
@@ -192,33 +245,47 @@ func (tgz *TarGzArchive) archive(
 			return nil
 		}
 		header.Name = relPath
-
-		fileType := "file"
 		if info.IsDir() {
-			fileType = "dir"
+			header.Name += "/"
+		}
+		meta := file_io.GetFileMetadata(info)
+		if target := hardlinkTarget(hardlinks, info, meta); len(target) > 0 {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = target
+			header.Size = 0
+		}
+		xattrs, err := file_io.ReadXattrs(srcPath)
+		if err != nil {
+			L.Warn(fmt.Sprintf("archive: could not read extended attributes: %v", err))
+		}
+		if len(xattrs) > 0 {
+			header.PAXRecords = xattrPAXRecords(path, xattrs)
 		}
-		catalogBatch = append(catalogBatch, model.FileCatalogRow{
-			TaskId:     tgz.Id,
-			FullPath:   relPath,
-			Name:       info.Name(),
-			ParentPath: filepath.Dir(relPath),
-			FileType:   fileType,
-			SizeBytes:  info.Size(),
-			ModifiedAt: info.ModTime(),
-		})
 
-		// TODO: make this configurable from config.json
-		const CATALOG_BATCH_SIZE int = 1000
-		if len(catalogBatch) >= CATALOG_BATCH_SIZE {
-			err := catalogRepo.AddMany(ctx, catalogBatch)
+		err = nextEntry()
+		if err != nil {
+			return fmt.Errorf("archive: could not write %s: %w", path, err)
+		}
+		row := newCatalogRow(tgz.Id, relPath, root, info, meta)
+		row.ArchiveOffset = uncompressed.n
+		row.ArchiveMember = members[len(members)-1].Index
+
+		// directories, symlinks and hardlinks have no content
+		if !info.Mode().IsRegular() || header.Typeflag == tar.TypeLink {
+			err = tarGzWriter.WriteHeader(header)
 			if err != nil {
-				return fmt.Errorf("archive: could not add files metadata due to error: %w", err)
+				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
+				return nil
 			}
-			catalogBatch = nil
+			if header.Typeflag == tar.TypeLink {
+				tgz.Progress.Done++
+				completedBytes += uint64(info.Size())
+			}
+			return addToCatalog(row)
 		}
 
 		if info.Mode().IsRegular() {
-			file, err := os.Open(path)
+			file, err := os.Open(srcPath)
 			if err != nil {
 				// skip files that are not readable
 				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
@@ -237,15 +304,37 @@ func (tgz *TarGzArchive) archive(
 				tgz.Progress.Total,
 				L.TruncateString(filepath.Base(path), 24, L.TRUNC_CENTER),
 				L.HumanReadableBytes(uint64(info.Size()), 2)))
-			err = tarGzWriter.WriteHeader(header)
+			regions, err := sparseRegions(file, info)
 			if err != nil {
-				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
-				return nil
+				L.Debug(fmt.Sprintf("archive: could not find holes in %s, archiving it in full: %v", path, err))
+				regions = nil
+			}
+			contentHash := sha256.New()
+			complete := true
+			if len(regions) > 0 {
+				complete, err = writeSparseEntry(tarGzWriter, uncompressed, header, file, regions, contentHash)
+			} else {
+				err = tarGzWriter.WriteHeader(header)
+				if err != nil {
+					L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
+					return nil
+				}
+				// the header has the size from before reading, so exactly
+				// that many bytes are written even if the file changes
+				complete, err = copyEntry(tarGzWriter, io.TeeReader(bufferedFileReader, contentHash), header.Size)
 			}
-			_, err = io.Copy(tarGzWriter, bufferedFileReader)
 			if err != nil {
-				L.Warn(fmt.Errorf("archive: skipping %s due to error: %w", path, err))
-				return nil
+				return fmt.Errorf("archive: could not write %s: %w", path, err)
+			}
+			addHardlinkTarget(hardlinks, relPath, info, meta)
+			if !complete {
+				L.Warn(fmt.Sprintf("archive: %s shrank or could not be read while archiving, its missing bytes are stored as zeros", path))
+			} else if current, err := file.Stat(); err == nil && current.Size() != header.Size {
+				L.Warn(fmt.Sprintf("archive: %s changed size while archiving, only its first %s are stored", path, L.HumanReadableBytes(uint64(header.Size), 2)))
+			}
+			if complete {
+				// hash of the stored content, even if the file grew meanwhile
+				row.Sha256 = hex.EncodeToString(contentHash.Sum(nil))
 			}
 			tgz.Progress.Done++
 			// update progress more frequently, because now we will have a tui dashboard
@@ -259,8 +348,15 @@ func (tgz *TarGzArchive) archive(
 					L.HumanReadableBytes(uint64(bufferedFileReader.Size()), 2)))
 			}
 		}
-		return nil
-	})
+		return addToCatalog(row)
+	}
+	for _, root = range tgz.InputPaths {
+		srcRoot = sourcePath(tgz.SourcePaths, root)
+		err = filepath.Walk(srcRoot, walkFn)
+		if err != nil || shouldAbort {
+			break
+		}
+	}
 
 	if err != nil {
 		tarGzWriter.Close()
@@ -284,6 +380,11 @@ func (tgz *TarGzArchive) archive(
 		return err
 	}
 
+	err = catalogRepo.AddArchiveMembers(ctx, members)
+	if err != nil {
+		return fmt.Errorf("archive: could not add gzip members to db due to error: %w", err)
+	}
+
 	tarFileInfo, err := file_io.GetFileInfo(tgz.getTarFile())
 	if err != nil {
 		return err
@@ -327,7 +428,23 @@ func (tgz *TarGzArchive) Abort(ctx context.Context) error {
 }
 
 func (tgz *TarGzArchive) Pause(ctx context.Context) error {
-	return fmt.Errorf("Unimplmented")
+	if tgz.Progress.Status != STATUS_RUNNING {
+		return fmt.Errorf("Pause() called when archiver is not running")
+	}
+	tgz.gate.Pause()
+	return tgz.UpdateStatus(ctx, STATUS_PAUSED)
+}
+
+func (tgz *TarGzArchive) Resume(ctx context.Context) error {
+	if tgz.Progress.Status != STATUS_PAUSED {
+		return fmt.Errorf("Resume() called when archiver is not paused")
+	}
+	tgz.gate.Resume()
+	return tgz.UpdateStatus(ctx, STATUS_RUNNING)
+}
+
+func (tgz *TarGzArchive) SetSourcePaths(sourcePaths map[string]string) {
+	tgz.SourcePaths = sourcePaths
 }
 
 func (tgz *TarGzArchive) GetArchiveFilePath(ctx context.Context) string {
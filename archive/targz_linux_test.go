@@ -0,0 +1,190 @@
+//go:build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestTarGzArchive_PosixMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "dir"), 0750))
+	createDummyFile(t, filepath.Join(inputPath, "a.txt"), "hardlinked content")
+	assert.NoError(t, os.Link(filepath.Join(inputPath, "a.txt"), filepath.Join(inputPath, "dir", "b.txt")))
+	assert.NoError(t, os.Symlink("a.txt", filepath.Join(inputPath, "link")))
+	hasXattrs := unix.Setxattr(filepath.Join(inputPath, "a.txt"), "user.glesha", []byte("test"), 0) == nil
+
+	task := &model.Task{Id: 1, InputPath: inputPath, OutputPath: outputPath}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	err = archiver.archive(context.Background(), catalogRepo, repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), archiver.Progress.Done)
+
+	f, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	headers := make(map[string]*tar.Header)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		headers[hdr.Name] = hdr
+	}
+
+	assert.Equal(t, byte(tar.TypeDir), headers["input/dir/"].Typeflag)
+	assert.Equal(t, int64(0750), headers["input/dir/"].Mode&0777)
+	assert.Equal(t, byte(tar.TypeSymlink), headers["input/link"].Typeflag)
+	// the first path of a hardlinked file has the content, later ones link to it
+	first, second := "input/a.txt", "input/dir/b.txt"
+	if headers[first].Typeflag == tar.TypeLink {
+		first, second = second, first
+	}
+	assert.Equal(t, byte(tar.TypeReg), headers[first].Typeflag)
+	assert.Equal(t, byte(tar.TypeLink), headers[second].Typeflag)
+	assert.Equal(t, first, headers[second].Linkname)
+	assert.Equal(t, os.Getuid(), headers[first].Uid)
+	if hasXattrs {
+		assert.Equal(t, "test", headers["input/a.txt"].PAXRecords["SCHILY.xattr.user.glesha"])
+	}
+
+	entries, err := catalogRepo.GetByParentPath(context.Background(), task.Id, "input")
+	assert.NoError(t, err)
+	for _, e := range entries {
+		assert.Equal(t, os.Getuid(), e.Uid)
+		assert.Equal(t, os.Getgid(), e.Gid)
+		if e.Name == "dir" {
+			assert.Equal(t, uint32(os.ModeDir|0750), e.Mode)
+		}
+	}
+}
+
+func TestHardlinkTarget(t *testing.T) {
+	inputPath := t.TempDir()
+	createDummyFile(t, filepath.Join(inputPath, "a.txt"), "hardlinked content")
+	assert.NoError(t, os.Link(filepath.Join(inputPath, "a.txt"), filepath.Join(inputPath, "b.txt")))
+	infoA, err := os.Lstat(filepath.Join(inputPath, "a.txt"))
+	assert.NoError(t, err)
+	infoB, err := os.Lstat(filepath.Join(inputPath, "b.txt"))
+	assert.NoError(t, err)
+
+	seen := make(map[inode]string)
+	assert.Empty(t, hardlinkTarget(seen, infoA, file_io.GetFileMetadata(infoA)))
+	// a.txt was not archived, e.g. it could not be read, so b.txt has to
+	// store the content instead of linking to it
+	assert.Empty(t, hardlinkTarget(seen, infoB, file_io.GetFileMetadata(infoB)))
+	addHardlinkTarget(seen, "input/b.txt", infoB, file_io.GetFileMetadata(infoB))
+	assert.Equal(t, "input/b.txt", hardlinkTarget(seen, infoA, file_io.GetFileMetadata(infoA)))
+}
+
+func TestTarGzArchive_SparseFile(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.MkdirAll(inputPath, 0755))
+	const size = 64 * 1024 * 1024
+	sparsePath := filepath.Join(inputPath, "disk.img")
+	f, err := os.Create(sparsePath)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Truncate(size))
+	_, err = f.WriteAt(bytes.Repeat([]byte("a"), 4096), 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt(bytes.Repeat([]byte("b"), 4096), 32*1024*1024)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	createDummyFile(t, filepath.Join(inputPath, "after.txt"), "after")
+
+	f, err = os.Open(sparsePath)
+	assert.NoError(t, err)
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	regions, err := sparseRegions(f, info)
+	f.Close()
+	assert.NoError(t, err)
+	if len(regions) == 0 {
+		t.Skip("file system does not report holes")
+	}
+
+	task := &model.Task{Id: 1, InputPath: inputPath, OutputPath: outputPath}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	err = archiver.archive(context.Background(), catalogRepo, repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+
+	tarInfo, err := os.Stat(archiver.getTarFile())
+	assert.NoError(t, err)
+	assert.Less(t, tarInfo.Size(), int64(1024*1024), "holes must not be stored")
+
+	tf, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer tf.Close()
+	gz, err := gzip.NewReader(tf)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	contents := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := io.ReadAll(tr)
+			assert.NoError(t, err)
+			contents[hdr.Name] = data
+		}
+		if hdr.Name == "input/disk.img" {
+			assert.Equal(t, "1", hdr.PAXRecords["GNU.sparse.major"])
+			assert.Equal(t, int64(size), hdr.Size)
+		}
+	}
+	original, err := os.ReadFile(sparsePath)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(original, contents["input/disk.img"]))
+	assert.Equal(t, "after", string(contents["input/after.txt"]))
+
+	// holes are part of the hashed content
+	entries, err := catalogRepo.GetByParentPath(context.Background(), task.Id, "input")
+	assert.NoError(t, err)
+	sum := sha256.Sum256(original)
+	for _, e := range entries {
+		if e.Name == "disk.img" {
+			assert.Equal(t, hex.EncodeToString(sum[:]), e.Sha256)
+		}
+	}
+}
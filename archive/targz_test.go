@@ -2,15 +2,20 @@ package archive
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
 	"glesha/database"
 	"glesha/database/model"
 	"glesha/database/repository"
+	"glesha/file_io"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -241,3 +246,240 @@ func TestIsValidTarGz(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestTarGzArchive_PauseResume(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test-pause")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	inputPath := filepath.Join(tempDir, "input")
+	assert.NoError(t, os.Mkdir(inputPath, 0755))
+	createDummyFile(t, filepath.Join(inputPath, "file1.txt"), "file1 content")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.Mkdir(outputPath, 0755))
+
+	archiver, err := NewTarGzArchiver(&model.Task{Id: 1, InputPath: inputPath, OutputPath: outputPath})
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+
+	t.Run("NotRunning", func(t *testing.T) {
+		assert.Error(t, archiver.Pause(context.Background()))
+		assert.Error(t, archiver.Resume(context.Background()))
+	})
+
+	t.Run("WaitsWhilePaused", func(t *testing.T) {
+		db, err := database.NewDB(":memory:")
+		assert.NoError(t, err)
+		defer db.Close(context.Background())
+		assert.NoError(t, db.Init(context.Background()))
+
+		archiver.gate.Pause()
+		done := make(chan error, 1)
+		go func() {
+			done <- archiver.archive(context.Background(),
+				repository.NewFileCatalogRepository(db), repository.NewTaskRepository(db))
+		}()
+		select {
+		case <-done:
+			t.Fatal("archive finished while paused")
+		case <-time.After(100 * time.Millisecond):
+		}
+		archiver.gate.Resume()
+		assert.NoError(t, <-done)
+		assert.NoError(t, IsValidTarGz(archiver.getTarFile()))
+	})
+}
+
+func TestTarGzArchive_FilterPatterns(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	outputPath := filepath.Join(tempDir, "output")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "node_modules"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "logs"), 0755))
+	assert.NoError(t, os.Mkdir(outputPath, 0755))
+	createDummyFile(t, filepath.Join(inputPath, "keep.txt"), "keep")
+	createDummyFile(t, filepath.Join(inputPath, "node_modules", "dep.js"), "dep")
+	createDummyFile(t, filepath.Join(inputPath, "logs", "a.log"), "log a")
+	createDummyFile(t, filepath.Join(inputPath, "logs", "important.log"), "log b")
+	createDummyFile(t, filepath.Join(inputPath, "logs", ".gleshaignore"), "!important.log\n")
+
+	task := &model.Task{
+		Id:             1,
+		InputPath:      inputPath,
+		OutputPath:     outputPath,
+		FilterPatterns: []string{"node_modules/", "*.log"},
+	}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+
+	// plan and hash must agree on which files are archived
+	filesInfo, err := file_io.ComputeFilesInfo(context.Background(), []string{inputPath}, archiver.Filter)
+	assert.NoError(t, err)
+	assert.Equal(t, filesInfo.TotalFileCount, archiver.Info.TotalFileCount)
+	assert.Equal(t, filesInfo.SizeInBytes, archiver.Info.SizeInBytes)
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	err = archiver.archive(context.Background(), repository.NewFileCatalogRepository(db), repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+
+	f, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			names = append(names, filepath.Base(hdr.Name))
+		}
+	}
+	assert.ElementsMatch(t, []string{"keep.txt", "important.log", ".gleshaignore"}, names)
+}
+
+func TestTarGzArchive_MultipleInputPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	docs := filepath.Join(tempDir, "docs")
+	photosA := filepath.Join(tempDir, "a", "photos")
+	photosB := filepath.Join(tempDir, "b", "photos")
+	outputPath := filepath.Join(tempDir, "output")
+	for _, dir := range []string{docs, photosA, photosB, outputPath} {
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	createDummyFile(t, filepath.Join(docs, "cv.txt"), "cv")
+	createDummyFile(t, filepath.Join(photosA, "a.jpg"), "a")
+	createDummyFile(t, filepath.Join(photosB, "b.jpg"), "b")
+
+	inputPaths, err := file_io.NormalizeInputPaths([]string{docs, photosB, photosA, docs})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{photosA, photosB, docs}, inputPaths)
+	_, err = file_io.NormalizeInputPaths([]string{tempDir, docs})
+	assert.Error(t, err)
+
+	task := &model.Task{
+		Id:         1,
+		InputPath:  inputPaths[0],
+		InputPaths: inputPaths,
+		OutputPath: outputPath,
+	}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+	assert.Equal(t, uint64(3), archiver.Info.TotalFileCount)
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	err = archiver.archive(context.Background(), catalogRepo, repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+
+	f, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			names = append(names, hdr.Name)
+		}
+	}
+	// colliding base names get a suffix
+	assert.ElementsMatch(t, []string{"photos/a.jpg", "photos-2/b.jpg", "docs/cv.txt"}, names)
+
+	entries, err := catalogRepo.GetByParentPath(context.Background(), task.Id, "photos-2")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, photosB, entries[0].Root)
+}
+
+func TestCopyEntry(t *testing.T) {
+	var buf bytes.Buffer
+	complete, err := copyEntry(&buf, strings.NewReader("hello world"), 5)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, "hello", buf.String())
+
+	// a file that shrinks is padded, so the tar entry keeps its size
+	buf.Reset()
+	complete, err = copyEntry(&buf, strings.NewReader("hi"), 5)
+	assert.NoError(t, err)
+	assert.False(t, complete)
+	assert.Equal(t, []byte("hi\x00\x00\x00"), buf.Bytes())
+}
+
+func TestTarGzArchive_SourcePaths(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	snapshotPath := filepath.Join(tempDir, "snapshot", "input")
+	outputPath := filepath.Join(tempDir, "output")
+	for _, dir := range []string{inputPath, snapshotPath, outputPath} {
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	createDummyFile(t, filepath.Join(inputPath, "a.txt"), "changed after snapshot")
+	createDummyFile(t, filepath.Join(snapshotPath, "a.txt"), "snapshot")
+	createDummyFile(t, filepath.Join(snapshotPath, "skip.log"), "excluded")
+
+	task := &model.Task{
+		Id:             1,
+		InputPath:      inputPath,
+		OutputPath:     outputPath,
+		FilterPatterns: []string{"*.log"},
+	}
+	archiver, err := NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(context.Background()))
+	archiver.SetSourcePaths(map[string]string{inputPath: snapshotPath})
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+	assert.NoError(t, db.Init(context.Background()))
+	catalogRepo := repository.NewFileCatalogRepository(db)
+	err = archiver.archive(context.Background(), catalogRepo, repository.NewTaskRepository(db))
+	assert.NoError(t, err)
+
+	f, err := os.Open(archiver.getTarFile())
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	contents := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := io.ReadAll(tr)
+			assert.NoError(t, err)
+			contents[hdr.Name] = string(data)
+		}
+	}
+	// entries are named after the input path, but read from the snapshot
+	assert.Equal(t, map[string]string{"input/a.txt": "snapshot"}, contents)
+
+	entries, err := catalogRepo.GetByParentPath(context.Background(), task.Id, "input")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, inputPath, entries[0].Root)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"glesha/backend"
 	"glesha/config"
+	"glesha/database/model"
 	"glesha/database/repository"
 	"glesha/file_io"
 	L "glesha/logger"
@@ -24,6 +26,7 @@ type AwsBackend struct {
 	accountId    uint64
 	region       string
 	storageClass string
+	objectLock   *config.AwsObjectLock
 	host         string
 	protocol     string
 }
@@ -39,50 +42,55 @@ type AWSFactory struct{}
 const STORAGE_BACKEND_METADATA_SCHEMA_VERSION int64 = 1
 const AWS_UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
 
+const (
+	MiB int64 = 1024 * 1024
+	GiB int64 = 1024 * MiB
+	TiB int64 = 1024 * GiB
+)
+
+// multipart upload limits: https://docs.aws.amazon.com/AmazonS3/latest/userguide/qfacts.html
+const (
+	AWS_MIN_PART_SIZE   int64 = 5 * MiB
+	AWS_MAX_PART_SIZE   int64 = 5 * GiB
+	AWS_MAX_PARTS       int64 = 10_000
+	AWS_MAX_OBJECT_SIZE int64 = 5 * TiB
+)
+
+// number of failed attempts after which a block is considered unrecoverable
+const AWS_MAX_BLOCK_RETRIES int64 = 5
+
 func new() (*AwsBackend, error) {
 	configs := config.Get()
 	if configs.Aws == nil {
 		return nil, fmt.Errorf("aws: could not find aws configuration")
 	}
-	validator := AwsValidator{}
-	err := validator.ValidateBucketName(configs.Aws.BucketName)
-	if err != nil {
-		return nil, err
-	}
-
-	err = validator.ValidateRegion(configs.Aws.Region)
-	if err != nil {
-		return nil, err
-	}
-
-	err = validator.ValidateStorageClass(configs.Aws.StorageClass)
-
-	if err != nil {
-		return nil, err
-	}
-
-	err = validator.ValidateAccountId(configs.Aws.AccountId)
+	L.Debug(fmt.Sprintf("config::ArchiveFormat %s", configs.ArchiveFormat))
+	return newFromConfig(configs.Aws)
+}
 
+func newFromConfig(cfg *config.Aws) (*AwsBackend, error) {
+	validator := AwsValidator{}
+	err := validator.Validate(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	L.Debug("aws: config is valid")
-	L.Debug(fmt.Sprintf("config::ArchiveFormat %s", configs.ArchiveFormat))
-	L.Debug(fmt.Sprintf("config::Aws::BucketName %s", configs.Aws.BucketName))
-	L.Debug(fmt.Sprintf("config::Aws::Region %s", configs.Aws.Region))
-	L.Debug(fmt.Sprintf("config::Aws::StorageClass %s", configs.Aws.StorageClass))
+	L.Debug(fmt.Sprintf("config::Aws::BucketName %s", cfg.BucketName))
+	L.Debug(fmt.Sprintf("config::Aws::Region %s", cfg.Region))
+	L.Debug(fmt.Sprintf("config::Aws::StorageClass %s", cfg.StorageClass))
 	client := &http.Client{}
-	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", configs.Aws.BucketName, configs.Aws.Region)
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", cfg.BucketName, cfg.Region)
 	protocol := "https://"
 	a := AwsBackend{
 		client:       client,
-		bucketName:   configs.Aws.BucketName,
-		accessKey:    configs.Aws.AccessKey,
-		secretKey:    configs.Aws.SecretKey,
-		region:       configs.Aws.Region,
-		storageClass: configs.Aws.StorageClass,
-		accountId:    configs.Aws.AccountId,
+		bucketName:   cfg.BucketName,
+		accessKey:    cfg.AccessKey,
+		secretKey:    cfg.SecretKey,
+		region:       cfg.Region,
+		storageClass: cfg.StorageClass,
+		objectLock:   cfg.ObjectLock,
+		accountId:    cfg.AccountId,
 		host:         host,
 		protocol:     protocol,
 	}
@@ -95,11 +103,21 @@ func (af *AWSFactory) NewStorageBackend() (backend.StorageBackend, error) {
 
 func (aws *AwsBackend) IsBlockSizeOK(blockSize int64, fileSize int64) error {
 	// AWS::MultipartUpload only supports parts between 1-10_000
-	if blockSize == 0 {
+	if blockSize <= 0 {
 		return fmt.Errorf("aws: block_size cannot be zero")
 	}
+	if fileSize > AWS_MAX_OBJECT_SIZE {
+		return fmt.Errorf("aws: file is larger than %s", L.HumanReadableBytes(uint64(AWS_MAX_OBJECT_SIZE), 0))
+	}
+	if blockSize > AWS_MAX_PART_SIZE {
+		return fmt.Errorf("aws: block_size is too large")
+	}
 	parts := (fileSize + blockSize - 1) / blockSize
-	if parts > 10_000 {
+	if parts > AWS_MAX_PARTS {
+		return fmt.Errorf("aws: block_size is too small")
+	}
+	// every part except the last one must be at least AWS_MIN_PART_SIZE
+	if parts > 1 && blockSize < AWS_MIN_PART_SIZE {
 		return fmt.Errorf("aws: block_size is too small")
 	}
 	return nil
@@ -109,6 +127,10 @@ func (aws *AwsBackend) CreateResourceContainer(ctx context.Context) error {
 	return aws.createS3Bucket(ctx)
 }
 
+func (aws *AwsBackend) GetResourceContainerId() string {
+	return "s3://" + aws.bucketName
+}
+
 func (aws *AwsBackend) CreateUploadResource(
 	ctx context.Context,
 	taskKey string,
@@ -122,6 +144,11 @@ func (aws *AwsBackend) CreateUploadResource(
 		resourceFilePath,
 		L.HumanReadableBytes(resourceFileInfo.Size, 2))
 
+	blockSize, err := aws.getOptimalBlockSizeForSize(int64(resourceFileInfo.Size))
+	if err != nil {
+		return nil, err
+	}
+
 	cost, err := EstimateCost(ctx, resourceFileInfo.Size, "INR")
 	if err != nil {
 		return nil, err
@@ -130,7 +157,7 @@ func (aws *AwsBackend) CreateUploadResource(
 	L.Print(renderEstimatedCost(
 		resourceFileInfo.Size,
 		cost,
-		AwsStorageClass(config.Get().Aws.StorageClass), "INR"))
+		AwsStorageClass(aws.storageClass), "INR"))
 
 	readable, err := file_io.IsReadable(resourceFilePath)
 
@@ -151,14 +178,9 @@ func (aws *AwsBackend) CreateUploadResource(
 		SchemaVersion: STORAGE_BACKEND_METADATA_SCHEMA_VERSION,
 	}
 
-	info, err := file_io.GetFileInfo(resourceFilePath)
-	if err != nil {
-		return nil, err
-	}
-
 	return &backend.CreateUploadResult{
 		Metadata:         metadata,
-		BlockSizeInBytes: aws.getOptimalBlockSizeForSize(int64(info.Size)),
+		BlockSizeInBytes: blockSize,
 	}, nil
 }
 
@@ -167,19 +189,21 @@ func (aws *AwsBackend) UploadResource(
 	taskRepo repository.TaskRepository,
 	uploadRepo repository.UploadRepository,
 	uploadBlockRepo repository.UploadBlockRepository,
-	maxConcurrentJobs int,
+	opts backend.UploadOptions,
 	uploadId int64,
 ) error {
+	err := aws.uploadResource(ctx, taskRepo, uploadRepo, uploadBlockRepo, opts, uploadId)
+	if !errors.Is(err, errNoSuchUpload) {
+		return err
+	}
+	// the multipart upload expired or was aborted while we were uploading,
+	// start a new one and upload everything again
+	L.Warn("aws: multipart upload does not exist anymore, starting a new one")
 	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
 	if err != nil {
 		return fmt.Errorf("could not find upload for upload id %d:%w", uploadId, err)
 	}
-	L.Printf(
-		"Using up to %s to upload\n",
-		L.HumanReadableCount(maxConcurrentJobs, "job", "jobs"),
-	)
 	task, err := taskRepo.GetTaskById(ctx, upload.TaskId)
-	taskKey := task.Key()
 	if err != nil {
 		return fmt.Errorf("could not find task for upload id %d:%w", uploadId, err)
 	}
@@ -188,6 +212,67 @@ func (aws *AwsBackend) UploadResource(
 	if err != nil {
 		return fmt.Errorf("could not parse storage backend metadata for upload id %d:%w", uploadId, err)
 	}
+	err = aws.restartMultipartUpload(ctx, uploadRepo, uploadBlockRepo, upload, &awsUploadRes, task.Key())
+	if err != nil {
+		return err
+	}
+	return aws.uploadResource(ctx, taskRepo, uploadRepo, uploadBlockRepo, opts, uploadId)
+}
+
+func (aws *AwsBackend) AbortUploadResource(
+	ctx context.Context,
+	taskKey string,
+	metadata backend.StorageMetadata,
+) error {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	return aws.abortMultipartUpload(ctx, taskKey, awsUploadRes.UploadId)
+}
+
+func (aws *AwsBackend) uploadResource(
+	ctx context.Context,
+	taskRepo repository.TaskRepository,
+	uploadRepo repository.UploadRepository,
+	uploadBlockRepo repository.UploadBlockRepository,
+	opts backend.UploadOptions,
+	uploadId int64,
+) error {
+	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
+	if err != nil {
+		return fmt.Errorf("could not find upload for upload id %d:%w", uploadId, err)
+	}
+	// S3 forgets a multipart upload once it is completed, so reconciling
+	// would mistake it for an expired one and upload everything again
+	if upload.Status == model.UPLOAD_STATUS_COMPLETED {
+		L.Info(fmt.Sprintf("Skipping upload id %d because it is completed already", uploadId))
+		return nil
+	}
+	startTime := time.Now()
+	cc := backend.NewConcurrencyController(opts, startTime)
+	if cc.IsAuto() {
+		L.Printf(
+			"Using %s to %s to upload (auto)\n",
+			L.HumanReadableCount(cc.Target(), "job", "jobs"),
+			L.HumanReadableCount(cc.MaxWorkers(), "job", "jobs"),
+		)
+	} else {
+		L.Printf(
+			"Using up to %s to upload\n",
+			L.HumanReadableCount(cc.MaxWorkers(), "job", "jobs"),
+		)
+	}
+	task, err := taskRepo.GetTaskById(ctx, upload.TaskId)
+	if err != nil {
+		return fmt.Errorf("could not find task for upload id %d:%w", uploadId, err)
+	}
+	taskKey := task.Key()
+	var awsUploadRes CreateMultipartUploadResult
+	err = json.Unmarshal([]byte(upload.StorageBackendMetadataJson), &awsUploadRes)
+	if err != nil {
+		return fmt.Errorf("could not parse storage backend metadata for upload id %d:%w", uploadId, err)
+	}
 	resetCnt, err := uploadBlockRepo.ResetDirtyBlocks(ctx, uploadId)
 	if err != nil {
 		return err
@@ -208,6 +293,11 @@ func (aws *AwsBackend) UploadResource(
 		L.Debug(fmt.Sprintf("Upload blocks created: %d", createdCnt))
 	}
 
+	err = aws.reconcileBlocks(ctx, uploadRepo, uploadBlockRepo, upload, &awsUploadRes, taskKey)
+	if err != nil {
+		return err
+	}
+
 	// add bytes from completed blocks
 	completedBlocks, err := uploadBlockRepo.GetCompletedBlocksForUploadId(ctx, upload.Id)
 	if err != nil {
@@ -219,63 +309,103 @@ func (aws *AwsBackend) UploadResource(
 	}
 	var totalSent atomic.Uint64
 	totalSent.Store(uint64(completedBytes))
+	opts.Progress.Start(completedBytes, upload.FileSize)
+
+	// a fatal error in any worker stops the whole upload, and is returned
+	// instead of ctx.Err() once all workers exit
+	uploadCtx, stopUpload := context.WithCancelCause(ctx)
+	defer stopUpload(nil)
 
 	// DB_BATCH_SIZE is # of next unfinished blocks to fetch from sqlite DB
 	// TODO: maybe this should be exposed as arg/config?
 	const DB_BATCH_SIZE = 16
 	blockIds := make(chan int64, DB_BATCH_SIZE)
 
+	// number of claimed blocks that workers have not finished yet, and
+	// a signal sent every time a worker finishes one
+	var inFlight atomic.Int64
+	blockDone := make(chan struct{}, 1)
+	finishBlock := func() {
+		inFlight.Add(-1)
+		select {
+		case blockDone <- struct{}{}:
+		default:
+		}
+	}
+
 	// producer - get the unfinished block ids from sqlite
+	// NOTE: blocks that failed in this run are claimed again until
+	// they run out of retries, so keep claiming until nothing is left
+	// and no block is still running
 	go func() {
 		defer close(blockIds)
 		for {
-			// TODO: implement error retries
-			ids, err := uploadBlockRepo.ClaimNextUnfinishedBlocks(ctx, uploadId, DB_BATCH_SIZE)
+			// read before claiming, so a block that fails after the
+			// claim is seen either by the claim or as in flight
+			running := inFlight.Load()
+			ids, err := uploadBlockRepo.ClaimNextUnfinishedBlocks(uploadCtx, uploadId, DB_BATCH_SIZE)
 			if err != nil {
-				L.Panic(fmt.Sprintf("could not get next unfinished blocks for upload id %d:%v", uploadId, err))
-				// TODO: handle errors
+				stopUpload(fmt.Errorf("could not get next unfinished blocks for upload id %d:%w", uploadId, err))
 				return
 			}
 			L.Debug(fmt.Sprintf("Claimed blocks to run: %v", ids))
 			if len(ids) == 0 {
-				L.Info("Skipping UploadBlock(s) because all blocks are finished uploading.")
-				break
+				if running == 0 {
+					L.Info("Skipping UploadBlock(s) because all blocks are finished uploading.")
+					break
+				}
+				// wait for running blocks, they may fail and need a retry
+				select {
+				case <-blockDone:
+				case <-uploadCtx.Done():
+					return
+				}
+				continue
 			}
 
 			for _, id := range ids {
+				inFlight.Add(1)
 				select {
 				case blockIds <- id:
-				case <-ctx.Done():
+				case <-uploadCtx.Done():
 					return
 				}
 			}
-
-			if len(ids) < DB_BATCH_SIZE {
-				// no more unfinished blocks
-				break
-			}
 		}
 	}()
 
-	sema := make(chan struct{}, maxConcurrentJobs)
 	var wg sync.WaitGroup
-	startTime := time.Now()
 
 	progress := sync.Map{} // progress[workerId] = sentBytes
 
-	// we also need maxConcurrentJobs while printing the progress line
-	progress.Store("maxConcurrentJobs", maxConcurrentJobs)
-
 	// consumer - process unfinished blocks
-	// NOTE: workerIds are 1 indexed
-	for workerId := 1; workerId <= maxConcurrentJobs; workerId++ {
+	// NOTE: workerIds are 1 indexed, workers above cc.Target() stay idle
+	for workerId := 1; workerId <= cc.MaxWorkers(); workerId++ {
 		wg.Add(1)
 		go func(workerId int) {
 			defer wg.Done()
-			for blockId := range blockIds {
-				sema <- struct{}{}
-				err = aws.uploadBlock(
-					ctx,
+			for {
+				if cc.WaitActive(uploadCtx, workerId) != nil {
+					return
+				}
+				if opts.Gate.Wait(uploadCtx) != nil {
+					return
+				}
+				var blockId int64
+				var ok bool
+				select {
+				case blockId, ok = <-blockIds:
+				case <-uploadCtx.Done():
+					return
+				}
+				if !ok {
+					return
+				}
+				if opts.Budget.Acquire(uploadCtx) != nil {
+					return
+				}
+				err := aws.uploadBlock(
+					uploadCtx,
 					uploadBlockRepo,
 					upload,
 					&awsUploadRes,
@@ -284,11 +414,34 @@ func (aws *AwsBackend) UploadResource(
 					workerId,
 					&progress,
 					&totalSent,
+					opts.Progress,
+					cc,
 				)
-				if err != nil {
-					L.Panic(err)
+				opts.Budget.Release()
+				cc.RecordBlock(workerId, err)
+				if err == nil || uploadCtx.Err() != nil {
+					finishBlock()
+					continue
+				}
+				retryCount, markErr := uploadBlockRepo.MarkError(uploadCtx, upload.Id, blockId, err.Error())
+				if markErr != nil {
+					stopUpload(fmt.Errorf("aws: could not mark upload as failed for block id %d of upload id %d: %w", blockId, upload.Id, markErr))
+					return
+				}
+				if !cc.IsAuto() || retryCount >= AWS_MAX_BLOCK_RETRIES {
+					stopUpload(err)
+					return
+				}
+				// the block is ERROR now, so the producer can claim it again
+				finishBlock()
+				L.Warn(fmt.Sprintf("aws: block %d failed (attempt %d/%d), will retry: %v",
+					blockId, retryCount, AWS_MAX_BLOCK_RETRIES, err))
+				// back off before this worker picks up the next block
+				select {
+				case <-time.After(time.Duration(retryCount) * time.Second):
+				case <-uploadCtx.Done():
+					return
 				}
-				<-sema
 			}
 		}(workerId)
 	}
@@ -300,22 +453,41 @@ func (aws *AwsBackend) UploadResource(
 		close(waitCh)
 	}()
 
-	select {
-	case <-waitCh:
-		delta := time.Now().UnixMilli() - startTime.UnixMilli()
-		if totalSent.Load() > 0 {
-			L.Footer(L.NORMAL, "")
-			L.Printf("Uploading: Done (%s uploaded)\n", L.HumanReadableBytes(totalSent.Load(), 1))
-			L.Printf("took %s\n", L.HumanReadableTime(delta))
+	ticker := time.NewTicker(backend.CONCURRENCY_SAMPLE_WINDOW)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if opts.Gate.IsPaused() {
+				L.Footer(L.NORMAL, fmt.Sprintf("Uploading: Paused (%s uploaded)",
+					L.HumanReadableBytes(totalSent.Load(), 1)))
+			}
+			prev, next := cc.Adjust(time.Now())
+			if prev != next {
+				L.Info(fmt.Sprintf("Scaling upload workers: %d -> %d", prev, next))
+			}
+		case <-waitCh:
+			if uploadCtx.Err() != nil {
+				// workers exited early, either due to a fatal error or ctx
+				return context.Cause(uploadCtx)
+			}
+			delta := time.Now().UnixMilli() - startTime.UnixMilli()
+			if totalSent.Load() > 0 {
+				L.Footer(L.NORMAL, "")
+				L.Printf("Uploading: Done (%s uploaded)\n", L.HumanReadableBytes(totalSent.Load(), 1))
+				L.Printf("took %s\n", L.HumanReadableTime(delta))
+			}
+			return aws.completeMultipartUpload(
+				ctx,
+				uploadRepo,
+				uploadBlockRepo,
+				upload,
+				&awsUploadRes,
+				task)
+		case <-uploadCtx.Done():
+			<-waitCh
+			return context.Cause(uploadCtx)
 		}
-		return aws.completeMultipartUpload(
-			ctx,
-			uploadRepo,
-			uploadBlockRepo,
-			upload,
-			&awsUploadRes,
-			task)
-	case <-ctx.Done():
-		return ctx.Err()
 	}
 }
@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"glesha/checksum"
+	"glesha/config"
+	L "glesha/logger"
+	"net/http"
+)
+
+// validates "cfg" and checks that its credentials can access its bucket
+// with a signed HeadBucket request, without uploading anything
+func CheckConnection(ctx context.Context, cfg *config.Aws) error {
+	aws, err := newFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return aws.headBucket(ctx)
+}
+
+func (aws *AwsBackend) headBucket(ctx context.Context) error {
+	// AWS::HeadBucket request
+	reqUrl := fmt.Sprintf("%s%s/", aws.protocol, aws.host)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", reqUrl, nil)
+	if err != nil {
+		return fmt.Errorf("aws: could not create HeadBucket request: %w", err)
+	}
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+	err = aws.signRequest(req, payloadHash)
+	if err != nil {
+		return fmt.Errorf("aws: could not sign HeadBucket request: %w", err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("aws: could not connect to %s: %w", aws.host, err)
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	// HEAD responses have no body, so errors are only known by status
+	switch {
+	case resp.StatusCode == 301:
+		return fmt.Errorf("aws: bucket %s is in region %s, not %s",
+			aws.bucketName, resp.Header.Get("x-amz-bucket-region"), aws.region)
+	case resp.StatusCode == 400:
+		return fmt.Errorf("aws: HeadBucket request was rejected, check the region and access key")
+	case resp.StatusCode == 403:
+		return fmt.Errorf("aws: access to bucket %s is denied, check the keys, their s3:ListBucket permission and the account id", aws.bucketName)
+	case resp.StatusCode == 404:
+		return fmt.Errorf("aws: bucket %s does not exist", aws.bucketName)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("aws: HeadBucket failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
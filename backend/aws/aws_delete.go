@@ -0,0 +1,328 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"glesha/backend"
+	"glesha/checksum"
+	L "glesha/logger"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type ObjectVersion struct {
+	Key            string `xml:"Key"`
+	VersionId      string `xml:"VersionId"`
+	IsDeleteMarker bool   `xml:"-"`
+}
+
+type ListVersionsResult struct {
+	XMLName             xml.Name        `xml:"ListVersionsResult"`
+	IsTruncated         bool            `xml:"IsTruncated"`
+	NextKeyMarker       string          `xml:"NextKeyMarker"`
+	NextVersionIdMarker string          `xml:"NextVersionIdMarker"`
+	Versions            []ObjectVersion `xml:"Version"`
+	DeleteMarkers       []ObjectVersion `xml:"DeleteMarker"`
+}
+
+func (aws *AwsBackend) GetResourceLock(
+	ctx context.Context,
+	taskKey string,
+	metadata backend.StorageMetadata,
+) (*backend.ResourceLock, error) {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return aws.headObjectLock(ctx, awsUploadRes.objectKey(taskKey), "")
+}
+
+func (aws *AwsBackend) DeleteResource(
+	ctx context.Context,
+	taskKey string,
+	metadata backend.StorageMetadata,
+) error {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	return aws.deleteObject(ctx, awsUploadRes.objectKey(taskKey))
+}
+
+func (aws *AwsBackend) DeleteResourceByKey(ctx context.Context, key string) error {
+	return aws.deleteObject(ctx, key)
+}
+
+// returns the key of the uploaded object, older uploads may not have it
+// in their metadata
+func (res *CreateMultipartUploadResult) objectKey(taskKey string) string {
+	if len(res.Key) > 0 {
+		return res.Key
+	}
+	return taskKey
+}
+
+func (aws *AwsBackend) EstimateDeletion(
+	ctx context.Context,
+	metadata backend.StorageMetadata,
+	sizeInBytes int64,
+	uploadedAt time.Time,
+	now time.Time,
+) (*backend.DeletionEstimate, error) {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	// uploads created by older versions did not record the storage class
+	storageClass := AwsStorageClass(awsUploadRes.StorageClass)
+	if len(storageClass) == 0 {
+		storageClass = AwsStorageClass(aws.storageClass)
+	}
+	exchangeRate, err := getExchangeRate(ctx, "USD", "INR")
+	if err != nil {
+		return nil, err
+	}
+	sizeInGB := float64(sizeInBytes) * float64(1e-9)
+	monthlyCost := exchangeRate * sizeInGB * awsPricePerGBMonth[storageClass]
+	minDuration := time.Duration(awsMinStorageDays[storageClass]) * 24 * time.Hour
+	remaining := max(0, minDuration-now.Sub(uploadedAt))
+	return &backend.DeletionEstimate{
+		StorageClass:         string(storageClass),
+		MinStorageDuration:   minDuration,
+		RemainingMinDuration: remaining,
+		EarlyDeletionCost:    monthlyCost * remaining.Hours() / (30 * 24),
+		MonthlyCost:          monthlyCost,
+		Currency:             "INR",
+	}, nil
+}
+
+func parseStorageMetadata(metadata backend.StorageMetadata) (*CreateMultipartUploadResult, error) {
+	if metadata.SchemaVersion != STORAGE_BACKEND_METADATA_SCHEMA_VERSION {
+		return nil, fmt.Errorf("aws: unsupported storage backend metadata schema version %d", metadata.SchemaVersion)
+	}
+	var awsUploadRes CreateMultipartUploadResult
+	err := json.Unmarshal([]byte(metadata.Json), &awsUploadRes)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not parse storage backend metadata: %w", err)
+	}
+	return &awsUploadRes, nil
+}
+
+// returns the storage class recorded in the metadata of an upload, older
+// uploads did not record it and return an empty string
+func GetUploadStorageClass(metadata backend.StorageMetadata) (string, error) {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return "", err
+	}
+	return awsUploadRes.StorageClass, nil
+}
+
+// deletes every version of object "key". buckets are created with object
+// lock, which needs versioning, so a plain DeleteObject would only add a
+// delete marker and the object would still be charged
+func (aws *AwsBackend) deleteObject(ctx context.Context, key string) error {
+	versions, err := aws.listObjectVersions(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		L.Debug(fmt.Sprintf("aws: object %s does not exist, nothing to delete", key))
+		return nil
+	}
+	// object lock applies to each version, check all of them before
+	// deleting anything so a locked object is not left half deleted
+	now := time.Now()
+	for _, v := range versions {
+		if v.IsDeleteMarker {
+			continue
+		}
+		lock, err := aws.headObjectLock(ctx, key, v.VersionId)
+		if err != nil {
+			return err
+		}
+		if lock.IsLocked(now) {
+			return fmt.Errorf("aws: could not delete %s: %w by %s", key, backend.ErrResourceLocked, lock.String())
+		}
+	}
+	for _, v := range versions {
+		err = aws.deleteObjectVersion(ctx, key, v.VersionId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns all versions and delete markers of object "key"
+func (aws *AwsBackend) listObjectVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	keyMarker := ""
+	versionIdMarker := ""
+	for {
+		// AWS::ListObjectVersions request
+		query := url.Values{}
+		query.Set("versions", "")
+		query.Set("prefix", key)
+		if len(keyMarker) > 0 {
+			query.Set("key-marker", keyMarker)
+			query.Set("version-id-marker", versionIdMarker)
+		}
+		reqUrl := fmt.Sprintf("%s%s/?%s", aws.protocol, aws.host, query.Encode())
+		req, err := http.NewRequestWithContext(ctx, "GET", reqUrl, nil)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not create ListObjectVersions request: %w", err)
+		}
+		req.Header.Set("Host", aws.host)
+		req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+		payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+		err = aws.signRequest(req, payloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not sign ListObjectVersions request: %w", err)
+		}
+		resp, err := aws.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		L.Debug(L.HttpResponseString(resp))
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var awsError AwsError
+		err = xml.Unmarshal(bodyBytes, &awsError)
+		if err == nil {
+			if awsError.Code == "AccessDenied" && resp.StatusCode == 403 {
+				return nil, fmt.Errorf("aws: user lacks s3:ListBucketVersions permission")
+			}
+			return nil, fmt.Errorf("aws: unknown error: %s", awsError.Message)
+		}
+		if resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("aws: ListObjectVersions failed with status %d", resp.StatusCode)
+		}
+		var result ListVersionsResult
+		err = xml.Unmarshal(bodyBytes, &result)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not parse ListObjectVersions response: %w", err)
+		}
+		// prefix also matches longer keys, only keep the exact key
+		for _, v := range result.Versions {
+			if v.Key == key {
+				versions = append(versions, v)
+			}
+		}
+		for _, v := range result.DeleteMarkers {
+			if v.Key == key {
+				v.IsDeleteMarker = true
+				versions = append(versions, v)
+			}
+		}
+		if !result.IsTruncated {
+			return versions, nil
+		}
+		keyMarker = result.NextKeyMarker
+		versionIdMarker = result.NextVersionIdMarker
+	}
+}
+
+func (aws *AwsBackend) deleteObjectVersion(ctx context.Context, key string, versionId string) error {
+	// AWS::DeleteObject request
+	reqUrl := fmt.Sprintf("%s%s/%s?versionId=%s",
+		aws.protocol,
+		aws.host,
+		key,
+		url.QueryEscape(versionId),
+	)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", reqUrl, nil)
+	if err != nil {
+		return fmt.Errorf("aws: could not create DeleteObject request: %w", err)
+	}
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+	err = aws.signRequest(req, payloadHash)
+	if err != nil {
+		return fmt.Errorf("aws: could not sign DeleteObject request: %w", err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("aws: could not read response body of DeleteObject request")
+	}
+	var awsError AwsError
+	err = xml.Unmarshal(bodyBytes, &awsError)
+	if err == nil {
+		if (awsError.Code == "NoSuchKey" || awsError.Code == "NoSuchVersion") && resp.StatusCode == 404 {
+			return nil
+		}
+		if awsError.Code == "AccessDenied" && resp.StatusCode == 403 {
+			return fmt.Errorf("aws: could not delete %s, user lacks s3:DeleteObjectVersion permission or the object is locked", key)
+		}
+		return fmt.Errorf("aws: unknown error: %s", awsError.Message)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("aws: DeleteObject failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// returns the object lock of version "versionId" of object "key", or of
+// its current version if "versionId" is empty. returns nil if the object
+// does not exist or is not locked
+func (aws *AwsBackend) headObjectLock(ctx context.Context, key string, versionId string) (*backend.ResourceLock, error) {
+	// AWS::HeadObject request
+	reqUrl := fmt.Sprintf("%s%s/%s", aws.protocol, aws.host, key)
+	if len(versionId) > 0 {
+		reqUrl = fmt.Sprintf("%s?versionId=%s", reqUrl, url.QueryEscape(versionId))
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", reqUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not create HeadObject request: %w", err)
+	}
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+	err = aws.signRequest(req, payloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not sign HeadObject request: %w", err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	// HEAD responses have no body, so errors are only known by status
+	switch {
+	case resp.StatusCode == 404:
+		return nil, nil
+	case resp.StatusCode == 403:
+		return nil, fmt.Errorf("aws: user lacks s3:GetObject or s3:GetObjectRetention permission for %s", key)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("aws: HeadObject failed with status %d", resp.StatusCode)
+	}
+	lock := &backend.ResourceLock{
+		Mode:      resp.Header.Get("x-amz-object-lock-mode"),
+		LegalHold: resp.Header.Get("x-amz-object-lock-legal-hold") == "ON",
+	}
+	if retainUntil := resp.Header.Get("x-amz-object-lock-retain-until-date"); len(retainUntil) > 0 {
+		lock.RetainUntil, err = time.Parse(time.RFC3339, retainUntil)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not parse object lock retain until date %s: %w", retainUntil, err)
+		}
+	}
+	if len(lock.Mode) == 0 && !lock.LegalHold {
+		return nil, nil
+	}
+	return lock, nil
+}
@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"glesha/backend"
+	"glesha/checksum"
+	L "glesha/logger"
+	"io"
+	"net/http"
+)
+
+func (aws *AwsBackend) GetUploadResourceKey(taskKey string, metadata backend.StorageMetadata) (string, error) {
+	awsUploadRes, err := parseStorageMetadata(metadata)
+	if err != nil {
+		return "", err
+	}
+	return awsUploadRes.objectKey(taskKey), nil
+}
+
+func (aws *AwsBackend) GetResourceRange(ctx context.Context, key string, start int64, end int64) (io.ReadCloser, error) {
+	// AWS::GetObject request
+	url := fmt.Sprintf("%s%s/%s", aws.protocol, aws.host, key)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not create GetObject request for %s: %w", key, err)
+	}
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	// the end of http ranges is inclusive
+	if end < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	} else {
+		if end <= start {
+			return io.NopCloser(http.NoBody), nil
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	}
+	payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+	err = aws.signRequest(req, payloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not sign GetObject request for %s: %w", key, err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		if resp.StatusCode == http.StatusOK && start > 0 {
+			// the range was ignored, which S3 only does for empty objects
+			resp.Body.Close()
+			return nil, fmt.Errorf("aws: GetObject of %s returned the whole object instead of a range", key)
+		}
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("aws: could not read response body of GetObject request")
+	}
+	var awsError AwsError
+	err = xml.Unmarshal(bodyBytes, &awsError)
+	if err != nil {
+		return nil, fmt.Errorf("aws: GetObject of %s failed with status %d", key, resp.StatusCode)
+	}
+	switch {
+	case awsError.Code == "InvalidObjectState" && resp.StatusCode == 403:
+		return nil, fmt.Errorf("aws: could not read %s: %w, restore it from its storage class first", key, backend.ErrResourceArchived)
+	case awsError.Code == "AccessDenied" && resp.StatusCode == 403:
+		return nil, fmt.Errorf("aws: user lacks s3:GetObject permission")
+	case awsError.Code == "NoSuchKey" && resp.StatusCode == 404:
+		return nil, fmt.Errorf("aws: %s does not exist in bucket %s", key, aws.bucketName)
+	case awsError.Code == "InvalidRange" && resp.StatusCode == 416:
+		return nil, fmt.Errorf("aws: range %d-%d is outside of %s", start, end, key)
+	case awsError.Code == "RequestTimeTooSkewed" && resp.StatusCode == 400:
+		return nil, fmt.Errorf("aws: system clock is off by > 15 minutes, please sync system time with NTP")
+	}
+	return nil, fmt.Errorf("aws: unknown error: %s", awsError.Message)
+}
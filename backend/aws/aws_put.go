@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"glesha/checksum"
+	L "glesha/logger"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// largest object that can be uploaded with a single PutObject request
+const AWS_MAX_PUT_SIZE int64 = 5 * GiB
+
+func (aws *AwsBackend) PutResource(ctx context.Context, key string, resourceFilePath string) error {
+	info, err := os.Stat(resourceFilePath)
+	if err != nil {
+		return fmt.Errorf("aws: could not stat %s: %w", resourceFilePath, err)
+	}
+	if info.Size() > AWS_MAX_PUT_SIZE {
+		return fmt.Errorf("aws: %s is larger than %s", resourceFilePath, L.HumanReadableBytes(uint64(AWS_MAX_PUT_SIZE), 1))
+	}
+	content, err := os.ReadFile(resourceFilePath)
+	if err != nil {
+		return fmt.Errorf("aws: could not read %s: %w", resourceFilePath, err)
+	}
+
+	// AWS::PutObject request
+	url := fmt.Sprintf("%s%s/%s", aws.protocol, aws.host, key)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("aws: could not create PutObject request for %s: %w", key, err)
+	}
+	sha256Sum := checksum.Sha256(content)
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// required by buckets with object lock
+	req.Header.Set("Content-MD5", checksum.Base64EncodeStr(checksum.Md5(content)))
+	req.Header.Set("x-amz-checksum-sha256", checksum.Base64EncodeStr(sha256Sum))
+	req.Header.Set("x-amz-storage-class", aws.storageClass)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	aws.setObjectLockHeaders(req, time.Now())
+	req.ContentLength = int64(len(content))
+
+	err = aws.signRequest(req, checksum.HexEncodeStr(sha256Sum))
+	if err != nil {
+		return fmt.Errorf("aws: could not sign PutObject request for %s: %w", key, err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("aws: could not read response body of PutObject request")
+	}
+	var awsError AwsError
+	err = xml.Unmarshal(bodyBytes, &awsError)
+	if err == nil {
+		if awsError.Code == "RequestTimeTooSkewed" && resp.StatusCode == 400 {
+			return fmt.Errorf("aws: system clock is off by > 15 minutes, please sync system time with NTP")
+		}
+		if awsError.Code == "AccessDenied" && resp.StatusCode == 403 {
+			return fmt.Errorf("aws: user lacks s3:PutObject permission")
+		}
+		if awsError.Code == "NoSuchBucket" && resp.StatusCode == 404 {
+			return fmt.Errorf("aws: bucket %s does not exist in region: %s", aws.bucketName, aws.region)
+		}
+		if awsError.Code == "BadDigest" && resp.StatusCode == 400 {
+			return fmt.Errorf("aws: %s was corrupted while uploading", key)
+		}
+		return fmt.Errorf("aws: unknown error: %s", awsError.Message)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("aws: PutObject failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"glesha/checksum"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	L "glesha/logger"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// returned when S3 does not know about a multipart upload, either because
+// it was aborted or it expired due to a bucket lifecycle rule
+var errNoSuchUpload = errors.New("aws: multipart upload does not exist")
+
+type ListedPart struct {
+	PartNumber     int64  `xml:"PartNumber"`
+	ETag           string `xml:"ETag"`
+	Size           int64  `xml:"Size"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256"`
+}
+
+type ListPartsResult struct {
+	XMLName              xml.Name     `xml:"ListPartsResult"`
+	IsTruncated          bool         `xml:"IsTruncated"`
+	NextPartNumberMarker int64        `xml:"NextPartNumberMarker"`
+	Parts                []ListedPart `xml:"Part"`
+}
+
+// returns all parts S3 has received for multipart upload "uploadId"
+func (aws *AwsBackend) listParts(
+	ctx context.Context,
+	taskKey string,
+	uploadId string,
+) ([]ListedPart, error) {
+	var parts []ListedPart
+	var marker int64 = 0
+	for {
+		// AWS::ListParts request
+		url := fmt.Sprintf("%s%s/%s?uploadId=%s&part-number-marker=%d",
+			aws.protocol,
+			aws.host,
+			taskKey,
+			uploadId,
+			marker,
+		)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not create ListParts request: %w", err)
+		}
+		req.Header.Set("Host", aws.host)
+		req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+		payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+		err = aws.signRequest(req, payloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not sign ListParts request: %w", err)
+		}
+		resp, err := aws.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		L.Debug(L.HttpResponseString(resp))
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+		var awsError AwsError
+		err = xml.Unmarshal(bodyBytes, &awsError)
+		if err == nil {
+			if awsError.Code == "NoSuchUpload" && resp.StatusCode == 404 {
+				return nil, errNoSuchUpload
+			}
+			if awsError.Code == "RequestTimeTooSkewed" && resp.StatusCode == 400 {
+				return nil, fmt.Errorf("aws: system clock is off by > 15 minutes, please sync system time with NTP")
+			}
+			if awsError.Code == "AccessDenied" && resp.StatusCode == 403 {
+				return nil, fmt.Errorf("aws: user lacks s3:ListMultipartUploadParts permission")
+			}
+			if awsError.Code == "NoSuchBucket" && resp.StatusCode == 404 {
+				return nil, fmt.Errorf("aws: bucket %s does not exist in region: %s", aws.bucketName, aws.region)
+			}
+			return nil, fmt.Errorf("aws: unknown error: %s", awsError.Message)
+		}
+		if resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("aws: ListParts failed with status %d", resp.StatusCode)
+		}
+
+		var result ListPartsResult
+		err = xml.Unmarshal(bodyBytes, &result)
+		if err != nil {
+			return nil, fmt.Errorf("aws: could not parse ListParts response: %w", err)
+		}
+		parts = append(parts, result.Parts...)
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	return parts, nil
+}
+
+// compares local block state with the parts S3 has already received.
+// blocks that S3 has with matching checksums are marked complete, and
+// completed blocks that S3 does not have are queued again.
+// if S3 no longer knows about the multipart upload, a new one is started.
+func (aws *AwsBackend) reconcileBlocks(
+	ctx context.Context,
+	uploadRepo repository.UploadRepository,
+	uploadBlockRepo repository.UploadBlockRepository,
+	upload *model.Upload,
+	uploadRes *CreateMultipartUploadResult,
+	taskKey string,
+) error {
+	parts, err := aws.listParts(ctx, taskKey, uploadRes.UploadId)
+	if errors.Is(err, errNoSuchUpload) {
+		L.Warn(fmt.Sprintf("aws: multipart upload %s has expired or was aborted, starting a new one",
+			L.TruncateString(uploadRes.UploadId, 16, L.TRUNC_CENTER)))
+		return aws.restartMultipartUpload(ctx, uploadRepo, uploadBlockRepo, upload, uploadRes, taskKey)
+	}
+	if err != nil {
+		return fmt.Errorf("could not list uploaded parts for upload id %d: %w", upload.Id, err)
+	}
+
+	remoteParts := make(map[int64]ListedPart, len(parts))
+	for _, p := range parts {
+		remoteParts[p.PartNumber] = p
+	}
+
+	blocks, err := uploadBlockRepo.GetBlocksForUploadId(ctx, upload.Id)
+	if err != nil {
+		return err
+	}
+
+	var requeue []int64
+	recovered := 0
+	for _, b := range blocks {
+		part, uploaded := remoteParts[partNumber(upload, &b)]
+		if b.Status == model.UB_STATUS_COMPLETE {
+			if !uploaded || (part.ChecksumSHA256 != "" && part.ChecksumSHA256 != b.Checksum) {
+				requeue = append(requeue, b.Id)
+			}
+			continue
+		}
+		if !uploaded || part.Size != b.Size {
+			continue
+		}
+		sha256Sum, md5Sum, err := file_io.ComputeRangeChecksums(ctx, upload.FilePath, b.FileOffset, b.Size)
+		if err != nil {
+			return err
+		}
+		localChecksum := checksum.Base64EncodeStr(sha256Sum)
+		if part.ChecksumSHA256 != "" {
+			if part.ChecksumSHA256 != localChecksum {
+				continue
+			}
+		} else if strings.Trim(part.ETag, `"`) != checksum.HexEncodeStr(md5Sum) {
+			continue
+		}
+		err = uploadBlockRepo.MarkComplete(ctx, upload.Id, b.Id, localChecksum, part.ETag)
+		if err != nil {
+			return err
+		}
+		recovered++
+	}
+
+	if recovered > 0 {
+		L.Info(fmt.Sprintf("Recovered %s that were already uploaded in a previous run",
+			L.HumanReadableCount(recovered, "block", "blocks")))
+	}
+	if len(requeue) > 0 {
+		L.Warn(fmt.Sprintf("Uploading %s again because aws does not have them",
+			L.HumanReadableCount(len(requeue), "block", "blocks")))
+		_, err = uploadBlockRepo.RequeueBlocks(ctx, upload.Id, requeue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// creates a new multipart upload for "upload" and discards all progress
+// made against the previous one
+func (aws *AwsBackend) restartMultipartUpload(
+	ctx context.Context,
+	uploadRepo repository.UploadRepository,
+	uploadBlockRepo repository.UploadBlockRepository,
+	upload *model.Upload,
+	uploadRes *CreateMultipartUploadResult,
+	taskKey string,
+) error {
+	newUploadRes, err := aws.createMultipartUpload(ctx, taskKey)
+	if err != nil {
+		return fmt.Errorf("aws: could not create multipart upload: %w", err)
+	}
+	newUploadResJson, err := json.Marshal(newUploadRes)
+	if err != nil {
+		return fmt.Errorf("aws: could not parse response from CreateMultipartUpload: %w", err)
+	}
+	err = uploadRepo.RestartUpload(ctx, upload.Id, string(newUploadResJson), STORAGE_BACKEND_METADATA_SCHEMA_VERSION)
+	if err != nil {
+		return err
+	}
+	_, err = uploadBlockRepo.RemoveAllBlocks(ctx, upload.Id)
+	if err != nil {
+		return fmt.Errorf("could not remove blocks for upload id %d: %w", upload.Id, err)
+	}
+	_, err = uploadBlockRepo.CreateUploadBlocks(ctx, upload.Id, upload.FileSize, upload.BlockSizeInBytes)
+	if err != nil {
+		return err
+	}
+	*uploadRes = *newUploadRes
+	upload.StorageBackendMetadataJson = string(newUploadResJson)
+	upload.UploadedBytes = 0
+	upload.UploadedBlocks = 0
+	return nil
+}
@@ -2,14 +2,27 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"glesha/backend"
+	"glesha/checksum"
 	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
 func TestNew(t *testing.T) {
@@ -106,6 +119,11 @@ func TestAwsBackend(t *testing.T) {
   <Message>Access Denied</Message>
 </Error>`)
 		case "/test-key":
+			if r.Header.Get("x-amz-object-lock-mode") != "" {
+				assert.Equal(t, "GOVERNANCE", r.Header.Get("x-amz-object-lock-mode"))
+				assert.NotEmpty(t, r.Header.Get("x-amz-object-lock-retain-until-date"))
+				assert.Equal(t, "ON", r.Header.Get("x-amz-object-lock-legal-hold"))
+			}
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
 <InitiateMultipartUploadResult>
@@ -179,4 +197,599 @@ func TestAwsBackend(t *testing.T) {
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Metadata.Json, "test-upload-id")
 	})
+
+	t.Run("CreateUploadResource_ObjectLock", func(t *testing.T) {
+		tempFile, err := os.CreateTemp("", "test-file")
+		assert.NoError(t, err)
+		defer os.Remove(tempFile.Name())
+
+		awsBackend.host = server.Listener.Addr().String()
+		awsBackend.objectLock = &config.AwsObjectLock{Mode: "GOVERNANCE", RetainDays: 30, LegalHold: true}
+		defer func() { awsBackend.objectLock = nil }()
+		result, err := awsBackend.CreateUploadResource(context.Background(), "test-key", tempFile.Name())
+		assert.NoError(t, err)
+		assert.Contains(t, result.Metadata.Json, `"object_lock_mode":"GOVERNANCE"`)
+		assert.Contains(t, result.Metadata.Json, `"object_lock_legal_hold":true`)
+	})
+}
+
+func TestGetOptimalBlockSizeForSize(t *testing.T) {
+	awsBackend := &AwsBackend{}
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{"Small", 1 * MiB},
+		{"Medium", 4 * GiB},
+		{"Large", 100 * GiB},
+		{"TwoTiB", 2 * TiB},
+		{"MaxObjectSize", AWS_MAX_OBJECT_SIZE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blockSize, err := awsBackend.getOptimalBlockSizeForSize(tt.size)
+			assert.NoError(t, err)
+			assert.Zero(t, blockSize%MiB)
+			assert.NoError(t, awsBackend.IsBlockSizeOK(blockSize, tt.size))
+		})
+	}
+
+	t.Run("TooLarge", func(t *testing.T) {
+		_, err := awsBackend.getOptimalBlockSizeForSize(AWS_MAX_OBJECT_SIZE + 1)
+		assert.Error(t, err)
+	})
+}
+
+func TestIsBlockSizeOK(t *testing.T) {
+	awsBackend := &AwsBackend{}
+	assert.Error(t, awsBackend.IsBlockSizeOK(0, 10*MiB))
+	assert.Error(t, awsBackend.IsBlockSizeOK(1*MiB, 100*GiB))
+	assert.Error(t, awsBackend.IsBlockSizeOK(1*MiB, 10*MiB))
+	assert.Error(t, awsBackend.IsBlockSizeOK(6*GiB, 10*GiB))
+	assert.NoError(t, awsBackend.IsBlockSizeOK(10*MiB, 1*MiB))
+}
+
+func TestListParts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if r.URL.Query().Get("uploadId") == "expired-upload-id" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>NoSuchUpload</Code>
+  <Message>The specified upload does not exist.</Message>
+</Error>`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("part-number-marker") {
+		case "0":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListPartsResult>
+  <IsTruncated>true</IsTruncated>
+  <NextPartNumberMarker>1</NextPartNumberMarker>
+  <Part>
+    <PartNumber>1</PartNumber>
+    <ETag>"etag-1"</ETag>
+    <Size>10</Size>
+    <ChecksumSHA256>checksum-1</ChecksumSHA256>
+  </Part>
+</ListPartsResult>`)
+		default:
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListPartsResult>
+  <IsTruncated>false</IsTruncated>
+  <Part>
+    <PartNumber>2</PartNumber>
+    <ETag>"etag-2"</ETag>
+    <Size>20</Size>
+  </Part>
+</ListPartsResult>`)
+		}
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+
+	t.Run("Paginated", func(t *testing.T) {
+		parts, err := awsBackend.listParts(context.Background(), "test-key", "test-upload-id")
+		assert.NoError(t, err)
+		assert.Len(t, parts, 2)
+		assert.Equal(t, int64(1), parts[0].PartNumber)
+		assert.Equal(t, "checksum-1", parts[0].ChecksumSHA256)
+		assert.Equal(t, int64(20), parts[1].Size)
+	})
+
+	t.Run("NoSuchUpload", func(t *testing.T) {
+		_, err := awsBackend.listParts(context.Background(), "test-key", "expired-upload-id")
+		assert.ErrorIs(t, err, errNoSuchUpload)
+	})
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE", r.Method)
+		switch r.URL.Query().Get("uploadId") {
+		case "expired-upload-id":
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>NoSuchUpload</Code>
+  <Message>The specified upload does not exist.</Message>
+</Error>`)
+		case "forbidden-upload-id":
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>AccessDenied</Code>
+  <Message>Access Denied</Message>
+</Error>`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+
+	t.Run("Aborted", func(t *testing.T) {
+		metadata := backend.StorageMetadata{
+			Json:          `{"upload_id":"test-upload-id"}`,
+			SchemaVersion: STORAGE_BACKEND_METADATA_SCHEMA_VERSION,
+		}
+		err := awsBackend.AbortUploadResource(context.Background(), "test-key", metadata)
+		assert.NoError(t, err)
+	})
+
+	t.Run("NoSuchUpload", func(t *testing.T) {
+		err := awsBackend.abortMultipartUpload(context.Background(), "test-key", "expired-upload-id")
+		assert.NoError(t, err)
+	})
+
+	t.Run("AccessDenied", func(t *testing.T) {
+		err := awsBackend.abortMultipartUpload(context.Background(), "test-key", "forbidden-upload-id")
+		assert.Error(t, err)
+	})
+}
+
+func TestDeleteResource(t *testing.T) {
+	var deleted []string
+	retainUntil := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "HEAD":
+			assert.NotEqual(t, "v3", r.URL.Query().Get("versionId"), "delete markers can not be locked")
+			if len(retainUntil) > 0 {
+				w.Header().Set("x-amz-object-lock-mode", "COMPLIANCE")
+				w.Header().Set("x-amz-object-lock-retain-until-date", retainUntil)
+			}
+			w.WriteHeader(http.StatusOK)
+		case "GET":
+			assert.Equal(t, "test-key", r.URL.Query().Get("prefix"))
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult>
+  <IsTruncated>false</IsTruncated>
+  <Version><Key>test-key</Key><VersionId>v1</VersionId></Version>
+  <Version><Key>test-key-other</Key><VersionId>v2</VersionId></Version>
+  <DeleteMarker><Key>test-key</Key><VersionId>v3</VersionId></DeleteMarker>
+</ListVersionsResult>`)
+		case "DELETE":
+			deleted = append(deleted, r.URL.Path+"@"+r.URL.Query().Get("versionId"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:       server.Client(),
+		bucketName:   "test-bucket",
+		region:       "us-east-1",
+		storageClass: string(AWS_SC_STANDARD),
+		protocol:     "http://",
+		host:         server.Listener.Addr().String(),
+	}
+	metadata := backend.StorageMetadata{
+		Json:          `{"upload_id":"test-upload-id","key":"test-key","storage_class":"DEEP_ARCHIVE"}`,
+		SchemaVersion: STORAGE_BACKEND_METADATA_SCHEMA_VERSION,
+	}
+
+	t.Run("Locked", func(t *testing.T) {
+		retainUntil = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		defer func() { retainUntil = "" }()
+		lock, err := awsBackend.GetResourceLock(context.Background(), "test-key", metadata)
+		assert.NoError(t, err)
+		assert.True(t, lock.IsLocked(time.Now()))
+		assert.Equal(t, "COMPLIANCE", lock.Mode)
+
+		err = awsBackend.DeleteResource(context.Background(), "test-key", metadata)
+		assert.ErrorIs(t, err, backend.ErrResourceLocked)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("DeletesAllVersions", func(t *testing.T) {
+		lock, err := awsBackend.GetResourceLock(context.Background(), "test-key", metadata)
+		assert.NoError(t, err)
+		assert.Nil(t, lock)
+		err = awsBackend.DeleteResource(context.Background(), "test-key", metadata)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/test-key@v1", "/test-key@v3"}, deleted)
+	})
+
+	t.Run("GetUploadStorageClass", func(t *testing.T) {
+		storageClass, err := GetUploadStorageClass(metadata)
+		assert.NoError(t, err)
+		assert.Equal(t, string(AWS_SC_DEEP_ARCHIVE), storageClass)
+
+		_, err = GetUploadStorageClass(backend.StorageMetadata{Json: "{}", SchemaVersion: 99})
+		assert.ErrorContains(t, err, "unsupported storage backend metadata schema version")
+	})
+
+	t.Run("EstimateDeletion", func(t *testing.T) {
+		now := time.Now()
+		estimate, err := awsBackend.EstimateDeletion(context.Background(), metadata, 1e9, now.Add(-30*24*time.Hour), now)
+		assert.NoError(t, err)
+		assert.Equal(t, string(AWS_SC_DEEP_ARCHIVE), estimate.StorageClass)
+		assert.Equal(t, 180*24*time.Hour, estimate.MinStorageDuration)
+		assert.Equal(t, 150*24*time.Hour, estimate.RemainingMinDuration)
+		assert.InDelta(t, estimate.MonthlyCost*5, estimate.EarlyDeletionCost, 1e-9)
+
+		estimate, err = awsBackend.EstimateDeletion(context.Background(), metadata, 1e9, now.Add(-200*24*time.Hour), now)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), estimate.RemainingMinDuration)
+		assert.Equal(t, float64(0), estimate.EarlyDeletionCost)
+	})
+}
+
+func TestPutResource(t *testing.T) {
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PUT", r.Method)
+		switch r.URL.Path {
+		case "/packs/ab/abcd":
+			assert.NotEmpty(t, r.Header.Get("Content-MD5"))
+			assert.NotEmpty(t, r.Header.Get("x-amz-checksum-sha256"))
+			assert.Equal(t, "GOVERNANCE", r.Header.Get("x-amz-object-lock-mode"))
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			uploaded = body
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>AccessDenied</Code>
+  <Message>Access Denied</Message>
+</Error>`)
+		}
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:       server.Client(),
+		bucketName:   "test-bucket",
+		region:       "us-east-1",
+		storageClass: string(AWS_SC_STANDARD),
+		objectLock:   &config.AwsObjectLock{Mode: "GOVERNANCE", RetainDays: 1},
+		protocol:     "http://",
+		host:         server.Listener.Addr().String(),
+	}
+	assert.Equal(t, "s3://test-bucket", awsBackend.GetResourceContainerId())
+
+	packPath := filepath.Join(t.TempDir(), "abcd")
+	err := os.WriteFile(packPath, []byte("pack content"), 0644)
+	assert.NoError(t, err)
+
+	err = awsBackend.PutResource(context.Background(), "packs/ab/abcd", packPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("pack content"), uploaded)
+
+	err = awsBackend.PutResource(context.Background(), "packs/ef/efgh", packPath)
+	assert.Error(t, err)
+
+	err = awsBackend.PutResource(context.Background(), "packs/ab/abcd", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestGetResourceRange(t *testing.T) {
+	content := "0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		switch r.URL.Path {
+		case "/packs/ab/abcd":
+			var start, end int
+			_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			assert.NoError(t, err)
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, content[start:end+1])
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>InvalidObjectState</Code>
+  <Message>The operation is not valid for the object's storage class</Message>
+</Error>`)
+		}
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:       server.Client(),
+		bucketName:   "test-bucket",
+		region:       "us-east-1",
+		storageClass: string(AWS_SC_STANDARD),
+		protocol:     "http://",
+		host:         server.Listener.Addr().String(),
+	}
+	body, err := awsBackend.GetResourceRange(context.Background(), "packs/ab/abcd", 2, 5)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.NoError(t, body.Close())
+	assert.Equal(t, "234", string(data))
+
+	_, err = awsBackend.GetResourceRange(context.Background(), "archive.tar.gz", 0, 5)
+	assert.ErrorIs(t, err, backend.ErrResourceArchived)
+
+	key, err := awsBackend.GetUploadResourceKey("task-key", backend.StorageMetadata{
+		Json:          `{"key":"uploads/archive.tar.gz"}`,
+		SchemaVersion: STORAGE_BACKEND_METADATA_SCHEMA_VERSION,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "uploads/archive.tar.gz", key)
+}
+
+func TestHeadBucket(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HEAD", r.Method)
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "123456789012", r.Header.Get("x-amz-expected-bucket-owner"))
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=test-access-key/")
+		if status == http.StatusMovedPermanently {
+			w.Header().Set("x-amz-bucket-region", "eu-west-1")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		accessKey:  "test-access-key",
+		secretKey:  "test-secret-key",
+		accountId:  123456789012,
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+
+	assert.NoError(t, awsBackend.headBucket(context.Background()))
+
+	status = http.StatusMovedPermanently
+	assert.EqualError(t, awsBackend.headBucket(context.Background()),
+		"aws: bucket test-bucket is in region eu-west-1, not us-east-1")
+
+	status = http.StatusForbidden
+	assert.ErrorContains(t, awsBackend.headBucket(context.Background()), "access to bucket test-bucket is denied")
+
+	status = http.StatusNotFound
+	assert.EqualError(t, awsBackend.headBucket(context.Background()), "aws: bucket test-bucket does not exist")
+
+	err := CheckConnection(context.Background(), &config.Aws{BucketName: "invalid_bucket"})
+	assert.EqualError(t, err, "aws: bucket name contains invalid characters")
+}
+
+func TestUploadResourceRetriesFailedLastBlock(t *testing.T) {
+	const blockSize = 8
+	const totalBlocks = 4
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListPartsResult>
+  <IsTruncated>false</IsTruncated>
+</ListPartsResult>`)
+		case "PUT":
+			partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+			assert.NoError(t, err)
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			mu.Lock()
+			attempts[partNumber]++
+			attempt := attempts[partNumber]
+			mu.Unlock()
+			if partNumber == totalBlocks && attempt == 1 {
+				// finish after the other blocks, so nothing is left to claim
+				time.Sleep(100 * time.Millisecond)
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>InternalError</Code>
+  <Message>We encountered an internal error. Please try again.</Message>
+</Error>`)
+				return
+			}
+			w.Header().Set("Etag", fmt.Sprintf(`"etag-%d"`, partNumber))
+			w.Header().Set("X-Amz-Checksum-Sha256", checksum.Base64EncodeStr(checksum.Sha256(body)))
+		case "POST":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CompleteMultipartUploadResult>
+  <Location>http://test-bucket/test-key</Location>
+</CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Init(ctx))
+	taskRepo := repository.NewTaskRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	uploadBlockRepo := repository.NewUploadBlockRepository(db)
+	uploadId := createTestUpload(t, db, []byte("0123456789abcdefghijklmnopqrstuv"), blockSize)
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+	opts := backend.UploadOptions{AutoJobs: true, MinJobs: 2, MaxJobs: 2}
+	err = awsBackend.UploadResource(ctx, taskRepo, uploadRepo, uploadBlockRepo, opts, uploadId)
+	assert.NoError(t, err)
+
+	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.UPLOAD_STATUS_COMPLETED, upload.Status)
+	assert.Equal(t, 2, attempts[totalBlocks])
+}
+
+func TestUploadResourcePartNumbers(t *testing.T) {
+	const blockSize = 8
+	ctx := context.Background()
+	content := []byte("0123456789abcdefghijklmnopqrstuv")
+
+	var mu sync.Mutex
+	var uploaded []int
+	var completeBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.Method {
+		case "GET":
+			// the first two parts were uploaded by a previous run
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListPartsResult>
+  <IsTruncated>false</IsTruncated>
+  <Part><PartNumber>1</PartNumber><Size>8</Size><ETag>"etag-1"</ETag><ChecksumSHA256>%s</ChecksumSHA256></Part>
+  <Part><PartNumber>2</PartNumber><Size>8</Size><ETag>"etag-2"</ETag><ChecksumSHA256>%s</ChecksumSHA256></Part>
+</ListPartsResult>`,
+				checksum.Base64EncodeStr(checksum.Sha256(content[0:8])),
+				checksum.Base64EncodeStr(checksum.Sha256(content[8:16])))
+		case "PUT":
+			partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+			assert.NoError(t, err)
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			mu.Lock()
+			uploaded = append(uploaded, partNumber)
+			mu.Unlock()
+			w.Header().Set("Etag", fmt.Sprintf(`"etag-%d"`, partNumber))
+			w.Header().Set("X-Amz-Checksum-Sha256", checksum.Base64EncodeStr(checksum.Sha256(body)))
+		case "POST":
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			completeBody = string(body)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CompleteMultipartUploadResult>
+  <Location>http://test-bucket/test-key</Location>
+</CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Init(ctx))
+	taskRepo := repository.NewTaskRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	uploadBlockRepo := repository.NewUploadBlockRepository(db)
+	// blocks of another upload take the first block ids
+	otherUploadId := createTestUpload(t, db, []byte("other upload"), 4)
+	_, err = uploadBlockRepo.CreateUploadBlocks(ctx, otherUploadId, 12, 4)
+	assert.NoError(t, err)
+	uploadId := createTestUpload(t, db, content, blockSize)
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+	err = awsBackend.UploadResource(ctx, taskRepo, uploadRepo, uploadBlockRepo, backend.UploadOptions{Jobs: 1}, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 4}, uploaded)
+	for i := 1; i <= 4; i++ {
+		assert.Contains(t, completeBody, fmt.Sprintf("<PartNumber>%d</PartNumber>", i))
+	}
+	assert.NotContains(t, completeBody, "<PartNumber>5</PartNumber>")
+}
+
+func TestUploadResourceSkipsCompletedUpload(t *testing.T) {
+	ctx := context.Background()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// S3 answers NoSuchUpload for a completed multipart upload
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Init(ctx))
+	taskRepo := repository.NewTaskRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	uploadBlockRepo := repository.NewUploadBlockRepository(db)
+	uploadId := createTestUpload(t, db, []byte("0123456789abcdef"), 8)
+	assert.NoError(t, uploadRepo.MarkComplete(ctx, uploadId, "http://test-bucket/test-key"))
+
+	awsBackend := &AwsBackend{
+		client:     server.Client(),
+		bucketName: "test-bucket",
+		region:     "us-east-1",
+		protocol:   "http://",
+		host:       server.Listener.Addr().String(),
+	}
+	err = awsBackend.UploadResource(ctx, taskRepo, uploadRepo, uploadBlockRepo, backend.UploadOptions{Jobs: 1}, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requests)
+	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.UPLOAD_STATUS_COMPLETED, upload.Status)
+}
+
+// creates a task and an upload of "content" in "db", returns the upload id
+func createTestUpload(t *testing.T, db *database.DB, content []byte, blockSize int64) int64 {
+	ctx := context.Background()
+	archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+	assert.NoError(t, os.WriteFile(archivePath, content, 0644))
+	taskId, err := repository.NewTaskRepository(db).CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: archivePath})
+	assert.NoError(t, err)
+	metadata, err := json.Marshal(CreateMultipartUploadResult{UploadId: "test-upload-id"})
+	assert.NoError(t, err)
+	size := int64(len(content))
+	uploadId, err := repository.NewUploadRepository(db).CreateUpload(ctx, taskId, string(metadata),
+		STORAGE_BACKEND_METADATA_SCHEMA_VERSION, archivePath, size, time.Now(), "sample-hash",
+		(size+blockSize-1)/blockSize, blockSize, time.Now(), time.Now())
+	assert.NoError(t, err)
+	return uploadId
 }
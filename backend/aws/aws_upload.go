@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"glesha/backend"
 	"glesha/checksum"
 	"glesha/database/model"
 	"glesha/database/repository"
@@ -14,6 +15,7 @@ import (
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type CreateMultipartUploadResult struct {
@@ -23,6 +25,12 @@ type CreateMultipartUploadResult struct {
 	AwsChecksumAlgorithm    string `json:"aws_checksum_algorithm"`
 	AwsChecksumType         string `json:"aws_checksum_type"`
 	AwsServerSideEncryption string `json:"aws_server_side_encryption"`
+	// empty for uploads created by older versions
+	StorageClass string `json:"storage_class,omitempty"`
+	// object lock requested for the uploaded object, see config.AwsObjectLock
+	ObjectLockMode        string `json:"object_lock_mode,omitempty"`
+	ObjectLockRetainUntil string `json:"object_lock_retain_until,omitempty"`
+	ObjectLockLegalHold   bool   `json:"object_lock_legal_hold,omitempty"`
 }
 
 func (aws *AwsBackend) createS3Bucket(ctx context.Context) error {
@@ -111,6 +119,7 @@ func (aws *AwsBackend) createMultipartUpload(
 	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
 	req.Header.Set("x-amz-checksum-algorithm", "SHA256")
 	req.Header.Set("x-amz-checksum-type", "COMPOSITE")
+	objectLockRetainUntil := aws.setObjectLockHeaders(req, time.Now())
 
 	err = aws.signRequest(req, AWS_UNSIGNED_PAYLOAD)
 
@@ -153,6 +162,9 @@ func (aws *AwsBackend) createMultipartUpload(
 		if awsError.Code == "BucketRegionError" && resp.StatusCode == 409 {
 			return nil, fmt.Errorf("aws: bucket %s is in different region", aws.bucketName)
 		}
+		if awsError.Code == "InvalidRequest" && aws.objectLock != nil {
+			return nil, fmt.Errorf("aws: could not apply object_lock to bucket %s: %s", aws.bucketName, awsError.Message)
+		}
 		return nil, fmt.Errorf("aws: unknown error: %s", awsError.Message)
 	}
 	type UploadResp struct {
@@ -173,9 +185,39 @@ func (aws *AwsBackend) createMultipartUpload(
 		AwsChecksumAlgorithm:    resp.Header.Get("x-amz-checksum-algorithm"),
 		AwsChecksumType:         resp.Header.Get("x-amz-checksum-type"),
 		AwsServerSideEncryption: resp.Header.Get("x-amz-server-side-encryption"),
+		StorageClass:            aws.storageClass,
+		ObjectLockMode:          req.Header.Get("x-amz-object-lock-mode"),
+		ObjectLockRetainUntil:   objectLockRetainUntil,
+		ObjectLockLegalHold:     aws.objectLock != nil && aws.objectLock.LegalHold,
 	}, nil
 }
 
+// sets the object lock headers from config on "req" and returns the
+// retain until date, empty if objects are not retained
+func (aws *AwsBackend) setObjectLockHeaders(req *http.Request, now time.Time) string {
+	if aws.objectLock == nil {
+		return ""
+	}
+	retainUntilStr := ""
+	if len(aws.objectLock.Mode) > 0 {
+		retainUntil := now.UTC().AddDate(0, 0, int(aws.objectLock.RetainDays))
+		retainUntilStr = retainUntil.Format(time.RFC3339)
+		req.Header.Set("x-amz-object-lock-mode", aws.objectLock.Mode)
+		req.Header.Set("x-amz-object-lock-retain-until-date", retainUntilStr)
+	}
+	if aws.objectLock.LegalHold {
+		req.Header.Set("x-amz-object-lock-legal-hold", "ON")
+	}
+	return retainUntilStr
+}
+
+// returns the S3 part number of block "b" of "upload", 1 for its first
+// block. block ids are unique across all uploads, and recreating blocks
+// gives them new ids, so they would soon exceed AWS_MAX_PARTS
+func partNumber(upload *model.Upload, b *model.UploadBlock) int64 {
+	return b.FileOffset/upload.BlockSizeInBytes + 1
+}
+
 func (aws *AwsBackend) uploadBlock(
 	ctx context.Context,
 	uploadBlockRepo repository.UploadBlockRepository,
@@ -186,6 +228,8 @@ func (aws *AwsBackend) uploadBlock(
 	workerId int,
 	progress *sync.Map,
 	totalSent *atomic.Uint64,
+	uploadProgress *backend.UploadProgress,
+	cc *backend.ConcurrencyController,
 ) error {
 
 	L.Debug(fmt.Sprintf("Uploading block %d using worker %d", blockId, workerId))
@@ -195,6 +239,11 @@ func (aws *AwsBackend) uploadBlock(
 		return fmt.Errorf("could not find block with id %d for upload id %d:%w", blockId, upload.Id, err)
 	}
 
+	err = uploadBlockRepo.MarkStarted(ctx, upload.Id, blockId, workerId)
+	if err != nil {
+		return err
+	}
+
 	var blockContent = make([]byte, ub.Size)
 	readCnt, err := file_io.ReadFromOffset(ctx, upload.FilePath, ub.FileOffset, blockContent)
 
@@ -210,7 +259,7 @@ func (aws *AwsBackend) uploadBlock(
 			aws.protocol,
 			aws.host,
 			taskKey,
-			blockId,
+			partNumber(upload, ub),
 			awsUploadRes.UploadId,
 		)
 
@@ -221,11 +270,13 @@ func (aws *AwsBackend) uploadBlock(
 				// process the progress update
 				val, _ := progress.LoadOrStore(workerId, int64(0))
 				totalSent.Add(uint64(delta))
+				uploadProgress.Add(delta)
 				progress.Store(workerId, val.(int64)+delta)
+				cc.AddBytes(workerId, delta)
 				p = float64(totalSent.Load()) * 100.0 / float64(upload.FileSize)
 
 				// print progress line
-				workerProgress := aws.getProgressLine(progress)
+				workerProgress := aws.getProgressLine(progress, cc)
 				if L.IsVerbose() {
 					L.Debug(fmt.Sprintf("[w%d|b%d] sent %d/%d bytes", workerId, blockId, val.(int64)+delta, ub.Size))
 				}
@@ -300,11 +351,6 @@ func (aws *AwsBackend) uploadBlock(
 			if awsError.Code == "BucketRegionError" && resp.StatusCode == 409 {
 				return fmt.Errorf("aws: bucket %s is in different region", aws.bucketName)
 			}
-
-			_, err = uploadBlockRepo.MarkError(ctx, upload.Id, blockId, awsError.Message)
-			if err != nil {
-				return fmt.Errorf("aws: could not mark upload as failed for block id %d of upload id %d: %w", blockId, ub.UploadId, err)
-			}
 			return fmt.Errorf("aws: unknown error: %s", awsError.Message)
 		}
 		etag := resp.Header.Get("Etag")
@@ -360,7 +406,7 @@ func (aws *AwsBackend) completeMultipartUpload(
 		p.Parts = append(
 			p.Parts,
 			CompletedPart{
-				PartNumber:     b.Id,
+				PartNumber:     partNumber(upload, &b),
 				ETag:           b.Etag,
 				ChecksumSHA256: b.Checksum,
 			})
@@ -422,6 +468,9 @@ func (aws *AwsBackend) completeMultipartUpload(
 	var awsError AwsError
 	err = xml.Unmarshal(bodyBytes, &awsError)
 	if err == nil {
+		if awsError.Code == "NoSuchUpload" && resp.StatusCode == 404 {
+			return errNoSuchUpload
+		}
 		if awsError.Code == "RequestTimeTooSkewed" && resp.StatusCode == 400 {
 			return fmt.Errorf("aws: system clock is off by > 15 minutes, please sync system time with NTP")
 		}
@@ -463,3 +512,56 @@ func (aws *AwsBackend) completeMultipartUpload(
 
 	return nil
 }
+
+// aborts multipart upload "uploadId", S3 discards all parts uploaded to it.
+// aborting an upload that does not exist anymore is not an error
+func (aws *AwsBackend) abortMultipartUpload(
+	ctx context.Context,
+	taskKey string,
+	uploadId string,
+) error {
+	// aws::AbortMultipartUpload request
+	url := fmt.Sprintf("%s%s/%s?uploadId=%s",
+		aws.protocol,
+		aws.host,
+		taskKey,
+		uploadId,
+	)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("could not create aws::AbortMultipartUpload request: %w", err)
+	}
+	req.Header.Set("Host", aws.host)
+	req.Header.Set("x-amz-expected-bucket-owner", fmt.Sprintf("%d", aws.accountId))
+	payloadHash := checksum.HexEncodeStr(checksum.Sha256([]byte{}))
+	err = aws.signRequest(req, payloadHash)
+	if err != nil {
+		return fmt.Errorf("could not sign aws::AbortMultipartUpload request: %w", err)
+	}
+	resp, err := aws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	L.Debug(L.HttpResponseString(resp))
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response body of aws::AbortMultipartUpload request")
+	}
+	var awsError AwsError
+	err = xml.Unmarshal(bodyBytes, &awsError)
+	if err == nil {
+		if awsError.Code == "NoSuchUpload" && resp.StatusCode == 404 {
+			L.Debug(fmt.Sprintf("aws: multipart upload %s does not exist, nothing to abort", uploadId))
+			return nil
+		}
+		if awsError.Code == "AccessDenied" && resp.StatusCode == 403 {
+			return fmt.Errorf("aws: user lacks s3:AbortMultipartUpload permission")
+		}
+		return fmt.Errorf("aws: unknown error: %s", awsError.Message)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("aws: AbortMultipartUpload failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
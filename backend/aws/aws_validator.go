@@ -2,6 +2,7 @@ package aws
 
 import (
 	"fmt"
+	"glesha/config"
 	"regexp"
 	"slices"
 	"strings"
@@ -9,6 +10,23 @@ import (
 
 type AwsValidator struct{}
 
+// validates every key of "cfg", returning the first error
+func (a *AwsValidator) Validate(cfg *config.Aws) error {
+	if err := a.ValidateBucketName(cfg.BucketName); err != nil {
+		return err
+	}
+	if err := a.ValidateRegion(cfg.Region); err != nil {
+		return err
+	}
+	if err := a.ValidateStorageClass(cfg.StorageClass); err != nil {
+		return err
+	}
+	if err := a.ValidateAccountId(cfg.AccountId); err != nil {
+		return err
+	}
+	return a.ValidateObjectLock(cfg.ObjectLock)
+}
+
 func (a *AwsValidator) ValidateRegion(region string) error {
 	// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CreateBucket.html#AmazonS3-CreateBucket-request-LocationConstraint
 	regions := []string{"af-south-1",
@@ -136,3 +154,29 @@ func (a *AwsValidator) ValidateAccountId(id uint64) error {
 	}
 	return nil
 }
+
+// object lock modes: https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-lock.html
+const (
+	AWS_OBJECT_LOCK_GOVERNANCE = "GOVERNANCE"
+	AWS_OBJECT_LOCK_COMPLIANCE = "COMPLIANCE"
+)
+
+func (a *AwsValidator) ValidateObjectLock(objectLock *config.AwsObjectLock) error {
+	if objectLock == nil {
+		return nil
+	}
+	if len(objectLock.Mode) == 0 {
+		if objectLock.RetainDays != 0 {
+			return fmt.Errorf("aws: object_lock.retain_days needs object_lock.mode")
+		}
+		return nil
+	}
+	if objectLock.Mode != AWS_OBJECT_LOCK_GOVERNANCE && objectLock.Mode != AWS_OBJECT_LOCK_COMPLIANCE {
+		return fmt.Errorf("aws: invalid object_lock.mode %s, expected %s or %s",
+			objectLock.Mode, AWS_OBJECT_LOCK_GOVERNANCE, AWS_OBJECT_LOCK_COMPLIANCE)
+	}
+	if objectLock.RetainDays <= 0 {
+		return fmt.Errorf("aws: object_lock.retain_days must be positive when object_lock.mode is set")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"glesha/config"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -86,3 +87,32 @@ func TestAwsValidator_ValidateAccountId(t *testing.T) {
 		}
 	})
 }
+
+func TestAwsValidator_ValidateObjectLock(t *testing.T) {
+	validator := AwsValidator{}
+
+	t.Run("Valid", func(t *testing.T) {
+		valid := []*config.AwsObjectLock{
+			nil,
+			{},
+			{LegalHold: true},
+			{Mode: AWS_OBJECT_LOCK_GOVERNANCE, RetainDays: 30},
+			{Mode: AWS_OBJECT_LOCK_COMPLIANCE, RetainDays: 180, LegalHold: true},
+		}
+		for _, ol := range valid {
+			assert.NoError(t, validator.ValidateObjectLock(ol), "Expected object lock %+v to be valid", ol)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		invalid := []*config.AwsObjectLock{
+			{RetainDays: 30},
+			{Mode: "governance", RetainDays: 30},
+			{Mode: AWS_OBJECT_LOCK_COMPLIANCE},
+			{Mode: AWS_OBJECT_LOCK_GOVERNANCE, RetainDays: -1},
+		}
+		for _, ol := range invalid {
+			assert.Error(t, validator.ValidateObjectLock(ol), "Expected object lock %+v to be invalid", ol)
+		}
+	})
+}
@@ -3,52 +3,63 @@ package aws
 import (
 	"context"
 	"fmt"
+	"glesha/backend"
 	L "glesha/logger"
 	"strings"
 	"sync"
 )
 
-func (aws *AwsBackend) getProgressLine(progress *sync.Map) string {
+func (aws *AwsBackend) getProgressLine(progress *sync.Map, cc *backend.ConcurrencyController) string {
 	// progress[workerId] -> sentBytes int64
-	// progress["maxConcurrentJobs"] -> jobs int
 	var sb strings.Builder
-	cnt := 0
-	maxJobsVal, ok := progress.Load("maxConcurrentJobs")
-	maxConcurrentJobs := 1
-	if ok {
-		maxConcurrentJobs = maxJobsVal.(int)
-	}
-	for id := 1; id <= maxConcurrentJobs; id++ {
+	activeJobs := cc.Target()
+	for id := 1; id <= activeJobs; id++ {
 		val, ok := progress.Load(id)
 		p := uint64(0)
 		if ok {
 			p = uint64(val.(int64))
 		}
-		sb.WriteString(fmt.Sprintf("[CN%d: %s]",
+		sb.WriteString(fmt.Sprintf("[CN%d: %s %s/s]",
 			id,
 			L.HumanReadableBytes(p, 1),
+			L.HumanReadableBytes(uint64(cc.WorkerRate(id)), 1),
 		))
-		if id != maxConcurrentJobs {
+		if id != activeJobs {
 			sb.WriteString(" ")
 		}
-		cnt++
 	}
 	return sb.String()
 }
 
+// storage cost in USD per GB-month, for us-east-1
+var awsPricePerGBMonth = map[AwsStorageClass]float64{
+	AWS_SC_STANDARD:            0.023,
+	AWS_SC_INTELLIGENT_TIERING: 0.023,
+	AWS_SC_STANDARD_IA:         0.0125,
+	AWS_SC_ONEZONE_IA:          0.01,
+	AWS_SC_GLACIER_IR:          0.004,
+	AWS_SC_GLACIER:             0.00099,
+	AWS_SC_DEEP_ARCHIVE:        0.00099,
+}
+
+// objects deleted before this many days are charged as if stored for this long
+// https://aws.amazon.com/s3/pricing/
+var awsMinStorageDays = map[AwsStorageClass]int64{
+	AWS_SC_STANDARD_IA:  30,
+	AWS_SC_ONEZONE_IA:   30,
+	AWS_SC_GLACIER_IR:   90,
+	AWS_SC_GLACIER:      90,
+	AWS_SC_DEEP_ARCHIVE: 180,
+}
+
 func EstimateCost(ctx context.Context, size uint64, currency string) (map[AwsStorageClass]float64, error) {
 	exchangeRate, err := getExchangeRate(ctx, "USD", currency)
 	if err != nil {
 		return nil, err
 	}
-	awsPricingByStorageClass := map[AwsStorageClass]float64{
-		AWS_SC_STANDARD:            exchangeRate * 12 * float64(size) * float64(0.023) * float64(1e-9),
-		AWS_SC_INTELLIGENT_TIERING: exchangeRate * 12 * float64(size) * float64(0.023) * float64(1e-9),
-		AWS_SC_STANDARD_IA:         exchangeRate * 12 * float64(size) * float64(0.0125) * float64(1e-9),
-		AWS_SC_ONEZONE_IA:          exchangeRate * 12 * float64(size) * float64(0.01) * float64(1e-9),
-		AWS_SC_GLACIER_IR:          exchangeRate * 12 * float64(size) * float64(0.004) * float64(1e-9),
-		AWS_SC_GLACIER:             exchangeRate * 12 * float64(size) * float64(0.00099) * float64(1e-9),
-		AWS_SC_DEEP_ARCHIVE:        exchangeRate * 12 * float64(size) * float64(0.00099) * float64(1e-9),
+	awsPricingByStorageClass := make(map[AwsStorageClass]float64)
+	for storageClass, price := range awsPricePerGBMonth {
+		awsPricingByStorageClass[storageClass] = exchangeRate * 12 * float64(size) * price * float64(1e-9)
 	}
 	return awsPricingByStorageClass, nil
 }
@@ -90,22 +101,28 @@ func renderEstimatedCost(
 	return sb.String()
 }
 
-func (aws *AwsBackend) getOptimalBlockSizeForSize(sizeInBytes int64) int64 {
-	const MB int64 = 1024 * 1024
-	const GB int64 = 1024 * MB
-	if sizeInBytes <= 20*MB {
-		return 10 * MB
+func (aws *AwsBackend) getOptimalBlockSizeForSize(sizeInBytes int64) (int64, error) {
+	if sizeInBytes > AWS_MAX_OBJECT_SIZE {
+		return -1, fmt.Errorf("aws: %s exceeds the maximum object size of %s",
+			L.HumanReadableBytes(uint64(sizeInBytes), 2),
+			L.HumanReadableBytes(uint64(AWS_MAX_OBJECT_SIZE), 0))
+	}
+	// smaller archives use fixed block sizes, so that a failed block
+	// is cheap to retry
+	if sizeInBytes <= 20*MiB {
+		return 10 * MiB, nil
 	}
-	if sizeInBytes <= 5*GB {
-		return 30 * MB
+	if sizeInBytes <= 5*GiB {
+		return 30 * MiB, nil
 	}
-	if sizeInBytes <= 20*GB {
-		return 50 * MB
+	if sizeInBytes <= 20*GiB {
+		return 50 * MiB, nil
 	}
-	// TODO: tweak these parameters for costs/efficiency etc after profiling
-	// since 1e4 is the max limit for number of parts
-	// max upload size for a single file is limited to 1.5 TB for now
-	return 150 * MB
+	// larger archives use the smallest MiB aligned block size that keeps
+	// the number of parts within AWS_MAX_PARTS
+	blockSize := max(150*MiB, (sizeInBytes+AWS_MAX_PARTS-1)/AWS_MAX_PARTS)
+	blockSize = ((blockSize + MiB - 1) / MiB) * MiB
+	return min(blockSize, AWS_MAX_PART_SIZE), nil
 }
 
 func getExchangeRate(_ context.Context, c1 string, c2 string) (float64, error) {
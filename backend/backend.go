@@ -2,9 +2,54 @@ package backend
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"glesha/database/repository"
+	"io"
+	"strings"
+	"time"
 )
 
+// returned when deleting a resource that is protected by a ResourceLock
+var ErrResourceLocked = errors.New("resource is locked")
+
+// returned when reading a resource that has to be restored from archival
+// storage first
+var ErrResourceArchived = errors.New("resource is in archival storage")
+
+// ResourceLock protects an uploaded resource from being deleted
+type ResourceLock struct {
+	// retention mode set by the storage provider, empty if there is no retention
+	Mode        string
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+// returns true if the resource can not be deleted at "now"
+func (l *ResourceLock) IsLocked(now time.Time) bool {
+	if l == nil {
+		return false
+	}
+	return l.LegalHold || (len(l.Mode) > 0 && now.Before(l.RetainUntil))
+}
+
+func (l *ResourceLock) String() string {
+	if l == nil {
+		return "not locked"
+	}
+	var reasons []string
+	if len(l.Mode) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%s retention until %s", l.Mode, l.RetainUntil.Local().Format(time.DateTime)))
+	}
+	if l.LegalHold {
+		reasons = append(reasons, "legal hold")
+	}
+	if len(reasons) == 0 {
+		return "not locked"
+	}
+	return strings.Join(reasons, " and ")
+}
+
 type StorageMetadata struct {
 	Json          string
 	SchemaVersion int64
@@ -14,9 +59,36 @@ type CreateUploadResult struct {
 	BlockSizeInBytes int64
 }
 
+// DeletionEstimate describes what deleting an uploaded resource costs
+type DeletionEstimate struct {
+	StorageClass string
+	// storage providers charge for at least this long, even if a
+	// resource is deleted earlier
+	MinStorageDuration time.Duration
+	// how much of MinStorageDuration is left, 0 if it has passed
+	RemainingMinDuration time.Duration
+	// charged for RemainingMinDuration when deleting now
+	EarlyDeletionCost float64
+	// storage cost saved every month by deleting
+	MonthlyCost float64
+	Currency    string
+}
+
 type StorageBackend interface {
 	CreateResourceContainer(ctx context.Context) error
 
+	// returns an id of the container resources are uploaded to, resources
+	// shared between tasks are tracked per container
+	GetResourceContainerId() string
+
+	// uploads a small file as resource "key" in a single request, used
+	// for packs of the repo archive format
+	PutResource(ctx context.Context, key string, resourceFilePath string) error
+
+	// permanently deletes resource "key" uploaded by PutResource, fails
+	// with ErrResourceLocked without deleting anything if it is locked
+	DeleteResourceByKey(ctx context.Context, key string) error
+
 	CreateUploadResource(
 		ctx context.Context,
 		taskKey string,
@@ -28,10 +100,53 @@ type StorageBackend interface {
 		taskRepo repository.TaskRepository,
 		uploadRepository repository.UploadRepository,
 		uploadBlockRepository repository.UploadBlockRepository,
-		maxConcurrentJobs int,
+		opts UploadOptions,
 		uploadId int64,
 	) error
 
+	// discards an upload resource created by CreateUploadResource along
+	// with everything uploaded to it so far
+	AbortUploadResource(
+		ctx context.Context,
+		taskKey string,
+		metadata StorageMetadata,
+	) error
+
+	// returns the lock of a resource uploaded by UploadResource, or nil
+	// if it does not exist or is not locked
+	GetResourceLock(
+		ctx context.Context,
+		taskKey string,
+		metadata StorageMetadata,
+	) (*ResourceLock, error)
+
+	// permanently deletes a resource uploaded by UploadResource, fails
+	// with ErrResourceLocked without deleting anything if it is locked
+	DeleteResource(
+		ctx context.Context,
+		taskKey string,
+		metadata StorageMetadata,
+	) error
+
+	// estimates what deleting a resource of "sizeInBytes" that was
+	// uploaded at "uploadedAt" costs at "now"
+	EstimateDeletion(
+		ctx context.Context,
+		metadata StorageMetadata,
+		sizeInBytes int64,
+		uploadedAt time.Time,
+		now time.Time,
+	) (*DeletionEstimate, error)
+
+	// returns the key of a resource uploaded by UploadResource, which
+	// GetResourceRange reads it with
+	GetUploadResourceKey(taskKey string, metadata StorageMetadata) (string, error)
+
+	// reads bytes [start, end) of resource "key", or from "start" to its
+	// end if "end" is -1. resources in archival storage classes can not
+	// be read until they are restored, this fails with ErrResourceArchived
+	GetResourceRange(ctx context.Context, key string, start int64, end int64) (io.ReadCloser, error)
+
 	IsBlockSizeOK(blockSize int64, fileSize int64) error
 }
 
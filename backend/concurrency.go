@@ -0,0 +1,198 @@
+package backend
+
+import (
+	"context"
+	"glesha/control"
+	"sync"
+	"time"
+)
+
+// UploadOptions controls how many workers UploadResource uses
+type UploadOptions struct {
+	// fixed number of workers, ignored when AutoJobs is set
+	Jobs int
+	// scale workers between MinJobs and MaxJobs based on measured
+	// throughput and error rate
+	AutoJobs bool
+	MinJobs  int
+	MaxJobs  int
+	// when paused, workers stop picking up new blocks after finishing
+	// the current one, nil means uploads are never paused
+	Gate *control.Gate
+	// shared by uploads running at the same time, nil means no limit
+	Budget *WorkerBudget
+	// updated as blocks are sent, nil means progress is only logged
+	Progress *UploadProgress
+}
+
+// WorkerBudget limits the total number of blocks being uploaded at once
+// across all uploads sharing it. a nil *WorkerBudget never blocks
+type WorkerBudget struct {
+	slots chan struct{}
+}
+
+func NewWorkerBudget(size int) *WorkerBudget {
+	return &WorkerBudget{slots: make(chan struct{}, max(size, 1))}
+}
+
+// blocks until a slot is free or ctx is done
+func (wb *WorkerBudget) Acquire(ctx context.Context) error {
+	if wb == nil {
+		return ctx.Err()
+	}
+	select {
+	case wb.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (wb *WorkerBudget) Release() {
+	if wb == nil {
+		return
+	}
+	<-wb.slots
+}
+
+const (
+	// how often adaptive concurrency re-evaluates the number of workers
+	CONCURRENCY_SAMPLE_WINDOW = 5 * time.Second
+	// scale down aggressively when more than 20% of blocks fail in a window
+	CONCURRENCY_MAX_ERROR_RATE = 0.2
+	// throughput must improve by at least 5% to keep adding workers
+	CONCURRENCY_SCALE_UP_RATIO = 1.05
+	// throughput dropping by more than 10% means the last worker hurt
+	CONCURRENCY_SCALE_DOWN_RATIO = 0.9
+)
+
+// ConcurrencyController decides how many upload workers are allowed to run.
+// In fixed mode it always allows UploadOptions.Jobs workers, in auto mode
+// it measures per-worker throughput and errors and scales workers up or down
+// between UploadOptions.MinJobs and UploadOptions.MaxJobs
+type ConcurrencyController struct {
+	mu           sync.Mutex
+	auto         bool
+	minJobs      int
+	maxJobs      int
+	target       int
+	windowStart  time.Time
+	windowBytes  map[int]int64
+	windowBlocks int
+	windowErrors int
+	workerRates  map[int]float64
+	lastRate     float64
+}
+
+func NewConcurrencyController(opts UploadOptions, now time.Time) *ConcurrencyController {
+	cc := &ConcurrencyController{
+		auto:        opts.AutoJobs,
+		windowStart: now,
+		windowBytes: map[int]int64{},
+		workerRates: map[int]float64{},
+	}
+	if !opts.AutoJobs {
+		jobs := max(opts.Jobs, 1)
+		cc.minJobs, cc.maxJobs, cc.target = jobs, jobs, jobs
+		return cc
+	}
+	cc.minJobs = max(opts.MinJobs, 1)
+	cc.maxJobs = max(opts.MaxJobs, cc.minJobs)
+	cc.target = cc.minJobs
+	return cc
+}
+
+func (cc *ConcurrencyController) IsAuto() bool {
+	return cc.auto
+}
+
+// returns the number of workers that should be spawned, workers with
+// workerId > Target() stay idle until the controller scales up
+func (cc *ConcurrencyController) MaxWorkers() int {
+	return cc.maxJobs
+}
+
+func (cc *ConcurrencyController) Target() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.target
+}
+
+// blocks until worker "workerId" (1 indexed) is allowed to run
+func (cc *ConcurrencyController) WaitActive(ctx context.Context, workerId int) error {
+	for {
+		if workerId <= cc.Target() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (cc *ConcurrencyController) AddBytes(workerId int, delta int64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.windowBytes[workerId] += delta
+}
+
+func (cc *ConcurrencyController) RecordBlock(workerId int, err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.windowBlocks++
+	if err != nil {
+		cc.windowErrors++
+	}
+}
+
+// returns throughput of worker "workerId" in bytes/sec measured in the last window
+func (cc *ConcurrencyController) WorkerRate(workerId int) float64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.workerRates[workerId]
+}
+
+// closes the current sample window and, in auto mode, scales the number
+// of workers. returns the previous and the new target.
+func (cc *ConcurrencyController) Adjust(now time.Time) (int, int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	prev := cc.target
+	elapsed := now.Sub(cc.windowStart).Seconds()
+	if elapsed <= 0 {
+		return prev, prev
+	}
+	var totalBytes int64
+	for id, b := range cc.windowBytes {
+		cc.workerRates[id] = float64(b) / elapsed
+		totalBytes += b
+	}
+	rate := float64(totalBytes) / elapsed
+	errorRate := 0.0
+	if cc.windowBlocks > 0 {
+		errorRate = float64(cc.windowErrors) / float64(cc.windowBlocks)
+	}
+
+	if cc.auto {
+		switch {
+		case errorRate > CONCURRENCY_MAX_ERROR_RATE:
+			cc.target = max(cc.minJobs, cc.target/2)
+		case totalBytes <= 0:
+			// nothing was sent in this window, no signal to act upon
+		case cc.lastRate == 0 || rate >= cc.lastRate*CONCURRENCY_SCALE_UP_RATIO:
+			cc.target = min(cc.maxJobs, cc.target+1)
+		case rate < cc.lastRate*CONCURRENCY_SCALE_DOWN_RATIO:
+			cc.target = max(cc.minJobs, cc.target-1)
+		}
+	}
+	if totalBytes > 0 {
+		cc.lastRate = rate
+	}
+	cc.windowStart = now
+	cc.windowBytes = map[int]int64{}
+	cc.windowBlocks = 0
+	cc.windowErrors = 0
+	return prev, cc.target
+}
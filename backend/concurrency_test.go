@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyController_Fixed(t *testing.T) {
+	now := time.Now()
+	cc := NewConcurrencyController(UploadOptions{Jobs: 4}, now)
+	assert.False(t, cc.IsAuto())
+	assert.Equal(t, 4, cc.MaxWorkers())
+	assert.Equal(t, 4, cc.Target())
+
+	cc.AddBytes(1, 1000)
+	prev, next := cc.Adjust(now.Add(time.Second))
+	assert.Equal(t, 4, prev)
+	assert.Equal(t, 4, next)
+	assert.Equal(t, float64(1000), cc.WorkerRate(1))
+}
+
+func TestConcurrencyController_Auto(t *testing.T) {
+	now := time.Now()
+	cc := NewConcurrencyController(UploadOptions{AutoJobs: true, MinJobs: 2, MaxJobs: 4}, now)
+	assert.True(t, cc.IsAuto())
+	assert.Equal(t, 4, cc.MaxWorkers())
+	assert.Equal(t, 2, cc.Target())
+
+	t.Run("ScaleUpWhenThroughputImproves", func(t *testing.T) {
+		cc.AddBytes(1, 1000)
+		now = now.Add(time.Second)
+		_, next := cc.Adjust(now)
+		assert.Equal(t, 3, next)
+
+		cc.AddBytes(1, 2000)
+		now = now.Add(time.Second)
+		_, next = cc.Adjust(now)
+		assert.Equal(t, 4, next)
+
+		// capped at MaxJobs
+		cc.AddBytes(1, 4000)
+		now = now.Add(time.Second)
+		_, next = cc.Adjust(now)
+		assert.Equal(t, 4, next)
+	})
+
+	t.Run("ScaleDownWhenThroughputDrops", func(t *testing.T) {
+		cc.AddBytes(1, 1000)
+		now = now.Add(time.Second)
+		_, next := cc.Adjust(now)
+		assert.Equal(t, 3, next)
+	})
+
+	t.Run("HoldWhenIdle", func(t *testing.T) {
+		now = now.Add(time.Second)
+		_, next := cc.Adjust(now)
+		assert.Equal(t, 3, next)
+	})
+
+	t.Run("ScaleDownOnErrors", func(t *testing.T) {
+		cc.AddBytes(1, 1000)
+		cc.RecordBlock(1, nil)
+		cc.RecordBlock(2, errors.New("timeout"))
+		now = now.Add(time.Second)
+		_, next := cc.Adjust(now)
+		assert.Equal(t, 2, next)
+	})
+}
+
+func TestConcurrencyController_WaitActive(t *testing.T) {
+	cc := NewConcurrencyController(UploadOptions{AutoJobs: true, MinJobs: 1, MaxJobs: 2}, time.Now())
+	assert.NoError(t, cc.WaitActive(context.Background(), 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, cc.WaitActive(ctx, 2))
+}
+
+func TestWorkerBudget(t *testing.T) {
+	t.Run("NilBudget", func(t *testing.T) {
+		var wb *WorkerBudget
+		assert.NoError(t, wb.Acquire(context.Background()))
+		wb.Release()
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		wb := NewWorkerBudget(2)
+		assert.NoError(t, wb.Acquire(context.Background()))
+		assert.NoError(t, wb.Acquire(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, wb.Acquire(ctx), context.DeadlineExceeded)
+
+		wb.Release()
+		assert.NoError(t, wb.Acquire(context.Background()))
+	})
+}
@@ -0,0 +1,40 @@
+package backend
+
+import "sync/atomic"
+
+// UploadProgress is updated while a resource is uploaded, so callers in
+// the same process can show progress without polling the database.
+// a nil *UploadProgress is not updated
+type UploadProgress struct {
+	sent  atomic.Int64
+	total atomic.Int64
+}
+
+func NewUploadProgress() *UploadProgress {
+	return &UploadProgress{}
+}
+
+// starts tracking an upload of "total" bytes, "sent" of which were
+// uploaded by previous runs
+func (p *UploadProgress) Start(sent int64, total int64) {
+	if p == nil {
+		return
+	}
+	p.sent.Store(sent)
+	p.total.Store(total)
+}
+
+func (p *UploadProgress) Add(delta int64) {
+	if p == nil {
+		return
+	}
+	p.sent.Add(delta)
+}
+
+// returns bytes sent so far and the total
+func (p *UploadProgress) Get() (int64, int64) {
+	if p == nil {
+		return 0, 0
+	}
+	return p.sent.Load(), p.total.Load()
+}
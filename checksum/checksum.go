@@ -33,3 +33,7 @@ func Base64DecodeStr(input string) ([]byte, error) {
 func NewSha256() hash.Hash {
 	return sha256.New()
 }
+
+func NewMd5() hash.Hash {
+	return md5.New()
+}
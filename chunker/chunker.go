@@ -0,0 +1,146 @@
+package chunker
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// default chunk sizes, chunks are cut at content defined boundaries, so
+// inserting bytes into a file only changes the chunks around the insertion
+const (
+	MIN_SIZE int = 512 * 1024
+	AVG_SIZE int = 1024 * 1024
+	MAX_SIZE int = 8 * 1024 * 1024
+)
+
+// Chunker splits a stream into chunks using FastCDC with normalized
+// chunking, see https://www.usenix.org/conference/atc16/technical-sessions/presentation/xia
+type Chunker struct {
+	r       io.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	// boundaries before avgSize need more zero bits than the ones after
+	// it, which keeps most chunks close to avgSize
+	maskS uint64
+	maskL uint64
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// returns a chunker with the default chunk sizes
+func New(r io.Reader) *Chunker {
+	c, _ := NewWithSizes(r, MIN_SIZE, AVG_SIZE, MAX_SIZE)
+	return c
+}
+
+// returns a chunker with custom chunk sizes, "avgSize" must be a power of 2
+func NewWithSizes(r io.Reader, minSize int, avgSize int, maxSize int) (*Chunker, error) {
+	if minSize <= 0 || minSize >= avgSize || avgSize >= maxSize {
+		return nil, fmt.Errorf("chunker: expected 0 < min < avg < max, got %d %d %d", minSize, avgSize, maxSize)
+	}
+	if avgSize&(avgSize-1) != 0 {
+		return nil, fmt.Errorf("chunker: average size %d is not a power of 2", avgSize)
+	}
+	avgBits := bits.TrailingZeros(uint(avgSize))
+	if avgBits < 3 {
+		return nil, fmt.Errorf("chunker: average size %d is too small", avgSize)
+	}
+	return &Chunker{
+		r:       r,
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   topBits(avgBits + 2),
+		maskL:   topBits(avgBits - 2),
+		buf:     make([]byte, maxSize),
+	}, nil
+}
+
+// the top bits of the fingerprint depend on the last 64 bytes, while the
+// low bits only depend on the last few
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// returns the next chunk, or io.EOF after the last one. the returned
+// slice is only valid until the next call
+func (c *Chunker) Next() ([]byte, error) {
+	err := c.fill()
+	if err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// reads until the buffer holds at least maxSize bytes or the stream ends
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.maxSize {
+		return nil
+	}
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the length of the chunk at the start of "data"
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	n = min(n, c.maxSize)
+	normal := min(n, c.avgSize)
+	var fp uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// random values for each byte, generated with splitmix64 from a fixed
+// seed. changing them moves every chunk boundary, and chunks stored by
+// earlier versions would not be deduplicated anymore
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x676c65736861)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
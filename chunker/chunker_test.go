@@ -0,0 +1,81 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randomBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunkAll(t *testing.T, data []byte) [][]byte {
+	c, err := NewWithSizes(bytes.NewReader(data), 2*1024, 8*1024, 64*1024)
+	assert.NoError(t, err)
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+	return chunks
+}
+
+func TestChunker_Sizes(t *testing.T) {
+	data := randomBytes(1024*1024, 1)
+	chunks := chunkAll(t, data)
+	assert.Greater(t, len(chunks), 1)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 64*1024)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), 2*1024)
+		}
+	}
+	// normalized chunking keeps the average close to avgSize
+	avg := len(data) / len(chunks)
+	assert.InDelta(t, 8*1024, avg, 4*1024)
+}
+
+func TestChunker_InsertionKeepsOtherChunks(t *testing.T) {
+	data := randomBytes(512*1024, 2)
+	modified := append(bytes.Clone(data[:100_000]), []byte("inserted bytes")...)
+	modified = append(modified, data[100_000:]...)
+
+	hashes := make(map[[32]byte]bool)
+	for _, chunk := range chunkAll(t, data) {
+		hashes[sha256.Sum256(chunk)] = true
+	}
+	modifiedChunks := chunkAll(t, modified)
+	changed := 0
+	for _, chunk := range modifiedChunks {
+		if !hashes[sha256.Sum256(chunk)] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 2)
+	assert.Greater(t, len(modifiedChunks), 10)
+}
+
+func TestChunker_Empty(t *testing.T) {
+	c := New(bytes.NewReader(nil))
+	_, err := c.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewWithSizes_Invalid(t *testing.T) {
+	_, err := NewWithSizes(bytes.NewReader(nil), 1024, 3000, 8192)
+	assert.Error(t, err)
+	_, err = NewWithSizes(bytes.NewReader(nil), 4096, 2048, 8192)
+	assert.Error(t, err)
+}
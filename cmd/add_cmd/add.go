@@ -8,25 +8,30 @@ import (
 	"glesha/database"
 	"glesha/database/repository"
 	"glesha/file_io"
+	"glesha/filter"
 	L "glesha/logger"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
 
 type AddCmdEnv struct {
-	InputPath     string
+	InputPaths    []string
 	OutputPath    string
 	ConfigPath    string
 	ConfigDir     string
 	ContentHash   string
 	Verbose       bool
 	AssumeYes     bool
+	Priority      int64
+	HasPriority   bool
 	Provider      config.Provider
 	ArchiveFormat config.ArchiveFormat
 	DB            *database.DB
-	IgnoredDirs   map[string]bool
+	FilterLines   []string
+	Filter        *filter.Filter
 	FilesInfo     *file_io.FilesInfo
 	TaskRepo      repository.TaskRepository
 }
@@ -59,8 +64,8 @@ func Execute(ctx context.Context, args []string) error {
 	defer addCmdEnv.DB.Close(ctx)
 
 	// compute content hash
-	L.Info(fmt.Sprintf("Checking if files are changed in %s", addCmdEnv.InputPath))
-	filesInfo, err := file_io.ComputeFilesInfo(ctx, addCmdEnv.InputPath, addCmdEnv.IgnoredDirs)
+	L.Info(fmt.Sprintf("Checking if files are changed in %s", strings.Join(addCmdEnv.InputPaths, ", ")))
+	filesInfo, err := file_io.ComputeFilesInfo(ctx, addCmdEnv.InputPaths, addCmdEnv.Filter)
 	if err != nil {
 		return err
 	}
@@ -72,7 +77,7 @@ func Execute(ctx context.Context, args []string) error {
 func queueTask(ctx context.Context, taskRepo repository.TaskRepository) error {
 	task, err := taskRepo.FindSimilarTask(
 		ctx,
-		addCmdEnv.InputPath,
+		addCmdEnv.InputPaths,
 		addCmdEnv.Provider,
 		addCmdEnv.FilesInfo,
 		addCmdEnv.ArchiveFormat,
@@ -87,7 +92,7 @@ func queueTask(ctx context.Context, taskRepo repository.TaskRepository) error {
 
 	if err == database.ErrDoesNotExist {
 		taskId, err = addCmdEnv.TaskRepo.CreateTask(ctx,
-			addCmdEnv.InputPath,
+			addCmdEnv.InputPaths,
 			addCmdEnv.OutputPath,
 			addCmdEnv.ConfigPath,
 			addCmdEnv.ArchiveFormat,
@@ -99,10 +104,23 @@ func queueTask(ctx context.Context, taskRepo repository.TaskRepository) error {
 		if err != nil {
 			return err
 		}
+		if len(addCmdEnv.FilterLines) > 0 {
+			err = addCmdEnv.TaskRepo.UpdateTaskFilterPatterns(ctx, taskId, addCmdEnv.FilterLines)
+			if err != nil {
+				return err
+			}
+		}
 		L.Printf("Task created with id: %d\n", taskId)
 	} else {
 		L.Printf("Similar Task already exist with id: %d\n", taskId)
 	}
+	if addCmdEnv.HasPriority {
+		err = addCmdEnv.TaskRepo.UpdateTaskPriority(ctx, taskId, addCmdEnv.Priority)
+		if err != nil {
+			return err
+		}
+		L.Printf("Task %d now has priority: %d\n", taskId, addCmdEnv.Priority)
+	}
 	L.Printf("Use 'glesha run <id>' to run the task.\n")
 	L.Printf("For more information, see 'glesha help add'.\n")
 	return err
@@ -133,6 +151,10 @@ func parseFlags(args []string) error {
 	addCmd.StringVar(archiveFormat, "a", "", "alias to -archive-format")
 	addCmd.StringVar(logLevel, "L", defaultLogLevel, "Set log level: debug info warn error panic")
 	addCmd.BoolVar(&assumeYes, "assume-yes", false, "Assume yes to all yes/no prompts")
+	priority := addCmd.Int64("priority", 0, "Tasks with higher priority run first")
+	var excludes, includes filter.PatternsFlag
+	addCmd.Var(&excludes, "exclude", "Exclude paths matching a gitignore style pattern")
+	addCmd.Var(&includes, "include", "Include paths excluded by other patterns")
 
 	addCmd.Usage = func() {
 		PrintUsage()
@@ -166,17 +188,21 @@ func parseFlags(args []string) error {
 		return fmt.Errorf("PATH not provided. For more information check 'glesha help add'")
 	}
 
-	if nArgs > 1 {
-		return fmt.Errorf("too many arguments. For more information check 'glesha help add'")
-	}
-
-	inputPathArg := addCmd.Arg(0)
-
-	if len(inputPathArg) == 0 {
-		return fmt.Errorf("PATH is not valid")
+	inputPathArgs := make([]string, 0, nArgs)
+	for _, inputPathArg := range addCmd.Args() {
+		if len(inputPathArg) == 0 {
+			return fmt.Errorf("PATH is not valid")
+		}
+		if strings.HasPrefix(inputPathArg, "~/") {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("cannot expand ~ for inputPath: %w", err)
+			}
+			inputPathArg = filepath.Join(homeDir, inputPathArg[2:])
+		}
+		inputPathArgs = append(inputPathArgs, inputPathArg)
 	}
-	inputPath := &inputPathArg
-	inputPathAbs, err := filepath.Abs(inputPathArg)
+	inputPaths, err := file_io.NormalizeInputPaths(inputPathArgs)
 	if err != nil {
 		return err
 	}
@@ -191,22 +217,10 @@ func parseFlags(args []string) error {
 	}
 	outputPath = &outputPathAbs
 
-	if *inputPath == "" {
-		return fmt.Errorf("required arg inputPath is not provided")
-	}
-
 	if *outputPath == "" {
 		return fmt.Errorf("required arg outputPath is not provided")
 	}
 
-	if strings.HasPrefix(*inputPath, "~/") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("cannot expand ~ for inputPath: %w", err)
-		}
-		*inputPath = filepath.Join(homeDir, (*inputPath)[2:])
-	}
-
 	if strings.HasPrefix(*outputPath, "~/") {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -251,10 +265,10 @@ func parseFlags(args []string) error {
 
 	// override config with cli flags
 	if len(*archiveFormat) > 0 {
-		switch config.ArchiveFormat(*archiveFormat) {
-		case config.AF_TARGZ:
-			L.Debug(fmt.Sprintf("Overriding archive format: %v -> %v", configs.ArchiveFormat, config.AF_TARGZ))
-			configs.ArchiveFormat = config.AF_TARGZ
+		switch af := config.ArchiveFormat(*archiveFormat); af {
+		case config.AF_TARGZ, config.AF_REPO:
+			L.Debug(fmt.Sprintf("Overriding archive format: %v -> %v", configs.ArchiveFormat, af))
+			configs.ArchiveFormat = af
 		default:
 			return fmt.Errorf("invalid archive format: %s", *archiveFormat)
 		}
@@ -276,16 +290,37 @@ func parseFlags(args []string) error {
 		return err
 	}
 
+	// patterns from config come first, so flags can override them
+	filterLines := filter.Lines(
+		append(slices.Clone(configs.Exclude), excludes...),
+		append(slices.Clone(configs.Include), includes...),
+	)
+	f, err := filter.New(inputPaths, filterLines, map[string]bool{outputPathAbs: true})
+	if err != nil {
+		return err
+	}
+
+	hasPriority := false
+	addCmd.Visit(func(f *flag.Flag) {
+		if f.Name == "priority" {
+			hasPriority = true
+		}
+	})
+
 	addCmdEnv = &AddCmdEnv{
-		InputPath:     inputPathAbs,
+		InputPaths:    inputPaths,
 		OutputPath:    outputPathAbs,
 		ConfigPath:    configPathAbs,
 		ConfigDir:     configDir,
 		AssumeYes:     assumeYes,
+		Priority:      *priority,
+		HasPriority:   hasPriority,
 		ArchiveFormat: configs.ArchiveFormat,
 		Provider:      configs.Provider,
 		ContentHash:   "",
 		DB:            nil,
+		FilterLines:   filterLines,
+		Filter:        f,
 	}
 	return nil
 }
@@ -4,11 +4,11 @@ import L "glesha/logger"
 
 const usageStr string = `
 USAGE
-glesha add [OPTIONS] PATH
+glesha add [OPTIONS] PATH...
 
 DESCRIPTION
 Queues a glesha task that -
-1. Archives the given directory into the specified archive format
+1. Archives the given directories into the specified archive format
 2. Uploads the generated archive to the specified storage provider
 The task does not start automatically. See 'glesha help run' for details.
 
@@ -25,7 +25,11 @@ Supported values for PROVIDER: aws
 Specifies which archive format to use for archiving.
 This argument, if provided, takes precedence over archive_format
 specified in the CONFIG.
-Supported values for ARCHIVE_FORMAT: targz
+Supported values for ARCHIVE_FORMAT: targz repo
+targz  - a single .tar.gz archive, uploaded in parallel blocks
+repo   - files are split into chunks, which are stored once per bucket in
+         packs. only chunks that are not uploaded yet are uploaded, along
+         with a manifest listing the files of the backup
 
 --output, -o
 Path to directory where archive should be generated
@@ -36,6 +40,24 @@ Path to config.json file
 Default is: ~/.config/glesha/config.json
 Use "glesha help config" for more information on configuring glesha.
 
+--priority <priority>
+Tasks with higher priority are run first by 'glesha run --all-queued'
+and 'glesha daemon'. If a similar task already exists, its priority
+is updated instead.
+Default: 0
+
+--exclude <pattern>
+Skips files and directories matching a gitignore style pattern.
+Can be given more than once, and is added to exclude in the CONFIG.
+Patterns without a '/' match at any depth, e.g. '*.tmp' or 'node_modules/'.
+Patterns with a '/' are relative to PATH, e.g. '/build' or 'docs/*.pdf'.
+'**' matches any number of directories.
+
+--include <pattern>
+Keeps files and directories matching a pattern even if they are excluded,
+same as a pattern starting with '!' in a .gleshaignore file.
+Can be given more than once, and is added to include in the CONFIG.
+
 --log-level, -L <log-level>
 Specify log output level
 Default: debug
@@ -52,6 +74,13 @@ Accepted values: auto, always, never
 
 PATH
 Directory path that should be archived
+When more than one PATH is given, they are archived together by a single
+task. Each PATH is stored in the archive under a directory named after it,
+e.g. Documents/ and Pictures/, with a numeric suffix if names collide.
+A PATH can not be inside another PATH.
+Any .gleshaignore file inside PATH is read like a .gitignore file, and its
+patterns apply to the directory it is in. These take precedence over
+--exclude and --include.
 
 EXAMPLES
 1. Create a targz archive and upload to s3-glacier, assuming
@@ -61,6 +90,15 @@ glesha add -c ~/.config/glesha/aws_config.json ./dir_to_upload
 2. Create a zip archive and upload to google_drive.
 glesha add -a zip -c ~/.config/glesha/gd_config.json ./dir_to_upload
 
+3. Queue a task that runs before tasks with default priority.
+glesha add --priority 10 ./dir_to_upload
+
+4. Back up several directories as a single archive.
+glesha add ~/Documents ~/Pictures /etc
+
+5. Skip logs and build output, but keep important.log.
+glesha add --exclude '*.log' --exclude 'build/' --include important.log ./dir_to_upload
+
 SEE ALSO
 1. glesha help run
 `
@@ -3,8 +3,16 @@ package cmd
 import (
 	"context"
 	"glesha/cmd/add_cmd"
+	"glesha/cmd/daemon_cmd"
+	"glesha/cmd/diff_cmd"
+	"glesha/cmd/find_cmd"
 	"glesha/cmd/help_cmd"
+	"glesha/cmd/mount_cmd"
+	"glesha/cmd/pause_cmd"
+	"glesha/cmd/prune_cmd"
+	"glesha/cmd/resume_cmd"
 	"glesha/cmd/run_cmd"
+	"glesha/cmd/schedule_cmd"
 	"glesha/cmd/tui_cmd"
 	"glesha/cmd/version_cmd"
 	"os"
@@ -28,6 +36,22 @@ func Execute(ctx context.Context, args []string) error {
 		return add_cmd.Execute(ctx, args[2:])
 	case "run":
 		return run_cmd.Execute(ctx, args[2:])
+	case "daemon":
+		return daemon_cmd.Execute(ctx, args[2:])
+	case "schedule":
+		return schedule_cmd.Execute(ctx, args[2:])
+	case "prune":
+		return prune_cmd.Execute(ctx, args[2:])
+	case "find":
+		return find_cmd.Execute(ctx, args[2:])
+	case "diff":
+		return diff_cmd.Execute(ctx, args[2:])
+	case "mount":
+		return mount_cmd.Execute(ctx, args[2:])
+	case "pause":
+		return pause_cmd.Execute(ctx, args[2:])
+	case "resume":
+		return resume_cmd.Execute(ctx, args[2:])
 	case "tui":
 		return tui_cmd.Execute(ctx, args[2:])
 	case "help":
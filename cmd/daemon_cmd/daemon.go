@@ -0,0 +1,113 @@
+package daemon_cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"glesha/database"
+	L "glesha/logger"
+	"glesha/runner"
+	"strings"
+	"time"
+)
+
+func Execute(ctx context.Context, args []string) error {
+	opts, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+
+	// initialize db connection
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	L.Debug(fmt.Sprintf("Found database at: %s", dbPath))
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	L.Info(fmt.Sprintf("Daemon started, looking for tasks to run every %s",
+		L.HumanReadableTime(opts.PollInterval.Milliseconds())))
+	err = runner.NewScheduler(runner.NewRunner(db), opts).Run(ctx)
+	if ctx.Err() != nil {
+		// stopped by a signal, not a failure
+		return nil
+	}
+	return err
+}
+
+func parseFlags(args []string) (runner.SchedulerOptions, error) {
+	const DEFAULT_JOBS = "1"
+	const DEFAULT_MIN_JOBS = 1
+	const DEFAULT_MAX_JOBS = 16
+	const DEFAULT_MAX_TASKS = 1
+	const DEFAULT_RETRIES = 3
+	const DEFAULT_RETRY_BACKOFF = 30 * time.Second
+	const DEFAULT_INTERVAL = time.Minute
+	daemonCmd := flag.NewFlagSet("daemon", flag.ExitOnError)
+	defaultLogLevel := L.GetLogLevel().String()
+	defaultColorMode := L.GetColorMode().String()
+
+	logLevel := daemonCmd.String("log-level", defaultLogLevel, "Set log level: debug info warn error panic")
+	colorMode := daemonCmd.String("color", defaultColorMode, "Set color mode: auto always never")
+
+	jobs := daemonCmd.String("jobs", DEFAULT_JOBS, "Set workers to use for each task, or 'auto'")
+	daemonCmd.StringVar(jobs, "j", DEFAULT_JOBS, "Set workers to use for each task, or 'auto'")
+	minJobs := daemonCmd.Int("min-jobs", DEFAULT_MIN_JOBS, "Set min workers to use with --jobs auto")
+	maxJobs := daemonCmd.Int("max-jobs", DEFAULT_MAX_JOBS, "Set max workers to use with --jobs auto")
+	maxTasks := daemonCmd.Int("max-tasks", DEFAULT_MAX_TASKS, "Set tasks to run at the same time")
+	maxWorkers := daemonCmd.Int("max-workers", 0, "Set upload workers shared by all tasks")
+	retries := daemonCmd.Int("retries", DEFAULT_RETRIES, "Set retries for failed tasks")
+	interval := daemonCmd.Duration("interval", DEFAULT_INTERVAL, "Set how often to look for new tasks")
+	daemonCmd.StringVar(logLevel, "L", defaultLogLevel, "Set log level: debug info warn error panic")
+
+	daemonCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := daemonCmd.Parse(args)
+	if err != nil {
+		return runner.SchedulerOptions{}, err
+	}
+
+	err = L.SetColorModeFromString(*colorMode)
+	if err != nil {
+		return runner.SchedulerOptions{}, fmt.Errorf("could not set color mode to %s: %w", *colorMode, err)
+	}
+	if *colorMode != defaultColorMode {
+		L.Info(fmt.Sprintf("Setting color mode to: %s", strings.ToUpper(*colorMode)))
+	}
+	err = L.SetLevelFromString(*logLevel)
+	if err != nil {
+		return runner.SchedulerOptions{}, err
+	}
+	if *logLevel != defaultLogLevel {
+		L.Info(fmt.Sprintf("Setting log level to: %s", strings.ToUpper(*logLevel)))
+	}
+
+	if daemonCmd.NArg() > 0 {
+		return runner.SchedulerOptions{}, fmt.Errorf("too many arguments. For more information check 'glesha help daemon'")
+	}
+	if *maxTasks < 1 || *maxWorkers < 0 || *retries < 0 || *interval < time.Second {
+		return runner.SchedulerOptions{}, fmt.Errorf("invalid value for --max-tasks, --max-workers, --retries or --interval. For more information check 'glesha help daemon'")
+	}
+	uploadOptions, err := runner.ParseUploadOptions(*jobs, *minJobs, *maxJobs)
+	if err != nil {
+		return runner.SchedulerOptions{}, err
+	}
+	return runner.SchedulerOptions{
+		MaxTasks:          *maxTasks,
+		MaxWorkers:        *maxWorkers,
+		MaxRetries:        *retries,
+		RetryBackoff:      DEFAULT_RETRY_BACKOFF,
+		PollInterval:      *interval,
+		UploadOptions:     uploadOptions,
+		EvaluateSchedules: true,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package daemon_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha daemon [OPTIONS]
+
+DESCRIPTION
+Keeps running in the foreground, and runs glesha tasks as they are queued.
+Tasks that are QUEUED, ARCHIVE_ABORTED, ARCHIVE_COMPLETED or
+UPLOAD_ABORTED are run in order of priority, see 'glesha help add'.
+Failed tasks are retried with increasing delay, tasks that keep failing
+are skipped until the daemon is restarted.
+Due schedules are checked at every interval, and queue tasks for their
+directories, see 'glesha help schedule'.
+
+OPTIONS
+--max-tasks <tasks>
+Maximum number of tasks to run at the same time.
+Default: 1
+
+--max-workers <workers>
+Maximum number of upload workers shared by all running tasks.
+Use 0 to only limit workers of each task with --jobs.
+Default: 0
+
+--retries <retries>
+Number of times a failed task is retried.
+Default: 3
+
+--interval <duration>
+How often to look for newly queued tasks and due schedules, e.g. 30s, 5m, 1h
+Default: 1m
+
+--jobs, -j <jobs>
+Maximum number of upload jobs for each task, or 'auto'.
+See 'glesha help run' for details.
+Default: 1
+
+--min-jobs <jobs>
+Minimum number of jobs to use with '--jobs auto'.
+Default: 1
+
+--max-jobs <jobs>
+Maximum number of jobs to use with '--jobs auto'.
+Default: 16
+
+--log-level, -L <log-level>
+Specify log output level
+Default: debug
+Accepted values (in order of increasing amount of output) -
+debug, info, warn, error, silent
+
+--color <color-mode>
+Specify output color mode.
+Default: auto
+Accepted values: auto, always, never
+
+EXAMPLES
+1. Run up to 2 tasks at the same time, with at most 8 uploads in flight -
+glesha daemon --max-tasks 2 --max-workers 8 -j 4
+
+SEE ALSO
+1. glesha help run
+2. glesha help add
+3. glesha help schedule
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
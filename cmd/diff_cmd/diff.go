@@ -0,0 +1,140 @@
+package diff_cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"glesha/database"
+	L "glesha/logger"
+	"glesha/runner"
+	"strconv"
+	"strings"
+)
+
+type DiffCmdEnv struct {
+	OldTaskId int64
+	// 0 with Live
+	NewTaskId int64
+	Live      bool
+	Summary   bool
+	Json      bool
+}
+
+func Execute(ctx context.Context, args []string) error {
+	env, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+	r := runner.NewRunner(db)
+	var d *runner.CatalogDiff
+	if env.Live {
+		d, err = r.DiffLive(ctx, env.OldTaskId)
+	} else {
+		d, err = r.DiffTasks(ctx, env.OldTaskId, env.NewTaskId)
+	}
+	if err != nil {
+		return err
+	}
+	if env.Json {
+		out, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode diff: %w", err)
+		}
+		L.Println(string(out))
+		return nil
+	}
+	if d.IsEmpty() {
+		L.Println("No changes")
+		return nil
+	}
+	L.Print(renderDiff(d, env.Summary))
+	return nil
+}
+
+func renderDiff(d *runner.CatalogDiff, summary bool) string {
+	var sb strings.Builder
+	if !summary {
+		for _, c := range d.Added {
+			sb.WriteString(fmt.Sprintf("+ %-10s %s\n", L.HumanReadableBytes(uint64(c.New.SizeBytes), 2), c.Path))
+		}
+		for _, c := range d.Removed {
+			sb.WriteString(fmt.Sprintf("- %-10s %s\n", L.HumanReadableBytes(uint64(c.Old.SizeBytes), 2), c.Path))
+		}
+		for _, c := range d.Modified {
+			sb.WriteString(fmt.Sprintf("M %-10s %s\n", signedBytes(c.New.SizeBytes-c.Old.SizeBytes), c.Path))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("%s added (%s), %s removed (%s), %s modified (%s, %s)\n",
+		L.HumanReadableCount(len(d.Added), "file", "files"),
+		L.HumanReadableBytes(uint64(d.AddedBytes), 2),
+		L.HumanReadableCount(len(d.Removed), "file", "files"),
+		L.HumanReadableBytes(uint64(d.RemovedBytes), 2),
+		L.HumanReadableCount(len(d.Modified), "file", "files"),
+		L.HumanReadableBytes(uint64(d.ModifiedBytes), 2),
+		signedBytes(d.ModifiedDeltaBytes)))
+	return sb.String()
+}
+
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + L.HumanReadableBytes(uint64(-n), 2)
+	}
+	return "+" + L.HumanReadableBytes(uint64(n), 2)
+}
+
+func parseFlags(args []string) (*DiffCmdEnv, error) {
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+	live := diffCmd.Bool("live", false, "Compare the task with its input paths as they are now")
+	summary := diffCmd.Bool("summary", false, "Only print totals")
+	asJson := diffCmd.Bool("json", false, "Print the diff as JSON")
+	diffCmd.Usage = func() {
+		PrintUsage()
+	}
+	// task ids may come before the options, e.g. 'glesha diff 4 --live'
+	var ids []string
+	for len(args) > 0 {
+		err := diffCmd.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		if diffCmd.NArg() == 0 {
+			break
+		}
+		ids = append(ids, diffCmd.Arg(0))
+		args = diffCmd.Args()[1:]
+	}
+	env := &DiffCmdEnv{Live: *live, Summary: *summary, Json: *asJson}
+	expected := 2
+	if env.Live {
+		expected = 1
+	}
+	if len(ids) != expected {
+		return nil, fmt.Errorf("expected two task Ids, or one with --live. For more information check 'glesha help diff'")
+	}
+	var err error
+	env.OldTaskId, err = strconv.ParseInt(ids[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid task Id %s: %w", ids[0], err)
+	}
+	if !env.Live {
+		env.NewTaskId, err = strconv.ParseInt(ids[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task Id %s: %w", ids[1], err)
+		}
+	}
+	return env, nil
+}
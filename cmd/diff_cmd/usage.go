@@ -0,0 +1,54 @@
+package diff_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha diff [OPTIONS] <old-task-id> <new-task-id>
+glesha diff [OPTIONS] --live <task-id>
+
+DESCRIPTION
+Lists files added, removed and modified between the archives of two
+tasks, or with --live, between the archive of a task and its input paths
+as they are now, e.g. to see what changed since the last backup before
+uploading a new one.
+
+Files are compared by their path in the archive, size, modification time
+and content hash when both sides have one. With --live, files whose
+modification time changed but not their size are hashed, so files that
+were only touched are not reported. Directories are not compared.
+
+Each file is printed with its size, or for modified files how much it
+grew, followed by totals -
++ added    - removed    M modified
+
+OPTIONS
+--live
+Compare the task with its input paths as they are now, using its filter
+patterns.
+
+--summary
+Only print the totals.
+
+--json
+Print the added, removed and modified files with their catalog entries
+and totals as JSON.
+
+EXAMPLES
+1. See what changed since task 12 was archived -
+glesha diff --live 12
+
+2. Compare two backups of the same directory -
+glesha diff 12 15
+
+SEE ALSO
+1. glesha help find
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -0,0 +1,224 @@
+package find_cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"glesha/backend"
+	"glesha/backend/aws"
+	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/filter"
+	L "glesha/logger"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FindCmdEnv struct {
+	Search *model.CatalogSearch
+	Json   bool
+}
+
+func Execute(ctx context.Context, args []string) error {
+	env, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+	hits, err := repository.NewFileCatalogRepository(db).Search(ctx, env.Search)
+	if err != nil {
+		return err
+	}
+	for i := range hits {
+		hits[i].StorageClass = storageClass(&hits[i])
+	}
+	if env.Json {
+		if hits == nil {
+			hits = []model.CatalogHit{}
+		}
+		out, err := json.MarshalIndent(hits, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode results: %w", err)
+		}
+		L.Println(string(out))
+		return nil
+	}
+	if len(hits) == 0 {
+		L.Println("No matching files found")
+		return nil
+	}
+	L.Print(renderHits(hits))
+	if env.Search.Limit > 0 && len(hits) == env.Search.Limit {
+		L.Printf("Showing the first %s, use --limit to show more\n",
+			L.HumanReadableCount(len(hits), "match", "matches"))
+	}
+	return nil
+}
+
+func renderHits(hits []model.CatalogHit) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-6s %-10s %-14s %-10s %-19s %s\n",
+		"TASK", "UPLOAD", "STORAGE CLASS", "SIZE", "MODIFIED", "PATH"))
+	for _, h := range hits {
+		sb.WriteString(fmt.Sprintf("%-6d %-10s %-14s %-10s %-19s %s\n",
+			h.TaskId,
+			orDash(string(h.UploadStatus)),
+			orDash(h.StorageClass),
+			L.HumanReadableBytes(uint64(h.SizeBytes), 2),
+			h.ModifiedAt.Format(time.DateTime),
+			h.Path))
+	}
+	return sb.String()
+}
+
+// returns the storage class the backend of the task of "h" recorded for
+// its upload, or an empty string if it is not uploaded or did not record one
+func storageClass(h *model.CatalogHit) string {
+	if len(h.StorageMetadataJson) == 0 || h.Provider != config.PROVIDER_AWS {
+		return ""
+	}
+	storageClass, err := aws.GetUploadStorageClass(backend.StorageMetadata{
+		Json:          h.StorageMetadataJson,
+		SchemaVersion: h.StorageMetadataSchemaVersion,
+	})
+	if err != nil {
+		L.Debug(fmt.Sprintf("could not get storage class of task %d: %v", h.TaskId, err))
+		return ""
+	}
+	return storageClass
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+func parseFlags(args []string) (*FindCmdEnv, error) {
+	findCmd := flag.NewFlagSet("find", flag.ExitOnError)
+	isRegex := findCmd.Bool("regex", false, "PATTERN is a regular expression")
+	ignoreCase := findCmd.Bool("ignore-case", false, "Match PATTERN case insensitively")
+	findCmd.BoolVar(ignoreCase, "i", false, "Match PATTERN case insensitively")
+	minSize := findCmd.String("min-size", "", "Only files of at least this size, e.g. 10M")
+	maxSize := findCmd.String("max-size", "", "Only files of at most this size, e.g. 1G")
+	after := findCmd.String("after", "", "Only files modified on or after this date")
+	before := findCmd.String("before", "", "Only files modified before this date")
+	limit := findCmd.Int("limit", 1000, "Maximum number of matches, 0 for all")
+	asJson := findCmd.Bool("json", false, "Print matches as JSON")
+	findCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := findCmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if findCmd.NArg() > 1 {
+		return nil, fmt.Errorf("expected at most one PATTERN. For more information check 'glesha help find'")
+	}
+	if *limit < 0 {
+		return nil, fmt.Errorf("--limit can not be negative")
+	}
+	search := &model.CatalogSearch{MinSize: -1, MaxSize: -1, Limit: *limit}
+	if findCmd.NArg() == 1 {
+		var re *regexp.Regexp
+		if *isRegex {
+			expr := findCmd.Arg(0)
+			if *ignoreCase {
+				expr = "(?i)" + expr
+			}
+			re, err = regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %w", findCmd.Arg(0), err)
+			}
+		} else {
+			re, err = filter.CompileGlob(findCmd.Arg(0), *ignoreCase)
+			if err != nil {
+				return nil, err
+			}
+		}
+		search.Match = re.MatchString
+		search.Substring = filter.RequiredSubstring(re)
+	}
+	if len(*minSize) > 0 {
+		search.MinSize, err = parseSize(*minSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(*maxSize) > 0 {
+		search.MaxSize, err = parseSize(*maxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(*after) > 0 {
+		search.ModifiedAfter, err = parseTime(*after)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(*before) > 0 {
+		search.ModifiedBefore, err = parseTime(*before)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FindCmdEnv{Search: search, Json: *asJson}, nil
+}
+
+// parses sizes like 512, 10K, 1.5G, units are powers of 1024
+func parseSize(s string) (int64, error) {
+	units := map[string]float64{
+		"": 1, "B": 1,
+		"K": 1 << 10, "KB": 1 << 10,
+		"M": 1 << 20, "MB": 1 << 20,
+		"G": 1 << 30, "GB": 1 << 30,
+		"T": 1 << 40, "TB": 1 << 40,
+	}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(upper, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := upper, ""
+	if i >= 0 {
+		num, unit = upper[:i], strings.TrimSpace(upper[i:])
+	}
+	multiplier, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512, 10K, 1.5G", s)
+	}
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512, 10K, 1.5G", s)
+	}
+	return int64(value * multiplier), nil
+}
+
+// parses a local date or date and time
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, time.DateTime, "2006-01-02T15:04:05", time.RFC3339} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected e.g. 2024-01-31 or \"2024-01-31 18:30:00\"", s)
+}
@@ -0,0 +1,73 @@
+package find_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha find [OPTIONS] [PATTERN]
+
+DESCRIPTION
+Searches the archived files of all tasks. For every match, the task it is
+in, the status and storage class of its upload, its size, modification
+time and the path it was archived from are listed, newest task first.
+
+PATTERN is matched against paths as stored in the archive, starting with
+the name of the input directory, e.g. 'photos/2023/beach.jpg' for
+~/photos/2023/beach.jpg. Without PATTERN, all files passing the other
+options are listed.
+
+By default PATTERN is a gitignore style glob. A glob without '/' matches
+names at any depth, e.g. '*.pdf', others match from the start of the
+path, e.g. 'docs/**/taxes/*.pdf'. '*' does not match '/', '**' matches
+any number of directories.
+
+Paths are indexed, so patterns containing at least 3 consecutive literal
+characters, e.g. 'taxes' in '*taxes*.pdf', are found quickly even in
+large catalogs. Other patterns scan the catalogs of all tasks.
+
+OPTIONS
+--regex
+PATTERN is a regular expression instead of a glob, e.g. 'IMG_\d{4}\.jpe?g$'.
+It matches anywhere in the path unless anchored with '^' or '$'.
+
+-i, --ignore-case
+Match PATTERN case insensitively.
+
+--min-size <size>
+--max-size <size>
+Only list files of at least or at most <size>, e.g. 512, 10K, 1.5G.
+Units are powers of 1024.
+
+--after <date>
+--before <date>
+Only list files modified on or after, or before <date>, in local time,
+e.g. 2024-01-31 or "2024-01-31 18:30:00".
+
+--limit <count>
+Stop after <count> matches, 1000 by default, 0 for no limit.
+
+--json
+Print matches as a JSON list. Each match has the catalog entry of the
+file, its source "path", "task_status", "upload_status" and "storage_class".
+
+EXAMPLES
+1. Find a tax return archived by any backup -
+glesha find -i '*tax*2023*.pdf'
+
+2. Find large videos modified last year -
+glesha find --min-size 1G --after 2024-01-01 --before 2025-01-01 '*.mp4'
+
+3. Process matches with jq -
+glesha find --json --limit 0 '*.key' | jq -r '.[].path'
+
+SEE ALSO
+1. glesha help diff
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -33,13 +33,19 @@ OPTIONS
     archive_format
         Specifies which archive format to use for archiving.
         This option is equivalent to --archive-format argument.
-        Supported values for ARCHIVE_FORMAT: targz
+        Supported values for ARCHIVE_FORMAT: targz repo
 
     provider
         Specifies which storage provider to use for uploading.
         This option is equivalent to --provider argument.
         Supported values for PROVIDER: aws
 
+    exclude, include
+        Lists of gitignore style patterns for files and directories to
+        skip, or to keep even if they are excluded.
+        These are applied before --exclude and --include arguments,
+        see 'glesha help add'.
+
     aws.account_id 
         12-digit AWS account Id, used to identify for ownership
         of the S3 bucket, to prevent accidental modifications.
@@ -62,6 +68,92 @@ OPTIONS
         ONEZONE_IA,GLACIER_IR, GLACIER, DEEP_ARCHIVE
         For more info: https://v.gd/s3_storage_classes
 
+    aws.object_lock (optional)
+        S3 Object Lock applied to every uploaded archive. glesha creates
+        buckets with object lock enabled, buckets created otherwise need
+        it enabled for these options to work.
+        Archives that are locked are never deleted by 'glesha prune'.
+
+        "object_lock": {
+            "mode": "GOVERNANCE",
+            "retain_days": 180,
+            "legal_hold": false
+        }
+
+    aws.object_lock.mode
+        Retention mode, GOVERNANCE or COMPLIANCE. Archives in COMPLIANCE
+        mode can not be deleted by anyone until retention ends.
+        Leave empty to not set a retention period.
+
+    aws.object_lock.retain_days
+        Number of days after upload during which archives can not be deleted.
+        Required when aws.object_lock.mode is set.
+
+    aws.object_lock.legal_hold
+        Places a legal hold on uploaded archives, they can not be deleted
+        until the hold is removed, regardless of retention.
+
+    snapshot (optional)
+        Archives files from a snapshot of the input paths, so files written
+        while archiving do not end up half changed in the archive.
+        The snapshot is taken right before archiving and removed after it,
+        The task records which snapshot it was archived from.
+
+        "snapshot": {
+            "method": "btrfs"
+        }
+
+    snapshot.method
+        btrfs     read only snapshot of the subvolume of each input path
+        zfs       snapshot of the dataset, read from its .zfs directory
+        lvm       snapshot of the logical volume, mounted read only in the
+                  output path. needs snapshot.lvm_size
+        reflink   copy of the input paths made with 'cp --reflink=always',
+                  the output path must be on the same filesystem (xfs, btrfs)
+                  and not inside an input path
+        command   runs snapshot.pre_command and snapshot.post_command
+        btrfs, zfs and lvm snapshots usually need root.
+
+    snapshot.lvm_size
+        Size of the copy-on-write space of lvm snapshots, e.g. "5G".
+        Archiving fails if more than this is written to the volume meanwhile.
+
+    snapshot.pre_command, snapshot.post_command
+        Shell commands run before and after archiving, e.g. to freeze a
+        database or create a snapshot glesha does not support.
+        GLESHA_TASK_ID and GLESHA_INPUT_PATHS (one per line) are set.
+        pre_command may print one path per input path to archive from
+        instead, or nothing to archive the input paths. post_command runs
+        even if pre_command fails.
+        Do not freeze the filesystem the output path is on.
+
+    hooks (optional)
+        Shell commands run at points of a task, e.g. to dump a database
+        before archiving or to send a notification after uploading.
+        Use a separate config file for tasks that need different hooks.
+        Exit codes and output of hooks are saved in the database.
+
+        "hooks": {
+            "pre_archive": "pg_dump app > /data/backup/app.sql",
+            "post_upload": "notify-send \"task $GLESHA_TASK_ID uploaded\"",
+            "on_failure": "notify-send \"$GLESHA_ERROR\""
+        }
+
+    hooks.pre_archive
+        Runs before archiving. The task is aborted if it exits with a
+        non-zero code. It is not run when a task continues an upload.
+
+    hooks.post_archive, hooks.post_upload
+        Run after archiving and after uploading completes.
+
+    hooks.on_failure
+        Runs when a task fails, but not when it is paused.
+        GLESHA_ERROR is set to the error.
+
+    Hooks get GLESHA_HOOK, GLESHA_TASK_ID, GLESHA_TASK_STATUS,
+    GLESHA_ARCHIVE_PATH and GLESHA_UPLOAD_ID environment variables,
+    values not known yet are empty.
+
 `
 
 func ConfigUsage() string {
@@ -4,7 +4,15 @@ import (
 	"context"
 	"fmt"
 	"glesha/cmd/add_cmd"
+	"glesha/cmd/daemon_cmd"
+	"glesha/cmd/diff_cmd"
+	"glesha/cmd/find_cmd"
+	"glesha/cmd/mount_cmd"
+	"glesha/cmd/pause_cmd"
+	"glesha/cmd/prune_cmd"
+	"glesha/cmd/resume_cmd"
 	"glesha/cmd/run_cmd"
+	"glesha/cmd/schedule_cmd"
 	"glesha/cmd/tui_cmd"
 )
 
@@ -19,6 +27,22 @@ func Execute(ctx context.Context, args []string) error {
 		add_cmd.PrintUsage()
 	case "run":
 		run_cmd.PrintUsage()
+	case "daemon":
+		daemon_cmd.PrintUsage()
+	case "schedule":
+		schedule_cmd.PrintUsage()
+	case "prune":
+		prune_cmd.PrintUsage()
+	case "find":
+		find_cmd.PrintUsage()
+	case "diff":
+		diff_cmd.PrintUsage()
+	case "mount":
+		mount_cmd.PrintUsage()
+	case "pause":
+		pause_cmd.PrintUsage()
+	case "resume":
+		resume_cmd.PrintUsage()
 	case "tui":
 		tui_cmd.PrintUsage()
 	case "help":
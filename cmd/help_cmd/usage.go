@@ -17,6 +17,11 @@ help       Help about a subcommand
 config     Help about config.json file
 add        Creates a glesha archive and upload task
 run        Runs a glesha task
+daemon     Runs queued glesha tasks in the background
+schedule   Manages recurring backups run by the daemon
+prune      Removes old backups using retention policies
+pause      Pauses a running glesha task
+resume     Resumes a paused glesha task
 ls         Lists all available glesha tasks
 rm         Deletes a glesha task, and relevant cache files
 cleanup    Cleans up cache, unwanted files created by glesha.
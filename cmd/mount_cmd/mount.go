@@ -0,0 +1,68 @@
+package mount_cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"glesha/database"
+	L "glesha/logger"
+	"glesha/mount"
+	"glesha/runner"
+	"os"
+	"path/filepath"
+)
+
+type MountCmdEnv struct {
+	MountPoint string
+	AllowOther bool
+}
+
+func Execute(ctx context.Context, args []string) error {
+	env, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+	r := runner.NewRunner(db)
+	L.Printf("Mounted backups at %s, press Ctrl-C to unmount\n", env.MountPoint)
+	return mount.Mount(ctx, r, env.MountPoint, mount.Options{AllowOther: env.AllowOther})
+}
+
+func parseFlags(args []string) (*MountCmdEnv, error) {
+	mountCmd := flag.NewFlagSet("mount", flag.ExitOnError)
+	allowOther := mountCmd.Bool("allow-other", false, "Let other users access the mount")
+	mountCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := mountCmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if mountCmd.NArg() != 1 {
+		return nil, fmt.Errorf("expected a mount point. For more information check 'glesha help mount'")
+	}
+	mountPoint, err := filepath.Abs(mountCmd.Arg(0))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mount point %s: %w", mountCmd.Arg(0), err)
+	}
+	info, err := os.Stat(mountPoint)
+	if err != nil {
+		return nil, fmt.Errorf("could not access mount point %s: %w", mountPoint, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("mount point %s is not a directory", mountPoint)
+	}
+	return &MountCmdEnv{MountPoint: mountPoint, AllowOther: *allowOther}, nil
+}
@@ -0,0 +1,47 @@
+package mount_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha mount [OPTIONS] <mount-point>
+
+DESCRIPTION
+Mounts the archived files of all tasks read only at <mount-point>, to
+browse backups and copy files out of them with any program. Each task is
+a directory named by its Id, holding its files at the same paths as in
+its archive, e.g. <mount-point>/12/docs/letter.pdf.
+
+Directories are listed from the file catalog, so browsing does not read
+any archive. Files are read from the local archive when it still exists,
+otherwise from the uploaded archive, fetching only the parts that are
+read. Reading files of archives stored in Glacier or Deep Archive fails
+until they are restored in the storage provider.
+
+The mount stays until glesha is stopped with Ctrl-C. Linux and macOS
+only, macOS needs macFUSE.
+
+OPTIONS
+--allow-other
+Let other users access the mount. Needs user_allow_other in
+/etc/fuse.conf unless glesha runs as root.
+
+EXAMPLES
+1. Browse all backups -
+mkdir -p ~/backups && glesha mount ~/backups
+
+2. Copy a file out of task 12 -
+cp ~/backups/12/docs/letter.pdf ~/letter.pdf
+
+SEE ALSO
+1. glesha help find
+2. glesha help diff
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -0,0 +1,42 @@
+package pause_cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"glesha/control"
+	L "glesha/logger"
+	"strconv"
+)
+
+func Execute(ctx context.Context, args []string) error {
+	taskId, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	res, err := control.Send(ctx, taskId, control.ACTION_PAUSE)
+	if errors.Is(err, control.ErrNotRunning) {
+		return fmt.Errorf("task %d is not running, see 'glesha help run'", taskId)
+	}
+	if err != nil {
+		return err
+	}
+	L.Printf("Task %d: %s paused\n", taskId, res.Phase)
+	return nil
+}
+
+func parseFlags(args []string) (int64, error) {
+	pauseCmd := flag.NewFlagSet("pause", flag.ExitOnError)
+	pauseCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := pauseCmd.Parse(args)
+	if err != nil {
+		return -1, err
+	}
+	if pauseCmd.NArg() != 1 {
+		return -1, fmt.Errorf("expected exactly one task Id. For more information check 'glesha help pause'")
+	}
+	return strconv.ParseInt(pauseCmd.Arg(0), 10, 64)
+}
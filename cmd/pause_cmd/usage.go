@@ -0,0 +1,36 @@
+package pause_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha pause ID
+
+DESCRIPTION
+Pauses a task that is currently being run by 'glesha run'.
+1. While archiving, the task pauses after the current file
+2. While uploading, the task pauses after the current blocks are uploaded
+
+The task stays paused until it is resumed with 'glesha resume'.
+If 'glesha run' exits while a task is paused, the next run continues an
+upload from where it was paused, an archive is created again.
+
+ID
+ID of the task that you want to pause.
+
+EXAMPLES
+1. Pause task 2039 -
+glesha pause 2039
+
+SEE ALSO
+1. glesha help resume
+2. glesha help run
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -0,0 +1,307 @@
+package prune_cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/file_io"
+	L "glesha/logger"
+	"glesha/runner"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PruneCmdEnv struct {
+	InputPath string
+	DryRun    bool
+	Force     bool
+}
+
+func Execute(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "set":
+			policy, err := parseSetFlags(args[1:])
+			if err != nil {
+				return err
+			}
+			return withRunner(ctx, func(r *runner.Runner) error {
+				err := r.RetentionRepo.SetPolicy(ctx, policy)
+				if err != nil {
+					return err
+				}
+				L.Printf("Retention policy set for %s\n", policy.InputPath)
+				return nil
+			})
+		case "unset":
+			if len(args) < 2 {
+				return fmt.Errorf("PATH not provided. For more information check 'glesha help prune'")
+			}
+			inputPath, err := expandPaths(args[1:])
+			if err != nil {
+				return err
+			}
+			return withRunner(ctx, func(r *runner.Runner) error {
+				err := r.RetentionRepo.DeletePolicy(ctx, inputPath)
+				if err == database.ErrDoesNotExist {
+					return fmt.Errorf("no retention policy for %s", inputPath)
+				}
+				if err != nil {
+					return err
+				}
+				L.Printf("Retention policy removed for %s\n", inputPath)
+				return nil
+			})
+		case "policies":
+			return withRunner(ctx, func(r *runner.Runner) error {
+				return listPolicies(ctx, r)
+			})
+		}
+	}
+	env, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	return withRunner(ctx, func(r *runner.Runner) error {
+		return prune(ctx, r, env)
+	})
+}
+
+func withRunner(ctx context.Context, fn func(r *runner.Runner) error) error {
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(runner.NewRunner(db))
+}
+
+func prune(ctx context.Context, r *runner.Runner, env *PruneCmdEnv) error {
+	candidates, err := r.PlanPrune(ctx, env.InputPath, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		L.Println("Nothing to prune, all backups are kept by retention policies")
+		return nil
+	}
+
+	now := time.Now()
+	var toRemove []*runner.PruneCandidate
+	locked := 0
+	for _, c := range candidates {
+		if c.Lock.IsLocked(now) {
+			L.Warn(fmt.Sprintf("Task %d can not be removed because it is locked by %s", c.Task.Id, c.Lock.String()))
+			locked++
+			continue
+		}
+		e := c.Estimate
+		if e != nil && e.RemainingMinDuration > 0 {
+			L.Warn(fmt.Sprintf(
+				"Task %d is stored as %s for less than %s, deleting it now is charged as if it were stored for %s more",
+				c.Task.Id,
+				e.StorageClass,
+				formatDays(e.MinStorageDuration),
+				formatDays(e.RemainingMinDuration)))
+			if !env.Force {
+				continue
+			}
+		}
+		toRemove = append(toRemove, c)
+	}
+	L.Print(renderReport(toRemove))
+	if locked > 0 {
+		L.Printf("Skipping %s protected by object lock.\n", L.HumanReadableCount(locked, "backup", "backups"))
+	}
+	if skipped := len(candidates) - len(toRemove) - locked; skipped > 0 {
+		L.Printf("Skipping %s within minimum storage duration, use --force to remove them anyway.\n",
+			L.HumanReadableCount(skipped, "backup", "backups"))
+	}
+	if env.DryRun {
+		L.Println("Dry run, nothing was removed")
+		return nil
+	}
+
+	var errs []error
+	removed := 0
+	for _, c := range toRemove {
+		err := r.Prune(ctx, c)
+		if err != nil {
+			L.Error(err)
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+		L.Printf("Removed task %d (%s)\n", c.Task.Id, c.Task.InputPathsKey())
+	}
+	L.Printf("Removed %s\n", L.HumanReadableCount(removed, "backup", "backups"))
+	if len(errs) > 0 {
+		return fmt.Errorf("could not remove %s: %w",
+			L.HumanReadableCount(len(errs), "backup", "backups"), errors.Join(errs...))
+	}
+	return nil
+}
+
+func renderReport(candidates []*runner.PruneCandidate) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-6s %-19s %-10s %-14s %-16s %s\n",
+		"TASK", "CREATED", "SIZE", "STORAGE CLASS", "EARLY DELETION", "PATH"))
+	var totalSize uint64
+	var monthlyCost, earlyDeletionCost float64
+	currency := ""
+	for _, c := range candidates {
+		size := uint64(c.Task.TotalSize)
+		storageClass := "-"
+		earlyDeletion := "-"
+		if c.Upload != nil {
+			size = uint64(c.Upload.FileSize)
+		}
+		if e := c.Estimate; e != nil {
+			storageClass = e.StorageClass
+			earlyDeletion = fmt.Sprintf("%.2f %s", e.EarlyDeletionCost, e.Currency)
+			monthlyCost += e.MonthlyCost
+			earlyDeletionCost += e.EarlyDeletionCost
+			currency = e.Currency
+		}
+		totalSize += size
+		sb.WriteString(fmt.Sprintf("%-6d %-19s %-10s %-14s %-16s %s\n",
+			c.Task.Id,
+			c.Task.CreatedAt.Format(time.DateTime),
+			L.HumanReadableBytes(size, 2),
+			storageClass,
+			earlyDeletion,
+			c.Task.InputPathsKey()))
+	}
+	sb.WriteString(fmt.Sprintf("Removing %s frees %s",
+		L.HumanReadableCount(len(candidates), "backup", "backups"),
+		L.HumanReadableBytes(totalSize, 2)))
+	if len(currency) > 0 {
+		sb.WriteString(fmt.Sprintf(", saves %.2f %s/month and costs %.2f %s in early deletion charges",
+			monthlyCost, currency, earlyDeletionCost, currency))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func listPolicies(ctx context.Context, r *runner.Runner) error {
+	policies, err := r.GetRetentionPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		L.Println("No retention policies found, see 'glesha help prune'")
+		return nil
+	}
+	paths := make([]string, 0, len(policies))
+	for p := range policies {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	L.Printf("%-5s %-6s %-7s %-8s %-10s %s\n", "LAST", "DAILY", "WEEKLY", "MONTHLY", "SOURCE", "PATH")
+	for _, path := range paths {
+		p := policies[path]
+		source := "policy"
+		if p.Id == 0 {
+			source = "schedule"
+		}
+		L.Printf("%-5d %-6d %-7d %-8d %-10s %s\n",
+			p.KeepLast, p.KeepDaily, p.KeepWeekly, p.KeepMonthly, source, path)
+	}
+	return nil
+}
+
+func formatDays(d time.Duration) string {
+	days := int(d.Hours()/24 + 0.5)
+	return L.HumanReadableCount(days, "day", "days")
+}
+
+func parseFlags(args []string) (*PruneCmdEnv, error) {
+	pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := pruneCmd.Bool("dry-run", false, "Only report what would be removed")
+	force := pruneCmd.Bool("force", false, "Also remove backups within the minimum storage duration")
+	pruneCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := pruneCmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	env := &PruneCmdEnv{DryRun: *dryRun, Force: *force}
+	if pruneCmd.NArg() > 0 {
+		env.InputPath, err = expandPaths(pruneCmd.Args())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+func parseSetFlags(args []string) (*model.RetentionPolicy, error) {
+	setCmd := flag.NewFlagSet("prune set", flag.ExitOnError)
+	keepLast := setCmd.Int64("keep-last", 0, "Number of most recent backups to keep")
+	keepDaily := setCmd.Int64("keep-daily", 0, "Number of days to keep the last backup of")
+	keepWeekly := setCmd.Int64("keep-weekly", 0, "Number of weeks to keep the last backup of")
+	keepMonthly := setCmd.Int64("keep-monthly", 0, "Number of months to keep the last backup of")
+	setCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := setCmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if setCmd.NArg() < 1 {
+		return nil, fmt.Errorf("PATH not provided. For more information check 'glesha help prune'")
+	}
+	policy := &model.RetentionPolicy{
+		KeepLast:    *keepLast,
+		KeepDaily:   *keepDaily,
+		KeepWeekly:  *keepWeekly,
+		KeepMonthly: *keepMonthly,
+	}
+	if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0 {
+		return nil, fmt.Errorf("--keep-* values can not be negative")
+	}
+	if policy.IsEmpty() {
+		return nil, fmt.Errorf("at least one of --keep-last, --keep-daily, --keep-weekly or --keep-monthly is required")
+	}
+	policy.InputPath, err = expandPaths(setCmd.Args())
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// returns the key of the backups of "paths", backups of several paths are
+// pruned together, see model.InputPathsKey
+func expandPaths(paths []string) (string, error) {
+	expanded := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if strings.HasPrefix(p, "~/") {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("cannot expand ~ for %s: %w", p, err)
+			}
+			p = filepath.Join(homeDir, p[2:])
+		}
+		expanded = append(expanded, p)
+	}
+	inputPaths, err := file_io.NormalizeInputPaths(expanded)
+	if err != nil {
+		return "", err
+	}
+	return model.InputPathsKey(inputPaths), nil
+}
@@ -0,0 +1,84 @@
+package prune_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha prune [--dry-run] [--force] [PATH...]
+glesha prune set [OPTIONS] PATH...
+glesha prune unset PATH...
+glesha prune policies
+
+DESCRIPTION
+Removes old backups that are not kept by the retention policy of their
+directory. For every removed backup, the uploaded archive, the local
+archive and its task are deleted.
+Only backups that are uploaded completely are considered, all backups of
+a directory without a retention policy are kept.
+
+Some storage classes charge for a minimum storage duration, e.g. 180 days
+for AWS Deep Archive. Backups that have not been stored that long are
+skipped with a warning, unless --force is used.
+Backups protected by S3 Object Lock, either by a retention period that has
+not passed or by a legal hold, are always skipped, see 'glesha help config'.
+Packs of backups with the repo archive format may be shared with other
+backups, they are removed once no remaining backup uses them. Packs are
+kept while a repo task has not finished archiving.
+
+SUBCOMMANDS
+set        Sets the retention policy for PATH, replacing the existing one
+unset      Removes the retention policy for PATH
+policies   Lists retention policies
+
+OPTIONS
+--dry-run
+Only report which backups would be removed and what it would cost.
+
+--force
+Also remove backups that are within the minimum storage duration of
+their storage class. The remaining duration is still charged.
+
+PATH
+Only prune backups of this directory.
+Backups of several directories, see 'glesha help add', are kept or removed
+together, and their retention policy is set by listing all of them as PATH.
+
+OPTIONS (set)
+A backup kept by any of these rules is not removed.
+
+--keep-last <count>
+Keep the most recent <count> backups.
+
+--keep-daily <count>
+Keep the most recent backup of each of the last <count> days that
+have a backup.
+
+--keep-weekly <count>
+Keep the most recent backup of each of the last <count> weeks that
+have a backup.
+
+--keep-monthly <count>
+Keep the most recent backup of each of the last <count> months that
+have a backup.
+
+Schedules created with --retain keep that many recent backups of their
+directory, unless the directory has a retention policy.
+
+EXAMPLES
+1. Keep 7 daily, 4 weekly and 12 monthly backups of ~/photos -
+glesha prune set --keep-daily 7 --keep-weekly 4 --keep-monthly 12 ~/photos
+
+2. See what would be removed, and what it would cost -
+glesha prune --dry-run
+
+SEE ALSO
+1. glesha help schedule
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
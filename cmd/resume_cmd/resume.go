@@ -0,0 +1,42 @@
+package resume_cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"glesha/control"
+	L "glesha/logger"
+	"strconv"
+)
+
+func Execute(ctx context.Context, args []string) error {
+	taskId, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	res, err := control.Send(ctx, taskId, control.ACTION_RESUME)
+	if errors.Is(err, control.ErrNotRunning) {
+		return fmt.Errorf("task %d is not running, continue it with 'glesha run %d'", taskId, taskId)
+	}
+	if err != nil {
+		return err
+	}
+	L.Printf("Task %d: %s resumed\n", taskId, res.Phase)
+	return nil
+}
+
+func parseFlags(args []string) (int64, error) {
+	resumeCmd := flag.NewFlagSet("resume", flag.ExitOnError)
+	resumeCmd.Usage = func() {
+		PrintUsage()
+	}
+	err := resumeCmd.Parse(args)
+	if err != nil {
+		return -1, err
+	}
+	if resumeCmd.NArg() != 1 {
+		return -1, fmt.Errorf("expected exactly one task Id. For more information check 'glesha help resume'")
+	}
+	return strconv.ParseInt(resumeCmd.Arg(0), 10, 64)
+}
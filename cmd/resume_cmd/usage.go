@@ -0,0 +1,34 @@
+package resume_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha resume ID
+
+DESCRIPTION
+Resumes a task that was paused with 'glesha pause', while it is still
+being run by 'glesha run'.
+
+To continue a paused task after 'glesha run' has exited, run it again
+with 'glesha run ID'.
+
+ID
+ID of the task that you want to resume.
+
+EXAMPLES
+1. Resume task 2039 -
+glesha resume 2039
+
+SEE ALSO
+1. glesha help pause
+2. glesha help run
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -5,17 +5,49 @@ import L "glesha/logger"
 const usageStr string = `
 USAGE
 glesha run [OPTIONS] ID
+glesha run [OPTIONS] --all-queued
 
 DESCRIPTION
 Runs an existing glesha task with <ID> -
 1. Archives the given directory into the specified archive format
 2. Uploads the generated archive to the specified storage provider
 
+While a task is running, it can be paused and resumed from another
+terminal with 'glesha pause ID' and 'glesha resume ID'.
+
 OPTIONS
+--all-queued
+Run all tasks that are QUEUED, ARCHIVE_ABORTED, ARCHIVE_COMPLETED or
+UPLOAD_ABORTED in order of priority, and exit when none are left.
+See 'glesha help add' for setting priority of a task.
+
+--max-tasks <tasks>
+Maximum number of tasks to run at the same time with --all-queued.
+Default: 1
+
+--max-workers <workers>
+Maximum number of upload workers shared by all tasks with --all-queued.
+Use 0 to only limit workers of each task with --jobs.
+Default: 0
+
+--retries <retries>
+Number of times a failed task is retried with --all-queued.
+Default: 3
+
 --jobs, -j <jobs>
 Specify maximum number of jobs to run simultaneously.
+Use 'auto' to measure upload throughput and error rate, and
+scale jobs up or down between --min-jobs and --max-jobs.
 Defaults to 1 if not specified.
 
+--min-jobs <jobs>
+Minimum number of jobs to use with '--jobs auto'.
+Default: 1
+
+--max-jobs <jobs>
+Maximum number of jobs to use with '--jobs auto'.
+Default: 16
+
 --log-level, -L <log-level>
 Specify log output level
 Default: debug
@@ -40,8 +72,16 @@ glesha run -j 6 -L debug 2039
 2. Run a task with 1 job -
 glesha run 2039
 
+3. Run a task and let glesha pick between 2 and 8 jobs -
+glesha run -j auto --min-jobs 2 --max-jobs 8 2039
+
+4. Run all queued tasks, 2 at a time -
+glesha run --all-queued --max-tasks 2
+
 SEE ALSO
 1. glesha help run
+2. glesha help pause
+3. glesha help daemon
 `
 
 func Usage() string {
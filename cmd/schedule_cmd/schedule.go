@@ -0,0 +1,287 @@
+package schedule_cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"glesha/config"
+	"glesha/cron"
+	"glesha/database"
+	"glesha/database/repository"
+	"glesha/file_io"
+	"glesha/filter"
+	L "glesha/logger"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScheduleAddEnv struct {
+	InputPath     string
+	OutputPath    string
+	ConfigPath    string
+	Provider      config.Provider
+	ArchiveFormat config.ArchiveFormat
+	Schedule      *cron.Schedule
+	Retain        int64
+	Priority      int64
+	FilterLines   []string
+}
+
+func Execute(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		PrintUsage()
+		return nil
+	}
+	switch args[0] {
+	case "add":
+		env, err := parseAddFlags(args[1:])
+		if err != nil {
+			return err
+		}
+		return withScheduleRepo(ctx, func(scheduleRepo repository.ScheduleRepository) error {
+			return addSchedule(ctx, scheduleRepo, env)
+		})
+	case "ls":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments. For more information check 'glesha help schedule'")
+		}
+		return withScheduleRepo(ctx, func(scheduleRepo repository.ScheduleRepository) error {
+			return listSchedules(ctx, scheduleRepo)
+		})
+	case "rm":
+		if len(args) != 2 {
+			return fmt.Errorf("expected exactly one schedule Id. For more information check 'glesha help schedule'")
+		}
+		scheduleId, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		return withScheduleRepo(ctx, func(scheduleRepo repository.ScheduleRepository) error {
+			err := scheduleRepo.DeleteSchedule(ctx, scheduleId)
+			if err == database.ErrDoesNotExist {
+				return fmt.Errorf("schedule %d does not exist", scheduleId)
+			}
+			if err != nil {
+				return err
+			}
+			L.Printf("Schedule %d removed\n", scheduleId)
+			return nil
+		})
+	case "help", "-h", "--help":
+		PrintUsage()
+		return nil
+	default:
+		return fmt.Errorf("no such subcommand: %s. For more information check 'glesha help schedule'", args[0])
+	}
+}
+
+func withScheduleRepo(ctx context.Context, fn func(scheduleRepo repository.ScheduleRepository) error) error {
+	dbPath, err := database.GetDBFilePath(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(repository.NewScheduleRepository(db))
+}
+
+func addSchedule(ctx context.Context, scheduleRepo repository.ScheduleRepository, env *ScheduleAddEnv) error {
+	nextRunAt := env.Schedule.Next(time.Now())
+	if nextRunAt.IsZero() {
+		return fmt.Errorf("schedule %s never runs", env.Schedule.String())
+	}
+	scheduleId, err := scheduleRepo.CreateSchedule(ctx,
+		env.InputPath,
+		env.OutputPath,
+		env.ConfigPath,
+		env.Provider,
+		env.ArchiveFormat,
+		env.Schedule.String(),
+		env.Retain,
+		env.Priority,
+		nextRunAt,
+	)
+	if err != nil {
+		return err
+	}
+	if len(env.FilterLines) > 0 {
+		err = scheduleRepo.UpdateScheduleFilterPatterns(ctx, scheduleId, env.FilterLines)
+		if err != nil {
+			return err
+		}
+	}
+	L.Printf("Schedule created with id: %d\n", scheduleId)
+	L.Printf("Next run at: %s\n", nextRunAt.Format(time.DateTime))
+	L.Printf("Schedules are only evaluated while 'glesha daemon' is running.\n")
+	return nil
+}
+
+func listSchedules(ctx context.Context, scheduleRepo repository.ScheduleRepository) error {
+	schedules, err := scheduleRepo.ListSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		L.Println("No schedules found, see 'glesha help schedule'")
+		return nil
+	}
+	L.Printf("%-4s %-16s %-6s %-19s %-9s %s\n", "ID", "EVERY", "RETAIN", "NEXT RUN", "LAST TASK", "PATH")
+	for _, sc := range schedules {
+		lastTask := "-"
+		if sc.LastTaskId != nil {
+			lastTask = strconv.FormatInt(*sc.LastTaskId, 10)
+		}
+		L.Printf("%-4d %-16s %-6d %-19s %-9s %s\n",
+			sc.Id,
+			L.TruncateString(sc.CronExpr, 16, L.TRUNC_CENTER),
+			sc.Retain,
+			sc.NextRunAt.Format(time.DateTime),
+			lastTask,
+			sc.InputPath,
+		)
+	}
+	return nil
+}
+
+func parseAddFlags(args []string) (*ScheduleAddEnv, error) {
+	globalWorkDir, err := file_io.GetGlobalWorkDir()
+	if err != nil {
+		return nil, err
+	}
+	defaultOutputPath := globalWorkDir
+
+	addCmd := flag.NewFlagSet("schedule add", flag.ExitOnError)
+	every := addCmd.String("every", "", "Cron expression for when to run the schedule (required)")
+	retain := addCmd.Int64("retain", 0, "Number of uploaded backups to keep, 0 keeps all")
+	priority := addCmd.Int64("priority", 0, "Priority of tasks created by the schedule")
+	outputPath := addCmd.String("output", defaultOutputPath, "Path to directory where archive should be generated")
+	configPath := addCmd.String("config", "", "Path to config.json file")
+	provider := addCmd.String("provider", "", "Which provider to use for uploading")
+	archiveFormat := addCmd.String("archive-format", "", "Which archive format to use for archiving")
+	addCmd.StringVar(outputPath, "o", defaultOutputPath, "alias to -output")
+	addCmd.StringVar(configPath, "c", "", "alias to -config")
+	addCmd.StringVar(provider, "p", "", "alias to -provider")
+	addCmd.StringVar(archiveFormat, "a", "", "alias to -archive-format")
+	var excludes, includes filter.PatternsFlag
+	addCmd.Var(&excludes, "exclude", "Exclude paths matching a gitignore style pattern")
+	addCmd.Var(&includes, "include", "Include paths excluded by other patterns")
+
+	addCmd.Usage = func() {
+		PrintUsage()
+	}
+	err = addCmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if addCmd.NArg() < 1 {
+		return nil, fmt.Errorf("PATH not provided. For more information check 'glesha help schedule'")
+	}
+	if addCmd.NArg() > 1 {
+		return nil, fmt.Errorf("too many arguments. For more information check 'glesha help schedule'")
+	}
+	if len(*every) == 0 {
+		return nil, fmt.Errorf("--every is required. For more information check 'glesha help schedule'")
+	}
+	schedule, err := cron.Parse(*every)
+	if err != nil {
+		return nil, err
+	}
+	if *retain < 0 {
+		return nil, fmt.Errorf("invalid value for --retain: %d", *retain)
+	}
+
+	inputPathAbs, err := expandPath(addCmd.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	outputPathAbs, err := expandPath(*outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var configPathAbs string
+	if len(*configPath) > 0 {
+		configPathAbs, err = expandPath(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		readable, err := file_io.IsReadable(configPathAbs)
+		if err != nil || !readable {
+			return nil, fmt.Errorf("config is not readable: %s", configPathAbs)
+		}
+	} else {
+		configPathAbs, err = config.GetDefaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Parse(configPathAbs)
+	if err != nil {
+		return nil, err
+	}
+	configs := config.Get()
+
+	env := &ScheduleAddEnv{
+		InputPath:     inputPathAbs,
+		OutputPath:    outputPathAbs,
+		ConfigPath:    configPathAbs,
+		Provider:      configs.Provider,
+		ArchiveFormat: configs.ArchiveFormat,
+		Schedule:      schedule,
+		Retain:        *retain,
+		Priority:      *priority,
+		// patterns from config come first, so flags can override them
+		FilterLines: filter.Lines(
+			append(slices.Clone(configs.Exclude), excludes...),
+			append(slices.Clone(configs.Include), includes...),
+		),
+	}
+	// reject invalid patterns now instead of when the schedule runs
+	_, err = filter.New([]string{inputPathAbs}, env.FilterLines, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// override config with cli flags
+	if len(*archiveFormat) > 0 {
+		switch af := config.ArchiveFormat(*archiveFormat); af {
+		case config.AF_TARGZ, config.AF_REPO:
+			env.ArchiveFormat = af
+		default:
+			return nil, fmt.Errorf("invalid archive format: %s", *archiveFormat)
+		}
+	}
+	if len(*provider) > 0 {
+		env.Provider, err = config.ParseProvider(*provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+func expandPath(p string) (string, error) {
+	if len(p) == 0 {
+		return "", fmt.Errorf("path is not valid")
+	}
+	if strings.HasPrefix(p, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot expand ~ for %s: %w", p, err)
+		}
+		p = filepath.Join(homeDir, p[2:])
+	}
+	return filepath.Abs(p)
+}
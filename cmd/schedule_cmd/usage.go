@@ -0,0 +1,76 @@
+package schedule_cmd
+
+import L "glesha/logger"
+
+const usageStr string = `
+USAGE
+glesha schedule add [OPTIONS] --every <expr> PATH
+glesha schedule ls
+glesha schedule rm <id>
+
+DESCRIPTION
+Manages recurring backups of a directory.
+Whenever a schedule is due, 'glesha daemon' queues a task for PATH and
+runs it, like 'glesha add' followed by 'glesha run'. If the contents of
+PATH have not changed since a previous task, no new task is queued.
+Schedules are only evaluated while 'glesha daemon' is running, runs that
+were missed while it was stopped are done once when it starts again.
+
+SUBCOMMANDS
+add        Creates a schedule for PATH
+ls         Lists all schedules
+rm         Deletes a schedule, tasks created by it are not deleted
+
+OPTIONS (add)
+--every <expr>
+When to run the schedule, as a 5 field cron expression -
+minute hour day-of-month month day-of-week
+Fields accept *, lists (1,15), ranges (1-5) and steps (*/10).
+Months and days of week can also be names, e.g. jan or mon-fri.
+The macros @hourly, @daily, @weekly, @monthly and @yearly are supported.
+Times are in local time. This option is required.
+
+--retain <count>
+Number of uploaded backups of PATH to keep, 0 keeps all.
+Older backups are removed by 'glesha prune', unless PATH has a
+retention policy, see 'glesha help prune'.
+Default: 0
+
+--priority <priority>
+Priority of tasks queued by this schedule, see 'glesha help add'.
+Default: 0
+
+--output, -o
+Path to directory where archive should be generated
+Default is: ~/.glesha-cache
+
+--config, -c
+Path to config.json file
+Default is: ~/.config/glesha/config.json
+
+--provider, -p [PROVIDER]
+--archive-format, -a [ARCHIVE_FORMAT]
+--exclude <pattern>
+--include <pattern>
+Same as in 'glesha help add'.
+
+EXAMPLES
+1. Back up ~/photos every day at 2 AM, keeping the last 7 backups -
+glesha schedule add --every "0 2 * * *" --retain 7 ~/photos
+
+2. Back up ~/work every weekday at 6 PM -
+glesha schedule add --every "0 18 * * mon-fri" ~/work
+
+SEE ALSO
+1. glesha help daemon
+2. glesha help add
+3. glesha help prune
+`
+
+func Usage() string {
+	return usageStr
+}
+
+func PrintUsage() {
+	L.Print(usageStr)
+}
@@ -2,8 +2,13 @@ package tui_cmd
 
 import (
 	"context"
+	"fmt"
+	"glesha/config"
 	"glesha/database"
+	L "glesha/logger"
 	"glesha/tui"
+	"os"
+	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -18,9 +23,39 @@ func Execute(ctx context.Context, args []string) error {
 		return err
 	}
 	defer db.Close(ctx)
+	err = db.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	// tasks run from the tui log to a file, the tui owns the terminal
+	logPath, err := getLogFilePath()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open log file %s: %w", logPath, err)
+	}
+	defer logFile.Close()
+	L.SetOutput(logFile)
+	defer L.SetOutput(os.Stdout)
 
 	app := tui.NewApp(ctx, db)
+	defer app.Close()
 	p := tea.NewProgram(app, tea.WithAltScreen())
 	_, err = p.Run()
 	return err
 }
+
+func getLogFilePath() (string, error) {
+	configDir, err := config.GetDefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(configDir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("could not create config dir %s: %w", configDir, err)
+	}
+	return filepath.Join(configDir, "tui.log"), nil
+}
@@ -7,7 +7,33 @@ USAGE
 glesha tui
 
 DESCRIPTION
-Launches the interactive Terminal User Interface for browsing tasks.
+Launches the interactive Terminal User Interface for browsing and running
+tasks.
+
+Tasks are run in the background while the tui is open, with live
+progress in the status bar. Pausing and aborting also work for tasks run
+by 'glesha run' or 'glesha daemon'. Quitting the tui aborts the tasks it
+runs, they continue from where they stopped when run again.
+
+Logs of tasks run by the tui are written to tui.log in the glesha config
+directory.
+
+KEYS
+/       Search files of the selected task, enter opens the directory of a match
+o       Sort files by name, size or modification time
+v       Show how much of a directory each entry takes, with directory sizes
+space   Mark the file or directory under the cursor for restoring
+R       Restore marked entries, or the one under the cursor, to a directory
+5/u     Show upload blocks, workers and errors of the selected task
+r       Run the selected task
+p       Pause or resume the selected task
+x       Abort the selected task
+d       Delete the selected task, its local archive and uploaded backup
+a       Add a task, pick the input path with the arrow keys
+c       Edit the config of the selected task, or the default config. keys
+        are validated as typed, ctrl+t tests the connection to the bucket
+        and ctrl+s saves the config
+q       Quit
 `
 
 func PrintUsage() {
@@ -14,6 +14,14 @@ These are common glesha commands used in various situations -
 help       Help about a subcommand
 add        Creates a glesha archive and upload task
 run        Runs a glesha task
+daemon     Runs queued glesha tasks in the background
+schedule   Manages recurring backups run by the daemon
+prune      Removes old backups using retention policies
+find       Searches archived files of all tasks
+diff       Lists files changed between backups
+mount      Mounts archived files of all tasks read only
+pause      Pauses a running glesha task
+resume     Resumes a paused glesha task
 tui        Interactive terminal user interface
 ls         Lists all available glesha tasks
 rm         Deletes a glesha task, and relevant cache files
@@ -11,6 +11,9 @@ type ArchiveFormat string
 const (
 	AF_TARGZ ArchiveFormat = "targz"
 	AF_ZIP   ArchiveFormat = "zip"
+	// files are split into deduplicated chunks, and only chunks that are
+	// not stored yet are uploaded, see archive.RepoArchive
+	AF_REPO ArchiveFormat = "repo"
 )
 
 func (archiveFormat *ArchiveFormat) String() string {
@@ -19,6 +22,8 @@ func (archiveFormat *ArchiveFormat) String() string {
 		return ".tar.gz"
 	case AF_ZIP:
 		return ".zip"
+	case AF_REPO:
+		return "repo"
 	default:
 		return "Unknown"
 	}
@@ -29,6 +34,8 @@ func ParseArchiveFormat(archiveFormatStr string) (ArchiveFormat, error) {
 	switch a {
 	case AF_TARGZ:
 		return AF_TARGZ, nil
+	case AF_REPO:
+		return AF_REPO, nil
 	default:
 		return "", fmt.Errorf("invalid archive format: %s", archiveFormatStr)
 	}
@@ -42,12 +49,12 @@ func (archiveFormat *ArchiveFormat) UnmarshalJSON(data []byte) error {
 	}
 	t := ArchiveFormat(maybeArchiveFormat)
 	switch t {
-	case AF_TARGZ, AF_ZIP:
+	case AF_TARGZ, AF_ZIP, AF_REPO:
 		{
 			*archiveFormat = t
 			return nil
 		}
 	default:
-		return fmt.Errorf("unknown archive_type: %s. supported archive types: %s", maybeArchiveFormat, AF_TARGZ)
+		return fmt.Errorf("unknown archive_type: %s. supported archive types: %s, %s", maybeArchiveFormat, AF_TARGZ, AF_REPO)
 	}
 }
@@ -10,43 +10,146 @@ import (
 	"slices"
 )
 
+// S3 Object Lock settings applied to every uploaded archive
+type AwsObjectLock struct {
+	// GOVERNANCE or COMPLIANCE, empty to not set a retention period
+	Mode string `json:"mode,omitempty"`
+	// number of days after upload until which archives can not be deleted
+	RetainDays int64 `json:"retain_days,omitempty"`
+	// archives with a legal hold can not be deleted until it is removed
+	LegalHold bool `json:"legal_hold,omitempty"`
+}
+
 type Aws struct {
-	AccessKey    string `json:"access_key"`
-	SecretKey    string `json:"secret_key"`
-	AccountId    uint64 `json:"account_id"`
-	Region       string `json:"region"`
-	BucketName   string `json:"bucket_name"`
-	StorageClass string `json:"storage_class"`
+	AccessKey    string         `json:"access_key"`
+	SecretKey    string         `json:"secret_key"`
+	AccountId    uint64         `json:"account_id"`
+	Region       string         `json:"region"`
+	BucketName   string         `json:"bucket_name"`
+	StorageClass string         `json:"storage_class"`
+	ObjectLock   *AwsObjectLock `json:"object_lock,omitempty"`
+}
+
+// methods of taking a snapshot of the input paths before archiving them
+const (
+	SNAPSHOT_BTRFS   = "btrfs"
+	SNAPSHOT_ZFS     = "zfs"
+	SNAPSHOT_LVM     = "lvm"
+	SNAPSHOT_REFLINK = "reflink"
+	SNAPSHOT_COMMAND = "command"
+)
+
+// Snapshot settings, files are archived from a snapshot so files written
+// while archiving do not end up inconsistent
+type Snapshot struct {
+	Method string `json:"method"`
+	// size of the copy-on-write volume of lvm snapshots, e.g. "5G"
+	LvmSize string `json:"lvm_size,omitempty"`
+	// shell commands run before and after archiving by the command method
+	PreCommand  string `json:"pre_command,omitempty"`
+	PostCommand string `json:"post_command,omitempty"`
+}
+
+// Hooks are shell commands run at points of a task, e.g. to dump a
+// database before archiving or to send a notification after uploading
+type Hooks struct {
+	// a failing pre archive hook aborts the task
+	PreArchive  string `json:"pre_archive,omitempty"`
+	PostArchive string `json:"post_archive,omitempty"`
+	PostUpload  string `json:"post_upload,omitempty"`
+	OnFailure   string `json:"on_failure,omitempty"`
 }
 
 type Config struct {
 	ArchiveFormat ArchiveFormat `json:"archive_format"`
 	Provider      Provider      `json:"provider"`
 	Aws           *Aws          `json:"aws,omitempty"`
+	// gitignore style patterns, see 'glesha help add'
+	Exclude []string `json:"exclude,omitempty"`
+	Include []string `json:"include,omitempty"`
+	// archive from a snapshot of the input paths, nil to archive them directly
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+	Hooks    *Hooks    `json:"hooks,omitempty"`
 }
 
 var config Config
 var configPath string
 
 func Parse(configPathArg string) error {
-	file, err := os.Open(configPathArg)
+	parsed, err := Load(configPathArg)
 	if err != nil {
-		return fmt.Errorf("config: could not open open config file for reading")
+		return err
+	}
+	config = *parsed
+
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// reads and validates the config at "path", without making it the config
+// returned by Get
+func Load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: could not open config file %s for reading: %w", path, err)
 	}
 	defer file.Close()
 	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
+	// decode into an empty config, so optional keys of a previously
+	// parsed config do not leak into this one
+	var parsed Config
+	err = decoder.Decode(&parsed)
 	if err != nil {
-		return fmt.Errorf("config: malformed config %s: %w", configPathArg, err)
+		return nil, fmt.Errorf("config: malformed config %s: %w", path, err)
 	}
-	err = validate(&config)
+	err = validate(&parsed)
 	if err != nil {
-		return fmt.Errorf("config: could not validate config: %w", err)
+		return nil, fmt.Errorf("config: could not validate config: %w", err)
 	}
+	return &parsed, nil
+}
 
-	configPath, err = filepath.Abs(configPath)
+// validates "c" and writes it to "path". it is written to a temporary file
+// renamed over "path", so a failed save keeps the previous config. configs
+// hold credentials, only the owner can read them
+func Save(path string, c *Config) error {
+	err := validate(c)
 	if err != nil {
-		return err
+		return fmt.Errorf("config: could not validate config: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("config: could not encode config: %w", err)
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("config: could not create %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".config-*.json")
+	if err != nil {
+		return fmt.Errorf("config: could not create temporary file in %s: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Chmod(0600)
+	if err == nil {
+		_, err = tmp.Write(append(data, '\n'))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("config: could not write %s: %w", tmp.Name(), err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("config: could not save %s: %w", path, err)
 	}
 	return nil
 }
@@ -131,12 +234,36 @@ func DumpDefaultConfig() string {
 }
 
 func validate(c *Config) error {
-	if !slices.Contains([]ArchiveFormat{AF_TARGZ}, c.ArchiveFormat) {
+	if !slices.Contains([]ArchiveFormat{AF_TARGZ, AF_REPO}, c.ArchiveFormat) {
 		return fmt.Errorf("unknown archive format")
 	}
 	if !slices.Contains([]Provider{PROVIDER_AWS}, c.Provider) {
 		return fmt.Errorf("unknown provider")
 	}
+	if c.Snapshot != nil {
+		err := validateSnapshot(c.Snapshot)
+		if err != nil {
+			return err
+		}
+	}
 	// NOTE: aws specific keys are validated in aws_validator.go
 	return nil
 }
+
+func validateSnapshot(s *Snapshot) error {
+	switch s.Method {
+	case SNAPSHOT_BTRFS, SNAPSHOT_ZFS, SNAPSHOT_REFLINK:
+	case SNAPSHOT_LVM:
+		if len(s.LvmSize) == 0 {
+			return fmt.Errorf("snapshot: lvm_size is required for lvm snapshots")
+		}
+	case SNAPSHOT_COMMAND:
+		if len(s.PreCommand) == 0 {
+			return fmt.Errorf("snapshot: pre_command is required for command snapshots")
+		}
+	default:
+		return fmt.Errorf("snapshot: unknown method %q, expected one of: %s %s %s %s %s",
+			s.Method, SNAPSHOT_BTRFS, SNAPSHOT_ZFS, SNAPSHOT_LVM, SNAPSHOT_REFLINK, SNAPSHOT_COMMAND)
+	}
+	return nil
+}
@@ -102,3 +102,82 @@ func TestGetDefaultConfigPath(t *testing.T) {
 	assert.NoError(t, err)
 	assert.False(t, info.IsDir())
 }
+
+func TestParse_ObjectLockDoesNotLeak(t *testing.T) {
+	tempDir := t.TempDir()
+	withLock := filepath.Join(tempDir, "with-lock.json")
+	withoutLock := filepath.Join(tempDir, "without-lock.json")
+	assert.NoError(t, os.WriteFile(withLock, []byte(`{
+		"archive_format": "targz",
+		"provider": "aws",
+		"aws": {"bucket_name": "bucket", "object_lock": {"mode": "GOVERNANCE", "retain_days": 30}}
+	}`), 0644))
+	assert.NoError(t, os.WriteFile(withoutLock, []byte(`{
+		"archive_format": "targz",
+		"provider": "aws",
+		"aws": {"bucket_name": "bucket"}
+	}`), 0644))
+
+	assert.NoError(t, Parse(withLock))
+	assert.NotNil(t, Get().Aws.ObjectLock)
+	assert.Equal(t, int64(30), Get().Aws.ObjectLock.RetainDays)
+
+	assert.NoError(t, Parse(withoutLock))
+	assert.Nil(t, Get().Aws.ObjectLock)
+}
+
+func TestParse_Snapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, tc := range map[string]struct {
+		snapshot string
+		valid    bool
+	}{
+		"Btrfs":             {`{"method": "btrfs"}`, true},
+		"LvmWithoutSize":    {`{"method": "lvm"}`, false},
+		"LvmWithSize":       {`{"method": "lvm", "lvm_size": "5G"}`, true},
+		"CommandWithoutPre": {`{"method": "command", "post_command": "true"}`, false},
+		"Command":           {`{"method": "command", "pre_command": "fsfreeze -f /data"}`, true},
+		"Unknown":           {`{"method": "ext4"}`, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, name+".json")
+			err := os.WriteFile(configPath, []byte(`{"archive_format": "targz", "provider": "aws", "snapshot": `+tc.snapshot+`}`), 0644)
+			assert.NoError(t, err)
+			err = Parse(configPath)
+			if tc.valid {
+				assert.NoError(t, err)
+				assert.NotNil(t, Get().Snapshot)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "glesha", "config.json")
+	c := &Config{
+		ArchiveFormat: AF_REPO,
+		Provider:      PROVIDER_AWS,
+		Aws:           &Aws{AccessKey: "key", SecretKey: "secret", BucketName: "bucket"},
+		Exclude:       []string{"*.tmp"},
+	}
+	assert.NoError(t, Save(configPath, c))
+
+	info, err := os.Stat(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	loaded, err := Load(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, c, loaded)
+
+	// an invalid config does not replace the saved one
+	err = Save(configPath, &Config{ArchiveFormat: "zip", Provider: PROVIDER_AWS})
+	assert.Error(t, err)
+	loaded, err = Load(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, c, loaded)
+	entries, err := os.ReadDir(filepath.Dir(configPath))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
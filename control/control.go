@@ -0,0 +1,214 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"glesha/config"
+	L "glesha/logger"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Action string
+
+const (
+	ACTION_PAUSE  Action = "pause"
+	ACTION_RESUME Action = "resume"
+	ACTION_STATUS Action = "status"
+	// stops the task, it can be continued later by running it again
+	ACTION_ABORT Action = "abort"
+)
+
+// returned by Send when no glesha process is running the task
+var ErrNotRunning = errors.New("control: task is not running")
+
+type Request struct {
+	Action Action `json:"action"`
+}
+
+type Response struct {
+	Ok     bool   `json:"ok"`
+	Paused bool   `json:"paused"`
+	Phase  string `json:"phase,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Handler is implemented by whatever runs a task, Server forwards
+// requests received on the control socket to it
+type Handler interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	Abort(ctx context.Context) error
+	Status(ctx context.Context) Response
+}
+
+type Server struct {
+	taskId   int64
+	path     string
+	listener net.Listener
+	handler  Handler
+	wg       sync.WaitGroup
+}
+
+// returns the control socket path for task "taskId"
+func GetSocketPath(taskId int64) (string, error) {
+	configDir, err := config.GetDefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "control", fmt.Sprintf("task-%d.sock", taskId)), nil
+}
+
+// starts listening on the control socket of task "taskId".
+// fails if another glesha process is already serving the same task
+func Listen(ctx context.Context, taskId int64, handler Handler) (*Server, error) {
+	path, err := GetSocketPath(taskId)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("control: could not create socket dir: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control: task %d is already running in another glesha process", taskId)
+		}
+		// left behind by a process that did not exit cleanly
+		L.Debug(fmt.Sprintf("control: removing stale socket %s", path))
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("control: could not listen on %s: %w", path, err)
+	}
+	s := &Server{
+		taskId:   taskId,
+		path:     path,
+		listener: listener,
+		handler:  handler,
+	}
+	s.wg.Add(1)
+	go s.serve(ctx)
+	L.Debug(fmt.Sprintf("control: listening on %s", path))
+	return s, nil
+}
+
+func (s *Server) serve(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				L.Warn(fmt.Sprintf("control: could not accept connection: %v", err))
+			}
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req Request
+	var res Response
+	err = json.Unmarshal(line, &req)
+	if err != nil {
+		res = Response{Error: fmt.Sprintf("invalid request: %v", err)}
+	} else {
+		res = s.dispatch(ctx, req)
+	}
+	out, _ := json.Marshal(res)
+	conn.Write(append(out, '\n'))
+}
+
+func (s *Server) dispatch(ctx context.Context, req Request) Response {
+	var err error
+	switch req.Action {
+	case ACTION_PAUSE:
+		err = s.handler.Pause(ctx)
+	case ACTION_RESUME:
+		err = s.handler.Resume(ctx)
+	case ACTION_ABORT:
+		err = s.handler.Abort(ctx)
+	case ACTION_STATUS:
+	default:
+		return Response{Error: fmt.Sprintf("unsupported action: %s", req.Action)}
+	}
+	res := s.handler.Status(ctx)
+	res.Ok = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// stops accepting requests and removes the socket file
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+// sends "action" to the glesha process running task "taskId"
+func Send(ctx context.Context, taskId int64, action Action) (*Response, error) {
+	path, err := GetSocketPath(taskId)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrNotRunning, taskId)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	out, err := json.Marshal(Request{Action: action})
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(append(out, '\n'))
+	if err != nil {
+		return nil, fmt.Errorf("control: could not send request: %w", err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("control: could not read response: %w", err)
+	}
+	var res Response
+	err = json.Unmarshal(line, &res)
+	if err != nil {
+		return nil, fmt.Errorf("control: invalid response: %w", err)
+	}
+	if !res.Ok {
+		return &res, fmt.Errorf("control: %s", strings.TrimSpace(res.Error))
+	}
+	return &res, nil
+}
+
+// reports whether some glesha process is serving the control socket of task "taskId"
+func IsRunning(ctx context.Context, taskId int64) bool {
+	_, err := Send(ctx, taskId, ACTION_STATUS)
+	return !errors.Is(err, ErrNotRunning)
+}
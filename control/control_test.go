@@ -0,0 +1,123 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testHandler struct {
+	gate    *Gate
+	aborted bool
+}
+
+func (h *testHandler) Pause(ctx context.Context) error {
+	if !h.gate.Pause() {
+		return fmt.Errorf("already paused")
+	}
+	return nil
+}
+
+func (h *testHandler) Resume(ctx context.Context) error {
+	if !h.gate.Resume() {
+		return fmt.Errorf("not paused")
+	}
+	return nil
+}
+
+func (h *testHandler) Abort(ctx context.Context) error {
+	h.aborted = true
+	return nil
+}
+
+func (h *testHandler) Status(ctx context.Context) Response {
+	return Response{Paused: h.gate.IsPaused(), Phase: "upload"}
+}
+
+func TestGate(t *testing.T) {
+	t.Run("NilGate", func(t *testing.T) {
+		var g *Gate
+		assert.False(t, g.IsPaused())
+		assert.NoError(t, g.Wait(context.Background()))
+	})
+
+	t.Run("PauseResume", func(t *testing.T) {
+		g := NewGate()
+		assert.True(t, g.Pause())
+		assert.False(t, g.Pause())
+		assert.True(t, g.IsPaused())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- g.Wait(context.Background())
+		}()
+		select {
+		case <-done:
+			t.Fatal("Wait returned while gate is paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.True(t, g.Resume())
+		assert.False(t, g.Resume())
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		g := NewGate()
+		g.Pause()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, g.Wait(ctx), context.Canceled)
+	})
+}
+
+func TestServer(t *testing.T) {
+	tempHome, err := os.MkdirTemp("", "test-home")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempHome)
+	t.Setenv("HOME", tempHome)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	ctx := context.Background()
+
+	_, err = Send(ctx, 1, ACTION_STATUS)
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	handler := &testHandler{gate: NewGate()}
+	server, err := Listen(ctx, 1, handler)
+	assert.NoError(t, err)
+
+	t.Run("AlreadyRunning", func(t *testing.T) {
+		_, err := Listen(ctx, 1, handler)
+		assert.Error(t, err)
+	})
+
+	t.Run("PauseResume", func(t *testing.T) {
+		res, err := Send(ctx, 1, ACTION_PAUSE)
+		assert.NoError(t, err)
+		assert.True(t, res.Paused)
+		assert.Equal(t, "upload", res.Phase)
+
+		res, err = Send(ctx, 1, ACTION_PAUSE)
+		assert.EqualError(t, err, "control: already paused")
+		assert.True(t, res.Paused)
+
+		res, err = Send(ctx, 1, ACTION_RESUME)
+		assert.NoError(t, err)
+		assert.False(t, res.Paused)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		_, err := Send(ctx, 1, ACTION_ABORT)
+		assert.NoError(t, err)
+		assert.True(t, handler.aborted)
+	})
+
+	assert.NoError(t, server.Close())
+	path, err := GetSocketPath(1)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, path)
+}
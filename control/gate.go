@@ -0,0 +1,70 @@
+package control
+
+import (
+	"context"
+	"sync"
+)
+
+// Gate lets long running work stop at safe points while paused.
+// a nil *Gate is never paused
+type Gate struct {
+	mu       sync.Mutex
+	paused   bool
+	resumeCh chan struct{}
+}
+
+func NewGate() *Gate {
+	return &Gate{}
+}
+
+// pauses the gate, returns false if it was already paused
+func (g *Gate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.resumeCh = make(chan struct{})
+	return true
+}
+
+// resumes the gate, returns false if it was not paused
+func (g *Gate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resumeCh)
+	return true
+}
+
+func (g *Gate) IsPaused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// blocks while the gate is paused, returns ctx.Err() if ctx is done first
+func (g *Gate) Wait(ctx context.Context) error {
+	if g == nil {
+		return ctx.Err()
+	}
+	g.mu.Lock()
+	paused, resumeCh := g.paused, g.resumeCh
+	g.mu.Unlock()
+	if !paused {
+		return ctx.Err()
+	}
+	select {
+	case <-resumeCh:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,73 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"0 2 * * *",
+		"*/15 9-17 * * mon-fri",
+		"0 0 1,15 * *",
+		"5/10 * * jan,jul sun",
+		"0 0 * * 7",
+		"@daily",
+		"@HOURLY",
+	}
+	for _, expr := range valid {
+		_, err := Parse(expr)
+		assert.NoError(t, err, expr)
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"@every",
+		"a * * * *",
+	}
+	for _, expr := range invalid {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	loc := time.UTC
+	// 2025-01-15 is a wednesday
+	from := time.Date(2025, 1, 15, 10, 30, 45, 0, loc)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 15, 10, 31, 0, 0, loc)},
+		{"0 2 * * *", time.Date(2025, 1, 16, 2, 0, 0, 0, loc)},
+		{"30 10 * * *", time.Date(2025, 1, 16, 10, 30, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, loc)},
+		{"0 9-17 * * mon-fri", time.Date(2025, 1, 15, 11, 0, 0, 0, loc)},
+		{"0 0 * * sun", time.Date(2025, 1, 19, 0, 0, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2025, 1, 19, 0, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, loc)},
+		{"@yearly", time.Date(2026, 1, 1, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		// day of month OR day of week when both are restricted
+		{"0 0 20 * fri", time.Date(2025, 1, 17, 0, 0, 0, 0, loc)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, s.Next(from), tt.expr)
+	}
+}
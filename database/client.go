@@ -43,6 +43,12 @@ const CREATE_INDICES_ON_UPLOADS = `
 CREATE INDEX IF NOT EXISTS idx_uploads_status ON uploads(status, task_id);
 `
 
+const CREATE_INDICES_ON_FILE_CATALOG = `
+CREATE INDEX IF NOT EXISTS idx_file_catalog_sha256 ON file_catalog(sha256);
+CREATE INDEX IF NOT EXISTS idx_file_catalog_parent_path ON file_catalog(task_id, parent_path);
+CREATE INDEX IF NOT EXISTS idx_file_catalog_full_path ON file_catalog(task_id, full_path);
+`
+
 const CREATE_INDICES_ON_UPLOAD_BLOCKS = `
 CREATE INDEX IF NOT EXISTS idx_upload_status ON upload_blocks(upload_id, status);
 `
@@ -61,8 +67,33 @@ func (d *DB) createTables(ctx context.Context) error {
 
 	stmts := []string{
 		model.CREATE_TASKS_TABLE, model.CREATE_UPLOADS_TABLE, model.CREATE_UPLOAD_BLOCKS_TABLE,
-		model.CREATE_FILE_CATALOG_TABLE,
-		CREATE_INDICES_ON_UPLOADS, CREATE_INDICES_ON_UPLOAD_BLOCKS,
+		model.CREATE_FILE_CATALOG_TABLE, model.CREATE_SCHEDULES_TABLE, model.CREATE_RETENTION_POLICIES_TABLE,
+		model.CREATE_PACKS_TABLE, model.CREATE_CHUNKS_TABLE, model.CREATE_HOOK_RUNS_TABLE,
+		model.CREATE_ARCHIVE_MEMBERS_TABLE,
+	}
+
+	for _, stmt := range stmts {
+		_, err = txn.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// tables created by older versions need new columns before
+	// indices and triggers can refer to them
+	err = migrateColumns(ctx, txn)
+	if err != nil {
+		return err
+	}
+
+	ftsExists, err := tableExists(ctx, txn, "file_catalog_fts")
+	if err != nil {
+		return err
+	}
+
+	stmts = []string{
+		model.CREATE_FILE_CATALOG_FTS, model.CREATE_FILE_CATALOG_FTS_TRIGGERS,
+		CREATE_INDICES_ON_UPLOADS, CREATE_INDICES_ON_UPLOAD_BLOCKS, CREATE_INDICES_ON_FILE_CATALOG,
 		model.CREATE_UPDATE_UPLOAD_PROGRESS_TRIGGER,
 	}
 
@@ -73,6 +104,13 @@ func (d *DB) createTables(ctx context.Context) error {
 		}
 	}
 
+	if !ftsExists {
+		_, err = txn.ExecContext(ctx, model.REBUILD_FILE_CATALOG_FTS)
+		if err != nil {
+			return fmt.Errorf("could not index file catalog: %w", err)
+		}
+	}
+
 	err = txn.Commit()
 	if err != nil {
 		return err
@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
+	"glesha/database/model"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +76,27 @@ func TestGetDBFilePath(t *testing.T) {
 	expectedPath := filepath.Join(tempHome, ".config", "glesha", "glesha-db.db")
 	assert.Equal(t, expectedPath, dbPath)
 }
+
+func TestDB_migrateColumns(t *testing.T) {
+	db, err := NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(context.Background())
+
+	// uploads table as created by older versions
+	oldUploadsTable := strings.Replace(model.CREATE_UPLOADS_TABLE, "file_sample_hash TEXT,\n", "", 1)
+	_, err = db.D.Exec(oldUploadsTable)
+	assert.NoError(t, err)
+
+	err = db.createTables(context.Background())
+	assert.NoError(t, err)
+
+	txn, err := db.D.Begin()
+	assert.NoError(t, err)
+	defer txn.Rollback()
+	exists, err := columnExists(context.Background(), txn, "uploads", "file_sample_hash")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// running again must not fail on existing columns
+	assert.NoError(t, migrateColumns(context.Background(), txn))
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	L "glesha/logger"
+)
+
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// columns added after the first release, CREATE TABLE statements in
+// database/model already contain them, these are only applied to
+// databases created by older versions
+// NOTE: only append to this list
+var columnMigrations = []columnMigration{
+	{table: "uploads", column: "file_sample_hash", definition: "TEXT"},
+	{table: "tasks", column: "priority", definition: "INTEGER DEFAULT 0"},
+	{table: "tasks", column: "filter_patterns", definition: "TEXT DEFAULT ''"},
+	{table: "schedules", column: "filter_patterns", definition: "TEXT DEFAULT ''"},
+	{table: "tasks", column: "input_paths", definition: "TEXT DEFAULT ''"},
+	{table: "file_catalog", column: "root", definition: "TEXT DEFAULT ''"},
+	{table: "file_catalog", column: "uid", definition: "INTEGER DEFAULT 0"},
+	{table: "file_catalog", column: "gid", definition: "INTEGER DEFAULT 0"},
+	{table: "file_catalog", column: "mode", definition: "INTEGER DEFAULT 0"},
+	{table: "file_catalog", column: "uname", definition: "TEXT DEFAULT ''"},
+	{table: "file_catalog", column: "gname", definition: "TEXT DEFAULT ''"},
+	{table: "tasks", column: "snapshot", definition: "TEXT DEFAULT ''"},
+	{table: "file_catalog", column: "archive_offset", definition: "INTEGER DEFAULT -1"},
+	{table: "file_catalog", column: "archive_size", definition: "INTEGER DEFAULT 0"},
+	{table: "file_catalog", column: "archive_member", definition: "INTEGER DEFAULT -1"},
+	{table: "file_catalog", column: "sha256", definition: "TEXT DEFAULT ''"},
+	{table: "upload_blocks", column: "worker_id", definition: "INTEGER DEFAULT 0"},
+	{table: "upload_blocks", column: "started_at", definition: "TEXT"},
+}
+
+func migrateColumns(ctx context.Context, txn *sql.Tx) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(ctx, txn, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		_, err = txn.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("could not add column %s to %s: %w", m.column, m.table, err)
+		}
+		L.Debug(fmt.Sprintf("db: added column %s.%s", m.table, m.column))
+	}
+	return nil
+}
+
+func columnExists(ctx context.Context, txn *sql.Tx, table string, column string) (bool, error) {
+	rows, err := txn.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, fmt.Errorf("could not get columns of table %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func tableExists(ctx context.Context, txn *sql.Tx, table string) (bool, error) {
+	var count int
+	err := txn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("could not check table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+const CREATE_PACKS_TABLE = `
+CREATE TABLE IF NOT EXISTS packs (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+container_id TEXT NOT NULL,
+hash TEXT NOT NULL,
+file_path TEXT NOT NULL,
+size_bytes INTEGER NOT NULL,
+status TEXT NOT NULL,
+
+created_at TEXT NOT NULL,
+uploaded_at TEXT,
+
+UNIQUE(container_id, hash)
+);`
+
+const CREATE_CHUNKS_TABLE = `
+CREATE TABLE IF NOT EXISTS chunks (
+container_id TEXT NOT NULL,
+hash TEXT NOT NULL,
+pack_id INTEGER NOT NULL,
+pack_offset INTEGER NOT NULL,
+size_bytes INTEGER NOT NULL,
+
+PRIMARY KEY(container_id, hash),
+FOREIGN KEY(pack_id) REFERENCES packs(id)
+);`
+
+type PackStatus string
+
+const (
+	// written locally by an archive, not uploaded yet
+	PACK_STATUS_PENDING  PackStatus = "PENDING"
+	PACK_STATUS_UPLOADED PackStatus = "UPLOADED"
+)
+
+// Pack is a file of chunks written by a repo archive, uploaded as a
+// single resource to the container with ContainerId
+type Pack struct {
+	Id          int64
+	ContainerId string
+	// sha256 of the pack file, in hex
+	Hash string
+	// removed once the pack is uploaded
+	FilePath   string
+	SizeBytes  int64
+	Status     PackStatus
+	CreatedAt  time.Time
+	UploadedAt time.Time
+}
+
+// Chunk is a deduplicated part of a file, stored once per container
+type Chunk struct {
+	ContainerId string
+	// sha256 of the chunk contents, in hex
+	Hash     string
+	PackId   int64
+	PackHash string
+	// offset of the chunk in its pack
+	Offset    int64
+	SizeBytes int64
+}
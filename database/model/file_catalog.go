@@ -1,6 +1,11 @@
 package model
 
-import "time"
+import (
+	"glesha/config"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 const CREATE_FILE_CATALOG_TABLE = `
 CREATE TABLE IF NOT EXISTS file_catalog (
@@ -14,10 +19,62 @@ parent_path TEXT,
 file_type TEXT NOT NULL,
 size_bytes INTEGER,
 modified_at TEXT,
+root TEXT DEFAULT '',
+uid INTEGER DEFAULT 0,
+gid INTEGER DEFAULT 0,
+mode INTEGER DEFAULT 0,
+uname TEXT DEFAULT '',
+gname TEXT DEFAULT '',
+archive_offset INTEGER DEFAULT -1,
+archive_size INTEGER DEFAULT 0,
+archive_member INTEGER DEFAULT -1,
+sha256 TEXT DEFAULT '',
 
 FOREIGN KEY(task_id) REFERENCES tasks(id) ON DELETE CASCADE
 );`
 
+const CREATE_ARCHIVE_MEMBERS_TABLE = `
+CREATE TABLE IF NOT EXISTS archive_members (
+task_id INTEGER NOT NULL,
+member_index INTEGER NOT NULL,
+compressed_offset INTEGER NOT NULL,
+uncompressed_offset INTEGER NOT NULL,
+
+PRIMARY KEY(task_id, member_index),
+FOREIGN KEY(task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);`
+
+// trigram index of catalog paths, kept in sync by triggers, so substring
+// searches over all tasks do not scan the whole catalog
+const CREATE_FILE_CATALOG_FTS = `
+CREATE VIRTUAL TABLE IF NOT EXISTS file_catalog_fts USING fts5(
+full_path,
+content='file_catalog',
+content_rowid='id',
+tokenize='trigram'
+);`
+
+const CREATE_FILE_CATALOG_FTS_TRIGGERS = `
+CREATE TRIGGER IF NOT EXISTS file_catalog_fts_insert AFTER INSERT ON file_catalog
+BEGIN
+  INSERT INTO file_catalog_fts(rowid, full_path) VALUES (new.id, new.full_path);
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_catalog_fts_delete AFTER DELETE ON file_catalog
+BEGIN
+  INSERT INTO file_catalog_fts(file_catalog_fts, rowid, full_path) VALUES ('delete', old.id, old.full_path);
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_catalog_fts_update AFTER UPDATE OF full_path ON file_catalog
+BEGIN
+  INSERT INTO file_catalog_fts(file_catalog_fts, rowid, full_path) VALUES ('delete', old.id, old.full_path);
+  INSERT INTO file_catalog_fts(rowid, full_path) VALUES (new.id, new.full_path);
+END;
+`
+
+// fills the index from catalogs written before it existed
+const REBUILD_FILE_CATALOG_FTS = `INSERT INTO file_catalog_fts(file_catalog_fts) VALUES ('rebuild');`
+
 type FileCatalogRow struct {
 	Id         int64     `json:"id"`
 	TaskId     int64     `json:"task_id"`
@@ -27,4 +84,94 @@ type FileCatalogRow struct {
 	FileType   string    `json:"file_type"` // 'file' | 'dir'
 	SizeBytes  int64     `json:"size_bytes"`
 	ModifiedAt time.Time `json:"modified_at"`
+	// input path the entry was archived from
+	Root  string `json:"root"`
+	Uid   int    `json:"uid"`
+	Gid   int    `json:"gid"`
+	Uname string `json:"uname"`
+	Gname string `json:"gname"`
+	// fs.FileMode of the entry
+	Mode uint32 `json:"mode"`
+	// offset of the tar header of the entry in the uncompressed archive,
+	// and bytes up to the next entry. -1 if the archive has no offsets
+	ArchiveOffset int64 `json:"archive_offset"`
+	ArchiveSize   int64 `json:"archive_size"`
+	// index of the gzip member the entry starts in
+	ArchiveMember int64 `json:"archive_member"`
+	// hex sha256 of the archived content of regular files, empty for other
+	// entries and files that changed while being archived
+	Sha256 string `json:"sha256"`
+}
+
+// returns the path the entry was archived from, the first element of
+// FullPath is the archive name of Root, unless Root is the filesystem root
+func (r *FileCatalogRow) SourcePath() string {
+	if len(r.Root) == 0 {
+		return r.FullPath
+	}
+	if filepath.Dir(r.Root) == r.Root {
+		return filepath.Join(r.Root, r.FullPath)
+	}
+	_, rel, ok := strings.Cut(r.FullPath, string(filepath.Separator))
+	if !ok {
+		return r.Root
+	}
+	return filepath.Join(r.Root, rel)
+}
+
+// CatalogSearch selects catalog entries of all tasks
+type CatalogSearch struct {
+	// only entries of this task, 0 for all tasks
+	TaskId int64
+	// text every matching full path contains, matched case insensitively
+	// using the trigram index. at least 3 characters, or empty to scan
+	Substring string
+	// exact match on the full path, nil matches every entry
+	Match func(fullPath string) bool
+	// size range in bytes, -1 for no bound
+	MinSize int64
+	MaxSize int64
+	// modification time range, zero for no bound
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// stop after this many hits, 0 for no limit
+	Limit int
+}
+
+// CatalogHit is a catalog entry found by a search with the state of the
+// backup it is in
+type CatalogHit struct {
+	FileCatalogRow
+	Path         string          `json:"path"`
+	Provider     config.Provider `json:"provider"`
+	TaskStatus   TaskStatus      `json:"task_status"`
+	UploadStatus UploadStatus    `json:"upload_status"`
+	// metadata the storage backend saved for the upload, only the
+	// backend knows its schema
+	StorageMetadataJson          string `json:"-"`
+	StorageMetadataSchemaVersion int64  `json:"-"`
+	// set from the metadata by the caller, empty if it is not known
+	StorageClass string `json:"storage_class"`
+}
+
+// DuplicateGroup is a set of files in a task with the same content
+type DuplicateGroup struct {
+	Sha256    string
+	SizeBytes int64
+	Paths     []string
+}
+
+// returns the bytes that would be saved by keeping a single copy
+func (g *DuplicateGroup) WastedBytes() int64 {
+	return g.SizeBytes * int64(len(g.Paths)-1)
+}
+
+// ArchiveMember is a gzip member of a tar.gz archive, each member can be
+// decompressed on its own, so an entry can be read by downloading only
+// the members it is in
+type ArchiveMember struct {
+	TaskId             int64 `json:"task_id"`
+	Index              int64 `json:"index"`
+	CompressedOffset   int64 `json:"compressed_offset"`
+	UncompressedOffset int64 `json:"uncompressed_offset"`
 }
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+const CREATE_HOOK_RUNS_TABLE = `
+CREATE TABLE IF NOT EXISTS hook_runs (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+task_id INTEGER NOT NULL,
+hook TEXT NOT NULL,
+command TEXT NOT NULL,
+exit_code INTEGER NOT NULL,
+stdout TEXT NOT NULL DEFAULT '',
+stderr TEXT NOT NULL DEFAULT '',
+
+started_at TEXT NOT NULL,
+finished_at TEXT NOT NULL,
+
+FOREIGN KEY(task_id) REFERENCES tasks(id)
+);`
+
+type Hook string
+
+const (
+	// runs before archiving, a failing pre archive hook aborts the task
+	HOOK_PRE_ARCHIVE  Hook = "pre_archive"
+	HOOK_POST_ARCHIVE Hook = "post_archive"
+	HOOK_POST_UPLOAD  Hook = "post_upload"
+	HOOK_ON_FAILURE   Hook = "on_failure"
+)
+
+// HookRun is a single run of a hook command of a task
+type HookRun struct {
+	Id      int64
+	TaskId  int64
+	Hook    Hook
+	Command string
+	// -1 if the command could not be started or was killed
+	ExitCode   int
+	Stdout     string
+	Stderr     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+const CREATE_RETENTION_POLICIES_TABLE = `
+CREATE TABLE IF NOT EXISTS retention_policies (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+input_path TEXT NOT NULL UNIQUE,
+
+keep_last INTEGER NOT NULL DEFAULT 0,
+keep_daily INTEGER NOT NULL DEFAULT 0,
+keep_weekly INTEGER NOT NULL DEFAULT 0,
+keep_monthly INTEGER NOT NULL DEFAULT 0,
+
+created_at TEXT NOT NULL,
+updated_at TEXT NOT NULL
+);`
+
+// RetentionPolicy decides which uploaded backups of InputPath are kept
+// by 'glesha prune', a backup kept by any of the rules is not removed
+type RetentionPolicy struct {
+	Id        int64
+	InputPath string
+	// number of most recent backups to keep
+	KeepLast int64
+	// number of days, weeks and months for which the most recent backup is kept
+	KeepDaily   int64
+	KeepWeekly  int64
+	KeepMonthly int64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// returns true if the policy does not keep anything, such policies are
+// ignored instead of removing every backup
+func (p *RetentionPolicy) IsEmpty() bool {
+	return p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0 && p.KeepMonthly <= 0
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"glesha/config"
+	"time"
+)
+
+const CREATE_SCHEDULES_TABLE = `
+CREATE TABLE IF NOT EXISTS schedules (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+input_path TEXT NOT NULL,
+output_path TEXT NOT NULL,
+config_path TEXT NOT NULL,
+
+provider TEXT NOT NULL,
+archive_format TEXT NOT NULL,
+
+cron_expr TEXT NOT NULL,
+retain INTEGER NOT NULL DEFAULT 0,
+priority INTEGER NOT NULL DEFAULT 0,
+
+last_run_at TEXT,
+next_run_at TEXT NOT NULL,
+last_task_id INTEGER,
+filter_patterns TEXT DEFAULT '',
+
+created_at TEXT NOT NULL,
+updated_at TEXT NOT NULL
+);`
+
+// Schedule creates a task for InputPath whenever CronExpr is due,
+// see 'glesha help schedule'
+type Schedule struct {
+	Id            int64
+	InputPath     string
+	OutputPath    string
+	ConfigPath    string
+	Provider      config.Provider
+	ArchiveFormat config.ArchiveFormat
+	CronExpr      string
+	// number of uploaded tasks to keep for InputPath, 0 keeps all
+	Retain     int64
+	Priority   int64
+	LastRunAt  time.Time
+	NextRunAt  time.Time
+	LastTaskId *int64
+	// copied to tasks created by the schedule, see Task.FilterPatterns
+	FilterPatterns []string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
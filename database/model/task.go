@@ -5,6 +5,8 @@ import (
 	"glesha/checksum"
 	"glesha/config"
 	L "glesha/logger"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -41,12 +43,19 @@ updated_at TEXT NOT NULL,
 content_hash TEXT NOT NULL,
 size INTEGER NOT NULL,
 file_count INTEGER NOT NULL,
-archived_file_count INTEGER DEFAULT 0
+archived_file_count INTEGER DEFAULT 0,
+priority INTEGER DEFAULT 0,
+filter_patterns TEXT DEFAULT '',
+input_paths TEXT DEFAULT '',
+snapshot TEXT DEFAULT ''
 );`
 
 type Task struct {
-	Id                int64
-	InputPath         string
+	Id int64
+	// first of InputPaths
+	InputPath string
+	// sorted input paths archived by the task, a single path for most tasks
+	InputPaths        []string
 	OutputPath        string
 	ConfigPath        string
 	Status            TaskStatus
@@ -58,18 +67,41 @@ type Task struct {
 	TotalSize         int64
 	TotalFileCount    int64
 	ArchivedFileCount int64
+	// tasks with higher priority are run first by 'glesha run --all-queued'
+	Priority int64
+	// gitignore style patterns excluded from both content hash and archive
+	FilterPatterns []string
+	// snapshot the last archive was created from, empty if it was created
+	// from the input paths directly
+	Snapshot string
 }
 
 func (t *Task) String() string {
-	return fmt.Sprintf("[Task]\n  Id: %d\n  InputPath: %s\n  OutputPath: %s\n  ConfigPath: %s\n  Provider: %s\n  ArchiveFormat: %s\n  Size: %s\n  TotalFileCount: %d\n",
+	s := fmt.Sprintf("[Task]\n  Id: %d\n  InputPaths: %s\n  OutputPath: %s\n  ConfigPath: %s\n  Provider: %s\n  ArchiveFormat: %s\n  Size: %s\n  TotalFileCount: %d\n",
 		t.Id,
-		t.InputPath,
+		strings.Join(t.InputPaths, ", "),
 		t.OutputPath,
 		t.ConfigPath,
 		t.Provider.String(),
 		t.ArchiveFormat.String(),
 		L.HumanReadableBytes(uint64(t.TotalSize), 2),
 		t.TotalFileCount)
+	if len(t.Snapshot) > 0 {
+		s += fmt.Sprintf("  Snapshot: %s\n", t.Snapshot)
+	}
+	return s
+}
+
+// identifies the set of input paths of the task, backups with the same
+// key are backups of the same data, e.g. for retention policies
+func (t *Task) InputPathsKey() string {
+	return InputPathsKey(t.InputPaths)
+}
+
+// joins "inputPaths" like the PATH environment variable, a single path is
+// its own key
+func InputPathsKey(inputPaths []string) string {
+	return strings.Join(inputPaths, string(filepath.ListSeparator))
 }
 
 func (t *Task) Key() string {
@@ -11,6 +11,7 @@ type UploadStatus string
 const (
 	UPLOAD_STATUS_QUEUED    UploadStatus = "QUEUED"
 	UPLOAD_STATUS_RUNNING   UploadStatus = "UPLOADING"
+	UPLOAD_STATUS_PAUSED    UploadStatus = "PAUSED"
 	UPLOAD_STATUS_ABORTED   UploadStatus = "ABORTED"
 	UPLOAD_STATUS_COMPLETED UploadStatus = "COMPLETED"
 	UPLOAD_STATUS_FAILED    UploadStatus = "FAILED"
@@ -26,6 +27,7 @@ storage_backend_metadata_schema_version INTEGER NOT NULL,
 file_path TEXT NOT NULL,
 file_size INTEGER NOT NULL,
 file_last_modified_at TEXT NOT NULL,
+file_sample_hash TEXT,
 
 uploaded_bytes INTEGER DEFAULT 0,
 uploaded_blocks INTEGER DEFAULT 0,
@@ -50,6 +52,7 @@ type Upload struct {
 	FilePath                            string
 	FileSize                            int64
 	FileLastModifiedAt                  time.Time
+	FileSampleHash                      string
 	UploadedBytes                       int64
 	UploadedBlocks                      int64
 	TotalBlocks                         int64
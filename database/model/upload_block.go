@@ -21,6 +21,8 @@ const CREATE_UPLOAD_BLOCKS_TABLE = `CREATE TABLE IF NOT EXISTS upload_blocks (
 			uploaded_at TEXT,
 			error_message TEXT,
 			error_count INTEGER NOT NULL DEFAULT 0,
+			worker_id INTEGER DEFAULT 0,
+			started_at TEXT,
 
 			FOREIGN KEY(upload_id) REFERENCES uploads(id) ON DELETE CASCADE
 );`
@@ -61,6 +63,10 @@ type UploadBlock struct {
 	UploadedAt   *time.Time
 	ErrorMessage string
 	ErrorCount   int64
+	// worker uploading the block, set when it starts and kept once it
+	// completes or fails, 0 while it is queued
+	WorkerId  int64
+	StartedAt *time.Time
 }
 
 func (ub *UploadBlock) String() string {
@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"glesha/database"
+	"glesha/database/model"
+	"time"
+)
+
+type ChunkRepository interface {
+	// saves a pack written by a repo archive along with its chunks, and
+	// returns the pack id. chunks that are already stored are skipped
+	AddPack(ctx context.Context, pack *model.Pack, chunks []model.Chunk) (int64, error)
+
+	// returns chunk "hash" stored in "containerId", or database.ErrDoesNotExist
+	GetChunk(ctx context.Context, containerId string, hash string) (*model.Chunk, error)
+
+	// returns pack "hash" stored in "containerId", or database.ErrDoesNotExist
+	GetPack(ctx context.Context, containerId string, hash string) (*model.Pack, error)
+
+	// returns packs of "containerId" that are not uploaded yet, oldest first
+	ListPendingPacks(ctx context.Context, containerId string) ([]*model.Pack, error)
+
+	// returns all packs of "containerId", oldest first
+	ListPacks(ctx context.Context, containerId string) ([]*model.Pack, error)
+
+	// returns all chunks stored in "containerId"
+	ListChunks(ctx context.Context, containerId string) ([]*model.Chunk, error)
+
+	MarkPackUploaded(ctx context.Context, packId int64, uploadedAt time.Time) error
+
+	// forgets a pack and its chunks, e.g. when a pending pack file was lost
+	DeletePack(ctx context.Context, packId int64) error
+}
+
+type chunkRepository struct {
+	db *database.DB
+}
+
+func NewChunkRepository(db *database.DB) ChunkRepository {
+	return chunkRepository{db: db}
+}
+
+const selectPacksQuery = `
+  SELECT
+  id,
+  container_id,
+  hash,
+  file_path,
+  size_bytes,
+  status,
+  created_at,
+  uploaded_at
+  FROM packs
+  `
+
+func (c chunkRepository) AddPack(ctx context.Context, pack *model.Pack, chunks []model.Chunk) (int64, error) {
+	txn, err := c.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer txn.Rollback()
+	res, err := txn.ExecContext(ctx,
+		`INSERT INTO packs
+    (container_id,
+    hash,
+    file_path,
+    size_bytes,
+    status,
+    created_at)
+    VALUES
+    (?,?,?,?,?,?)`,
+		pack.ContainerId,
+		pack.Hash,
+		pack.FilePath,
+		pack.SizeBytes,
+		model.PACK_STATUS_PENDING,
+		database.ToTimeStr(pack.CreatedAt),
+	)
+	if err != nil {
+		return -1, fmt.Errorf("could not add pack %s: %w", pack.Hash, err)
+	}
+	packId, err := res.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("could not get last insert id for pack %s: %w", pack.Hash, err)
+	}
+	stmt, err := txn.PrepareContext(ctx,
+		`INSERT INTO chunks
+    (container_id,
+    hash,
+    pack_id,
+    pack_offset,
+    size_bytes)
+    VALUES
+    (?,?,?,?,?)
+    ON CONFLICT(container_id, hash) DO NOTHING`)
+	if err != nil {
+		return -1, err
+	}
+	defer stmt.Close()
+	for _, chunk := range chunks {
+		_, err = stmt.ExecContext(ctx, pack.ContainerId, chunk.Hash, packId, chunk.Offset, chunk.SizeBytes)
+		if err != nil {
+			return -1, fmt.Errorf("could not add chunk %s of pack %s: %w", chunk.Hash, pack.Hash, err)
+		}
+	}
+	err = txn.Commit()
+	if err != nil {
+		return -1, err
+	}
+	return packId, nil
+}
+
+func (c chunkRepository) GetChunk(ctx context.Context, containerId string, hash string) (*model.Chunk, error) {
+	q := `
+  SELECT
+  c.container_id,
+  c.hash,
+  c.pack_id,
+  p.hash,
+  c.pack_offset,
+  c.size_bytes
+  FROM chunks c
+  JOIN packs p ON p.id = c.pack_id
+  WHERE c.container_id=? AND c.hash=?
+  `
+	var chunk model.Chunk
+	err := c.db.D.QueryRowContext(ctx, q, containerId, hash).Scan(
+		&chunk.ContainerId,
+		&chunk.Hash,
+		&chunk.PackId,
+		&chunk.PackHash,
+		&chunk.Offset,
+		&chunk.SizeBytes,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, database.ErrDoesNotExist
+		}
+		return nil, fmt.Errorf("could not get chunk %s: %w", hash, err)
+	}
+	return &chunk, nil
+}
+
+func (c chunkRepository) GetPack(ctx context.Context, containerId string, hash string) (*model.Pack, error) {
+	packs, err := c.queryPacks(ctx, selectPacksQuery+"WHERE container_id=? AND hash=?", containerId, hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pack %s: %w", hash, err)
+	}
+	if len(packs) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+	return packs[0], nil
+}
+
+func (c chunkRepository) ListPendingPacks(ctx context.Context, containerId string) ([]*model.Pack, error) {
+	packs, err := c.queryPacks(ctx,
+		selectPacksQuery+"WHERE container_id=? AND status=? ORDER BY id ASC",
+		containerId, model.PACK_STATUS_PENDING)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pending packs: %w", err)
+	}
+	return packs, nil
+}
+
+func (c chunkRepository) ListPacks(ctx context.Context, containerId string) ([]*model.Pack, error) {
+	packs, err := c.queryPacks(ctx, selectPacksQuery+"WHERE container_id=? ORDER BY id ASC", containerId)
+	if err != nil {
+		return nil, fmt.Errorf("could not list packs: %w", err)
+	}
+	return packs, nil
+}
+
+func (c chunkRepository) ListChunks(ctx context.Context, containerId string) ([]*model.Chunk, error) {
+	q := `
+  SELECT
+  c.container_id,
+  c.hash,
+  c.pack_id,
+  p.hash,
+  c.pack_offset,
+  c.size_bytes
+  FROM chunks c
+  JOIN packs p ON p.id = c.pack_id
+  WHERE c.container_id=?
+  `
+	rows, err := c.db.D.QueryContext(ctx, q, containerId)
+	if err != nil {
+		return nil, fmt.Errorf("could not list chunks: %w", err)
+	}
+	defer rows.Close()
+	var chunks []*model.Chunk
+	for rows.Next() {
+		var chunk model.Chunk
+		err := rows.Scan(
+			&chunk.ContainerId,
+			&chunk.Hash,
+			&chunk.PackId,
+			&chunk.PackHash,
+			&chunk.Offset,
+			&chunk.SizeBytes,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not list chunks: %w", err)
+		}
+		chunks = append(chunks, &chunk)
+	}
+	return chunks, rows.Err()
+}
+
+func (c chunkRepository) MarkPackUploaded(ctx context.Context, packId int64, uploadedAt time.Time) error {
+	res, err := c.db.D.ExecContext(ctx,
+		"UPDATE packs SET status=?, uploaded_at=? WHERE id=?",
+		model.PACK_STATUS_UPLOADED,
+		database.ToTimeStr(uploadedAt),
+		packId)
+	if err != nil {
+		return fmt.Errorf("could not mark pack %d as uploaded: %w", packId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not mark pack %d as uploaded: %w", packId, err)
+	}
+	if rowsAffected != 1 {
+		return fmt.Errorf("was expecting %d row updates, but %d rows were updated", 1, rowsAffected)
+	}
+	return nil
+}
+
+func (c chunkRepository) DeletePack(ctx context.Context, packId int64) error {
+	txn, err := c.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+	_, err = txn.ExecContext(ctx, "DELETE FROM chunks WHERE pack_id=?", packId)
+	if err != nil {
+		return fmt.Errorf("could not delete chunks of pack %d: %w", packId, err)
+	}
+	res, err := txn.ExecContext(ctx, "DELETE FROM packs WHERE id=?", packId)
+	if err != nil {
+		return fmt.Errorf("could not delete pack %d: %w", packId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete pack %d: %w", packId, err)
+	}
+	if rowsAffected == 0 {
+		return database.ErrDoesNotExist
+	}
+	return txn.Commit()
+}
+
+func (c chunkRepository) queryPacks(ctx context.Context, q string, args ...any) ([]*model.Pack, error) {
+	rows, err := c.db.D.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var packs []*model.Pack
+	for rows.Next() {
+		var p model.Pack
+		var createdAtStr string
+		var uploadedAtStr sql.NullString
+		err := rows.Scan(
+			&p.Id,
+			&p.ContainerId,
+			&p.Hash,
+			&p.FilePath,
+			&p.SizeBytes,
+			&p.Status,
+			&createdAtStr,
+			&uploadedAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.CreatedAt = database.FromTimeStr(createdAtStr)
+		if uploadedAtStr.Valid {
+			p.UploadedAt = database.FromTimeStr(uploadedAtStr.String)
+		}
+		packs = append(packs, &p)
+	}
+	return packs, rows.Err()
+}
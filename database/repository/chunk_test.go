@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glesha/database"
+	"glesha/database/model"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestChunks(t *testing.T) {
+	db := setupTestDB(t)
+	chunkRepo := NewChunkRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	_, err := chunkRepo.GetChunk(ctx, "s3://bucket", "chunk-a")
+	assert.Equal(t, database.ErrDoesNotExist, err)
+
+	pack := &model.Pack{ContainerId: "s3://bucket", Hash: "pack-1", FilePath: "/packs/pack-1", SizeBytes: 30, CreatedAt: time.Now()}
+	packId, err := chunkRepo.AddPack(ctx, pack, []model.Chunk{
+		{Hash: "chunk-a", Offset: 0, SizeBytes: 10},
+		{Hash: "chunk-b", Offset: 10, SizeBytes: 20},
+	})
+	assert.NoError(t, err)
+
+	chunk, err := chunkRepo.GetChunk(ctx, "s3://bucket", "chunk-b")
+	assert.NoError(t, err)
+	assert.Equal(t, packId, chunk.PackId)
+	assert.Equal(t, "pack-1", chunk.PackHash)
+	assert.Equal(t, int64(10), chunk.Offset)
+	assert.Equal(t, int64(20), chunk.SizeBytes)
+
+	// chunks are stored per container
+	_, err = chunkRepo.GetChunk(ctx, "s3://other-bucket", "chunk-a")
+	assert.Equal(t, database.ErrDoesNotExist, err)
+
+	// chunks that are already stored keep their pack
+	pack2 := &model.Pack{ContainerId: "s3://bucket", Hash: "pack-2", FilePath: "/packs/pack-2", SizeBytes: 15, CreatedAt: time.Now()}
+	pack2Id, err := chunkRepo.AddPack(ctx, pack2, []model.Chunk{
+		{Hash: "chunk-a", Offset: 0, SizeBytes: 10},
+		{Hash: "chunk-c", Offset: 10, SizeBytes: 5},
+	})
+	assert.NoError(t, err)
+	chunk, err = chunkRepo.GetChunk(ctx, "s3://bucket", "chunk-a")
+	assert.NoError(t, err)
+	assert.Equal(t, packId, chunk.PackId)
+
+	pending, err := chunkRepo.ListPendingPacks(ctx, "s3://bucket")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	assert.NoError(t, chunkRepo.MarkPackUploaded(ctx, packId, time.Now()))
+	p, err := chunkRepo.GetPack(ctx, "s3://bucket", "pack-1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.PACK_STATUS_UPLOADED, p.Status)
+	assert.False(t, p.UploadedAt.IsZero())
+	pending, err = chunkRepo.ListPendingPacks(ctx, "s3://bucket")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, pack2Id, pending[0].Id)
+
+	packs, err := chunkRepo.ListPacks(ctx, "s3://bucket")
+	assert.NoError(t, err)
+	assert.Len(t, packs, 2)
+	assert.Equal(t, packId, packs[0].Id)
+	chunks, err := chunkRepo.ListChunks(ctx, "s3://bucket")
+	assert.NoError(t, err)
+	chunkPacks := make(map[string]string)
+	for _, c := range chunks {
+		chunkPacks[c.Hash] = c.PackHash
+	}
+	assert.Equal(t, map[string]string{"chunk-a": "pack-1", "chunk-b": "pack-1", "chunk-c": "pack-2"}, chunkPacks)
+	chunks, err = chunkRepo.ListChunks(ctx, "s3://other-bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, chunks)
+
+	assert.NoError(t, chunkRepo.DeletePack(ctx, pack2Id))
+	_, err = chunkRepo.GetChunk(ctx, "s3://bucket", "chunk-c")
+	assert.Equal(t, database.ErrDoesNotExist, err)
+	_, err = chunkRepo.GetPack(ctx, "s3://bucket", "pack-2")
+	assert.Equal(t, database.ErrDoesNotExist, err)
+	assert.Equal(t, database.ErrDoesNotExist, chunkRepo.DeletePack(ctx, pack2Id))
+}
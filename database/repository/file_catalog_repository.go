@@ -1,15 +1,47 @@
 package repository
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
+	"fmt"
 	"glesha/database"
 	"glesha/database/model"
 	L "glesha/logger"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
 type FileCatalogRepository interface {
 	AddMany(ctx context.Context, entries []model.FileCatalogRow) error
 	GetByParentPath(ctx context.Context, taskId int64, parentPath string) ([]model.FileCatalogRow, error)
+
+	// returns all entries of "taskId" ordered by full path
+	GetByTaskId(ctx context.Context, taskId int64) ([]model.FileCatalogRow, error)
+
+	// returns the entry "fullPath" of "taskId", or database.ErrDoesNotExist
+	GetByFullPath(ctx context.Context, taskId int64, fullPath string) (*model.FileCatalogRow, error)
+
+	// removes entries and gzip members of "taskId", e.g. before archiving it again
+	DeleteByTaskId(ctx context.Context, taskId int64) error
+
+	// saves the gzip members of a tar.gz archive
+	AddArchiveMembers(ctx context.Context, members []model.ArchiveMember) error
+
+	// returns gzip members of "taskId" ordered by index
+	GetArchiveMembers(ctx context.Context, taskId int64) ([]model.ArchiveMember, error)
+
+	// returns groups of files with the same content in "taskId", the
+	// groups wasting the most space first
+	ListDuplicates(ctx context.Context, taskId int64) ([]model.DuplicateGroup, error)
+
+	// returns entries of all tasks matching "search", newest task first
+	Search(ctx context.Context, search *model.CatalogSearch) ([]model.CatalogHit, error)
+
+	// returns the total size of files under each directory in "parentPath"
+	// of "taskId", keyed by full path
+	GetDirSizes(ctx context.Context, taskId int64, parentPath string) (map[string]int64, error)
 }
 
 type fileCatalogRepository struct {
@@ -33,16 +65,27 @@ func (r *fileCatalogRepository) AddMany(ctx context.Context, entries []model.Fil
   parent_path,
   file_type,
   size_bytes,
-  modified_at)
+  modified_at,
+  root,
+  uid,
+  gid,
+  mode,
+  uname,
+  gname,
+  archive_offset,
+  archive_size,
+  archive_member,
+  sha256)
   VALUES
-  (?, ?, ?, ?, ?, ?, ?)`
+  (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	stmt, err := tx.PrepareContext(ctx, q)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	for _, e := range entries {
-		_, err = stmt.ExecContext(ctx, e.TaskId, e.FullPath, e.Name, e.ParentPath, e.FileType, e.SizeBytes, database.ToTimeStr(e.ModifiedAt))
+		_, err = stmt.ExecContext(ctx, e.TaskId, e.FullPath, e.Name, e.ParentPath, e.FileType, e.SizeBytes, database.ToTimeStr(e.ModifiedAt), e.Root,
+			e.Uid, e.Gid, e.Mode, e.Uname, e.Gname, e.ArchiveOffset, e.ArchiveSize, e.ArchiveMember, e.Sha256)
 		if err != nil {
 			err1 := tx.Rollback()
 			if err1 != nil {
@@ -66,7 +109,17 @@ func (r *fileCatalogRepository) GetByParentPath(ctx context.Context, taskId int6
   parent_path,
   file_type,
   size_bytes,
-  modified_at
+  modified_at,
+  root,
+  uid,
+  gid,
+  mode,
+  uname,
+  gname,
+  archive_offset,
+  archive_size,
+  archive_member,
+  sha256
   FROM file_catalog
   WHERE task_id = ? AND parent_path = ?
   ORDER BY file_type DESC, name ASC
@@ -83,7 +136,8 @@ func (r *fileCatalogRepository) GetByParentPath(ctx context.Context, taskId int6
 	for rows.Next() {
 		var e model.FileCatalogRow
 		var modAtStr string
-		if err := rows.Scan(&e.Id, &e.TaskId, &e.FullPath, &e.Name, &e.ParentPath, &e.FileType, &e.SizeBytes, &modAtStr); err != nil {
+		if err := rows.Scan(&e.Id, &e.TaskId, &e.FullPath, &e.Name, &e.ParentPath, &e.FileType, &e.SizeBytes, &modAtStr, &e.Root,
+			&e.Uid, &e.Gid, &e.Mode, &e.Uname, &e.Gname, &e.ArchiveOffset, &e.ArchiveSize, &e.ArchiveMember, &e.Sha256); err != nil {
 			return nil, err
 		}
 		e.ModifiedAt = database.FromTimeStr(modAtStr)
@@ -91,3 +145,323 @@ func (r *fileCatalogRepository) GetByParentPath(ctx context.Context, taskId int6
 	}
 	return entries, nil
 }
+
+func (r *fileCatalogRepository) GetByTaskId(ctx context.Context, taskId int64) ([]model.FileCatalogRow, error) {
+	q := `
+  SELECT
+  id,
+  task_id,
+  full_path,
+  name,
+  parent_path,
+  file_type,
+  size_bytes,
+  modified_at,
+  root,
+  uid,
+  gid,
+  mode,
+  uname,
+  gname,
+  archive_offset,
+  archive_size,
+  archive_member,
+  sha256
+  FROM file_catalog
+  WHERE task_id = ?
+  ORDER BY full_path ASC
+  `
+	rows, err := r.db.D.QueryContext(ctx, q, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("could not get catalog of task %d: %w", taskId, err)
+	}
+	defer rows.Close()
+	var entries []model.FileCatalogRow
+	for rows.Next() {
+		var e model.FileCatalogRow
+		var modAtStr string
+		if err := rows.Scan(&e.Id, &e.TaskId, &e.FullPath, &e.Name, &e.ParentPath, &e.FileType, &e.SizeBytes, &modAtStr, &e.Root,
+			&e.Uid, &e.Gid, &e.Mode, &e.Uname, &e.Gname, &e.ArchiveOffset, &e.ArchiveSize, &e.ArchiveMember, &e.Sha256); err != nil {
+			return nil, err
+		}
+		e.ModifiedAt = database.FromTimeStr(modAtStr)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *fileCatalogRepository) GetByFullPath(ctx context.Context, taskId int64, fullPath string) (*model.FileCatalogRow, error) {
+	q := `
+  SELECT
+  id,
+  task_id,
+  full_path,
+  name,
+  parent_path,
+  file_type,
+  size_bytes,
+  modified_at,
+  root,
+  uid,
+  gid,
+  mode,
+  uname,
+  gname,
+  archive_offset,
+  archive_size,
+  archive_member,
+  sha256
+  FROM file_catalog
+  WHERE task_id = ? AND full_path = ?
+  ORDER BY id DESC
+  LIMIT 1
+  `
+	var e model.FileCatalogRow
+	var modAtStr string
+	err := r.db.D.QueryRowContext(ctx, q, taskId, fullPath).Scan(&e.Id, &e.TaskId, &e.FullPath, &e.Name, &e.ParentPath, &e.FileType, &e.SizeBytes, &modAtStr, &e.Root,
+		&e.Uid, &e.Gid, &e.Mode, &e.Uname, &e.Gname, &e.ArchiveOffset, &e.ArchiveSize, &e.ArchiveMember, &e.Sha256)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrDoesNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s of task %d: %w", fullPath, taskId, err)
+	}
+	e.ModifiedAt = database.FromTimeStr(modAtStr)
+	return &e, nil
+}
+
+func (r *fileCatalogRepository) DeleteByTaskId(ctx context.Context, taskId int64) error {
+	tx, err := r.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"DELETE FROM file_catalog WHERE task_id=?",
+		"DELETE FROM archive_members WHERE task_id=?",
+	} {
+		_, err = tx.ExecContext(ctx, stmt, taskId)
+		if err != nil {
+			return fmt.Errorf("could not delete catalog of task %d: %w", taskId, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *fileCatalogRepository) AddArchiveMembers(ctx context.Context, members []model.ArchiveMember) error {
+	tx, err := r.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `
+  INSERT OR REPLACE INTO archive_members
+  (task_id,
+  member_index,
+  compressed_offset,
+  uncompressed_offset)
+  VALUES
+  (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range members {
+		_, err = stmt.ExecContext(ctx, m.TaskId, m.Index, m.CompressedOffset, m.UncompressedOffset)
+		if err != nil {
+			return fmt.Errorf("could not add gzip member %d of task %d: %w", m.Index, m.TaskId, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *fileCatalogRepository) GetArchiveMembers(ctx context.Context, taskId int64) ([]model.ArchiveMember, error) {
+	rows, err := r.db.D.QueryContext(ctx, `
+  SELECT
+  task_id,
+  member_index,
+  compressed_offset,
+  uncompressed_offset
+  FROM archive_members
+  WHERE task_id = ?
+  ORDER BY member_index ASC
+  `, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("could not get gzip members of task %d: %w", taskId, err)
+	}
+	defer rows.Close()
+	var members []model.ArchiveMember
+	for rows.Next() {
+		var m model.ArchiveMember
+		err := rows.Scan(&m.TaskId, &m.Index, &m.CompressedOffset, &m.UncompressedOffset)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (r *fileCatalogRepository) ListDuplicates(ctx context.Context, taskId int64) ([]model.DuplicateGroup, error) {
+	rows, err := r.db.D.QueryContext(ctx, `
+  SELECT
+  sha256,
+  size_bytes,
+  full_path
+  FROM file_catalog
+  WHERE task_id = ? AND sha256 IN (
+    SELECT sha256 FROM file_catalog
+    WHERE task_id = ? AND sha256 != ''
+    GROUP BY sha256
+    HAVING COUNT(*) > 1
+  )
+  ORDER BY sha256, full_path
+  `, taskId, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("could not list duplicates of task %d: %w", taskId, err)
+	}
+	defer rows.Close()
+	var groups []model.DuplicateGroup
+	for rows.Next() {
+		var hash, fullPath string
+		var size int64
+		err := rows.Scan(&hash, &size, &fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Sha256 != hash {
+			groups = append(groups, model.DuplicateGroup{Sha256: hash, SizeBytes: size})
+		}
+		last := &groups[len(groups)-1]
+		last.Paths = append(last.Paths, fullPath)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(groups, func(a, b model.DuplicateGroup) int {
+		return cmp.Compare(b.WastedBytes(), a.WastedBytes())
+	})
+	return groups, nil
+}
+
+func (r *fileCatalogRepository) Search(ctx context.Context, search *model.CatalogSearch) ([]model.CatalogHit, error) {
+	var where []string
+	var args []any
+	if search.TaskId > 0 {
+		where = append(where, "fc.task_id = ?")
+		args = append(args, search.TaskId)
+	}
+	// the trigram index can not find shorter text
+	if utf8.RuneCountInString(search.Substring) >= 3 {
+		where = append(where, "fc.id IN (SELECT rowid FROM file_catalog_fts WHERE file_catalog_fts MATCH ?)")
+		args = append(args, `"`+strings.ReplaceAll(search.Substring, `"`, `""`)+`"`)
+	}
+	if search.MinSize >= 0 {
+		where = append(where, "fc.size_bytes >= ?")
+		args = append(args, search.MinSize)
+	}
+	if search.MaxSize >= 0 {
+		where = append(where, "fc.size_bytes <= ?")
+		args = append(args, search.MaxSize)
+	}
+	// times are stored in a sortable format
+	if !search.ModifiedAfter.IsZero() {
+		where = append(where, "fc.modified_at >= ?")
+		args = append(args, database.ToTimeStr(search.ModifiedAfter))
+	}
+	if !search.ModifiedBefore.IsZero() {
+		where = append(where, "fc.modified_at < ?")
+		args = append(args, database.ToTimeStr(search.ModifiedBefore))
+	}
+	q := `
+  SELECT
+  fc.id,
+  fc.task_id,
+  fc.full_path,
+  fc.name,
+  fc.parent_path,
+  fc.file_type,
+  fc.size_bytes,
+  fc.modified_at,
+  fc.root,
+  fc.uid,
+  fc.gid,
+  fc.mode,
+  fc.uname,
+  fc.gname,
+  fc.archive_offset,
+  fc.archive_size,
+  fc.archive_member,
+  fc.sha256,
+  t.provider,
+  t.status,
+  COALESCE(u.status, ''),
+  COALESCE(u.storage_backend_metadata_json, ''),
+  COALESCE(u.storage_backend_metadata_schema_version, 0)
+  FROM file_catalog fc
+  JOIN tasks t ON t.id = fc.task_id
+  LEFT JOIN uploads u ON u.task_id = fc.task_id`
+	if len(where) > 0 {
+		q += "\n  WHERE " + strings.Join(where, " AND ")
+	}
+	q += "\n  ORDER BY fc.task_id DESC, fc.full_path ASC"
+	rows, err := r.db.D.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not search file catalog: %w", err)
+	}
+	defer rows.Close()
+	var hits []model.CatalogHit
+	for rows.Next() {
+		var h model.CatalogHit
+		var modAtStr string
+		e := &h.FileCatalogRow
+		err := rows.Scan(&e.Id, &e.TaskId, &e.FullPath, &e.Name, &e.ParentPath, &e.FileType, &e.SizeBytes, &modAtStr, &e.Root,
+			&e.Uid, &e.Gid, &e.Mode, &e.Uname, &e.Gname, &e.ArchiveOffset, &e.ArchiveSize, &e.ArchiveMember, &e.Sha256,
+			&h.Provider, &h.TaskStatus, &h.UploadStatus, &h.StorageMetadataJson, &h.StorageMetadataSchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+		if search.Match != nil && !search.Match(e.FullPath) {
+			continue
+		}
+		e.ModifiedAt = database.FromTimeStr(modAtStr)
+		h.Path = e.SourcePath()
+		hits = append(hits, h)
+		if search.Limit > 0 && len(hits) >= search.Limit {
+			break
+		}
+	}
+	return hits, rows.Err()
+}
+
+func (r *fileCatalogRepository) GetDirSizes(ctx context.Context, taskId int64, parentPath string) (map[string]int64, error) {
+	// "0" sorts right after "/", so the range holds every path under a
+	// directory and can use the full path index
+	q := `
+  SELECT
+  d.full_path,
+  COALESCE(SUM(f.size_bytes), 0)
+  FROM file_catalog d
+  LEFT JOIN file_catalog f ON f.task_id = d.task_id
+    AND f.full_path > d.full_path || '/'
+    AND f.full_path < d.full_path || '0'
+    AND f.file_type = 'file'
+  WHERE d.task_id = ? AND d.parent_path = ? AND d.file_type = 'dir'
+  GROUP BY d.full_path
+  `
+	rows, err := r.db.D.QueryContext(ctx, q, taskId, parentPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get sizes of directories in %s of task %d: %w", parentPath, taskId, err)
+	}
+	defer rows.Close()
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var fullPath string
+		var size int64
+		if err := rows.Scan(&fullPath, &size); err != nil {
+			return nil, err
+		}
+		sizes[fullPath] = size
+	}
+	return sizes, rows.Err()
+}
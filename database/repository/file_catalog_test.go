@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"glesha/config"
+	"glesha/database/model"
+	"glesha/file_io"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestSearchCatalog(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	catalogRepo := NewFileCatalogRepository(db)
+
+	modifiedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	var taskIds []int64
+	for _, inputPath := range []string{"/home/me/docs", "/home/me/photos"} {
+		taskId, err := taskRepo.CreateTask(ctx, []string{inputPath}, "/output", "/config",
+			config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+			&file_io.FilesInfo{ContentHash: inputPath})
+		assert.NoError(t, err)
+		taskIds = append(taskIds, taskId)
+	}
+	_, err := uploadRepo.CreateUpload(ctx, taskIds[0], `{"storage_class":"DEEP_ARCHIVE"}`, 1,
+		"/output/docs.tar.gz", 2048, time.Now(), "sample-hash", 1, 2048, time.Now(), time.Now())
+	assert.NoError(t, err)
+
+	row := func(taskId int64, root string, fullPath string, size int64, modifiedAt time.Time) model.FileCatalogRow {
+		return model.FileCatalogRow{TaskId: taskId, FullPath: fullPath, FileType: "file",
+			SizeBytes: size, ModifiedAt: modifiedAt, Root: root}
+	}
+	err = catalogRepo.AddMany(ctx, []model.FileCatalogRow{
+		row(taskIds[0], "/home/me/docs", "docs/Taxes/2023.pdf", 100, modifiedAt),
+		row(taskIds[0], "/home/me/docs", "docs/taxes/notes.txt", 10, modifiedAt),
+		row(taskIds[0], "/home/me/docs", "docs/letter.pdf", 5000, modifiedAt.AddDate(-1, 0, 0)),
+	})
+	assert.NoError(t, err)
+	err = catalogRepo.AddMany(ctx, []model.FileCatalogRow{
+		row(taskIds[1], "/home/me/photos", "photos/taxes-receipt.jpg", 300, modifiedAt),
+	})
+	assert.NoError(t, err)
+
+	paths := func(hits []model.CatalogHit) []string {
+		var p []string
+		for _, h := range hits {
+			p = append(p, h.Path)
+		}
+		return p
+	}
+
+	t.Run("Substring", func(t *testing.T) {
+		hits, err := catalogRepo.Search(ctx, &model.CatalogSearch{Substring: "TAXES", MinSize: -1, MaxSize: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"/home/me/photos/taxes-receipt.jpg",
+			"/home/me/docs/Taxes/2023.pdf",
+			"/home/me/docs/taxes/notes.txt",
+		}, paths(hits))
+		assert.Equal(t, model.TASK_STATUS_QUEUED, hits[0].TaskStatus)
+		assert.Empty(t, hits[0].UploadStatus)
+		assert.Equal(t, config.PROVIDER_AWS, hits[0].Provider)
+		assert.Empty(t, hits[0].StorageMetadataJson)
+		assert.Equal(t, model.UPLOAD_STATUS_QUEUED, hits[1].UploadStatus)
+		assert.Equal(t, `{"storage_class":"DEEP_ARCHIVE"}`, hits[1].StorageMetadataJson)
+		assert.Equal(t, int64(1), hits[1].StorageMetadataSchemaVersion)
+	})
+
+	t.Run("MatchSizeAndTime", func(t *testing.T) {
+		re := regexp.MustCompile(`\.pdf$`)
+		hits, err := catalogRepo.Search(ctx, &model.CatalogSearch{
+			Match:   re.MatchString,
+			MinSize: 50,
+			MaxSize: -1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/home/me/docs/Taxes/2023.pdf", "/home/me/docs/letter.pdf"}, paths(hits))
+
+		hits, err = catalogRepo.Search(ctx, &model.CatalogSearch{
+			Match:         re.MatchString,
+			MinSize:       -1,
+			MaxSize:       1000,
+			ModifiedAfter: modifiedAt.AddDate(0, -1, 0),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/home/me/docs/Taxes/2023.pdf"}, paths(hits))
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		hits, err := catalogRepo.Search(ctx, &model.CatalogSearch{MinSize: -1, MaxSize: -1, Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, hits, 2)
+	})
+
+	t.Run("Task", func(t *testing.T) {
+		hits, err := catalogRepo.Search(ctx, &model.CatalogSearch{TaskId: taskIds[1], MinSize: -1, MaxSize: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/home/me/photos/taxes-receipt.jpg"}, paths(hits))
+	})
+
+	t.Run("DeletedEntriesAreNotFound", func(t *testing.T) {
+		assert.NoError(t, catalogRepo.DeleteByTaskId(ctx, taskIds[0]))
+		hits, err := catalogRepo.Search(ctx, &model.CatalogSearch{Substring: "taxes", MinSize: -1, MaxSize: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/home/me/photos/taxes-receipt.jpg"}, paths(hits))
+	})
+}
+
+func TestGetDirSizes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	taskRepo := NewTaskRepository(db)
+	catalogRepo := NewFileCatalogRepository(db)
+
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/home/me/docs"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: "docs"})
+	assert.NoError(t, err)
+
+	entry := func(fullPath string, parentPath string, fileType string, size int64) model.FileCatalogRow {
+		return model.FileCatalogRow{TaskId: taskId, FullPath: fullPath, ParentPath: parentPath,
+			FileType: fileType, SizeBytes: size, ModifiedAt: time.Now()}
+	}
+	err = catalogRepo.AddMany(ctx, []model.FileCatalogRow{
+		entry("docs", ".", "dir", 4096),
+		entry("docs/a", "docs", "dir", 4096),
+		entry("docs/a/1.txt", "docs/a", "file", 10),
+		entry("docs/a/b", "docs/a", "dir", 4096),
+		entry("docs/a/b/2.txt", "docs/a/b", "file", 20),
+		// shares the prefix "docs/a" but is not under it
+		entry("docs/a.txt", "docs", "file", 300),
+		entry("docs/a-b", "docs", "dir", 4096),
+		entry("docs/a-b/3.txt", "docs/a-b", "file", 4000),
+		entry("docs/empty", "docs", "dir", 4096),
+	})
+	assert.NoError(t, err)
+
+	sizes, err := catalogRepo.GetDirSizes(ctx, taskId, "docs")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"docs/a": 30, "docs/a-b": 4000, "docs/empty": 0}, sizes)
+
+	sizes, err = catalogRepo.GetDirSizes(ctx, taskId, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"docs": 4330}, sizes)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"glesha/database"
+	"glesha/database/model"
+)
+
+type HookRunRepository interface {
+	// saves a finished hook run and returns its id
+	AddHookRun(ctx context.Context, run *model.HookRun) (int64, error)
+
+	// returns hook runs of "taskId", oldest first
+	ListHookRuns(ctx context.Context, taskId int64) ([]*model.HookRun, error)
+}
+
+type hookRunRepository struct {
+	db *database.DB
+}
+
+func NewHookRunRepository(db *database.DB) HookRunRepository {
+	return hookRunRepository{db: db}
+}
+
+func (h hookRunRepository) AddHookRun(ctx context.Context, run *model.HookRun) (int64, error) {
+	res, err := h.db.D.ExecContext(ctx,
+		`INSERT INTO hook_runs
+    (task_id,
+    hook,
+    command,
+    exit_code,
+    stdout,
+    stderr,
+    started_at,
+    finished_at)
+    VALUES
+    (?,?,?,?,?,?,?,?)`,
+		run.TaskId,
+		run.Hook,
+		run.Command,
+		run.ExitCode,
+		run.Stdout,
+		run.Stderr,
+		database.ToTimeStr(run.StartedAt),
+		database.ToTimeStr(run.FinishedAt),
+	)
+	if err != nil {
+		return -1, fmt.Errorf("could not add %s hook run of task %d: %w", run.Hook, run.TaskId, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("could not get last insert id for hook run: %w", err)
+	}
+	return id, nil
+}
+
+func (h hookRunRepository) ListHookRuns(ctx context.Context, taskId int64) ([]*model.HookRun, error) {
+	rows, err := h.db.D.QueryContext(ctx,
+		`SELECT
+    id,
+    task_id,
+    hook,
+    command,
+    exit_code,
+    stdout,
+    stderr,
+    started_at,
+    finished_at
+    FROM hook_runs
+    WHERE task_id=?
+    ORDER BY id ASC`, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("could not list hook runs of task %d: %w", taskId, err)
+	}
+	defer rows.Close()
+	var runs []*model.HookRun
+	for rows.Next() {
+		var run model.HookRun
+		var startedAtStr, finishedAtStr string
+		err := rows.Scan(
+			&run.Id,
+			&run.TaskId,
+			&run.Hook,
+			&run.Command,
+			&run.ExitCode,
+			&run.Stdout,
+			&run.Stderr,
+			&startedAtStr,
+			&finishedAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		run.StartedAt = database.FromTimeStr(startedAtStr)
+		run.FinishedAt = database.FromTimeStr(finishedAtStr)
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glesha/config"
+	"glesha/database/model"
+	"glesha/file_io"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestHookRuns(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	taskRepo := NewTaskRepository(db)
+	hookRunRepo := NewHookRunRepository(db)
+
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: "test-hash"})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for _, hook := range []model.Hook{model.HOOK_PRE_ARCHIVE, model.HOOK_ON_FAILURE} {
+		_, err = hookRunRepo.AddHookRun(ctx, &model.HookRun{
+			TaskId:     taskId,
+			Hook:       hook,
+			Command:    "pg_dump app > /input/app.sql",
+			ExitCode:   1,
+			Stderr:     "connection refused",
+			StartedAt:  now,
+			FinishedAt: now.Add(time.Second),
+		})
+		assert.NoError(t, err)
+	}
+	runs, err := hookRunRepo.ListHookRuns(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, model.HOOK_PRE_ARCHIVE, runs[0].Hook)
+	assert.Equal(t, 1, runs[0].ExitCode)
+	assert.Equal(t, "connection refused", runs[0].Stderr)
+	assert.Equal(t, now.Unix(), runs[0].StartedAt.Unix())
+
+	// runs are removed with their task
+	assert.NoError(t, taskRepo.DeleteTask(ctx, taskId))
+	runs, err = hookRunRepo.ListHookRuns(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Empty(t, runs)
+}
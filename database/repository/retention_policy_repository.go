@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"glesha/database"
+	"glesha/database/model"
+	"time"
+)
+
+type RetentionPolicyRepository interface {
+	// creates the policy for "policy.InputPath", or replaces the existing one
+	SetPolicy(ctx context.Context, policy *model.RetentionPolicy) error
+
+	GetPolicyForPath(ctx context.Context, inputPath string) (*model.RetentionPolicy, error)
+
+	ListPolicies(ctx context.Context) ([]*model.RetentionPolicy, error)
+
+	DeletePolicy(ctx context.Context, inputPath string) error
+}
+
+type retentionPolicyRepository struct {
+	db *database.DB
+}
+
+func NewRetentionPolicyRepository(db *database.DB) RetentionPolicyRepository {
+	return retentionPolicyRepository{db: db}
+}
+
+const selectRetentionPoliciesQuery = `
+  SELECT
+  id,
+  input_path,
+  keep_last,
+  keep_daily,
+  keep_weekly,
+  keep_monthly,
+  created_at,
+  updated_at
+  FROM retention_policies
+  `
+
+func (r retentionPolicyRepository) SetPolicy(ctx context.Context, policy *model.RetentionPolicy) error {
+	now := database.ToTimeStr(time.Now())
+	_, err := r.db.D.ExecContext(ctx,
+		`INSERT INTO retention_policies
+    (input_path,
+    keep_last,
+    keep_daily,
+    keep_weekly,
+    keep_monthly,
+    created_at,
+    updated_at)
+    VALUES
+    (?,?,?,?,?,?,?)
+    ON CONFLICT(input_path) DO UPDATE SET
+    keep_last=excluded.keep_last,
+    keep_daily=excluded.keep_daily,
+    keep_weekly=excluded.keep_weekly,
+    keep_monthly=excluded.keep_monthly,
+    updated_at=excluded.updated_at`,
+		policy.InputPath,
+		policy.KeepLast,
+		policy.KeepDaily,
+		policy.KeepWeekly,
+		policy.KeepMonthly,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("could not set retention policy for path %s: %w", policy.InputPath, err)
+	}
+	return nil
+}
+
+func (r retentionPolicyRepository) GetPolicyForPath(ctx context.Context, inputPath string) (*model.RetentionPolicy, error) {
+	policies, err := r.queryPolicies(ctx, selectRetentionPoliciesQuery+"WHERE input_path=?", inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get retention policy for path %s: %w", inputPath, err)
+	}
+	if len(policies) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+	return policies[0], nil
+}
+
+func (r retentionPolicyRepository) ListPolicies(ctx context.Context) ([]*model.RetentionPolicy, error) {
+	policies, err := r.queryPolicies(ctx, selectRetentionPoliciesQuery+"ORDER BY input_path ASC")
+	if err != nil {
+		return nil, fmt.Errorf("could not list retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+func (r retentionPolicyRepository) DeletePolicy(ctx context.Context, inputPath string) error {
+	res, err := r.db.D.ExecContext(ctx, "DELETE FROM retention_policies WHERE input_path=?", inputPath)
+	if err != nil {
+		return fmt.Errorf("could not delete retention policy for path %s: %w", inputPath, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete retention policy for path %s: %w", inputPath, err)
+	}
+	if rowsAffected == 0 {
+		return database.ErrDoesNotExist
+	}
+	return nil
+}
+
+func (r retentionPolicyRepository) queryPolicies(ctx context.Context, q string, args ...any) ([]*model.RetentionPolicy, error) {
+	rows, err := r.db.D.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var policies []*model.RetentionPolicy
+	for rows.Next() {
+		var p model.RetentionPolicy
+		var createdAtStr, updatedAtStr string
+		err := rows.Scan(
+			&p.Id,
+			&p.InputPath,
+			&p.KeepLast,
+			&p.KeepDaily,
+			&p.KeepWeekly,
+			&p.KeepMonthly,
+			&createdAtStr,
+			&updatedAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.CreatedAt = database.FromTimeStr(createdAtStr)
+		p.UpdatedAt = database.FromTimeStr(updatedAtStr)
+		policies = append(policies, &p)
+	}
+	return policies, rows.Err()
+}
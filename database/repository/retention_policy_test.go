@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"glesha/database"
+	"glesha/database/model"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	db := setupTestDB(t)
+	retentionRepo := NewRetentionPolicyRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	_, err := retentionRepo.GetPolicyForPath(ctx, "/input")
+	assert.Equal(t, database.ErrDoesNotExist, err)
+
+	assert.NoError(t, retentionRepo.SetPolicy(ctx, &model.RetentionPolicy{InputPath: "/input", KeepLast: 3}))
+	assert.NoError(t, retentionRepo.SetPolicy(ctx, &model.RetentionPolicy{InputPath: "/input2", KeepDaily: 7}))
+
+	// setting again replaces the existing policy
+	assert.NoError(t, retentionRepo.SetPolicy(ctx, &model.RetentionPolicy{InputPath: "/input", KeepWeekly: 4}))
+	p, err := retentionRepo.GetPolicyForPath(ctx, "/input")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), p.KeepLast)
+	assert.Equal(t, int64(4), p.KeepWeekly)
+
+	policies, err := retentionRepo.ListPolicies(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	assert.NoError(t, retentionRepo.DeletePolicy(ctx, "/input"))
+	assert.Equal(t, database.ErrDoesNotExist, retentionRepo.DeletePolicy(ctx, "/input"))
+}
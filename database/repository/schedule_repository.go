@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"strings"
+	"time"
+)
+
+type ScheduleRepository interface {
+	CreateSchedule(
+		ctx context.Context,
+		inputPath string,
+		outputPath string,
+		configPath string,
+		provider config.Provider,
+		archiveFormat config.ArchiveFormat,
+		cronExpr string,
+		retain int64,
+		priority int64,
+		nextRunAt time.Time,
+	) (int64, error)
+
+	GetScheduleById(ctx context.Context, id int64) (*model.Schedule, error)
+
+	ListSchedules(ctx context.Context) ([]*model.Schedule, error)
+
+	// returns schedules with next_run_at at or before "now"
+	ListDueSchedules(ctx context.Context, now time.Time) ([]*model.Schedule, error)
+
+	UpdateScheduleRun(
+		ctx context.Context,
+		id int64,
+		lastRunAt time.Time,
+		nextRunAt time.Time,
+		lastTaskId *int64,
+	) error
+
+	UpdateScheduleFilterPatterns(ctx context.Context, id int64, patterns []string) error
+
+	DeleteSchedule(ctx context.Context, id int64) error
+}
+
+type scheduleRepository struct {
+	db *database.DB
+}
+
+func NewScheduleRepository(db *database.DB) ScheduleRepository {
+	return scheduleRepository{db: db}
+}
+
+const selectSchedulesQuery = `
+  SELECT
+  id,
+  input_path,
+  output_path,
+  config_path,
+  provider,
+  archive_format,
+  cron_expr,
+  retain,
+  priority,
+  last_run_at,
+  next_run_at,
+  last_task_id,
+  filter_patterns,
+  created_at,
+  updated_at
+  FROM schedules
+  `
+
+func (s scheduleRepository) CreateSchedule(
+	ctx context.Context,
+	inputPath string,
+	outputPath string,
+	configPath string,
+	provider config.Provider,
+	archiveFormat config.ArchiveFormat,
+	cronExpr string,
+	retain int64,
+	priority int64,
+	nextRunAt time.Time,
+) (int64, error) {
+	now := database.ToTimeStr(time.Now())
+	result, err := s.db.D.ExecContext(ctx,
+		`INSERT INTO schedules
+    (input_path,
+    output_path,
+    config_path,
+    provider,
+    archive_format,
+    cron_expr,
+    retain,
+    priority,
+    next_run_at,
+    created_at,
+    updated_at)
+    VALUES
+    (?,?,?,?,?,?,?,?,?,?,?)`,
+		inputPath,
+		outputPath,
+		configPath,
+		provider,
+		archiveFormat,
+		cronExpr,
+		retain,
+		priority,
+		database.ToTimeStr(nextRunAt),
+		now,
+		now,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("could not create schedule for path %s: %w", inputPath, err)
+	}
+	return result.LastInsertId()
+}
+
+func (s scheduleRepository) GetScheduleById(ctx context.Context, id int64) (*model.Schedule, error) {
+	schedules, err := s.querySchedules(ctx, selectSchedulesQuery+"WHERE id=?", id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get schedule for id %d: %w", id, err)
+	}
+	if len(schedules) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+	return schedules[0], nil
+}
+
+func (s scheduleRepository) ListSchedules(ctx context.Context) ([]*model.Schedule, error) {
+	schedules, err := s.querySchedules(ctx, selectSchedulesQuery+"ORDER BY id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("could not list schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (s scheduleRepository) ListDueSchedules(ctx context.Context, now time.Time) ([]*model.Schedule, error) {
+	// NOTE: times are stored in a sortable format, so they can be compared as strings
+	schedules, err := s.querySchedules(ctx,
+		selectSchedulesQuery+"WHERE next_run_at <= ? ORDER BY priority DESC, id ASC",
+		database.ToTimeStr(now))
+	if err != nil {
+		return nil, fmt.Errorf("could not list due schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (s scheduleRepository) UpdateScheduleRun(
+	ctx context.Context,
+	id int64,
+	lastRunAt time.Time,
+	nextRunAt time.Time,
+	lastTaskId *int64,
+) error {
+	_, err := s.db.D.ExecContext(ctx,
+		`UPDATE schedules SET
+    last_run_at=?,
+    next_run_at=?,
+    last_task_id=COALESCE(?, last_task_id),
+    updated_at=?
+    WHERE id=?`,
+		database.ToTimeStr(lastRunAt),
+		database.ToTimeStr(nextRunAt),
+		lastTaskId,
+		database.ToTimeStr(time.Now()),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not update schedule %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s scheduleRepository) UpdateScheduleFilterPatterns(ctx context.Context, id int64, patterns []string) error {
+	_, err := s.db.D.ExecContext(ctx,
+		"UPDATE schedules SET filter_patterns=?, updated_at=? WHERE id=?",
+		strings.Join(patterns, "\n"),
+		database.ToTimeStr(time.Now()),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not update filter patterns for schedule %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s scheduleRepository) DeleteSchedule(ctx context.Context, id int64) error {
+	res, err := s.db.D.ExecContext(ctx, "DELETE FROM schedules WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete schedule %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete schedule %d: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return database.ErrDoesNotExist
+	}
+	return nil
+}
+
+func (s scheduleRepository) querySchedules(ctx context.Context, q string, args ...any) ([]*model.Schedule, error) {
+	rows, err := s.db.D.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var schedules []*model.Schedule
+	for rows.Next() {
+		var sc model.Schedule
+		var providerStr, archiveFormatStr, nextRunAtStr, filterPatternsStr, createdAtStr, updatedAtStr string
+		var lastRunAtStr sql.NullString
+		var lastTaskId sql.NullInt64
+		err := rows.Scan(
+			&sc.Id,
+			&sc.InputPath,
+			&sc.OutputPath,
+			&sc.ConfigPath,
+			&providerStr,
+			&archiveFormatStr,
+			&sc.CronExpr,
+			&sc.Retain,
+			&sc.Priority,
+			&lastRunAtStr,
+			&nextRunAtStr,
+			&lastTaskId,
+			&filterPatternsStr,
+			&createdAtStr,
+			&updatedAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sc.Provider, err = config.ParseProvider(providerStr)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse provider %s: %w", providerStr, err)
+		}
+		sc.ArchiveFormat, err = config.ParseArchiveFormat(archiveFormatStr)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse archive format %s: %w", archiveFormatStr, err)
+		}
+		sc.FilterPatterns = splitFilterPatterns(filterPatternsStr)
+		if lastRunAtStr.Valid {
+			sc.LastRunAt = database.FromTimeStr(lastRunAtStr.String)
+		}
+		if lastTaskId.Valid {
+			sc.LastTaskId = &lastTaskId.Int64
+		}
+		sc.NextRunAt = database.FromTimeStr(nextRunAtStr)
+		sc.CreatedAt = database.FromTimeStr(createdAtStr)
+		sc.UpdatedAt = database.FromTimeStr(updatedAtStr)
+		schedules = append(schedules, &sc)
+	}
+	return schedules, rows.Err()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glesha/config"
+	"glesha/database"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestSchedules(t *testing.T) {
+	db := setupTestDB(t)
+	scheduleRepo := NewScheduleRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	now := time.Now()
+	dueId, err := scheduleRepo.CreateSchedule(ctx, "/input", "/output", "/config",
+		config.PROVIDER_AWS, config.AF_TARGZ, "0 2 * * *", 7, 1, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	laterId, err := scheduleRepo.CreateSchedule(ctx, "/input2", "/output", "/config",
+		config.PROVIDER_AWS, config.AF_TARGZ, "@daily", 0, 0, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	schedules, err := scheduleRepo.ListSchedules(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 2)
+
+	due, err := scheduleRepo.ListDueSchedules(ctx, now)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, dueId, due[0].Id)
+	assert.Equal(t, "0 2 * * *", due[0].CronExpr)
+	assert.Equal(t, int64(7), due[0].Retain)
+	assert.Nil(t, due[0].LastTaskId)
+
+	taskId := int64(42)
+	err = scheduleRepo.UpdateScheduleRun(ctx, dueId, now, now.Add(24*time.Hour), &taskId)
+	assert.NoError(t, err)
+	due, err = scheduleRepo.ListDueSchedules(ctx, now)
+	assert.NoError(t, err)
+	assert.Len(t, due, 0)
+
+	// a run that did not create a task keeps the last task id
+	err = scheduleRepo.UpdateScheduleRun(ctx, dueId, now, now.Add(24*time.Hour), nil)
+	assert.NoError(t, err)
+	schedule, err := scheduleRepo.GetScheduleById(ctx, dueId)
+	assert.NoError(t, err)
+	assert.Equal(t, taskId, *schedule.LastTaskId)
+
+	assert.NoError(t, scheduleRepo.DeleteSchedule(ctx, laterId))
+	assert.ErrorIs(t, scheduleRepo.DeleteSchedule(ctx, laterId), database.ErrDoesNotExist)
+	_, err = scheduleRepo.GetScheduleById(ctx, laterId)
+	assert.ErrorIs(t, err, database.ErrDoesNotExist)
+}
@@ -9,13 +9,14 @@ import (
 	"glesha/database/model"
 	"glesha/file_io"
 	L "glesha/logger"
+	"strings"
 	"time"
 )
 
 type TaskRepository interface {
 	FindSimilarTask(
 		ctx context.Context,
-		inputPath string,
+		inputPaths []string,
 		provider config.Provider,
 		filesInfo *file_io.FilesInfo,
 		archiveFormat config.ArchiveFormat,
@@ -29,7 +30,7 @@ type TaskRepository interface {
 
 	CreateTask(
 		ctx context.Context,
-		inputPath string,
+		inputPaths []string,
 		outputPath string,
 		configPath string,
 		archiveFormat config.ArchiveFormat,
@@ -53,6 +54,19 @@ type TaskRepository interface {
 	UpdateArchivedFileCount(ctx context.Context, taskId int64, count int64) error
 
 	ListTasks(ctx context.Context) ([]*model.Task, error)
+
+	// returns tasks with one of "statuses", highest priority first
+	ListRunnableTasks(ctx context.Context, statuses []model.TaskStatus) ([]*model.Task, error)
+
+	UpdateTaskPriority(ctx context.Context, taskId int64, priority int64) error
+
+	UpdateTaskFilterPatterns(ctx context.Context, taskId int64, patterns []string) error
+
+	// records the snapshot the task was archived from, see snapshot.Snapshot
+	UpdateTaskSnapshot(ctx context.Context, taskId int64, snapshot string) error
+
+	// deletes the task along with its uploads, upload blocks and file catalog
+	DeleteTask(ctx context.Context, taskId int64) error
 }
 
 type taskRepository struct {
@@ -65,7 +79,7 @@ func NewTaskRepository(db *database.DB) TaskRepository {
 
 func (t taskRepository) FindSimilarTask(
 	ctx context.Context,
-	inputPath string,
+	inputPaths []string,
 	provider config.Provider,
 	filesInfo *file_io.FilesInfo,
 	archiveFormat config.ArchiveFormat,
@@ -82,15 +96,16 @@ func (t taskRepository) FindSimilarTask(
   updated_at,
   content_hash,
   size,
-  file_count
+  file_count,
+  input_paths
   FROM tasks
-  WHERE input_path=? AND provider=? AND content_hash=? AND archive_format=?
+  WHERE input_path=? AND input_paths=? AND provider=? AND content_hash=? AND archive_format=?
   ORDER BY created_at DESC LIMIT 1
   `
 	rows, err := t.db.D.QueryContext(
 		ctx,
 		q,
-		inputPath, provider, filesInfo.ContentHash, archiveFormat,
+		inputPaths[0], joinInputPaths(inputPaths), provider, filesInfo.ContentHash, archiveFormat,
 	)
 	if err != nil {
 		return nil, err
@@ -107,12 +122,15 @@ func (t taskRepository) FindSimilarTask(
 		L.Debug("Task exists")
 		var createdAtStr string
 		var updatedAtStr string
+		var inputPathsStr string
 		err := rows.Scan(&task.Id, &task.InputPath,
 			&task.OutputPath, &task.ConfigPath, &task.Provider, &task.Status,
-			&createdAtStr, &updatedAtStr, &task.ContentHash, &task.TotalSize, &task.TotalFileCount)
+			&createdAtStr, &updatedAtStr, &task.ContentHash, &task.TotalSize, &task.TotalFileCount,
+			&inputPathsStr)
 		if err != nil {
 			return nil, err
 		}
+		task.InputPaths = splitInputPaths(task.InputPath, inputPathsStr)
 		task.CreatedAt = database.FromTimeStr(createdAtStr)
 		task.UpdatedAt = database.FromTimeStr(updatedAtStr)
 	}
@@ -126,7 +144,7 @@ func (t taskRepository) FindSimilarTask(
 // returns task_id upon succeful task creation
 func (t taskRepository) CreateTask(
 	ctx context.Context,
-	inputPath string,
+	inputPaths []string,
 	outputPath string,
 	configPath string,
 	archiveFormat config.ArchiveFormat,
@@ -135,9 +153,13 @@ func (t taskRepository) CreateTask(
 	updatedAt time.Time,
 	filesInfo *file_io.FilesInfo,
 ) (int64, error) {
+	if len(inputPaths) == 0 {
+		return -1, fmt.Errorf("could not create task without input paths")
+	}
 	result, err := t.db.D.ExecContext(ctx,
 		`INSERT INTO tasks
     (input_path,
+    input_paths,
     output_path,
     config_path,
     archive_format,
@@ -149,8 +171,9 @@ func (t taskRepository) CreateTask(
     size,
     file_count)
     VALUES
-    (?,?,?,?,?,?,?,?,?,?,?)`,
-		inputPath,
+    (?,?,?,?,?,?,?,?,?,?,?,?)`,
+		inputPaths[0],
+		joinInputPaths(inputPaths),
 		outputPath,
 		configPath,
 		archiveFormat,
@@ -163,7 +186,7 @@ func (t taskRepository) CreateTask(
 		filesInfo.TotalFileCount,
 	)
 	if err != nil {
-		return -1, fmt.Errorf("could not create task for path %s: %w", inputPath, err)
+		return -1, fmt.Errorf("could not create task for path %s: %w", model.InputPathsKey(inputPaths), err)
 	}
 	lastInsertId, err := result.LastInsertId()
 	if err != nil {
@@ -187,7 +210,11 @@ func (t taskRepository) GetTaskById(ctx context.Context, taskId int64) (*model.T
   content_hash,
   size,
   file_count,
-  archived_file_count
+  archived_file_count,
+  priority,
+  filter_patterns,
+  input_paths,
+  snapshot
   FROM tasks
   WHERE id=?
   `
@@ -198,6 +225,8 @@ func (t taskRepository) GetTaskById(ctx context.Context, taskId int64) (*model.T
 	var updatedAtStr string
 	var providerStr string
 	var archiveFormatStr string
+	var filterPatternsStr string
+	var inputPathsStr string
 
 	err := row.Scan(
 		&task.Id,
@@ -213,6 +242,10 @@ func (t taskRepository) GetTaskById(ctx context.Context, taskId int64) (*model.T
 		&task.TotalSize,
 		&task.TotalFileCount,
 		&task.ArchivedFileCount,
+		&task.Priority,
+		&filterPatternsStr,
+		&inputPathsStr,
+		&task.Snapshot,
 	)
 
 	if err != nil {
@@ -224,6 +257,8 @@ func (t taskRepository) GetTaskById(ctx context.Context, taskId int64) (*model.T
 
 	task.CreatedAt = database.FromTimeStr(createdAtStr)
 	task.UpdatedAt = database.FromTimeStr(updatedAtStr)
+	task.FilterPatterns = splitFilterPatterns(filterPatternsStr)
+	task.InputPaths = splitInputPaths(task.InputPath, inputPathsStr)
 	task.Provider, err = config.ParseProvider(providerStr)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse provider %s: %w", providerStr, err)
@@ -250,11 +285,58 @@ func (t taskRepository) ListTasks(ctx context.Context) ([]*model.Task, error) {
   content_hash,
   size,
   file_count,
-  archived_file_count
+  archived_file_count,
+  priority,
+  filter_patterns,
+  input_paths,
+  snapshot
   FROM tasks
   ORDER BY id ASC
   `
-	rows, err := t.db.D.QueryContext(ctx, q)
+	return t.queryTasks(ctx, q)
+}
+
+func (t taskRepository) ListRunnableTasks(ctx context.Context, statuses []model.TaskStatus) ([]*model.Task, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ",")
+	q := fmt.Sprintf(`
+  SELECT
+  id,
+  input_path,
+  output_path,
+  config_path,
+  status,
+  provider,
+  archive_format,
+  created_at,
+  updated_at,
+  content_hash,
+  size,
+  file_count,
+  archived_file_count,
+  priority,
+  filter_patterns,
+  input_paths,
+  snapshot
+  FROM tasks
+  WHERE status IN (%s)
+  ORDER BY priority DESC, id ASC
+  `, placeholders)
+	args := make([]any, len(statuses))
+	for i, s := range statuses {
+		args[i] = s
+	}
+	tasks, err := t.queryTasks(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list runnable tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (t taskRepository) queryTasks(ctx context.Context, q string, args ...any) ([]*model.Task, error) {
+	rows, err := t.db.D.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -262,18 +344,20 @@ func (t taskRepository) ListTasks(ctx context.Context) ([]*model.Task, error) {
 	var tasks []*model.Task
 	for rows.Next() {
 		var task model.Task
-		var createdAtStr, updatedAtStr, providerStr, archiveFormatStr string
-		err := rows.Scan(&task.Id, &task.InputPath, &task.OutputPath, &task.ConfigPath, &task.Status, &providerStr, &archiveFormatStr, &createdAtStr, &updatedAtStr, &task.ContentHash, &task.TotalSize, &task.TotalFileCount, &task.ArchivedFileCount)
+		var createdAtStr, updatedAtStr, providerStr, archiveFormatStr, filterPatternsStr, inputPathsStr string
+		err := rows.Scan(&task.Id, &task.InputPath, &task.OutputPath, &task.ConfigPath, &task.Status, &providerStr, &archiveFormatStr, &createdAtStr, &updatedAtStr, &task.ContentHash, &task.TotalSize, &task.TotalFileCount, &task.ArchivedFileCount, &task.Priority, &filterPatternsStr, &inputPathsStr, &task.Snapshot)
 		if err != nil {
 			return nil, err
 		}
 		task.CreatedAt = database.FromTimeStr(createdAtStr)
 		task.UpdatedAt = database.FromTimeStr(updatedAtStr)
+		task.FilterPatterns = splitFilterPatterns(filterPatternsStr)
+		task.InputPaths = splitInputPaths(task.InputPath, inputPathsStr)
 		task.Provider, _ = config.ParseProvider(providerStr)
 		task.ArchiveFormat, _ = config.ParseArchiveFormat(archiveFormatStr)
 		tasks = append(tasks, &task)
 	}
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
 func (t taskRepository) UpdateTaskStatus(ctx context.Context, taskId int64, status model.TaskStatus) error {
@@ -323,3 +407,118 @@ func (t taskRepository) UpdateArchivedFileCount(ctx context.Context, taskId int6
 	_, err := t.db.D.ExecContext(ctx, "UPDATE tasks SET archived_file_count = ?, updated_at = ? WHERE id = ?", count, database.ToTimeStr(time.Now()), taskId)
 	return err
 }
+
+func (t taskRepository) UpdateTaskPriority(ctx context.Context, taskId int64, priority int64) error {
+	res, err := t.db.D.ExecContext(ctx,
+		"UPDATE tasks SET priority=?, updated_at=? WHERE id=?",
+		priority,
+		database.ToTimeStr(time.Now()),
+		taskId)
+	if err != nil {
+		return fmt.Errorf("could not update priority for task %d: %w", taskId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update priority for task %d: %w", taskId, err)
+	}
+	if rowsAffected != 1 {
+		return fmt.Errorf("was expecting %d row updates, but %d rows were updated", 1, rowsAffected)
+	}
+	return nil
+}
+
+func (t taskRepository) DeleteTask(ctx context.Context, taskId int64) error {
+	txn, err := t.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+	stmts := []string{
+		"DELETE FROM upload_blocks WHERE upload_id IN (SELECT id FROM uploads WHERE task_id=?)",
+		"DELETE FROM uploads WHERE task_id=?",
+		"DELETE FROM file_catalog WHERE task_id=?",
+		"DELETE FROM archive_members WHERE task_id=?",
+		"DELETE FROM hook_runs WHERE task_id=?",
+		"UPDATE schedules SET last_task_id=NULL WHERE last_task_id=?",
+	}
+	for _, stmt := range stmts {
+		_, err = txn.ExecContext(ctx, stmt, taskId)
+		if err != nil {
+			return fmt.Errorf("could not delete task %d: %w", taskId, err)
+		}
+	}
+	res, err := txn.ExecContext(ctx, "DELETE FROM tasks WHERE id=?", taskId)
+	if err != nil {
+		return fmt.Errorf("could not delete task %d: %w", taskId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete task %d: %w", taskId, err)
+	}
+	if rowsAffected == 0 {
+		return database.ErrDoesNotExist
+	}
+	return txn.Commit()
+}
+
+func (t taskRepository) UpdateTaskFilterPatterns(ctx context.Context, taskId int64, patterns []string) error {
+	res, err := t.db.D.ExecContext(ctx,
+		"UPDATE tasks SET filter_patterns=?, updated_at=? WHERE id=?",
+		strings.Join(patterns, "\n"),
+		database.ToTimeStr(time.Now()),
+		taskId)
+	if err != nil {
+		return fmt.Errorf("could not update filter patterns for task %d: %w", taskId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update filter patterns for task %d: %w", taskId, err)
+	}
+	if rowsAffected != 1 {
+		return fmt.Errorf("was expecting %d row updates, but %d rows were updated", 1, rowsAffected)
+	}
+	return nil
+}
+
+func (t taskRepository) UpdateTaskSnapshot(ctx context.Context, taskId int64, snapshot string) error {
+	res, err := t.db.D.ExecContext(ctx,
+		"UPDATE tasks SET snapshot=?, updated_at=? WHERE id=?",
+		snapshot,
+		database.ToTimeStr(time.Now()),
+		taskId)
+	if err != nil {
+		return fmt.Errorf("could not update snapshot for task %d: %w", taskId, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update snapshot for task %d: %w", taskId, err)
+	}
+	if rowsAffected != 1 {
+		return fmt.Errorf("was expecting %d row updates, but %d rows were updated", 1, rowsAffected)
+	}
+	return nil
+}
+
+// patterns are stored one per line, like in a .gleshaignore file
+func splitFilterPatterns(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// input_paths is only set for tasks with more than one input path, so
+// single path tasks look the same as the ones created before it existed
+func joinInputPaths(inputPaths []string) string {
+	if len(inputPaths) < 2 {
+		return ""
+	}
+	return strings.Join(inputPaths, "\n")
+}
+
+func splitInputPaths(inputPath string, s string) []string {
+	if len(s) == 0 {
+		return []string{inputPath}
+	}
+	return strings.Split(s, "\n")
+}
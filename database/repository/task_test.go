@@ -35,7 +35,7 @@ func TestCreateAndGetTask(t *testing.T) {
 
 	taskId, err := taskRepo.CreateTask(
 		context.Background(),
-		"/input",
+		[]string{"/input"},
 		"/output",
 		"/config",
 		config.AF_TARGZ,
@@ -51,6 +51,7 @@ func TestCreateAndGetTask(t *testing.T) {
 	assert.NotNil(t, task)
 	assert.Equal(t, taskId, task.Id)
 	assert.Equal(t, "/input", task.InputPath)
+	assert.Equal(t, []string{"/input"}, task.InputPaths)
 	assert.Equal(t, int64(1024), task.TotalSize)
 }
 
@@ -66,14 +67,14 @@ func TestFindSimilarTask(t *testing.T) {
 	}
 
 	t.Run("NoSimilarTask", func(t *testing.T) {
-		_, err := taskRepo.FindSimilarTask(context.Background(), "/input", config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
+		_, err := taskRepo.FindSimilarTask(context.Background(), []string{"/input"}, config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
 		assert.ErrorIs(t, err, database.ErrDoesNotExist)
 	})
 
 	t.Run("SimilarTaskExists", func(t *testing.T) {
 		taskId, err := taskRepo.CreateTask(
 			context.Background(),
-			"/input",
+			[]string{"/input"},
 			"/output",
 			"/config",
 			config.AF_TARGZ,
@@ -84,13 +85,39 @@ func TestFindSimilarTask(t *testing.T) {
 		)
 		assert.NoError(t, err)
 
-		task, err := taskRepo.FindSimilarTask(context.Background(), "/input", config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
+		task, err := taskRepo.FindSimilarTask(context.Background(), []string{"/input"}, config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
 		assert.NoError(t, err)
 		assert.NotNil(t, task)
 		assert.Equal(t, taskId, task.Id)
 	})
 }
 
+func TestCreateTask_MultipleInputPaths(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	defer db.Close(context.Background())
+
+	inputPaths := []string{"/docs", "/photos"}
+	filesInfo := &file_io.FilesInfo{ContentHash: "test-hash"}
+	taskId, err := taskRepo.CreateTask(context.Background(), inputPaths, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(), filesInfo)
+	assert.NoError(t, err)
+
+	task, err := taskRepo.GetTaskById(context.Background(), taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, "/docs", task.InputPath)
+	assert.Equal(t, inputPaths, task.InputPaths)
+
+	similar, err := taskRepo.FindSimilarTask(context.Background(), inputPaths, config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
+	assert.NoError(t, err)
+	assert.Equal(t, taskId, similar.Id)
+	assert.Equal(t, inputPaths, similar.InputPaths)
+
+	// a subset of the input paths is a different task
+	_, err = taskRepo.FindSimilarTask(context.Background(), []string{"/docs"}, config.PROVIDER_AWS, filesInfo, config.AF_TARGZ)
+	assert.Equal(t, database.ErrDoesNotExist, err)
+}
+
 func TestUpdateTaskStatus(t *testing.T) {
 	db := setupTestDB(t)
 	taskRepo := NewTaskRepository(db)
@@ -104,7 +131,7 @@ func TestUpdateTaskStatus(t *testing.T) {
 
 	taskId, err := taskRepo.CreateTask(
 		context.Background(),
-		"/input",
+		[]string{"/input"},
 		"/output",
 		"/config",
 		config.AF_TARGZ,
@@ -136,7 +163,7 @@ func TestUpdateTaskContentInfo(t *testing.T) {
 
 	taskId, err := taskRepo.CreateTask(
 		context.Background(),
-		"/input",
+		[]string{"/input"},
 		"/output",
 		"/config",
 		config.AF_TARGZ,
@@ -161,3 +188,105 @@ func TestUpdateTaskContentInfo(t *testing.T) {
 	assert.Equal(t, int64(2048), task.TotalSize)
 	assert.Equal(t, "new-test-hash", task.ContentHash)
 }
+
+func TestUpdateTaskFilterPatterns(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	defer db.Close(context.Background())
+
+	taskId, err := taskRepo.CreateTask(
+		context.Background(),
+		[]string{"/input"},
+		"/output",
+		"/config",
+		config.AF_TARGZ,
+		config.PROVIDER_AWS,
+		time.Now(),
+		time.Now(),
+		&file_io.FilesInfo{},
+	)
+	assert.NoError(t, err)
+
+	task, err := taskRepo.GetTaskById(context.Background(), taskId)
+	assert.NoError(t, err)
+	assert.Empty(t, task.FilterPatterns)
+
+	patterns := []string{"*.log", "node_modules/", "!important.log"}
+	err = taskRepo.UpdateTaskFilterPatterns(context.Background(), taskId, patterns)
+	assert.NoError(t, err)
+
+	task, err = taskRepo.GetTaskById(context.Background(), taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, patterns, task.FilterPatterns)
+}
+
+func TestListRunnableTasks(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	filesInfo := &file_io.FilesInfo{ContentHash: "test-hash"}
+	createTask := func(status model.TaskStatus, priority int64) int64 {
+		taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+			config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(), filesInfo)
+		assert.NoError(t, err)
+		assert.NoError(t, taskRepo.UpdateTaskStatus(ctx, taskId, status))
+		assert.NoError(t, taskRepo.UpdateTaskPriority(ctx, taskId, priority))
+		return taskId
+	}
+	low := createTask(model.TASK_STATUS_QUEUED, 0)
+	high := createTask(model.TASK_STATUS_UPLOAD_ABORTED, 10)
+	createTask(model.TASK_STATUS_UPLOAD_COMPLETED, 20)
+	lowToo := createTask(model.TASK_STATUS_ARCHIVE_ABORTED, 0)
+
+	tasks, err := taskRepo.ListRunnableTasks(ctx, []model.TaskStatus{
+		model.TASK_STATUS_QUEUED,
+		model.TASK_STATUS_ARCHIVE_ABORTED,
+		model.TASK_STATUS_UPLOAD_ABORTED,
+	})
+	assert.NoError(t, err)
+	var ids []int64
+	for _, task := range tasks {
+		ids = append(ids, task.Id)
+	}
+	assert.Equal(t, []int64{high, low, lowToo}, ids)
+	assert.Equal(t, int64(10), tasks[0].Priority)
+
+	task, err := taskRepo.GetTaskById(ctx, high)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), task.Priority)
+
+	assert.Error(t, taskRepo.UpdateTaskPriority(ctx, 1000, 1))
+}
+
+func TestDeleteTask(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	uploadBlockRepo := NewUploadBlockRepository(db)
+
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: "test-hash"})
+	assert.NoError(t, err)
+	uploadId, err := uploadRepo.CreateUpload(ctx, taskId, "{}", 1, "/path/to/file",
+		30, time.Now(), "", 3, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+	_, err = uploadBlockRepo.CreateUploadBlocks(ctx, uploadId, 30, 10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, taskRepo.DeleteTask(ctx, taskId))
+
+	_, err = taskRepo.GetTaskById(ctx, taskId)
+	assert.Error(t, err)
+	_, err = uploadRepo.GetUploadById(ctx, uploadId)
+	assert.Error(t, err)
+	blocks, err := uploadBlockRepo.GetBlocksForUploadId(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Empty(t, blocks)
+
+	assert.Equal(t, database.ErrDoesNotExist, taskRepo.DeleteTask(ctx, taskId))
+}
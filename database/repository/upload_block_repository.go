@@ -41,6 +41,13 @@ type UploadBlockRepository interface {
 		ctx context.Context,
 		uploadId int64,
 	) (removeCnt int64, err error)
+	// records that worker "workerId" started uploading the block
+	MarkStarted(
+		ctx context.Context,
+		uploadId int64,
+		blockId int64,
+		workerId int,
+	) error
 	MarkComplete(
 		ctx context.Context,
 		uploadId int64,
@@ -62,6 +69,15 @@ type UploadBlockRepository interface {
 		ctx context.Context,
 		uploadId int64,
 	) (resetCount int64, err error)
+	GetBlocksForUploadId(
+		ctx context.Context,
+		uploadId int64,
+	) (blocks []model.UploadBlock, err error)
+	RequeueBlocks(
+		ctx context.Context,
+		uploadId int64,
+		blockIds []int64,
+	) (requeueCount int64, err error)
 }
 
 type uploadBlockRepo struct {
@@ -181,6 +197,25 @@ func (ubr uploadBlockRepo) UpdateStatus(
 	return nil
 }
 
+func (ubr uploadBlockRepo) MarkStarted(
+	ctx context.Context,
+	uploadId int64,
+	blockId int64,
+	workerId int,
+) error {
+	q := `UPDATE upload_blocks
+			 SET worker_id=?,
+			 started_at=?,
+			 updated_at=?
+			 WHERE id=? AND upload_id=?`
+	now := database.ToTimeStr(time.Now())
+	_, err := ubr.db.D.ExecContext(ctx, q, workerId, now, now, blockId, uploadId)
+	if err != nil {
+		return fmt.Errorf("could not mark started block with id %d: %w", blockId, err)
+	}
+	return nil
+}
+
 func (ubr uploadBlockRepo) MarkComplete(
 	ctx context.Context,
 	uploadId int64,
@@ -235,7 +270,7 @@ func (ubr uploadBlockRepo) MarkError(
 
 func (ubr uploadBlockRepo) ResetDirtyBlocks(ctx context.Context, uploadId int64) (int64, error) {
 	q := `UPDATE upload_blocks
-        SET status=? WHERE status=? AND upload_id=?`
+        SET status=?, worker_id=0, started_at=NULL WHERE status=? AND upload_id=?`
 	res, err := ubr.db.D.ExecContext(ctx, q, model.UB_STATUS_QUEUED, model.UB_STATUS_RUNNING, uploadId)
 	if err != nil {
 		return -1, fmt.Errorf("could not reset dirty blocks for upload id %d:%w", uploadId, err)
@@ -249,7 +284,7 @@ func (ubr uploadBlockRepo) ClaimNextUnfinishedBlocks(
 	limit int,
 ) (blockIds []int64, err error) {
 	q := `UPDATE upload_blocks
-	      SET status=?
+	      SET status=?, worker_id=0, started_at=NULL
 				WHERE id IN (
 				  SELECT id FROM upload_blocks
 					WHERE upload_id=? AND status in (?,?)
@@ -297,7 +332,9 @@ func (ubr uploadBlockRepo) GetById(ctx context.Context, id int64) (res *model.Up
 					updated_at,
 					uploaded_at,
 					error_message,
-					error_count
+					error_count,
+					worker_id,
+					started_at
 				FROM upload_blocks WHERE id=?`
 
 	row := ubr.db.D.QueryRow(q, id)
@@ -307,6 +344,7 @@ func (ubr uploadBlockRepo) GetById(ctx context.Context, id int64) (res *model.Up
 	var updatedAtStr string
 	var uploadedAtStr sql.NullString
 	var errorMessage sql.NullString
+	var startedAtStr sql.NullString
 	ub := model.UploadBlock{}
 	err = row.Scan(
 		&ub.Id,
@@ -321,6 +359,8 @@ func (ubr uploadBlockRepo) GetById(ctx context.Context, id int64) (res *model.Up
 		&uploadedAtStr,
 		&errorMessage,
 		&ub.ErrorCount,
+		&ub.WorkerId,
+		&startedAtStr,
 	)
 
 	if err != nil {
@@ -336,6 +376,13 @@ func (ubr uploadBlockRepo) GetById(ctx context.Context, id int64) (res *model.Up
 		ts := database.FromTimeStr(uploadedAtStr.String)
 		ub.UploadedAt = &ts
 	}
+	if errorMessage.Valid {
+		ub.ErrorMessage = errorMessage.String
+	}
+	if startedAtStr.Valid {
+		ts := database.FromTimeStr(startedAtStr.String)
+		ub.StartedAt = &ts
+	}
 	ub.CreatedAt = database.FromTimeStr(createdAtStr)
 	ub.UpdatedAt = database.FromTimeStr(updatedAtStr)
 	return &ub, nil
@@ -354,13 +401,48 @@ func (ubr uploadBlockRepo) GetCompletedBlocksForUploadId(ctx context.Context, up
 					updated_at,
 					uploaded_at,
 					error_message,
-					error_count
+					error_count,
+					worker_id,
+					started_at
 				FROM upload_blocks WHERE upload_id=? AND status=? ORDER BY id ASC`
-	rows, err := ubr.db.D.QueryContext(ctx, q, uploadId, model.UB_STATUS_COMPLETE)
-	var blocks []model.UploadBlock
+	blocks, err := ubr.queryBlocks(ctx, q, uploadId, model.UB_STATUS_COMPLETE)
 	if err != nil {
 		return blocks, fmt.Errorf("couldnt get completed blocks for upload id %d:%w", uploadId, err)
 	}
+	return blocks, nil
+}
+
+func (ubr uploadBlockRepo) GetBlocksForUploadId(ctx context.Context, uploadId int64) ([]model.UploadBlock, error) {
+	q := `SELECT
+					id,
+					upload_id,
+					file_offset,
+					size,
+					status,
+					etag,
+					checksum,
+					created_at,
+					updated_at,
+					uploaded_at,
+					error_message,
+					error_count,
+					worker_id,
+					started_at
+				FROM upload_blocks WHERE upload_id=? ORDER BY id ASC`
+	blocks, err := ubr.queryBlocks(ctx, q, uploadId)
+	if err != nil {
+		return blocks, fmt.Errorf("couldnt get blocks for upload id %d:%w", uploadId, err)
+	}
+	return blocks, nil
+}
+
+// runs query "q" that selects all upload_blocks columns and scans the result
+func (ubr uploadBlockRepo) queryBlocks(ctx context.Context, q string, args ...any) ([]model.UploadBlock, error) {
+	rows, err := ubr.db.D.QueryContext(ctx, q, args...)
+	var blocks []model.UploadBlock
+	if err != nil {
+		return blocks, err
+	}
 	defer rows.Close()
 	for rows.Next() {
 		var etagStr sql.NullString
@@ -369,6 +451,7 @@ func (ubr uploadBlockRepo) GetCompletedBlocksForUploadId(ctx context.Context, up
 		var updatedAtStr string
 		var uploadedAtStr sql.NullString
 		var errorMessage sql.NullString
+		var startedAtStr sql.NullString
 		ub := model.UploadBlock{}
 		err = rows.Scan(
 			&ub.Id,
@@ -383,9 +466,11 @@ func (ubr uploadBlockRepo) GetCompletedBlocksForUploadId(ctx context.Context, up
 			&uploadedAtStr,
 			&errorMessage,
 			&ub.ErrorCount,
+			&ub.WorkerId,
+			&startedAtStr,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("could not scan upload block for id %d:%w", uploadId, err)
+			return nil, fmt.Errorf("could not scan upload block: %w", err)
 		}
 		if etagStr.Valid {
 			ub.Etag = etagStr.String
@@ -397,11 +482,74 @@ func (ubr uploadBlockRepo) GetCompletedBlocksForUploadId(ctx context.Context, up
 			ts := database.FromTimeStr(uploadedAtStr.String)
 			ub.UploadedAt = &ts
 		}
+		if errorMessage.Valid {
+			ub.ErrorMessage = errorMessage.String
+		}
+		if startedAtStr.Valid {
+			ts := database.FromTimeStr(startedAtStr.String)
+			ub.StartedAt = &ts
+		}
 		ub.CreatedAt = database.FromTimeStr(createdAtStr)
 		ub.UpdatedAt = database.FromTimeStr(updatedAtStr)
 		blocks = append(blocks, ub)
 	}
-	return blocks, nil
+	return blocks, rows.Err()
+}
+
+// moves blocks back to UB_QUEUED, progress of the upload is rolled back
+// for blocks that were already marked complete
+func (ubr uploadBlockRepo) RequeueBlocks(ctx context.Context, uploadId int64, blockIds []int64) (int64, error) {
+	if len(blockIds) == 0 {
+		return 0, nil
+	}
+	txn, err := ubr.db.D.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer txn.Rollback()
+
+	placeholders := strings.Repeat("?,", len(blockIds))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]any, 0, len(blockIds)+2)
+	args = append(args, uploadId, model.UB_STATUS_COMPLETE)
+	for _, id := range blockIds {
+		args = append(args, id)
+	}
+
+	q := fmt.Sprintf(`UPDATE uploads SET
+				uploaded_blocks = uploaded_blocks - completed.cnt,
+				uploaded_bytes = uploaded_bytes - completed.bytes
+				FROM (
+				  SELECT COUNT(*) AS cnt, COALESCE(SUM(size), 0) AS bytes FROM upload_blocks
+				  WHERE upload_id=? AND status=? AND id IN (%s)
+				) AS completed
+				WHERE uploads.id=?`, placeholders)
+	_, err = txn.ExecContext(ctx, q, append(args, uploadId)...)
+	if err != nil {
+		return -1, fmt.Errorf("could not roll back progress for upload id %d:%w", uploadId, err)
+	}
+
+	args = args[:0]
+	args = append(args, model.UB_STATUS_QUEUED, database.ToTimeStr(time.Now()), uploadId)
+	for _, id := range blockIds {
+		args = append(args, id)
+	}
+	q = fmt.Sprintf(`UPDATE upload_blocks
+				SET status=?,
+				etag=NULL,
+				checksum=NULL,
+				uploaded_at=NULL,
+				updated_at=?
+				WHERE upload_id=? AND id IN (%s)`, placeholders)
+	res, err := txn.ExecContext(ctx, q, args...)
+	if err != nil {
+		return -1, fmt.Errorf("could not requeue blocks for upload id %d:%w", uploadId, err)
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	return requeued, txn.Commit()
 }
 
 func (ubr uploadBlockRepo) RemoveAllBlocks(ctx context.Context, uploadId int64) (int64, error) {
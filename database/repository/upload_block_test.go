@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glesha/config"
+	"glesha/database/model"
+	"glesha/file_io"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestRequeueBlocks(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	uploadBlockRepo := NewUploadBlockRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	filesInfo := &file_io.FilesInfo{
+		TotalFileCount: 1,
+		SizeInBytes:    30,
+		ContentHash:    "test-hash",
+	}
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(), filesInfo)
+	assert.NoError(t, err)
+	uploadId, err := uploadRepo.CreateUpload(ctx, taskId, "{}", 1, "/path/to/file",
+		30, time.Now(), "", 3, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+
+	cnt, err := uploadBlockRepo.CreateUploadBlocks(ctx, uploadId, 30, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), cnt)
+
+	blocks, err := uploadBlockRepo.GetBlocksForUploadId(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 3)
+
+	assert.NoError(t, uploadBlockRepo.MarkComplete(ctx, uploadId, blocks[0].Id, "c0", "e0"))
+	assert.NoError(t, uploadBlockRepo.MarkComplete(ctx, uploadId, blocks[1].Id, "c1", "e1"))
+
+	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), upload.UploadedBlocks)
+	assert.Equal(t, int64(20), upload.UploadedBytes)
+
+	requeued, err := uploadBlockRepo.RequeueBlocks(ctx, uploadId, []int64{blocks[1].Id, blocks[2].Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), requeued)
+
+	upload, err = uploadRepo.GetUploadById(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), upload.UploadedBlocks)
+	assert.Equal(t, int64(10), upload.UploadedBytes)
+
+	block, err := uploadBlockRepo.GetById(ctx, blocks[1].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.UB_STATUS_QUEUED, block.Status)
+	assert.Empty(t, block.Checksum)
+
+	completed, err := uploadBlockRepo.GetCompletedBlocksForUploadId(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Len(t, completed, 1)
+}
+
+func TestRestartUpload(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	filesInfo := &file_io.FilesInfo{ContentHash: "test-hash"}
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(), filesInfo)
+	assert.NoError(t, err)
+	uploadId, err := uploadRepo.CreateUpload(ctx, taskId, "old", 1, "/path/to/file",
+		30, time.Now(), "", 3, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, uploadRepo.UpdateStatus(ctx, uploadId, model.UPLOAD_STATUS_FAILED))
+
+	err = uploadRepo.RestartUpload(ctx, uploadId, "new", 2)
+	assert.NoError(t, err)
+
+	upload, err := uploadRepo.GetUploadById(ctx, uploadId)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", upload.StorageBackendMetadataJson)
+	assert.Equal(t, int64(2), upload.StorageBackendMetadataSchemaVersion)
+	assert.Equal(t, model.UPLOAD_STATUS_QUEUED, upload.Status)
+}
+
+func TestMarkStarted(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	uploadBlockRepo := NewUploadBlockRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{TotalFileCount: 1, SizeInBytes: 20, ContentHash: "test-hash"})
+	assert.NoError(t, err)
+	uploadId, err := uploadRepo.CreateUpload(ctx, taskId, "{}", 1, "/path/to/file",
+		20, time.Now(), "", 2, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+	_, err = uploadBlockRepo.CreateUploadBlocks(ctx, uploadId, 20, 10)
+	assert.NoError(t, err)
+
+	blockIds, err := uploadBlockRepo.ClaimNextUnfinishedBlocks(ctx, uploadId, 1)
+	assert.NoError(t, err)
+	assert.Len(t, blockIds, 1)
+	block, err := uploadBlockRepo.GetById(ctx, blockIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.UB_STATUS_RUNNING, block.Status)
+	assert.Equal(t, int64(0), block.WorkerId)
+	assert.Nil(t, block.StartedAt)
+
+	assert.NoError(t, uploadBlockRepo.MarkStarted(ctx, uploadId, blockIds[0], 3))
+	block, err = uploadBlockRepo.GetById(ctx, blockIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), block.WorkerId)
+	assert.NotNil(t, block.StartedAt)
+
+	// a failed block is claimed again before a worker starts it
+	assert.NoError(t, uploadBlockRepo.UpdateStatus(ctx, uploadId, blockIds[0], model.UB_STATUS_ERROR))
+	_, err = uploadBlockRepo.ClaimNextUnfinishedBlocks(ctx, uploadId, 2)
+	assert.NoError(t, err)
+	blocks, err := uploadBlockRepo.GetBlocksForUploadId(ctx, uploadId)
+	assert.NoError(t, err)
+	for _, b := range blocks {
+		assert.Equal(t, model.UB_STATUS_RUNNING, b.Status)
+		assert.Equal(t, int64(0), b.WorkerId)
+		assert.Nil(t, b.StartedAt)
+	}
+}
@@ -18,6 +18,7 @@ type UploadRepository interface {
 		filePath string,
 		fileSize int64,
 		fileLastModifiedAt time.Time,
+		fileSampleHash string,
 		totalBlocks int64,
 		blockSizeInBytes int64,
 		createdAt time.Time,
@@ -45,6 +46,18 @@ type UploadRepository interface {
 		id int64,
 		status model.UploadStatus,
 	) error
+
+	RestartUpload(
+		ctx context.Context,
+		id int64,
+		storageBackendMetadataJson string,
+		storageBackendMetadataSchemaVersion int64,
+	) error
+
+	DeleteUpload(
+		ctx context.Context,
+		id int64,
+	) error
 }
 
 type uploadRepository struct {
@@ -63,6 +76,7 @@ func (u uploadRepository) CreateUpload(
 	filePath string,
 	fileSize int64,
 	fileLastModifiedAt time.Time,
+	fileSampleHash string,
 	totalBlocks int64,
 	blockSizeInBytes int64,
 	createdAt time.Time,
@@ -77,11 +91,12 @@ func (u uploadRepository) CreateUpload(
     file_path,
     file_size,
     file_last_modified_at,
+    file_sample_hash,
     total_blocks,
     block_size_in_bytes,
     created_at,
     updated_at
-    ) VALUES (?,?,?,?,?,?,?,?,?,?)
+    ) VALUES (?,?,?,?,?,?,?,?,?,?,?)
     ON CONFLICT(task_id) DO NOTHING`,
 		taskId,
 		storageBackendMetadataJson,
@@ -89,6 +104,7 @@ func (u uploadRepository) CreateUpload(
 		filePath,
 		fileSize,
 		database.ToTimeStr(fileLastModifiedAt),
+		fileSampleHash,
 		totalBlocks,
 		blockSizeInBytes,
 		database.ToTimeStr(createdAt),
@@ -125,6 +141,7 @@ func (u uploadRepository) GetUploadByTaskId(ctx context.Context, taskId int64) (
     file_path,
     file_size,
     file_last_modified_at,
+    file_sample_hash,
     uploaded_bytes,
     uploaded_blocks,
     total_blocks,
@@ -138,6 +155,7 @@ func (u uploadRepository) GetUploadByTaskId(ctx context.Context, taskId int64) (
 
 	var upload model.Upload
 	var fileLastModifiedAtStr sql.NullString
+	var fileSampleHashStr sql.NullString
 	var createdAtStr string
 	var updatedAtStr string
 	var completedAtStr sql.NullString
@@ -150,6 +168,7 @@ func (u uploadRepository) GetUploadByTaskId(ctx context.Context, taskId int64) (
 		&upload.FilePath,
 		&upload.FileSize,
 		&fileLastModifiedAtStr,
+		&fileSampleHashStr,
 		&upload.UploadedBytes,
 		&upload.UploadedBlocks,
 		&upload.TotalBlocks,
@@ -171,6 +190,9 @@ func (u uploadRepository) GetUploadByTaskId(ctx context.Context, taskId int64) (
 		upload.FileLastModifiedAt = database.FromTimeStr(fileLastModifiedAtStr.String)
 	}
 
+	if fileSampleHashStr.Valid {
+		upload.FileSampleHash = fileSampleHashStr.String
+	}
 	upload.CreatedAt = database.FromTimeStr(createdAtStr)
 	upload.UpdatedAt = database.FromTimeStr(updatedAtStr)
 	if completedAtStr.Valid {
@@ -192,6 +214,7 @@ func (u uploadRepository) GetUploadById(ctx context.Context, uploadId int64) (*m
     file_path,
     file_size,
     file_last_modified_at,
+    file_sample_hash,
     uploaded_bytes,
     uploaded_blocks,
     total_blocks,
@@ -205,6 +228,7 @@ func (u uploadRepository) GetUploadById(ctx context.Context, uploadId int64) (*m
 
 	var upload model.Upload
 	var fileLastModifiedAtStr sql.NullString
+	var fileSampleHashStr sql.NullString
 	var createdAtStr string
 	var updatedAtStr string
 	var completedAtStr sql.NullString
@@ -217,6 +241,7 @@ func (u uploadRepository) GetUploadById(ctx context.Context, uploadId int64) (*m
 		&upload.FilePath,
 		&upload.FileSize,
 		&fileLastModifiedAtStr,
+		&fileSampleHashStr,
 		&upload.UploadedBytes,
 		&upload.UploadedBlocks,
 		&upload.TotalBlocks,
@@ -233,6 +258,9 @@ func (u uploadRepository) GetUploadById(ctx context.Context, uploadId int64) (*m
 	if fileLastModifiedAtStr.Valid {
 		upload.FileLastModifiedAt = database.FromTimeStr(fileLastModifiedAtStr.String)
 	}
+	if fileSampleHashStr.Valid {
+		upload.FileSampleHash = fileSampleHashStr.String
+	}
 	upload.CreatedAt = database.FromTimeStr(createdAtStr)
 	upload.UpdatedAt = database.FromTimeStr(updatedAtStr)
 	if completedAtStr.Valid {
@@ -279,3 +307,46 @@ func (u uploadRepository) UpdateStatus(
 	}
 	return nil
 }
+
+// replaces storage backend metadata of upload "id" with a newly created
+// upload resource and resets its progress
+func (u uploadRepository) RestartUpload(
+	ctx context.Context,
+	id int64,
+	storageBackendMetadataJson string,
+	storageBackendMetadataSchemaVersion int64,
+) error {
+	q := `UPDATE uploads SET
+  storage_backend_metadata_json=?,
+  storage_backend_metadata_schema_version=?,
+  uploaded_bytes=0,
+  uploaded_blocks=0,
+  status=?,
+  url=NULL,
+  completed_at=NULL,
+  updated_at=?
+  WHERE id=?`
+	now := database.ToTimeStr(time.Now())
+	_, err := u.db.D.ExecContext(ctx, q,
+		storageBackendMetadataJson,
+		storageBackendMetadataSchemaVersion,
+		model.UPLOAD_STATUS_QUEUED,
+		now,
+		id)
+	if err != nil {
+		return fmt.Errorf("could not restart upload for upload id %d:%w", id, err)
+	}
+	return nil
+}
+
+// removes upload "id", its blocks must be removed before calling this
+func (u uploadRepository) DeleteUpload(
+	ctx context.Context,
+	id int64,
+) error {
+	_, err := u.db.D.ExecContext(ctx, "DELETE FROM uploads WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete upload for upload id %d:%w", id, err)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"glesha/config"
+	"glesha/database"
 	"glesha/file_io"
 
 	"github.com/stretchr/testify/assert"
@@ -26,7 +27,7 @@ func TestCreateAndGetUpload(t *testing.T) {
 
 	taskId, err := taskRepo.CreateTask(
 		context.Background(),
-		"/input",
+		[]string{"/input"},
 		"/output",
 		"/config",
 		config.AF_TARGZ,
@@ -47,6 +48,7 @@ func TestCreateAndGetUpload(t *testing.T) {
 		"/path/to/file",
 		2048,
 		time.Now(),
+		"sample-hash",
 		10,
 		204,
 		time.Now(),
@@ -62,6 +64,7 @@ func TestCreateAndGetUpload(t *testing.T) {
 	assert.Equal(t, metadataJson, upload.StorageBackendMetadataJson)
 	assert.Equal(t, metadataSchemaVersion, upload.StorageBackendMetadataSchemaVersion)
 	assert.True(t, upload.StorageBackendMetadataSchemaVersion > 0)
+	assert.Equal(t, "sample-hash", upload.FileSampleHash)
 
 	// Try to create again, should return existing
 	newUploadId, err := uploadRepo.CreateUpload(
@@ -72,6 +75,7 @@ func TestCreateAndGetUpload(t *testing.T) {
 		"/path/to/file2",
 		4096,
 		time.Now(),
+		"sample-hash-2",
 		20,
 		204,
 		time.Now(),
@@ -85,3 +89,31 @@ func TestCreateAndGetUpload(t *testing.T) {
 	assert.Equal(t, metadataJson, newUpload.StorageBackendMetadataJson)
 	assert.Equal(t, metadataSchemaVersion, newUpload.StorageBackendMetadataSchemaVersion)
 }
+
+func TestDeleteUpload(t *testing.T) {
+	db := setupTestDB(t)
+	taskRepo := NewTaskRepository(db)
+	uploadRepo := NewUploadRepository(db)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	filesInfo := &file_io.FilesInfo{ContentHash: "test-hash"}
+	taskId, err := taskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(), filesInfo)
+	assert.NoError(t, err)
+	uploadId, err := uploadRepo.CreateUpload(ctx, taskId, "{}", 1, "/path/to/file",
+		30, time.Now(), "", 3, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+
+	err = uploadRepo.DeleteUpload(ctx, uploadId)
+	assert.NoError(t, err)
+
+	_, err = uploadRepo.GetUploadByTaskId(ctx, taskId)
+	assert.ErrorIs(t, err, database.ErrDoesNotExist)
+
+	// a new upload can be created for the same task
+	newUploadId, err := uploadRepo.CreateUpload(ctx, taskId, "{}", 1, "/path/to/file",
+		40, time.Now(), "", 4, 10, time.Now(), time.Now())
+	assert.NoError(t, err)
+	assert.NotEqual(t, uploadId, newUploadId)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"glesha/checksum"
+	"glesha/filter"
 	L "glesha/logger"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -48,10 +51,29 @@ func (pr *ProgressReader) Seek(offset int64, whence int) (int64, error) {
 	return pr.R.Seek(offset, whence)
 }
 
-func ComputeFilesInfo(ctx context.Context, inputPath string, ignorePaths map[string]bool) (*FilesInfo, error) {
+// walks "inputPaths" in order and hashes paths and sizes of everything
+// that is not excluded by "f", the archive must use the same filter
+func ComputeFilesInfo(ctx context.Context, inputPaths []string, f *filter.Filter) (*FilesInfo, error) {
 	filesInfo := &FilesInfo{TotalFileCount: 0, SizeInBytes: 0, ReadableFileCount: 0, ContentHash: ""}
 	contentHashWriter := checksum.NewSha256()
-	err := filepath.WalkDir(inputPath, func(path string, d fs.DirEntry, walkError error) error {
+	for _, inputPath := range inputPaths {
+		err := computeFilesInfo(ctx, inputPath, f, filesInfo, contentHashWriter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	filesInfo.ContentHash = checksum.Base64EncodeStr(contentHashWriter.Sum([]byte{}))
+	return filesInfo, nil
+}
+
+func computeFilesInfo(
+	ctx context.Context,
+	inputPath string,
+	f *filter.Filter,
+	filesInfo *FilesInfo,
+	contentHashWriter hash.Hash,
+) error {
+	return filepath.WalkDir(inputPath, func(path string, d fs.DirEntry, walkError error) error {
 		select {
 		case <-ctx.Done():
 			return fs.SkipAll
@@ -61,11 +83,13 @@ func ComputeFilesInfo(ctx context.Context, inputPath string, ignorePaths map[str
 		if walkError != nil {
 			return fs.SkipDir
 		}
-		_, exists := ignorePaths[path]
 
-		if exists {
+		if f.IsExcluded(path, d.IsDir()) {
 			L.Debug(fmt.Sprintf("ComputeFileInfo: Ignoring %s", path))
-			return fs.SkipDir
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
 		}
 
 		isSpecialPath := strings.HasPrefix(path, "/proc") ||
@@ -102,11 +126,37 @@ func ComputeFilesInfo(ctx context.Context, inputPath string, ignorePaths map[str
 		contentHashWriter.Write([]byte(strconv.FormatInt(info.Size(), 10)))
 		return nil
 	})
-	if err != nil {
-		return nil, err
+}
+
+// returns absolute, sorted and de-duplicated "inputPaths", so the same
+// set of paths always maps to the same task. a path inside another one
+// is rejected, since its files would be archived twice
+func NormalizeInputPaths(inputPaths []string) ([]string, error) {
+	if len(inputPaths) == 0 {
+		return nil, fmt.Errorf("no input path provided")
 	}
-	filesInfo.ContentHash = checksum.Base64EncodeStr(contentHashWriter.Sum([]byte{}))
-	return filesInfo, nil
+	res := make([]string, 0, len(inputPaths))
+	for _, p := range inputPaths {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("input path is not valid")
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, abs)
+	}
+	slices.Sort(res)
+	res = slices.Compact(res)
+	for i := 1; i < len(res); i++ {
+		for _, parent := range res[:i] {
+			rel, err := filepath.Rel(parent, res[i])
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("input path %s is inside input path %s", res[i], parent)
+			}
+		}
+	}
+	return res, nil
 }
 
 func IsReadable(filePath string) (bool, error) {
@@ -268,3 +318,81 @@ func ReadFromOffset(ctx context.Context, filePath string, offset int64, buf []by
 		return 0, ctx.Err()
 	}
 }
+
+// returns sha256 and md5 of "size" bytes of file at "filePath" starting from "offset"
+func ComputeRangeChecksums(ctx context.Context, filePath string, offset int64, size int64) (sha256Sum []byte, md5Sum []byte, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open file %s:%w", filePath, err)
+	}
+	defer file.Close()
+	sha256Writer := checksum.NewSha256()
+	md5Writer := checksum.NewMd5()
+	section := io.NewSectionReader(file, offset, size)
+	buf := make([]byte, 1024*1024)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		default:
+		}
+		n, readErr := section.Read(buf)
+		if n > 0 {
+			sha256Writer.Write(buf[:n])
+			md5Writer.Write(buf[:n])
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("could not read %s at offset %d:%w", filePath, offset, readErr)
+		}
+	}
+	return sha256Writer.Sum(nil), md5Writer.Sum(nil), nil
+}
+
+const (
+	SAMPLED_HASH_SAMPLE_COUNT = 16
+	SAMPLED_HASH_SAMPLE_SIZE  = 64 * 1024
+)
+
+// returns a hex encoded sha256 of file size and SAMPLED_HASH_SAMPLE_COUNT
+// evenly spaced samples of "filePath". this is much cheaper than hashing
+// the whole file, and catches files that were rewritten with the same size
+func ComputeSampledHash(ctx context.Context, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not open file %s:%w", filePath, err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("could not stat file %s:%w", filePath, err)
+	}
+	size := stat.Size()
+	hasher := checksum.NewSha256()
+	hasher.Write([]byte(strconv.FormatInt(size, 10)))
+
+	buf := make([]byte, SAMPLED_HASH_SAMPLE_SIZE)
+	var stride int64 = 0
+	if size > SAMPLED_HASH_SAMPLE_SIZE {
+		stride = (size - SAMPLED_HASH_SAMPLE_SIZE) / (SAMPLED_HASH_SAMPLE_COUNT - 1)
+	}
+	for i := range int64(SAMPLED_HASH_SAMPLE_COUNT) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+		offset := i * stride
+		n, readErr := file.ReadAt(buf, offset)
+		if readErr != nil && readErr != io.EOF {
+			return "", fmt.Errorf("could not read %s at offset %d:%w", filePath, offset, readErr)
+		}
+		hasher.Write(buf[:n])
+		if stride == 0 {
+			break
+		}
+	}
+	return checksum.HexEncodeStr(hasher.Sum(nil)), nil
+}
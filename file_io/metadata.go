@@ -0,0 +1,130 @@
+package file_io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileMetadata holds what fs.FileInfo does not expose portably, it is
+// needed to restore ownership and hardlinks
+type FileMetadata struct {
+	Uid   int
+	Gid   int
+	Uname string
+	Gname string
+	// Dev and Ino identify a file across its hardlinks, both are 0 on
+	// platforms without inodes
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
+}
+
+// returns true if more than one path refers to the same file
+func (m *FileMetadata) IsHardlinked() bool {
+	return m.Ino != 0 && m.Nlink > 1
+}
+
+func GetFileMetadata(info fs.FileInfo) FileMetadata {
+	m := fileMetadata(info)
+	m.Uname = lookupName(&userNames, m.Uid, func(id string) (string, error) {
+		u, err := user.LookupId(id)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	})
+	m.Gname = lookupName(&groupNames, m.Gid, func(id string) (string, error) {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return "", err
+		}
+		return g.Name, nil
+	})
+	return m
+}
+
+// names are looked up once per id, most files are owned by a few users
+var userNames, groupNames sync.Map
+
+func lookupName(cache *sync.Map, id int, lookup func(string) (string, error)) string {
+	if name, ok := cache.Load(id); ok {
+		return name.(string)
+	}
+	// ids without a name are archived without one, like tar does
+	name, err := lookup(strconv.Itoa(id))
+	if err != nil {
+		name = ""
+	}
+	cache.Store(id, name)
+	return name
+}
+
+// tags of POSIX ACL entries, see acl_ea.h in the linux kernel
+const (
+	ACL_TAG_USER_OBJ  uint16 = 0x01
+	ACL_TAG_USER      uint16 = 0x02
+	ACL_TAG_GROUP_OBJ uint16 = 0x04
+	ACL_TAG_GROUP     uint16 = 0x08
+	ACL_TAG_MASK      uint16 = 0x10
+	ACL_TAG_OTHER     uint16 = 0x20
+)
+
+// xattrs linux stores POSIX ACLs in
+const (
+	XATTR_POSIX_ACL_ACCESS  = "system.posix_acl_access"
+	XATTR_POSIX_ACL_DEFAULT = "system.posix_acl_default"
+)
+
+// converts the value of a POSIX ACL xattr to the short text form used by
+// setfacl and tar, e.g. "user::rw-,user:1000:r--,group::r--,mask::r--,other::---"
+func PosixACLText(value []byte) (string, error) {
+	const version uint32 = 2
+	const entrySize = 8
+	if len(value) < 4 || binary.LittleEndian.Uint32(value) != version {
+		return "", fmt.Errorf("unsupported posix acl version")
+	}
+	entries := value[4:]
+	if len(entries)%entrySize != 0 {
+		return "", fmt.Errorf("posix acl has a truncated entry")
+	}
+	parts := make([]string, 0, len(entries)/entrySize)
+	for i := 0; i < len(entries); i += entrySize {
+		tag := binary.LittleEndian.Uint16(entries[i:])
+		perm := binary.LittleEndian.Uint16(entries[i+2:])
+		id := binary.LittleEndian.Uint32(entries[i+4:])
+		var qualifier string
+		switch tag {
+		case ACL_TAG_USER_OBJ:
+			qualifier = "user:"
+		case ACL_TAG_USER:
+			qualifier = fmt.Sprintf("user:%d", id)
+		case ACL_TAG_GROUP_OBJ:
+			qualifier = "group:"
+		case ACL_TAG_GROUP:
+			qualifier = fmt.Sprintf("group:%d", id)
+		case ACL_TAG_MASK:
+			qualifier = "mask:"
+		case ACL_TAG_OTHER:
+			qualifier = "other:"
+		default:
+			return "", fmt.Errorf("unknown posix acl tag: %#x", tag)
+		}
+		perms := []byte("---")
+		if perm&4 != 0 {
+			perms[0] = 'r'
+		}
+		if perm&2 != 0 {
+			perms[1] = 'w'
+		}
+		if perm&1 != 0 {
+			perms[2] = 'x'
+		}
+		parts = append(parts, qualifier+":"+string(perms))
+	}
+	return strings.Join(parts, ","), nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package file_io
+
+import "io/fs"
+
+// ownership and inodes are not available, every file is its own hardlink
+func fileMetadata(info fs.FileInfo) FileMetadata {
+	return FileMetadata{Nlink: 1}
+}
@@ -0,0 +1,35 @@
+package file_io
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosixACLText(t *testing.T) {
+	acl := binary.LittleEndian.AppendUint32(nil, 2)
+	for _, e := range []struct {
+		tag  uint16
+		perm uint16
+		id   uint32
+	}{
+		{ACL_TAG_USER_OBJ, 6, 0xffffffff},
+		{ACL_TAG_USER, 4, 1000},
+		{ACL_TAG_GROUP_OBJ, 5, 0xffffffff},
+		{ACL_TAG_MASK, 7, 0xffffffff},
+		{ACL_TAG_OTHER, 0, 0xffffffff},
+	} {
+		acl = binary.LittleEndian.AppendUint16(acl, e.tag)
+		acl = binary.LittleEndian.AppendUint16(acl, e.perm)
+		acl = binary.LittleEndian.AppendUint32(acl, e.id)
+	}
+	text, err := PosixACLText(acl)
+	assert.NoError(t, err)
+	assert.Equal(t, "user::rw-,user:1000:r--,group::r-x,mask::rwx,other::---", text)
+
+	_, err = PosixACLText(acl[:len(acl)-1])
+	assert.Error(t, err)
+	_, err = PosixACLText([]byte{1, 0, 0, 0})
+	assert.Error(t, err)
+}
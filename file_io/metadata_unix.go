@@ -0,0 +1,22 @@
+//go:build unix
+
+package file_io
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func fileMetadata(info fs.FileInfo) FileMetadata {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileMetadata{Nlink: 1}
+	}
+	return FileMetadata{
+		Uid:   int(st.Uid),
+		Gid:   int(st.Gid),
+		Dev:   uint64(st.Dev),
+		Ino:   uint64(st.Ino),
+		Nlink: uint64(st.Nlink),
+	}
+}
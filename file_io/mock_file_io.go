@@ -2,6 +2,7 @@ package file_io
 
 import (
 	"context"
+	"glesha/filter"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -24,7 +25,7 @@ func (m *MockFileIO) IsWritable(path string) error {
 }
 
 // ComputeFilesInfo is a mock method
-func (m *MockFileIO) ComputeFilesInfo(ctx context.Context, path string, ignoredDirs map[string]bool) (*FilesInfo, error) {
-	args := m.Called(ctx, path, ignoredDirs)
+func (m *MockFileIO) ComputeFilesInfo(ctx context.Context, paths []string, f *filter.Filter) (*FilesInfo, error) {
+	args := m.Called(ctx, paths, f)
 	return args.Get(0).(*FilesInfo), args.Error(1)
 }
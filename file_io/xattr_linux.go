@@ -0,0 +1,61 @@
+//go:build linux
+
+package file_io
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// returns the extended attributes of "path" without following symlinks,
+// POSIX ACLs are included as XATTR_POSIX_ACL_ACCESS and
+// XATTR_POSIX_ACL_DEFAULT. file systems without xattrs have none
+func ReadXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list xattrs of %s: %w", path, err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	names := make([]byte, size)
+	size, err = unix.Llistxattr(path, names)
+	if err != nil {
+		return nil, fmt.Errorf("could not list xattrs of %s: %w", path, err)
+	}
+	xattrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getXattr(path, name)
+		if errors.Is(err, unix.ENODATA) {
+			// removed after it was listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read xattr %s of %s: %w", name, path, err)
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+func getXattr(path string, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
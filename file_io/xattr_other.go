@@ -0,0 +1,8 @@
+//go:build !linux
+
+package file_io
+
+// extended attributes are only archived on linux
+func ReadXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,309 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	L "glesha/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// name of files with gitignore style patterns, discovered in the input tree
+const IGNORE_FILE_NAME = ".gleshaignore"
+
+type pattern struct {
+	line    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Filter decides which paths under the input paths are left out of both
+// the content hash and the archive, so the two always agree
+type Filter struct {
+	roots []string
+	// absolute paths that are always skipped, e.g. the glesha work dir
+	ignoredPaths map[string]bool
+	// patterns from --exclude, --include and config.json, relative to the
+	// root a path is in
+	patterns []pattern
+	// patterns from IGNORE_FILE_NAME files, by the directory they are in
+	mu          sync.Mutex
+	ignoreFiles map[string][]pattern
+}
+
+// returns a filter for paths under "roots", "lines" are gitignore style
+// patterns relative to each root, see 'glesha help add'
+func New(roots []string, lines []string, ignoredPaths map[string]bool) (*Filter, error) {
+	patterns, err := parseLines(lines)
+	if err != nil {
+		return nil, err
+	}
+	if ignoredPaths == nil {
+		ignoredPaths = make(map[string]bool)
+	}
+	cleanRoots := make([]string, len(roots))
+	for i, root := range roots {
+		cleanRoots[i] = filepath.Clean(root)
+	}
+	return &Filter{
+		roots:        cleanRoots,
+		ignoredPaths: ignoredPaths,
+		patterns:     patterns,
+		ignoreFiles:  make(map[string][]pattern),
+	}, nil
+}
+
+// returns gitignore style lines for "excludes" and "includes", includes
+// are negated, so they re-include paths matched by earlier excludes
+func Lines(excludes []string, includes []string) []string {
+	lines := make([]string, 0, len(excludes)+len(includes))
+	lines = append(lines, excludes...)
+	for _, include := range includes {
+		lines = append(lines, "!"+include)
+	}
+	return lines
+}
+
+// returns true if "path" should be skipped. it expects parents to be
+// checked before their children, and excluded directories to not be
+// walked into, like filepath.Walk does
+func (f *Filter) IsExcluded(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	path = filepath.Clean(path)
+	if f.ignoredPaths[path] {
+		return true
+	}
+	root, ok := f.rootOf(path)
+	if !ok || path == root {
+		return false
+	}
+	excluded := false
+	// later patterns take precedence, deeper ignore files override
+	// shallower ones, like in git
+	if negate, ok := matchLast(f.patterns, root, path, isDir); ok {
+		excluded = !negate
+	}
+	for _, dir := range parentDirs(root, path) {
+		if negate, ok := matchLast(f.ignoreFile(dir), dir, path, isDir); ok {
+			excluded = !negate
+		}
+	}
+	return excluded
+}
+
+// returns the innermost root that "path" is in
+func (f *Filter) rootOf(path string) (string, bool) {
+	found := ""
+	for _, root := range f.roots {
+		if len(root) <= len(found) {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		found = root
+	}
+	return found, len(found) > 0
+}
+
+// returns directories from "root" to the parent of "path"
+func parentDirs(root string, path string) []string {
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return dirs
+}
+
+func (f *Filter) ignoreFile(dir string) []pattern {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	patterns, ok := f.ignoreFiles[dir]
+	if ok {
+		return patterns
+	}
+	ignoreFilePath := filepath.Join(dir, IGNORE_FILE_NAME)
+	file, err := os.Open(ignoreFilePath)
+	if err == nil {
+		defer file.Close()
+		var lines []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		patterns, err = parseLines(lines)
+		if err != nil {
+			L.Warn(fmt.Errorf("filter: ignoring %s: %w", ignoreFilePath, err))
+			patterns = nil
+		} else {
+			L.Debug(fmt.Sprintf("filter: using %d patterns from %s", len(patterns), ignoreFilePath))
+		}
+	}
+	f.ignoreFiles[dir] = patterns
+	return patterns
+}
+
+// returns whether the last pattern matching "path" is negated, and
+// false if no pattern matches
+func matchLast(patterns []pattern, base string, path string, isDir bool) (negate bool, ok bool) {
+	if len(patterns) == 0 {
+		return false, false
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+	for i := len(patterns) - 1; i >= 0; i-- {
+		p := patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			return p.negate, true
+		}
+	}
+	return false, false
+}
+
+func parseLines(lines []string) ([]pattern, error) {
+	var patterns []pattern
+	for _, line := range lines {
+		p, ok, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, nil
+}
+
+// parses a single gitignore style line, returns false for blank lines
+// and comments
+func parseLine(line string) (pattern, bool, error) {
+	p := pattern{line: line}
+	line = strings.TrimRight(line, " \t\r")
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if len(line) == 0 {
+		return p, false, nil
+	}
+	re, err := regexp.Compile(patternToRegexp(line))
+	if err != nil {
+		return p, false, fmt.Errorf("invalid pattern %q: %w", p.line, err)
+	}
+	p.re = re
+	return p, true, nil
+}
+
+// patterns with a slash are relative to their base, others match at any depth
+func patternToRegexp(glob string) string {
+	anchored := strings.Contains(glob, "/")
+	glob = strings.TrimPrefix(glob, "/")
+	expr := globToRegexp(glob)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+	return "^" + expr + "$"
+}
+
+// compiles a gitignore style pattern matching slash separated paths
+func CompileGlob(glob string, ignoreCase bool) (*regexp.Regexp, error) {
+	expr := patternToRegexp(strings.TrimRight(glob, "/"))
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", glob, err)
+	}
+	return re, nil
+}
+
+// returns the longest text every match of "re" contains, or an empty
+// string if there is none. the text may differ in case for (?i) patterns
+func RequiredSubstring(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	parsed = parsed.Simplify()
+	subs := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		subs = parsed.Sub
+	}
+	longest := ""
+	for _, sub := range subs {
+		if sub.Op == syntax.OpLiteral && len(string(sub.Rune)) > len(longest) {
+			longest = string(sub.Rune)
+		}
+	}
+	return longest
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
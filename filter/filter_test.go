@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_IsExcluded(t *testing.T) {
+	root := t.TempDir()
+	f, err := New([]string{root}, Lines(
+		[]string{"node_modules/", "*.log", "/build", "cache/**", "docs/**/*.pdf", "# comment", ""},
+		[]string{"keep.log"},
+	), map[string]bool{filepath.Join(root, "work"): true})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{".", true, false},
+		{"work", true, true},
+		{"node_modules", true, true},
+		{"a/b/node_modules", true, true},
+		{"node_modules", false, false},
+		{"app.log", false, true},
+		{"a/app.log", false, true},
+		{"a/keep.log", false, false},
+		{"build", true, true},
+		{"a/build", true, false},
+		{"cache", true, false},
+		{"cache/x/y", false, true},
+		{"docs/a.pdf", false, true},
+		{"docs/x/y/a.pdf", false, true},
+		{"docs/a.txt", false, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(root, tt.path)
+		assert.Equal(t, tt.excluded, f.IsExcluded(path, tt.isDir), "path %s", tt.path)
+	}
+}
+
+func TestFilter_IgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, IGNORE_FILE_NAME), []byte("*.iso\n*.tmp\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a", IGNORE_FILE_NAME), []byte("!important.iso\n/local\n"), 0644))
+
+	f, err := New([]string{root}, []string{"*.bak"}, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, f.IsExcluded(filepath.Join(root, "vm.iso"), false))
+	assert.True(t, f.IsExcluded(filepath.Join(root, "a", "b", "x.tmp"), false))
+	assert.True(t, f.IsExcluded(filepath.Join(root, "a", "x.bak"), false))
+	// deeper ignore files override shallower ones
+	assert.False(t, f.IsExcluded(filepath.Join(root, "a", "b", "important.iso"), false))
+	assert.True(t, f.IsExcluded(filepath.Join(root, "important.iso"), false))
+	// anchored patterns are relative to the ignore file
+	assert.True(t, f.IsExcluded(filepath.Join(root, "a", "local"), true))
+	assert.False(t, f.IsExcluded(filepath.Join(root, "local"), true))
+}
+
+func TestFilter_Nil(t *testing.T) {
+	var f *Filter
+	assert.False(t, f.IsExcluded("/any/path", false))
+}
+
+func TestFilter_MultipleRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	docs := filepath.Join(tempDir, "docs")
+	photos := filepath.Join(tempDir, "photos")
+	assert.NoError(t, os.MkdirAll(docs, 0755))
+	assert.NoError(t, os.MkdirAll(photos, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(photos, IGNORE_FILE_NAME), []byte("*.raw\n"), 0644))
+
+	f, err := New([]string{docs, photos}, []string{"/drafts"}, nil)
+	assert.NoError(t, err)
+
+	// anchored patterns are relative to the root a path is in
+	assert.True(t, f.IsExcluded(filepath.Join(docs, "drafts"), true))
+	assert.True(t, f.IsExcluded(filepath.Join(photos, "drafts"), true))
+	assert.False(t, f.IsExcluded(filepath.Join(docs, "a", "drafts"), true))
+	// ignore files only apply inside their own root
+	assert.True(t, f.IsExcluded(filepath.Join(photos, "a.raw"), false))
+	assert.False(t, f.IsExcluded(filepath.Join(docs, "a.raw"), false))
+	// roots themselves are never excluded
+	assert.False(t, f.IsExcluded(docs, true))
+	assert.False(t, f.IsExcluded(photos, true))
+}
+
+func TestCompileGlob(t *testing.T) {
+	re, err := CompileGlob("*.PDF", true)
+	assert.NoError(t, err)
+	assert.True(t, re.MatchString("docs/taxes/2023.pdf"))
+	assert.False(t, re.MatchString("docs/taxes/2023.pdf.bak"))
+
+	re, err = CompileGlob("docs/**/taxes/*.pdf", false)
+	assert.NoError(t, err)
+	assert.True(t, re.MatchString("docs/2023/taxes/a.pdf"))
+	assert.False(t, re.MatchString("old/docs/2023/taxes/a.pdf"))
+	assert.False(t, re.MatchString("docs/2023/Taxes/a.pdf"))
+}
+
+func TestRequiredSubstring(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{`^(.*/)?[^/]*\.pdf$`, ".pdf"},
+		{`taxes/[^/]*receipt`, "receipt"},
+		{`(?i)Taxes`, "Taxes"},
+		{`a|b`, ""},
+		{`.*`, ""},
+	}
+	for _, tt := range tests {
+		// case insensitive patterns may return the text in any case
+		assert.Equal(t, strings.ToLower(tt.expected),
+			strings.ToLower(RequiredSubstring(regexp.MustCompile(tt.expr))), tt.expr)
+	}
+}
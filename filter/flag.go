@@ -0,0 +1,16 @@
+package filter
+
+import "strings"
+
+// PatternsFlag collects a flag that can be given more than once, for
+// --exclude and --include, use it with flag.Var
+type PatternsFlag []string
+
+func (p *PatternsFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *PatternsFlag) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
@@ -5,8 +5,10 @@ go 1.24.3
 require (
 	github.com/charmbracelet/bubbletea v1.3.10
 	github.com/charmbracelet/lipgloss v1.1.0
+	github.com/hanwen/go-fuse/v2 v2.11.0
 	github.com/muesli/termenv v0.16.0
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.39.0
 	modernc.org/sqlite v1.37.1
 )
 
@@ -33,7 +35,6 @@ require (
 	github.com/stretchr/objx v0.5.2 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/exp v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.3.8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	modernc.org/libc v1.65.7 // indirect
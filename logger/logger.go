@@ -2,6 +2,7 @@ package L
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -79,6 +80,8 @@ var (
 	footerText   = ""
 	footerLines  = 0
 	footerLevel  = INFO
+	// footers move the cursor, so they are only printed to a terminal
+	footerOutput io.Writer = os.Stdout
 )
 
 // cursor sequences
@@ -150,6 +153,22 @@ func SetColorMode(cm ColorMode) error {
 	return nil
 }
 
+// writes all logs to "w" instead of stdout and stderr, e.g. while the
+// tui owns the terminal. footers are not printed unless "w" is stdout
+func SetOutput(w io.Writer) {
+	footerMutex.Lock()
+	defer footerMutex.Unlock()
+	clearFooter()
+	footerLines = 0
+	for _, l := range []*log.Logger{debugLogger, infoLogger, normalLogger, warnLogger, errorLogger, panicLogger} {
+		l.SetOutput(w)
+	}
+	footerOutput = nil
+	if w == os.Stdout {
+		footerOutput = os.Stdout
+	}
+}
+
 func (cm ColorMode) String() string {
 	switch cm {
 	case COLOR_MODE_ALWAYS:
@@ -291,30 +291,30 @@ func getLoggerAndStyle(l LogLevel) (*log.Logger, *lipgloss.Style) {
 // removes the current footer from terminal
 // Must be called while holding footerMutex
 func clearFooter() {
-	if footerLines == 0 {
+	if footerLines == 0 || footerOutput == nil {
 		return
 	}
 
 	// Move cursor up to start of footer
 	for i := 0; i < footerLines; i++ {
-		fmt.Printf("%s", c_up)
+		fmt.Fprint(footerOutput, c_up)
 	}
 
 	// Clear each footer line
 	for i := 0; i < footerLines; i++ {
-		fmt.Printf("\r%s\n", c_clear_line)
+		fmt.Fprintf(footerOutput, "\r%s\n", c_clear_line)
 	}
 
 	// Move cursor back up to where footer started
 	for i := 0; i < footerLines; i++ {
-		fmt.Printf("%s", c_up)
+		fmt.Fprint(footerOutput, c_up)
 	}
 }
 
 // reprints the footer after a log message
 // must be called while holding `footerMutex`
 func printFooter() int {
-	if len(footerText) == 0 {
+	if len(footerText) == 0 || footerOutput == nil {
 		return 0
 	}
 	_, style := getLoggerAndStyle(footerLevel)
@@ -325,7 +325,7 @@ func printFooter() int {
 			continue
 		}
 		rendered := style.Render(strings.TrimSpace(line))
-		fmt.Printf("%s\n", rendered)
+		fmt.Fprintf(footerOutput, "%s\n", rendered)
 		lineCnt++
 	}
 	return lineCnt
@@ -0,0 +1,371 @@
+//go:build linux || darwin
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/database"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/runner"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// catalogs do not change until a task is archived again, so the kernel
+// may cache names and attributes for a while
+const CACHE_TIMEOUT = time.Minute
+
+// reads further ahead than this are served by opening the entry again
+// at the requested offset instead of reading up to it
+const MAX_SKIP_BYTES int64 = 4 * 1024 * 1024
+
+// inode numbers of tasks and catalog entries, apart from each other and
+// from the numbers go-fuse assigns itself
+const (
+	TASK_INO_BASE  uint64 = 1 << 61
+	ENTRY_INO_BASE uint64 = 1 << 62
+)
+
+type catalogFS struct {
+	// reads outlive the fuse request that opened the file
+	ctx     context.Context
+	r       *runner.Runner
+	entries *runner.EntryReader
+}
+
+// mounts the catalogs of all tasks read only at "mountpoint" until "ctx"
+// is done or it is unmounted, e.g. with 'fusermount -u'
+func Mount(ctx context.Context, r *runner.Runner, mountpoint string, opts Options) error {
+	cfs := &catalogFS{ctx: ctx, r: r, entries: r.NewEntryReader()}
+	timeout := CACHE_TIMEOUT
+	server, err := gofs.Mount(mountpoint, &rootNode{cfs: cfs}, &gofs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:     "glesha",
+			Name:       "glesha",
+			Options:    []string{"ro"},
+			AllowOther: opts.AllowOther,
+			// mount(2) works without fusermount when running as root
+			DirectMount: true,
+			Debug:       L.IsVerbose(),
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+	if err != nil {
+		return fmt.Errorf("could not mount %s: %w", mountpoint, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	err = server.Unmount()
+	if err != nil {
+		return fmt.Errorf("could not unmount %s, it may still be in use: %w", mountpoint, err)
+	}
+	<-done
+	return nil
+}
+
+// lists every task as a directory named by its id
+type rootNode struct {
+	gofs.Inode
+	cfs *catalogFS
+}
+
+var _ = (gofs.NodeReaddirer)((*rootNode)(nil))
+var _ = (gofs.NodeLookuper)((*rootNode)(nil))
+
+func (n *rootNode) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	tasks, err := n.cfs.r.TaskRepo.ListTasks(ctx)
+	if err != nil {
+		return nil, toErrno("list tasks", err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(tasks))
+	for _, t := range tasks {
+		entries = append(entries, fuse.DirEntry{
+			Name: strconv.FormatInt(t.Id, 10),
+			Mode: fuse.S_IFDIR,
+			Ino:  TASK_INO_BASE | uint64(t.Id),
+		})
+	}
+	return gofs.NewListDirStream(entries), 0
+}
+
+func (n *rootNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	taskId, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || strconv.FormatInt(taskId, 10) != name {
+		return nil, syscall.ENOENT
+	}
+	t, err := n.cfs.r.TaskRepo.GetTaskById(ctx, taskId)
+	if err != nil {
+		return nil, toErrno("get task "+name, err)
+	}
+	taskAttr(t, &out.Attr)
+	child := &dirNode{cfs: n.cfs, taskId: t.Id, task: t}
+	return n.NewInode(ctx, child, gofs.StableAttr{Mode: fuse.S_IFDIR, Ino: TASK_INO_BASE | uint64(t.Id)}), 0
+}
+
+// a task, or a directory in its catalog
+type dirNode struct {
+	gofs.Inode
+	cfs    *catalogFS
+	taskId int64
+	// set for tasks
+	task *model.Task
+	// set for directories in the catalog
+	row *model.FileCatalogRow
+}
+
+var _ = (gofs.NodeReaddirer)((*dirNode)(nil))
+var _ = (gofs.NodeLookuper)((*dirNode)(nil))
+var _ = (gofs.NodeGetattrer)((*dirNode)(nil))
+
+// entries of a task directory are the top level entries of its archive
+func (n *dirNode) catalogPath() string {
+	if n.row == nil {
+		return "."
+	}
+	return n.row.FullPath
+}
+
+func (n *dirNode) Getattr(ctx context.Context, f gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if n.row == nil {
+		taskAttr(n.task, &out.Attr)
+		return 0
+	}
+	entryAttr(n.row, &out.Attr)
+	return 0
+}
+
+func (n *dirNode) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	rows, err := n.cfs.r.FileCatalogRepo.GetByParentPath(ctx, n.taskId, n.catalogPath())
+	if err != nil {
+		return nil, toErrno("list "+n.catalogPath(), err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for i := range rows {
+		if !isValidName(rows[i].Name) || seen[rows[i].Name] {
+			continue
+		}
+		seen[rows[i].Name] = true
+		entries = append(entries, fuse.DirEntry{
+			Name: rows[i].Name,
+			Mode: fileType(&rows[i]),
+			Ino:  ENTRY_INO_BASE | uint64(rows[i].Id),
+		})
+	}
+	return gofs.NewListDirStream(entries), 0
+}
+
+func (n *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	if !isValidName(name) {
+		return nil, syscall.ENOENT
+	}
+	fullPath := name
+	if n.row != nil {
+		fullPath = filepath.Join(n.row.FullPath, name)
+	}
+	row, err := n.cfs.r.FileCatalogRepo.GetByFullPath(ctx, n.taskId, fullPath)
+	if err != nil {
+		return nil, toErrno("look up "+fullPath, err)
+	}
+	entryAttr(row, &out.Attr)
+	var child gofs.InodeEmbedder
+	switch fileType(row) {
+	case fuse.S_IFDIR:
+		child = &dirNode{cfs: n.cfs, taskId: n.taskId, row: row}
+	case fuse.S_IFLNK:
+		child = &symlinkNode{cfs: n.cfs, row: row}
+	default:
+		child = &fileNode{cfs: n.cfs, row: row}
+	}
+	return n.NewInode(ctx, child, gofs.StableAttr{Mode: fileType(row), Ino: ENTRY_INO_BASE | uint64(row.Id)}), 0
+}
+
+type symlinkNode struct {
+	gofs.Inode
+	cfs *catalogFS
+	row *model.FileCatalogRow
+}
+
+var _ = (gofs.NodeReadlinker)((*symlinkNode)(nil))
+var _ = (gofs.NodeGetattrer)((*symlinkNode)(nil))
+
+func (n *symlinkNode) Getattr(ctx context.Context, f gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	entryAttr(n.row, &out.Attr)
+	return 0
+}
+
+func (n *symlinkNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	target, err := n.cfs.entries.Readlink(ctx, n.row)
+	if err != nil {
+		return nil, toErrno("read link "+n.row.FullPath, err)
+	}
+	return []byte(target), 0
+}
+
+type fileNode struct {
+	gofs.Inode
+	cfs *catalogFS
+	row *model.FileCatalogRow
+}
+
+var _ = (gofs.NodeOpener)((*fileNode)(nil))
+var _ = (gofs.NodeGetattrer)((*fileNode)(nil))
+
+func (n *fileNode) Getattr(ctx context.Context, f gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	entryAttr(n.row, &out.Attr)
+	return 0
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	// content is opened on the first read, so 'ls' and 'stat' stay cheap
+	return &fileHandle{cfs: n.cfs, row: n.row}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// fileHandle streams an entry from its start, reads at earlier offsets
+// open it again, which for tar.gz archives decompresses it from the start
+type fileHandle struct {
+	cfs *catalogFS
+	row *model.FileCatalogRow
+	mu  sync.Mutex
+	rc  io.ReadCloser
+	pos int64
+	// the last read, the kernel may request it again out of order
+	last    []byte
+	lastOff int64
+}
+
+var _ = (gofs.FileReader)((*fileHandle)(nil))
+var _ = (gofs.FileReleaser)((*fileHandle)(nil))
+
+func (h *fileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if off >= h.row.SizeBytes {
+		return fuse.ReadResultData(nil), 0
+	}
+	if off >= h.lastOff && off+int64(len(dest)) <= h.lastOff+int64(len(h.last)) {
+		return fuse.ReadResultData(h.last[off-h.lastOff : off-h.lastOff+int64(len(dest))]), 0
+	}
+	if h.rc == nil || off < h.pos || off-h.pos > MAX_SKIP_BYTES {
+		h.close()
+		rc, err := h.cfs.entries.Open(h.cfs.ctx, h.row, off)
+		if err != nil {
+			return nil, toErrno("open "+h.row.FullPath, err)
+		}
+		h.rc = rc
+		h.pos = off
+	}
+	if off > h.pos {
+		n, err := io.CopyN(io.Discard, h.rc, off-h.pos)
+		h.pos += n
+		if err == io.EOF {
+			return fuse.ReadResultData(nil), 0
+		}
+		if err != nil {
+			h.close()
+			return nil, toErrno("read "+h.row.FullPath, err)
+		}
+	}
+	n, err := io.ReadFull(h.rc, dest)
+	h.pos += int64(n)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		h.close()
+		return nil, toErrno("read "+h.row.FullPath, err)
+	}
+	h.last = append(h.last[:0], dest[:n]...)
+	h.lastOff = off
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *fileHandle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.close()
+	h.last = nil
+	return 0
+}
+
+func (h *fileHandle) close() {
+	if h.rc != nil {
+		h.rc.Close()
+		h.rc = nil
+	}
+}
+
+func fileType(row *model.FileCatalogRow) uint32 {
+	mode := fs.FileMode(row.Mode)
+	switch {
+	case row.FileType == "dir":
+		return fuse.S_IFDIR
+	case mode&fs.ModeSymlink != 0:
+		return fuse.S_IFLNK
+	default:
+		return fuse.S_IFREG
+	}
+}
+
+// catalog entries are shown with their archived owner, permissions
+// without write bits, size and modification time
+func entryAttr(row *model.FileCatalogRow, out *fuse.Attr) {
+	out.Ino = ENTRY_INO_BASE | uint64(row.Id)
+	out.Mode = fileType(row) | uint32(fs.FileMode(row.Mode).Perm()&^0222)
+	out.Size = uint64(max(row.SizeBytes, 0))
+	// du counts blocks
+	out.Blocks = (out.Size + 511) / 512
+	out.Blksize = 4096
+	out.Nlink = 1
+	out.Owner = fuse.Owner{Uid: uint32(row.Uid), Gid: uint32(row.Gid)}
+	mtime := row.ModifiedAt
+	out.SetTimes(&mtime, &mtime, &mtime)
+}
+
+func taskAttr(t *model.Task, out *fuse.Attr) {
+	out.Ino = TASK_INO_BASE | uint64(t.Id)
+	out.Mode = fuse.S_IFDIR | 0555
+	out.Nlink = 2
+	out.Blksize = 4096
+	updatedAt := t.UpdatedAt
+	out.SetTimes(&updatedAt, &updatedAt, &updatedAt)
+}
+
+// catalogs of tasks archiving / have an entry for / itself
+func isValidName(name string) bool {
+	return len(name) > 0 && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// missing entries are expected when looking up names, other errors are
+// logged since the caller only sees EIO
+func toErrno(action string, err error) syscall.Errno {
+	if errors.Is(err, database.ErrDoesNotExist) {
+		return syscall.ENOENT
+	}
+	if errors.Is(err, context.Canceled) {
+		return syscall.EINTR
+	}
+	L.Warn(fmt.Sprintf("mount: could not %s: %v", action, err))
+	return syscall.EIO
+}
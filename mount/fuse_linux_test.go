@@ -0,0 +1,92 @@
+package mount
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/config"
+	"glesha/database"
+	"glesha/file_io"
+	"glesha/runner"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestMount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mounting without fusermount needs root")
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("fuse is not available")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inputPath := filepath.Join(t.TempDir(), "docs")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "sub", "a.txt"), []byte("hello"), 0644))
+	assert.NoError(t, os.Symlink("sub/a.txt", filepath.Join(inputPath, "link")))
+
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Init(ctx))
+	r := runner.NewRunner(db)
+	taskId, err := r.TaskRepo.CreateTask(ctx, []string{inputPath}, t.TempDir(), "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: "test-hash"})
+	assert.NoError(t, err)
+	task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+	archiver, err := archive.NewTarGzArchiver(task)
+	assert.NoError(t, err)
+	assert.NoError(t, archiver.Plan(ctx))
+	assert.NoError(t, archiver.Start(ctx, r.FileCatalogRepo, r.TaskRepo))
+
+	mountPoint := t.TempDir()
+	done := make(chan error)
+	go func() {
+		done <- Mount(ctx, r, mountPoint, Options{})
+	}()
+	taskDir := filepath.Join(mountPoint, strconv.FormatInt(taskId, 10))
+	var info os.FileInfo
+	for range 50 {
+		info, err = os.Stat(taskDir)
+		if err == nil {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Skipf("could not mount: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, info.IsDir())
+
+	entries, err := os.ReadDir(filepath.Join(taskDir, "docs"))
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"link", "sub"}, names)
+
+	data, err := os.ReadFile(filepath.Join(taskDir, "docs", "sub", "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	target, err := os.Readlink(filepath.Join(taskDir, "docs", "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sub/a.txt", target)
+	err = os.WriteFile(filepath.Join(taskDir, "docs", "new.txt"), nil, 0644)
+	assert.Error(t, err)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,10 @@
+// Package mount exposes the file catalogs of tasks as a read only
+// filesystem, files are read from their archives on demand
+package mount
+
+// Options of a mount
+type Options struct {
+	// lets other users access the mount, needs user_allow_other in
+	// /etc/fuse.conf unless mounting as root
+	AllowOther bool
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"glesha/runner"
+	"runtime"
+)
+
+func Mount(ctx context.Context, r *runner.Runner, mountpoint string, opts Options) error {
+	return fmt.Errorf("mounting is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,72 @@
+package retention
+
+import (
+	"fmt"
+	"glesha/database/model"
+	"sort"
+	"time"
+)
+
+type rule struct {
+	keep int64
+	// backups in the same bucket count as one, only the most recent
+	// backup of a bucket is kept
+	bucket func(t time.Time) string
+}
+
+// splits "backups" of a single input path into the ones kept by "policy"
+// and the ones that can be removed. backups are ordered newest first, and
+// the time a backup was created is used to place it in days, weeks and months
+func Select(backups []*model.Task, policy *model.RetentionPolicy) (keep []*model.Task, remove []*model.Task) {
+	sorted := make([]*model.Task, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].Id > sorted[j].Id
+		}
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+	if policy == nil || policy.IsEmpty() {
+		return sorted, nil
+	}
+
+	rules := []rule{
+		{keep: policy.KeepLast, bucket: nil},
+		{keep: policy.KeepDaily, bucket: func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{keep: policy.KeepWeekly, bucket: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{keep: policy.KeepMonthly, bucket: func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	kept := make(map[int64]bool)
+	for _, r := range rules {
+		remaining := r.keep
+		lastBucket := ""
+		for _, b := range sorted {
+			if remaining <= 0 {
+				break
+			}
+			if r.bucket == nil {
+				kept[b.Id] = true
+				remaining--
+				continue
+			}
+			bucket := r.bucket(b.CreatedAt)
+			if bucket == lastBucket {
+				continue
+			}
+			lastBucket = bucket
+			kept[b.Id] = true
+			remaining--
+		}
+	}
+	for _, b := range sorted {
+		if kept[b.Id] {
+			keep = append(keep, b)
+		} else {
+			remove = append(remove, b)
+		}
+	}
+	return keep, remove
+}
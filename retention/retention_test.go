@@ -0,0 +1,69 @@
+package retention
+
+import (
+	"glesha/database/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func backupsAt(times ...string) []*model.Task {
+	var tasks []*model.Task
+	for i, ts := range times {
+		createdAt, err := time.Parse(time.DateTime, ts)
+		if err != nil {
+			panic(err)
+		}
+		tasks = append(tasks, &model.Task{Id: int64(i + 1), CreatedAt: createdAt})
+	}
+	return tasks
+}
+
+func ids(tasks []*model.Task) []int64 {
+	var res []int64
+	for _, t := range tasks {
+		res = append(res, t.Id)
+	}
+	return res
+}
+
+func TestSelect(t *testing.T) {
+	backups := backupsAt(
+		"2025-01-01 02:00:00", // 1: wed, week 1, jan
+		"2025-01-15 02:00:00", // 2: wed, week 3, jan
+		"2025-02-03 02:00:00", // 3: mon, week 6, feb
+		"2025-02-04 02:00:00", // 4: tue, week 6, feb
+		"2025-02-04 14:00:00", // 5: tue, week 6, feb
+		"2025-02-05 02:00:00", // 6: wed, week 6, feb
+	)
+
+	t.Run("EmptyPolicyKeepsAll", func(t *testing.T) {
+		keep, remove := Select(backups, &model.RetentionPolicy{})
+		assert.Equal(t, []int64{6, 5, 4, 3, 2, 1}, ids(keep))
+		assert.Empty(t, remove)
+	})
+
+	t.Run("KeepLast", func(t *testing.T) {
+		keep, remove := Select(backups, &model.RetentionPolicy{KeepLast: 2})
+		assert.Equal(t, []int64{6, 5}, ids(keep))
+		assert.Equal(t, []int64{4, 3, 2, 1}, ids(remove))
+	})
+
+	t.Run("KeepDaily", func(t *testing.T) {
+		keep, _ := Select(backups, &model.RetentionPolicy{KeepDaily: 3})
+		// 4 and 5 are on the same day, only the newer one is kept
+		assert.Equal(t, []int64{6, 5, 3}, ids(keep))
+	})
+
+	t.Run("KeepWeeklyAndMonthly", func(t *testing.T) {
+		keep, remove := Select(backups, &model.RetentionPolicy{KeepWeekly: 2, KeepMonthly: 2})
+		assert.Equal(t, []int64{6, 2}, ids(keep))
+		assert.Equal(t, []int64{5, 4, 3, 1}, ids(remove))
+	})
+
+	t.Run("RulesAreCombined", func(t *testing.T) {
+		keep, _ := Select(backups, &model.RetentionPolicy{KeepLast: 1, KeepMonthly: 3})
+		assert.Equal(t, []int64{6, 2}, ids(keep))
+	})
+}
@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/control"
+	"glesha/database/model"
+	L "glesha/logger"
+	"sync"
+)
+
+const (
+	PHASE_ARCHIVE string = "archive"
+	PHASE_UPLOAD  string = "upload"
+	// packs of repo archives are uploaded before the manifest
+	PHASE_PACKS string = "packs"
+)
+
+// returned by RunTask when the task was stopped with control.ACTION_ABORT
+var ErrTaskAborted = errors.New("task was aborted")
+
+// TaskProgress is the progress of a task running in this process
+type TaskProgress struct {
+	Phase  string
+	Paused bool
+	// files for PHASE_ARCHIVE, bytes for PHASE_PACKS and PHASE_UPLOAD
+	Done  int64
+	Total int64
+}
+
+// taskController handles requests received on the control socket of the
+// task being run, and persists paused states of the task and its upload
+type taskController struct {
+	mu         sync.Mutex
+	runner     *Runner
+	taskId     int64
+	phase      string
+	paused     bool
+	archiver   archive.Archiver
+	uploadId   int64
+	uploadGate *control.Gate
+	// shared by packs and the archive, they are not uploaded at the same time
+	uploadProgress *backend.UploadProgress
+	// cancels the context the task runs with
+	cancel  context.CancelFunc
+	aborted bool
+}
+
+func newTaskController(r *Runner, taskId int64, cancel context.CancelFunc) *taskController {
+	return &taskController{
+		runner:         r,
+		taskId:         taskId,
+		uploadGate:     control.NewGate(),
+		uploadProgress: backend.NewUploadProgress(),
+		cancel:         cancel,
+	}
+}
+
+func (tc *taskController) setArchivePhase(archiver archive.Archiver) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.phase = PHASE_ARCHIVE
+	tc.paused = false
+	tc.archiver = archiver
+}
+
+func (tc *taskController) setUploadPhase(uploadId int64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.phase = PHASE_UPLOAD
+	tc.paused = false
+	tc.uploadId = uploadId
+}
+
+func (tc *taskController) setPackUploadPhase() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.phase = PHASE_PACKS
+	tc.paused = false
+}
+
+func (tc *taskController) IsPaused() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.paused
+}
+
+func (tc *taskController) Pause(ctx context.Context) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.paused {
+		return fmt.Errorf("task %d is already paused", tc.taskId)
+	}
+	switch tc.phase {
+	case PHASE_ARCHIVE:
+		err := tc.archiver.Pause(ctx)
+		if err != nil {
+			return err
+		}
+		tc.paused = true
+		L.Info("Pausing archive after the current file")
+		return tc.runner.TaskRepo.UpdateTaskStatus(ctx, tc.taskId, model.TASK_STATUS_ARCHIVE_PAUSED)
+	case PHASE_UPLOAD, PHASE_PACKS:
+		tc.uploadGate.Pause()
+		tc.paused = true
+		L.Info("Pausing upload after the current blocks")
+		err := tc.runner.TaskRepo.UpdateTaskStatus(ctx, tc.taskId, model.TASK_STATUS_UPLOAD_PAUSED)
+		if err != nil || tc.phase == PHASE_PACKS {
+			return err
+		}
+		return tc.runner.UploadRepo.UpdateStatus(ctx, tc.uploadId, model.UPLOAD_STATUS_PAUSED)
+	default:
+		return fmt.Errorf("task %d can not be paused right now, try again in a moment", tc.taskId)
+	}
+}
+
+func (tc *taskController) Resume(ctx context.Context) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if !tc.paused {
+		return fmt.Errorf("task %d is not paused", tc.taskId)
+	}
+	switch tc.phase {
+	case PHASE_ARCHIVE:
+		err := tc.archiver.Resume(ctx)
+		if err != nil {
+			return err
+		}
+		tc.paused = false
+		L.Info("Resuming archive")
+		return tc.runner.TaskRepo.UpdateTaskStatus(ctx, tc.taskId, model.TASK_STATUS_ARCHIVE_RUNNING)
+	case PHASE_UPLOAD, PHASE_PACKS:
+		tc.uploadGate.Resume()
+		tc.paused = false
+		L.Info("Resuming upload")
+		err := tc.runner.TaskRepo.UpdateTaskStatus(ctx, tc.taskId, model.TASK_STATUS_UPLOAD_RUNNING)
+		if err != nil || tc.phase == PHASE_PACKS {
+			return err
+		}
+		return tc.runner.UploadRepo.UpdateStatus(ctx, tc.uploadId, model.UPLOAD_STATUS_RUNNING)
+	default:
+		return fmt.Errorf("task %d is not paused", tc.taskId)
+	}
+}
+
+// stops the task, a paused task is aborted as well so it is not left
+// waiting to be resumed
+func (tc *taskController) Abort(ctx context.Context) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.aborted {
+		return fmt.Errorf("task %d is already being aborted", tc.taskId)
+	}
+	tc.aborted = true
+	tc.paused = false
+	L.Info("Aborting task")
+	tc.cancel()
+	return nil
+}
+
+func (tc *taskController) IsAborted() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.aborted
+}
+
+func (tc *taskController) Progress(ctx context.Context) TaskProgress {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	p := TaskProgress{Phase: tc.phase, Paused: tc.paused}
+	switch tc.phase {
+	case PHASE_ARCHIVE:
+		progress, err := tc.archiver.GetProgress(ctx)
+		if err == nil {
+			p.Done, p.Total = int64(progress.Done), int64(progress.Total)
+		}
+	case PHASE_PACKS, PHASE_UPLOAD:
+		p.Done, p.Total = tc.uploadProgress.Get()
+	}
+	return p
+}
+
+func (tc *taskController) Status(ctx context.Context) control.Response {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return control.Response{Paused: tc.paused, Phase: tc.phase}
+}
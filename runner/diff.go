@@ -0,0 +1,216 @@
+package runner
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/checksum"
+	"glesha/database"
+	"glesha/database/model"
+	L "glesha/logger"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ChangeKind string
+
+const (
+	CHANGE_ADDED    ChangeKind = "added"
+	CHANGE_REMOVED  ChangeKind = "removed"
+	CHANGE_MODIFIED ChangeKind = "modified"
+)
+
+// CatalogChange is a file that differs between two catalogs, Old is nil
+// for added files and New is nil for removed files
+type CatalogChange struct {
+	Kind ChangeKind            `json:"kind"`
+	Path string                `json:"path"`
+	Old  *model.FileCatalogRow `json:"old,omitempty"`
+	New  *model.FileCatalogRow `json:"new,omitempty"`
+}
+
+// CatalogDiff lists files added, removed and modified between two
+// catalogs ordered by path. directories are not compared
+type CatalogDiff struct {
+	Added    []CatalogChange `json:"added"`
+	Removed  []CatalogChange `json:"removed"`
+	Modified []CatalogChange `json:"modified"`
+	// total size of added and removed files
+	AddedBytes   int64 `json:"added_bytes"`
+	RemovedBytes int64 `json:"removed_bytes"`
+	// total size of modified files, and how much it grew
+	ModifiedBytes      int64 `json:"modified_bytes"`
+	ModifiedDeltaBytes int64 `json:"modified_delta_bytes"`
+}
+
+func (d *CatalogDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// compares the catalogs of two archived tasks, changes are from
+// "oldTaskId" to "newTaskId"
+func (r *Runner) DiffTasks(ctx context.Context, oldTaskId int64, newTaskId int64) (*CatalogDiff, error) {
+	oldRows, err := r.taskCatalog(ctx, oldTaskId)
+	if err != nil {
+		return nil, err
+	}
+	newRows, err := r.taskCatalog(ctx, newTaskId)
+	if err != nil {
+		return nil, err
+	}
+	return DiffCatalogs(oldRows, newRows, nil)
+}
+
+// compares the catalog of "taskId" with its input paths as they are now.
+// files that only have a new modification time are hashed if their
+// archived hash is known, so touched files are not reported
+func (r *Runner) DiffLive(ctx context.Context, taskId int64) (*CatalogDiff, error) {
+	oldRows, err := r.taskCatalog(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	newRows, err := archive.ScanCatalog(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return DiffCatalogs(oldRows, newRows, func(row *model.FileCatalogRow) (string, error) {
+		return hashFile(ctx, row.SourcePath())
+	})
+}
+
+func (r *Runner) taskCatalog(ctx context.Context, taskId int64) ([]model.FileCatalogRow, error) {
+	_, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	if errors.Is(err, database.ErrDoesNotExist) {
+		return nil, fmt.Errorf("task %d does not exist", taskId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.FileCatalogRepo.GetByTaskId(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("task %d has no file catalog, it has not been archived yet", taskId)
+	}
+	return rows, nil
+}
+
+// compares catalogs "oldRows" and "newRows" by full path, size,
+// modification time and hash when both have one. "hashOf" returns the hex
+// sha256 of a new regular file, it may be nil
+func DiffCatalogs(
+	oldRows []model.FileCatalogRow,
+	newRows []model.FileCatalogRow,
+	hashOf func(row *model.FileCatalogRow) (string, error),
+) (*CatalogDiff, error) {
+	oldByPath := make(map[string]*model.FileCatalogRow, len(oldRows))
+	for i := range oldRows {
+		if oldRows[i].FileType != "dir" {
+			oldByPath[oldRows[i].FullPath] = &oldRows[i]
+		}
+	}
+	d := &CatalogDiff{}
+	seen := make(map[string]bool, len(newRows))
+	for i := range newRows {
+		n := &newRows[i]
+		if n.FileType == "dir" {
+			continue
+		}
+		seen[n.FullPath] = true
+		o, ok := oldByPath[n.FullPath]
+		if !ok {
+			d.Added = append(d.Added, CatalogChange{Kind: CHANGE_ADDED, Path: n.FullPath, New: n})
+			d.AddedBytes += n.SizeBytes
+			continue
+		}
+		changed, err := entryChanged(o, n, hashOf)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			d.Modified = append(d.Modified, CatalogChange{Kind: CHANGE_MODIFIED, Path: n.FullPath, Old: o, New: n})
+			d.ModifiedBytes += n.SizeBytes
+			d.ModifiedDeltaBytes += n.SizeBytes - o.SizeBytes
+		}
+	}
+	for i := range oldRows {
+		o := &oldRows[i]
+		if o.FileType == "dir" || seen[o.FullPath] {
+			continue
+		}
+		d.Removed = append(d.Removed, CatalogChange{Kind: CHANGE_REMOVED, Path: o.FullPath, Old: o})
+		d.RemovedBytes += o.SizeBytes
+	}
+	for _, changes := range [][]CatalogChange{d.Added, d.Removed, d.Modified} {
+		sortChanges(changes)
+	}
+	return d, nil
+}
+
+func entryChanged(
+	o *model.FileCatalogRow,
+	n *model.FileCatalogRow,
+	hashOf func(row *model.FileCatalogRow) (string, error),
+) (bool, error) {
+	if fs.FileMode(o.Mode).Type() != fs.FileMode(n.Mode).Type() || o.SizeBytes != n.SizeBytes {
+		return true, nil
+	}
+	if len(o.Sha256) > 0 && len(n.Sha256) > 0 {
+		return o.Sha256 != n.Sha256, nil
+	}
+	if sameModTime(o.ModifiedAt, n.ModifiedAt) {
+		return false, nil
+	}
+	if hashOf == nil || len(o.Sha256) == 0 || !fs.FileMode(n.Mode).IsRegular() {
+		return true, nil
+	}
+	hash, err := hashOf(n)
+	if errors.Is(err, context.Canceled) {
+		return false, err
+	}
+	if err != nil {
+		L.Warn(fmt.Sprintf("diff: could not hash %s, comparing by modification time: %v", n.FullPath, err))
+		return true, nil
+	}
+	return hash != o.Sha256, nil
+}
+
+// catalogs store local wall clock times to the second, and read them back
+// without a location, so times are compared by their wall clock
+func sameModTime(a time.Time, b time.Time) bool {
+	return a.Format(time.DateTime) == b.Format(time.DateTime)
+}
+
+func sortChanges(changes []CatalogChange) {
+	slices.SortFunc(changes, func(a, b CatalogChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
+
+func hashFile(ctx context.Context, path string) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := checksum.NewSha256()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
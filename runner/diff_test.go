@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/config"
+	"glesha/database/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestDiffCatalogs(t *testing.T) {
+	modifiedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	file := func(path string, size int64, modifiedAt time.Time, hash string) model.FileCatalogRow {
+		return model.FileCatalogRow{FullPath: path, FileType: "file", SizeBytes: size, ModifiedAt: modifiedAt, Sha256: hash}
+	}
+	oldRows := []model.FileCatalogRow{
+		{FullPath: "docs", FileType: "dir", ModifiedAt: modifiedAt},
+		file("docs/same.txt", 10, modifiedAt, ""),
+		file("docs/grown.txt", 10, modifiedAt, ""),
+		file("docs/touched.txt", 10, modifiedAt, "aaaa"),
+		file("docs/rewritten.txt", 10, modifiedAt, "aaaa"),
+		file("docs/removed.txt", 7, modifiedAt, ""),
+	}
+	newRows := []model.FileCatalogRow{
+		{FullPath: "docs", FileType: "dir", ModifiedAt: modifiedAt.Add(time.Hour)},
+		file("docs/same.txt", 10, modifiedAt, ""),
+		file("docs/grown.txt", 25, modifiedAt.Add(time.Hour), ""),
+		file("docs/touched.txt", 10, modifiedAt.Add(time.Hour), "aaaa"),
+		file("docs/rewritten.txt", 10, modifiedAt, "bbbb"),
+		file("docs/added.txt", 3, modifiedAt, ""),
+	}
+
+	d, err := DiffCatalogs(oldRows, newRows, nil)
+	assert.NoError(t, err)
+	assert.Len(t, d.Added, 1)
+	assert.Equal(t, "docs/added.txt", d.Added[0].Path)
+	assert.Equal(t, int64(3), d.AddedBytes)
+	assert.Len(t, d.Removed, 1)
+	assert.Equal(t, "docs/removed.txt", d.Removed[0].Path)
+	assert.Equal(t, int64(7), d.RemovedBytes)
+	var modified []string
+	for _, c := range d.Modified {
+		modified = append(modified, c.Path)
+	}
+	// touched.txt has the same hash, rewritten.txt the same size and time
+	assert.Equal(t, []string{"docs/grown.txt", "docs/rewritten.txt"}, modified)
+	assert.Equal(t, int64(35), d.ModifiedBytes)
+	assert.Equal(t, int64(15), d.ModifiedDeltaBytes)
+
+	d, err = DiffCatalogs(oldRows, oldRows, nil)
+	assert.NoError(t, err)
+	assert.True(t, d.IsEmpty())
+}
+
+func TestDiffLive(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	inputPath := filepath.Join(t.TempDir(), "docs")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "sub"), 0755))
+	write := func(name string, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(inputPath, name), []byte(content), 0644))
+	}
+	write("same.txt", "same")
+	write("touched.txt", "touched")
+	write("edited.txt", "before")
+	write("sub/removed.txt", "removed")
+
+	task := createTestTask(t, r, config.AF_TARGZ, []string{inputPath}, t.TempDir(), "/config")
+	taskId := task.Id
+
+	_, err := r.DiffLive(ctx, taskId)
+	assert.ErrorContains(t, err, "not been archived")
+
+	// the catalog as an archiver would have written it
+	rows, err := archive.ScanCatalog(ctx, task)
+	assert.NoError(t, err)
+	for i := range rows {
+		if rows[i].FileType == "file" {
+			hash, err := hashFile(ctx, rows[i].SourcePath())
+			assert.NoError(t, err)
+			rows[i].Sha256 = hash
+		}
+	}
+	assert.NoError(t, r.FileCatalogRepo.AddMany(ctx, rows))
+
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(inputPath, "touched.txt"), later, later))
+	write("edited.txt", "after!")
+	assert.NoError(t, os.Chtimes(filepath.Join(inputPath, "edited.txt"), later, later))
+	write("sub/added.txt", "added")
+	assert.NoError(t, os.Remove(filepath.Join(inputPath, "sub/removed.txt")))
+
+	d, err := r.DiffLive(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Len(t, d.Added, 1)
+	assert.Equal(t, filepath.Join("docs", "sub", "added.txt"), d.Added[0].Path)
+	assert.Len(t, d.Removed, 1)
+	assert.Equal(t, filepath.Join("docs", "sub", "removed.txt"), d.Removed[0].Path)
+	assert.Len(t, d.Modified, 1)
+	assert.Equal(t, filepath.Join("docs", "edited.txt"), d.Modified[0].Path)
+}
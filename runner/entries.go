@@ -0,0 +1,395 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EntryReader reads the content of catalog entries of archived tasks,
+// from the local archive while it exists, otherwise from the storage
+// backend it was uploaded to. it is safe for concurrent use
+type EntryReader struct {
+	r       *Runner
+	mu      sync.Mutex
+	sources map[int64]*entrySource
+}
+
+// where the archive of a task is read from, loaded once per task
+type entrySource struct {
+	task *model.Task
+	// local archive file, empty if it was removed
+	archivePath string
+	// key of the uploaded archive, used when archivePath is empty
+	resourceKey string
+	archiveSize int64
+	// created when something has to be read from the backend
+	backendMu      sync.Mutex
+	storageBackend backend.StorageBackend
+	// gzip members of tar.gz archives
+	members []model.ArchiveMember
+	// files of repo archives by entry name
+	manifest *archive.Manifest
+	files    map[string]*archive.ManifestFile
+}
+
+func (r *Runner) NewEntryReader() *EntryReader {
+	return &EntryReader{r: r, sources: make(map[int64]*entrySource)}
+}
+
+// returns the content of regular file "row" starting "offset" bytes in
+func (er *EntryReader) Open(ctx context.Context, row *model.FileCatalogRow, offset int64) (io.ReadCloser, error) {
+	src, err := er.source(ctx, row.TaskId)
+	if err != nil {
+		return nil, err
+	}
+	if src.manifest != nil {
+		return src.openRepoEntry(ctx, er.r, row.FullPath, offset)
+	}
+	return er.openTarGzEntry(ctx, src, row, offset)
+}
+
+// returns the target of symlink "row"
+func (er *EntryReader) Readlink(ctx context.Context, row *model.FileCatalogRow) (string, error) {
+	src, err := er.source(ctx, row.TaskId)
+	if err != nil {
+		return "", err
+	}
+	if src.manifest != nil {
+		f, ok := src.files[row.FullPath]
+		if !ok {
+			return "", fmt.Errorf("%s is not in the manifest of task %d", row.FullPath, row.TaskId)
+		}
+		return f.Link, nil
+	}
+	hdr, _, closer, err := src.readTarEntry(ctx, row)
+	if err != nil {
+		return "", err
+	}
+	closer.Close()
+	return hdr.Linkname, nil
+}
+
+func (er *EntryReader) source(ctx context.Context, taskId int64) (*entrySource, error) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	if src, ok := er.sources[taskId]; ok {
+		return src, nil
+	}
+	src, err := er.loadSource(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	er.sources[taskId] = src
+	return src, nil
+}
+
+func (er *EntryReader) loadSource(ctx context.Context, taskId int64) (*entrySource, error) {
+	t, err := er.r.TaskRepo.GetTaskById(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	src := &entrySource{task: t}
+	archivePath := archive.ArchiveFilePath(t)
+	info, err := os.Stat(archivePath)
+	if err == nil {
+		src.archivePath = archivePath
+		src.archiveSize = info.Size()
+	} else {
+		upload, err := er.r.UploadRepo.GetUploadByTaskId(ctx, taskId)
+		if errors.Is(err, database.ErrDoesNotExist) {
+			return nil, fmt.Errorf("archive of task %d was removed from %s and not uploaded", taskId, t.OutputPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if upload.Status != model.UPLOAD_STATUS_COMPLETED {
+			return nil, fmt.Errorf("archive of task %d was removed from %s and its upload is %s", taskId, t.OutputPath, upload.Status)
+		}
+		storageBackend, err := src.backend()
+		if err != nil {
+			return nil, err
+		}
+		src.resourceKey, err = storageBackend.GetUploadResourceKey(t.Key(), backend.StorageMetadata{
+			Json:          upload.StorageBackendMetadataJson,
+			SchemaVersion: upload.StorageBackendMetadataSchemaVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+		src.archiveSize = upload.FileSize
+	}
+
+	if t.ArchiveFormat != config.AF_REPO {
+		src.members, err = er.r.FileCatalogRepo.GetArchiveMembers(ctx, taskId)
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+	rc, err := src.openRange(ctx, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	src.manifest, err = archive.DecodeManifest(rc)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest of task %d: %w", taskId, err)
+	}
+	src.files = make(map[string]*archive.ManifestFile, len(src.manifest.Files))
+	for i := range src.manifest.Files {
+		src.files[src.manifest.Files[i].Name] = &src.manifest.Files[i]
+	}
+	return src, nil
+}
+
+// returns bytes [start, end) of the archive, to its end if "end" is -1
+func (src *entrySource) openRange(ctx context.Context, start int64, end int64) (io.ReadCloser, error) {
+	if len(src.archivePath) > 0 {
+		return openFileRange(src.archivePath, start, end)
+	}
+	storageBackend, err := src.backend()
+	if err != nil {
+		return nil, err
+	}
+	return storageBackend.GetResourceRange(ctx, src.resourceKey, start, end)
+}
+
+func (src *entrySource) backend() (backend.StorageBackend, error) {
+	src.backendMu.Lock()
+	defer src.backendMu.Unlock()
+	if src.storageBackend == nil {
+		storageBackend, err := newStorageBackend(src.task)
+		if err != nil {
+			return nil, err
+		}
+		src.storageBackend = storageBackend
+	}
+	return src.storageBackend, nil
+}
+
+func openFileRange(path string, start int64, end int64) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Seek(start, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if end < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, end-start), file}, nil
+}
+
+func (er *EntryReader) openTarGzEntry(
+	ctx context.Context,
+	src *entrySource,
+	row *model.FileCatalogRow,
+	offset int64,
+) (io.ReadCloser, error) {
+	hdr, content, closer, err := src.readTarEntry(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		// the content is stored with the first entry of the file
+		closer.Close()
+		target, err := er.r.FileCatalogRepo.GetByFullPath(ctx, row.TaskId, strings.TrimSuffix(hdr.Linkname, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("could not find hardlink target %s of %s: %w", hdr.Linkname, row.FullPath, err)
+		}
+		hdr, content, closer, err = src.readTarEntry(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeGNUSparse {
+		closer.Close()
+		return nil, fmt.Errorf("%s is not a regular file", row.FullPath)
+	}
+	_, err = io.CopyN(io.Discard, content, offset)
+	if err != nil && err != io.EOF {
+		closer.Close()
+		return nil, fmt.Errorf("could not seek in %s: %w", row.FullPath, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{content, closer}, nil
+}
+
+// returns the header and content of "row", entries of catalogs written
+// before archives recorded offsets are searched from the start
+func (src *entrySource) readTarEntry(
+	ctx context.Context,
+	row *model.FileCatalogRow,
+) (*tar.Header, io.Reader, io.Closer, error) {
+	if row.ArchiveOffset >= 0 {
+		start, end, skip, err := archive.EntryRange(src.members, row, src.archiveSize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rc, err := src.openRange(ctx, start, end)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		hdr, content, err := archive.ReadEntry(rc, skip)
+		if err != nil {
+			rc.Close()
+			return nil, nil, nil, fmt.Errorf("could not read %s: %w", row.FullPath, err)
+		}
+		return hdr, content, rc, nil
+	}
+	rc, err := src.openRange(ctx, 0, -1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, nil, nil, fmt.Errorf("could not read archive of task %d: %w", row.TaskId, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			rc.Close()
+			return nil, nil, nil, fmt.Errorf("%s is not in the archive of task %d", row.FullPath, row.TaskId)
+		}
+		if err != nil {
+			rc.Close()
+			return nil, nil, nil, fmt.Errorf("could not read archive of task %d: %w", row.TaskId, err)
+		}
+		if strings.TrimSuffix(hdr.Name, "/") == row.FullPath {
+			return hdr, tr, rc, nil
+		}
+	}
+}
+
+func (src *entrySource) openRepoEntry(ctx context.Context, r *Runner, name string, offset int64) (io.ReadCloser, error) {
+	f, ok := src.files[name]
+	if ok && len(f.Hardlink) > 0 {
+		f, ok = src.files[f.Hardlink]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the manifest of task %d", name, src.task.Id)
+	}
+	if !fs.FileMode(f.Mode).IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", name)
+	}
+	cr := &chunkReader{ctx: ctx, r: r, src: src}
+	for _, chunkHash := range f.Chunks {
+		chunk, ok := src.manifest.Chunks[chunkHash]
+		if !ok {
+			return nil, fmt.Errorf("chunk %s of %s is not in the manifest", chunkHash, name)
+		}
+		if offset >= chunk.Size {
+			offset -= chunk.Size
+			continue
+		}
+		cr.chunks = append(cr.chunks, chunkRef{hash: chunkHash, chunk: chunk})
+	}
+	cr.skip = offset
+	return cr, nil
+}
+
+type chunkRef struct {
+	hash  string
+	chunk archive.ManifestChunk
+}
+
+// chunkReader reads chunks of a file one at a time, each from its local
+// pack while it waits for upload, otherwise from the backend
+type chunkReader struct {
+	ctx    context.Context
+	r      *Runner
+	src    *entrySource
+	chunks []chunkRef
+	// bytes of the first chunk before the requested offset
+	skip    int64
+	current io.Reader
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.current != nil {
+			n, err := cr.current.Read(p)
+			if err != io.EOF {
+				return n, err
+			}
+			cr.current = nil
+			if n > 0 {
+				return n, nil
+			}
+		}
+		if len(cr.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := cr.readChunk(cr.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		cr.chunks = cr.chunks[1:]
+		cr.current = bytes.NewReader(data[min(cr.skip, int64(len(data))):])
+		cr.skip = 0
+	}
+}
+
+// reads chunk "ref" and checks its hash, so a corrupted pack is not
+// returned as file content
+func (cr *chunkReader) readChunk(ref chunkRef) ([]byte, error) {
+	chunk := ref.chunk
+	var rc io.ReadCloser
+	pack, err := cr.r.ChunkRepo.GetPack(cr.ctx, cr.src.manifest.ContainerId, chunk.Pack)
+	if err == nil && pack.Status == model.PACK_STATUS_PENDING {
+		rc, err = openFileRange(pack.FilePath, chunk.Offset, chunk.Offset+chunk.Size)
+	} else {
+		var storageBackend backend.StorageBackend
+		storageBackend, err = cr.src.backend()
+		if err != nil {
+			return nil, err
+		}
+		rc, err = storageBackend.GetResourceRange(cr.ctx, archive.PackKey(chunk.Pack), chunk.Offset, chunk.Offset+chunk.Size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read pack %s: %w", chunk.Pack, err)
+	}
+	defer rc.Close()
+	data := make([]byte, chunk.Size)
+	_, err = io.ReadFull(rc, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not read pack %s: %w", chunk.Pack, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != ref.hash {
+		return nil, fmt.Errorf("chunk %s in pack %s is corrupted", ref.hash, chunk.Pack)
+	}
+	return data, nil
+}
+
+func (cr *chunkReader) Close() error {
+	cr.chunks = nil
+	cr.current = nil
+	return nil
+}
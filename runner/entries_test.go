@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/config"
+	"io"
+	"io/fs"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestEntryReader(t *testing.T) {
+	ctx := context.Background()
+	inputPath := filepath.Join(t.TempDir(), "docs")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "sub"), 0755))
+	big := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(big)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "sub", "big.bin"), big, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.txt"), []byte("hello"), 0644))
+	assert.NoError(t, os.Link(filepath.Join(inputPath, "a.txt"), filepath.Join(inputPath, "b.txt")))
+	assert.NoError(t, os.Symlink("a.txt", filepath.Join(inputPath, "link")))
+	expectedContents := map[string][]byte{
+		"docs/sub/big.bin": big,
+		"docs/a.txt":       []byte("hello"),
+		"docs/b.txt":       []byte("hello"),
+	}
+
+	for _, format := range []config.ArchiveFormat{config.AF_TARGZ, config.AF_REPO} {
+		t.Run(string(format), func(t *testing.T) {
+			contents := maps.Clone(expectedContents)
+			r := setupTestRunner(t)
+			task := createTestTask(t, r, format, []string{inputPath}, t.TempDir(), "/config")
+			taskId := task.Id
+			var archiver archive.Archiver
+			var err error
+			if format == config.AF_REPO {
+				archiver, err = archive.NewRepoArchiver(task, r.ChunkRepo, "s3://test-bucket")
+			} else {
+				archiver, err = archive.NewTarGzArchiver(task)
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, archiver.Plan(ctx))
+			assert.NoError(t, archiver.Start(ctx, r.FileCatalogRepo, r.TaskRepo))
+
+			rows, err := r.FileCatalogRepo.GetByTaskId(ctx, taskId)
+			assert.NoError(t, err)
+			er := r.NewEntryReader()
+			for i := range rows {
+				row := &rows[i]
+				if fs.FileMode(row.Mode)&fs.ModeSymlink != 0 {
+					target, err := er.Readlink(ctx, row)
+					assert.NoError(t, err)
+					assert.Equal(t, "a.txt", target)
+					continue
+				}
+				expected, ok := contents[filepath.ToSlash(row.FullPath)]
+				if !ok {
+					continue
+				}
+				for _, offset := range []int64{0, 3, int64(len(expected))} {
+					rc, err := er.Open(ctx, row, offset)
+					assert.NoError(t, err, row.FullPath)
+					data, err := io.ReadAll(rc)
+					assert.NoError(t, err)
+					assert.NoError(t, rc.Close())
+					assert.Equal(t, expected[offset:], data, row.FullPath)
+				}
+				delete(contents, filepath.ToSlash(row.FullPath))
+			}
+			assert.Empty(t, contents)
+
+			// without the local archive it has to be uploaded
+			assert.NoError(t, os.Remove(archive.ArchiveFilePath(task)))
+			_, err = r.NewEntryReader().Open(ctx, &rows[0], 0)
+			assert.ErrorContains(t, err, "not uploaded")
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"glesha/config"
+	"glesha/database/model"
+	L "glesha/logger"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// output of a hook stored in the db is limited to its last bytes, errors
+// are usually printed last
+const HOOK_OUTPUT_LIMIT int = 64 * 1024
+
+// runs the hook commands of a task and records each run
+type taskHooks struct {
+	r      *Runner
+	taskId int64
+	hooks  config.Hooks
+	// passed to hooks, set as the task progresses
+	archivePath string
+	uploadId    int64
+}
+
+func newTaskHooks(r *Runner, taskId int64, hooks *config.Hooks) *taskHooks {
+	h := &taskHooks{r: r, taskId: taskId}
+	if hooks != nil {
+		h.hooks = *hooks
+	}
+	return h
+}
+
+func (h *taskHooks) command(hook model.Hook) string {
+	switch hook {
+	case model.HOOK_PRE_ARCHIVE:
+		return h.hooks.PreArchive
+	case model.HOOK_POST_ARCHIVE:
+		return h.hooks.PostArchive
+	case model.HOOK_POST_UPLOAD:
+		return h.hooks.PostUpload
+	case model.HOOK_ON_FAILURE:
+		return h.hooks.OnFailure
+	}
+	return ""
+}
+
+// runs "hook" if it is configured, "taskErr" is passed to on_failure hooks.
+// returns an error if the hook could not be run or exited with a non-zero code
+func (h *taskHooks) run(ctx context.Context, hook model.Hook, taskErr error) error {
+	command := h.command(hook)
+	if len(command) == 0 {
+		return nil
+	}
+	var status model.TaskStatus
+	t, err := h.r.TaskRepo.GetTaskById(ctx, h.taskId)
+	if err == nil {
+		status = t.Status
+	}
+	uploadId := ""
+	if h.uploadId > 0 {
+		uploadId = strconv.FormatInt(h.uploadId, 10)
+	}
+	env := []string{
+		"GLESHA_HOOK=" + string(hook),
+		fmt.Sprintf("GLESHA_TASK_ID=%d", h.taskId),
+		"GLESHA_TASK_STATUS=" + string(status),
+		"GLESHA_ARCHIVE_PATH=" + h.archivePath,
+		"GLESHA_UPLOAD_ID=" + uploadId,
+	}
+	if taskErr != nil {
+		env = append(env, "GLESHA_ERROR="+taskErr.Error())
+	}
+
+	L.Info(fmt.Sprintf("Running %s hook", hook))
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	stdout := &tailBuffer{limit: HOOK_OUTPUT_LIMIT}
+	stderr := &tailBuffer{limit: HOOK_OUTPUT_LIMIT}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	hookRun := &model.HookRun{
+		TaskId:    h.taskId,
+		Hook:      hook,
+		Command:   command,
+		ExitCode:  -1,
+		StartedAt: time.Now(),
+	}
+	err = cmd.Run()
+	hookRun.FinishedAt = time.Now()
+	if cmd.ProcessState != nil {
+		hookRun.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	hookRun.Stdout = stdout.String()
+	hookRun.Stderr = stderr.String()
+	// the run is recorded even if the task was cancelled meanwhile
+	_, addErr := h.r.HookRunRepo.AddHookRun(context.WithoutCancel(ctx), hookRun)
+	if addErr != nil {
+		L.Warn(addErr)
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+	L.Printf("Hook %s: OK\n", hook)
+	return nil
+}
+
+// keeps the last "limit" bytes written to it
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.limit {
+		b.buf = b.buf[len(b.buf)-b.limit:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	if b.truncated {
+		return "[truncated]\n" + string(b.buf)
+	}
+	return string(b.buf)
+}
@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"context"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/database/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestRunTask_FailingPreArchiveHook(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	tempDir := t.TempDir()
+	failureLog := filepath.Join(tempDir, "failure.log")
+	configPath := filepath.Join(tempDir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{
+		"archive_format": "targz",
+		"provider": "aws",
+		"hooks": {
+			"pre_archive": "echo dumping; echo no database >&2; exit 3",
+			"post_archive": "touch archived",
+			"on_failure": "echo \"$GLESHA_TASK_ID $GLESHA_TASK_STATUS $GLESHA_ERROR\" > `+failureLog+`"
+		}
+	}`), 0644))
+	task := createTestTask(t, r, config.AF_TARGZ, []string{tempDir}, tempDir, configPath)
+	taskId := task.Id
+
+	err := r.runTask(ctx, task, newTaskController(r, taskId, func() {}), nil, backend.UploadOptions{Jobs: 1})
+	assert.ErrorContains(t, err, "pre_archive hook failed")
+
+	// nothing was archived, and the task can be run again
+	task, err = r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TASK_STATUS_QUEUED, task.Status)
+
+	runs, err := r.HookRunRepo.ListHookRuns(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, model.HOOK_PRE_ARCHIVE, runs[0].Hook)
+	assert.Equal(t, 3, runs[0].ExitCode)
+	assert.Equal(t, "dumping\n", runs[0].Stdout)
+	assert.Equal(t, "no database\n", runs[0].Stderr)
+	assert.Equal(t, model.HOOK_ON_FAILURE, runs[1].Hook)
+	assert.Equal(t, 0, runs[1].ExitCode)
+
+	failure, err := os.ReadFile(failureLog)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(failure), "1 QUEUED aborting task 1: pre_archive hook failed"))
+}
+
+func TestRunTask_PreArchiveHookRunsWhenRearchiving(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{
+		"archive_format": "targz",
+		"provider": "aws",
+		"hooks": {"pre_archive": "echo $GLESHA_TASK_STATUS; exit 1"}
+	}`), 0644))
+	taskId := createTestTask(t, r, config.AF_TARGZ, []string{tempDir}, tempDir, configPath).Id
+	// the archive of a completed task is missing, so it is archived again
+	assert.NoError(t, r.TaskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_ARCHIVE_COMPLETED))
+	task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+
+	err = r.runTask(ctx, task, newTaskController(r, taskId, func() {}), nil, backend.UploadOptions{Jobs: 1})
+	assert.ErrorContains(t, err, "pre_archive hook failed")
+
+	runs, err := r.HookRunRepo.ListHookRuns(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, model.HOOK_PRE_ARCHIVE, runs[0].Hook)
+	assert.Equal(t, "ARCHIVE_COMPLETED\n", runs[0].Stdout)
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 4}
+	_, _ = b.Write([]byte("ab"))
+	assert.Equal(t, "ab", b.String())
+	_, _ = b.Write([]byte("cdef"))
+	assert.Equal(t, "[truncated]\ncdef", b.String())
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/database/model"
+	L "glesha/logger"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// uploads packs written by repo archives that are not uploaded yet, they
+// are shared by all tasks using the same container, so this also uploads
+// packs left behind by other tasks. packs must be uploaded before any
+// manifest referencing them
+func (r *Runner) uploadPacks(
+	ctx context.Context,
+	t *model.Task,
+	tc *taskController,
+	storageBackend backend.StorageBackend,
+) error {
+	packs, err := r.ChunkRepo.ListPendingPacks(ctx, storageBackend.GetResourceContainerId())
+	if err != nil {
+		return err
+	}
+	if len(packs) == 0 {
+		L.Info("Skipping uploading packs because all chunks are already uploaded")
+		return nil
+	}
+	var totalBytes, sentBytes int64
+	for _, pack := range packs {
+		totalBytes += pack.SizeBytes
+	}
+
+	_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_RUNNING)
+	tc.setPackUploadPhase()
+	tc.uploadProgress.Start(0, totalBytes)
+	for i, pack := range packs {
+		if tc.uploadGate.IsPaused() {
+			L.Footer(L.NORMAL, fmt.Sprintf("Uploading packs: Paused (%d/%d)", i, len(packs)))
+		}
+		err = tc.uploadGate.Wait(ctx)
+		if err != nil {
+			// a paused upload keeps its UPLOAD_PAUSED status
+			if !tc.IsPaused() {
+				_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_ABORTED)
+			}
+			return err
+		}
+
+		_, err = os.Stat(pack.FilePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// its chunks are forgotten, so they are stored again by the
+			// next archive that needs them
+			err = r.ChunkRepo.DeletePack(ctx, pack.Id)
+			if err != nil {
+				return err
+			}
+			_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_ABORTED)
+			return fmt.Errorf("pack %s was removed before it was uploaded, run the task again to archive its chunks again", pack.FilePath)
+		}
+
+		p := float64(sentBytes) * 100.0 / float64(totalBytes)
+		L.Footer(L.NORMAL, fmt.Sprintf("Uploading packs: %.1f%% %s (%d/%d) [%s Sent]",
+			p,
+			L.ProgressBar(p, -1),
+			i,
+			len(packs),
+			L.HumanReadableBytes(uint64(sentBytes), 1)))
+		err = storageBackend.PutResource(ctx, archive.PackKey(pack.Hash), pack.FilePath)
+		if err != nil {
+			if !tc.IsPaused() {
+				_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_ABORTED)
+			}
+			return fmt.Errorf("could not upload pack %s: %w", pack.Hash, err)
+		}
+		err = r.ChunkRepo.MarkPackUploaded(ctx, pack.Id, time.Now())
+		if err != nil {
+			return err
+		}
+		err = os.Remove(pack.FilePath)
+		if err != nil {
+			L.Warn(fmt.Sprintf("Could not remove uploaded pack %s: %v", pack.FilePath, err))
+		}
+		sentBytes += pack.SizeBytes
+		tc.uploadProgress.Add(pack.SizeBytes)
+	}
+	L.Footer(L.NORMAL, "")
+	L.Printf("Upload Packs: OK (%d packs, %s)\n", len(packs), L.HumanReadableBytes(uint64(totalBytes), 2))
+	return nil
+}
+
+// deletes packs of the container of "storageBackend" that no manifest of
+// a remaining task references, from the storage backend or the disk, and
+// forgets their chunks. chunks of a live pack are kept even if no manifest
+// references them, so later archives can still deduplicate against them.
+// nothing is deleted while a repo task has no manifest yet, since its
+// chunks may be in any pack
+func (r *Runner) collectPacks(ctx context.Context, storageBackend backend.StorageBackend) error {
+	containerId := storageBackend.GetResourceContainerId()
+	tasks, err := r.TaskRepo.ListTasks(ctx)
+	if err != nil {
+		return err
+	}
+	er := r.NewEntryReader()
+	liveChunks := make(map[string]bool)
+	livePacks := make(map[string]bool)
+	for _, t := range tasks {
+		if t.ArchiveFormat != config.AF_REPO {
+			continue
+		}
+		switch t.Status {
+		case model.TASK_STATUS_ARCHIVE_COMPLETED,
+			model.TASK_STATUS_UPLOAD_RUNNING,
+			model.TASK_STATUS_UPLOAD_PAUSED,
+			model.TASK_STATUS_UPLOAD_ABORTED,
+			model.TASK_STATUS_UPLOAD_COMPLETED:
+		default:
+			return fmt.Errorf("task %d is %s and may use any pack", t.Id, t.Status)
+		}
+		src, err := er.source(ctx, t.Id)
+		if err != nil {
+			return fmt.Errorf("could not read manifest of task %d: %w", t.Id, err)
+		}
+		if src.manifest.ContainerId != containerId {
+			continue
+		}
+		for hash, chunk := range src.manifest.Chunks {
+			liveChunks[hash] = true
+			livePacks[chunk.Pack] = true
+		}
+	}
+	chunks, err := r.ChunkRepo.ListChunks(ctx, containerId)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if liveChunks[c.Hash] {
+			livePacks[c.PackHash] = true
+		}
+	}
+	packs, err := r.ChunkRepo.ListPacks(ctx, containerId)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	var removedBytes int64
+	for _, pack := range packs {
+		if livePacks[pack.Hash] {
+			continue
+		}
+		if pack.Status == model.PACK_STATUS_UPLOADED {
+			err = storageBackend.DeleteResourceByKey(ctx, archive.PackKey(pack.Hash))
+			if errors.Is(err, backend.ErrResourceLocked) {
+				L.Warn(fmt.Sprintf("Keeping unused pack %s: %v", pack.Hash, err))
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not delete pack %s: %w", pack.Hash, err)
+			}
+		}
+		err = os.Remove(pack.FilePath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("could not delete local pack %s: %w", pack.FilePath, err)
+		}
+		err = r.ChunkRepo.DeletePack(ctx, pack.Id)
+		if err != nil {
+			return err
+		}
+		removed++
+		removedBytes += pack.SizeBytes
+	}
+	if removed > 0 {
+		L.Printf("Removed %s no backup uses anymore (%s)\n",
+			L.HumanReadableCount(removed, "pack", "packs"),
+			L.HumanReadableBytes(uint64(removedBytes), 2))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/file_io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// records PutResource and DeleteResourceByKey calls, other methods are
+// not used by uploadPacks and collectPacks
+type putRecorder struct {
+	backend.StorageBackend
+	keys    []string
+	deleted []string
+}
+
+func (p *putRecorder) GetResourceContainerId() string {
+	return "s3://test-bucket"
+}
+
+func (p *putRecorder) PutResource(ctx context.Context, key string, resourceFilePath string) error {
+	p.keys = append(p.keys, key)
+	return nil
+}
+
+func (p *putRecorder) DeleteResourceByKey(ctx context.Context, key string) error {
+	p.deleted = append(p.deleted, key)
+	return nil
+}
+
+func TestUploadPacks(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	task := createTestTask(t, r, config.AF_REPO, []string{"/input"}, "/output", "/config")
+	taskId := task.Id
+
+	packDir := t.TempDir()
+	addPack := func(hash string, writeFile bool) {
+		packPath := filepath.Join(packDir, hash)
+		if writeFile {
+			assert.NoError(t, os.WriteFile(packPath, []byte(hash), 0644))
+		}
+		_, err := r.ChunkRepo.AddPack(ctx, &model.Pack{
+			ContainerId: "s3://test-bucket",
+			Hash:        hash,
+			FilePath:    packPath,
+			SizeBytes:   int64(len(hash)),
+			CreatedAt:   time.Now(),
+		}, []model.Chunk{{Hash: "chunk-" + hash, SizeBytes: int64(len(hash))}})
+		assert.NoError(t, err)
+	}
+
+	t.Run("Uploaded", func(t *testing.T) {
+		addPack("aa11", true)
+		addPack("bb22", true)
+		storageBackend := &putRecorder{}
+		err := r.uploadPacks(ctx, task, newTaskController(r, taskId, func() {}), storageBackend)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"packs/aa/aa11", "packs/bb/bb22"}, storageBackend.keys)
+		assert.NoFileExists(t, filepath.Join(packDir, "aa11"))
+		pending, err := r.ChunkRepo.ListPendingPacks(ctx, "s3://test-bucket")
+		assert.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("MissingPack", func(t *testing.T) {
+		addPack("cc33", false)
+		storageBackend := &putRecorder{}
+		err := r.uploadPacks(ctx, task, newTaskController(r, taskId, func() {}), storageBackend)
+		assert.Error(t, err)
+		assert.Empty(t, storageBackend.keys)
+		_, err = r.ChunkRepo.GetChunk(ctx, "s3://test-bucket", "chunk-cc33")
+		assert.Equal(t, database.ErrDoesNotExist, err)
+		task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+		assert.NoError(t, err)
+		assert.Equal(t, model.TASK_STATUS_ARCHIVE_ABORTED, task.Status)
+	})
+}
+
+func TestCollectPacks(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+	storageBackend := &putRecorder{}
+
+	// archives and uploads "files", packs are shared with earlier tasks
+	archiveTask := func(files map[string]string) (*model.Task, []string) {
+		inputPath := t.TempDir()
+		for name, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(inputPath, name), []byte(content), 0644))
+		}
+		task := createTestTask(t, r, config.AF_REPO, []string{inputPath}, t.TempDir(), "/config")
+		taskId := task.Id
+		archiver, err := archive.NewRepoArchiver(task, r.ChunkRepo, storageBackend.GetResourceContainerId())
+		assert.NoError(t, err)
+		assert.NoError(t, archiver.Plan(ctx))
+		assert.NoError(t, archiver.Start(ctx, r.FileCatalogRepo, r.TaskRepo))
+		assert.NoError(t, r.TaskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED))
+		packs, err := r.ChunkRepo.ListPendingPacks(ctx, storageBackend.GetResourceContainerId())
+		assert.NoError(t, err)
+		var keys []string
+		for _, pack := range packs {
+			assert.NoError(t, r.ChunkRepo.MarkPackUploaded(ctx, pack.Id, time.Now()))
+			keys = append(keys, archive.PackKey(pack.Hash))
+		}
+		return task, keys
+	}
+	task1, packs1 := archiveTask(map[string]string{"a.txt": "shared by task 1 and 2", "b.txt": "only in task 1"})
+	task2, packs2 := archiveTask(map[string]string{"a.txt": "shared by task 1 and 2"})
+	task3, packs3 := archiveTask(map[string]string{"c.txt": "only in task 3"})
+	assert.Len(t, packs1, 1)
+	assert.Empty(t, packs2)
+	assert.Len(t, packs3, 1)
+	remainingPacks := func() int {
+		packs, err := r.ChunkRepo.ListPacks(ctx, storageBackend.GetResourceContainerId())
+		assert.NoError(t, err)
+		return len(packs)
+	}
+
+	t.Run("UnusedPack", func(t *testing.T) {
+		assert.NoError(t, r.Prune(ctx, &PruneCandidate{Task: task3, storageBackend: storageBackend}))
+		assert.Equal(t, packs3, storageBackend.deleted)
+		assert.Equal(t, 1, remainingPacks())
+	})
+
+	t.Run("PackUsedByOtherTask", func(t *testing.T) {
+		assert.NoError(t, r.Prune(ctx, &PruneCandidate{Task: task1, storageBackend: storageBackend}))
+		assert.Equal(t, packs3, storageBackend.deleted)
+		assert.Equal(t, 1, remainingPacks())
+	})
+
+	t.Run("TaskWithoutManifest", func(t *testing.T) {
+		queuedId, err := r.TaskRepo.CreateTask(ctx, []string{"/input"}, t.TempDir(), "/config",
+			config.AF_REPO, config.PROVIDER_AWS, time.Now(), time.Now(),
+			&file_io.FilesInfo{ContentHash: "queued"})
+		assert.NoError(t, err)
+		assert.NoError(t, r.Prune(ctx, &PruneCandidate{Task: task2, storageBackend: storageBackend}))
+		assert.Equal(t, packs3, storageBackend.deleted)
+		assert.Equal(t, 1, remainingPacks())
+
+		assert.NoError(t, r.TaskRepo.DeleteTask(ctx, queuedId))
+		assert.NoError(t, r.collectPacks(ctx, storageBackend))
+		assert.Equal(t, append(packs3, packs1...), storageBackend.deleted)
+		assert.Equal(t, 0, remainingPacks())
+		chunks, err := r.ChunkRepo.ListChunks(ctx, storageBackend.GetResourceContainerId())
+		assert.NoError(t, err)
+		assert.Empty(t, chunks)
+	})
+}
@@ -0,0 +1,217 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/control"
+	"glesha/database"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/retention"
+	"os"
+	"sort"
+	"time"
+)
+
+// PruneCandidate is an uploaded backup that is not kept by the retention
+// policy of its input path
+type PruneCandidate struct {
+	Task *model.Task
+	// nil if the task has no upload
+	Upload *model.Upload
+	// nil if the task has no upload
+	Estimate *backend.DeletionEstimate
+	// nil if the uploaded resource is not locked
+	Lock           *backend.ResourceLock
+	storageBackend backend.StorageBackend
+}
+
+// returns the retention policy for every input path. schedules created
+// with --retain act as a keep last policy for paths without a policy
+func (r *Runner) GetRetentionPolicies(ctx context.Context) (map[string]*model.RetentionPolicy, error) {
+	policies, err := r.RetentionRepo.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]*model.RetentionPolicy)
+	for _, p := range policies {
+		res[p.InputPath] = p
+	}
+	schedules, err := r.ScheduleRepo.ListSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fromSchedules := make(map[string]*model.RetentionPolicy)
+	for _, sc := range schedules {
+		if _, ok := res[sc.InputPath]; ok || sc.Retain <= 0 {
+			continue
+		}
+		// multiple schedules for a path keep the most backups any of them asks for
+		p, ok := fromSchedules[sc.InputPath]
+		if !ok || p.KeepLast < sc.Retain {
+			fromSchedules[sc.InputPath] = &model.RetentionPolicy{InputPath: sc.InputPath, KeepLast: sc.Retain}
+		}
+	}
+	for path, p := range fromSchedules {
+		res[path] = p
+	}
+	return res, nil
+}
+
+// returns uploaded backups that are not kept by retention policies,
+// only for "inputPath" if it is not empty. backups of several input paths
+// are grouped, and looked up, by model.InputPathsKey. tasks that are not
+// uploaded completely are never pruned
+func (r *Runner) PlanPrune(ctx context.Context, inputPath string, now time.Time) ([]*PruneCandidate, error) {
+	policies, err := r.GetRetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := r.TaskRepo.ListTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	backupsByPath := make(map[string][]*model.Task)
+	for _, t := range tasks {
+		if t.Status != model.TASK_STATUS_UPLOAD_COMPLETED {
+			continue
+		}
+		key := t.InputPathsKey()
+		if len(inputPath) > 0 && key != inputPath {
+			continue
+		}
+		backupsByPath[key] = append(backupsByPath[key], t)
+	}
+	paths := make([]string, 0, len(backupsByPath))
+	for p := range backupsByPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var candidates []*PruneCandidate
+	for _, p := range paths {
+		_, remove := retention.Select(backupsByPath[p], policies[p])
+		for _, t := range remove {
+			c, err := r.newPruneCandidate(ctx, t, now)
+			if err != nil {
+				return nil, fmt.Errorf("could not plan pruning task %d: %w", t.Id, err)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+func (r *Runner) newPruneCandidate(ctx context.Context, t *model.Task, now time.Time) (*PruneCandidate, error) {
+	c := &PruneCandidate{Task: t}
+	upload, err := r.UploadRepo.GetUploadByTaskId(ctx, t.Id)
+	if errors.Is(err, database.ErrDoesNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Upload = upload
+	c.storageBackend, err = newStorageBackend(t)
+	if err != nil {
+		return nil, err
+	}
+	uploadedAt := upload.CompletedAt
+	if uploadedAt.IsZero() {
+		uploadedAt = upload.CreatedAt
+	}
+	metadata := backend.StorageMetadata{
+		Json:          upload.StorageBackendMetadataJson,
+		SchemaVersion: upload.StorageBackendMetadataSchemaVersion,
+	}
+	c.Estimate, err = c.storageBackend.EstimateDeletion(ctx, metadata, upload.FileSize, uploadedAt, now)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status == model.UPLOAD_STATUS_COMPLETED {
+		c.Lock, err = c.storageBackend.GetResourceLock(ctx, t.Key(), metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// removes the uploaded resource, the local archive and the database rows
+// of a backup returned by PlanPrune. locked resources are not removed.
+// packs of repo archives are removed once no remaining backup uses them
+func (r *Runner) Prune(ctx context.Context, c *PruneCandidate) error {
+	t := c.Task
+	if c.Upload != nil {
+		metadata := backend.StorageMetadata{
+			Json:          c.Upload.StorageBackendMetadataJson,
+			SchemaVersion: c.Upload.StorageBackendMetadataSchemaVersion,
+		}
+		var err error
+		if c.Upload.Status == model.UPLOAD_STATUS_COMPLETED {
+			err = c.storageBackend.DeleteResource(ctx, t.Key(), metadata)
+		} else {
+			err = c.storageBackend.AbortUploadResource(ctx, t.Key(), metadata)
+		}
+		if err != nil {
+			return fmt.Errorf("could not delete uploaded archive of task %d: %w", t.Id, err)
+		}
+		err = os.Remove(c.Upload.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not delete local archive of task %d: %w", t.Id, err)
+		}
+		if err == nil {
+			L.Debug(fmt.Sprintf("Deleted local archive %s", c.Upload.FilePath))
+		}
+	}
+	err := r.TaskRepo.DeleteTask(ctx, t.Id)
+	if err != nil || t.ArchiveFormat != config.AF_REPO {
+		return err
+	}
+	storageBackend := c.storageBackend
+	if storageBackend == nil {
+		storageBackend, err = newStorageBackend(t)
+	}
+	if err == nil {
+		err = r.collectPacks(ctx, storageBackend)
+	}
+	// the task is gone already, its packs are removed by a later prune
+	if err != nil {
+		L.Warn(fmt.Sprintf("Keeping packs of task %d, they are removed by a later prune: %v", t.Id, err))
+	}
+	return nil
+}
+
+// deletes task "taskId" like Prune deletes a backup, along with its local
+// archive if it was not uploaded. running tasks can not be deleted
+func (r *Runner) DeleteTask(ctx context.Context, taskId int64, now time.Time) error {
+	if control.IsRunning(ctx, taskId) {
+		return fmt.Errorf("task %d is running, abort it before deleting it", taskId)
+	}
+	t, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	c, err := r.newPruneCandidate(ctx, t, now)
+	if err != nil {
+		return err
+	}
+	if c.Lock.IsLocked(now) {
+		return fmt.Errorf("uploaded archive of task %d can not be deleted because of %s", taskId, c.Lock)
+	}
+	if c.Upload == nil {
+		archivePath := archive.ArchiveFilePath(t)
+		err = os.Remove(archivePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not delete local archive of task %d: %w", taskId, err)
+		}
+		if err == nil {
+			L.Debug(fmt.Sprintf("Deleted local archive %s", archivePath))
+		}
+	}
+	return r.Prune(ctx, c)
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"glesha/config"
+	"glesha/database/model"
+	"glesha/file_io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	now := time.Now()
+	var ids []int64
+	for i := range 3 {
+		createdAt := now.Add(time.Duration(i-3) * 24 * time.Hour)
+		taskId, err := r.TaskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+			config.AF_TARGZ, config.PROVIDER_AWS, createdAt, createdAt,
+			&file_io.FilesInfo{ContentHash: "test-hash"})
+		assert.NoError(t, err)
+		assert.NoError(t, r.TaskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED))
+		ids = append(ids, taskId)
+	}
+	// tasks that are not uploaded are never pruned
+	_, err := r.TaskRepo.CreateTask(ctx, []string{"/input"}, "/output", "/config",
+		config.AF_TARGZ, config.PROVIDER_AWS, now.Add(-10*24*time.Hour), now,
+		&file_io.FilesInfo{ContentHash: "other-hash"})
+	assert.NoError(t, err)
+
+	t.Run("NoPolicyKeepsAll", func(t *testing.T) {
+		candidates, err := r.PlanPrune(ctx, "", now)
+		assert.NoError(t, err)
+		assert.Empty(t, candidates)
+	})
+
+	t.Run("ScheduleRetain", func(t *testing.T) {
+		_, err := r.ScheduleRepo.CreateSchedule(ctx, "/input", "/output", "/config",
+			config.PROVIDER_AWS, config.AF_TARGZ, "@daily", 2, 0, now)
+		assert.NoError(t, err)
+		candidates, err := r.PlanPrune(ctx, "", now)
+		assert.NoError(t, err)
+		assert.Len(t, candidates, 1)
+		assert.Equal(t, ids[0], candidates[0].Task.Id)
+	})
+
+	t.Run("PolicyOverridesSchedule", func(t *testing.T) {
+		assert.NoError(t, r.RetentionRepo.SetPolicy(ctx, &model.RetentionPolicy{InputPath: "/input", KeepLast: 1}))
+		candidates, err := r.PlanPrune(ctx, "/other", now)
+		assert.NoError(t, err)
+		assert.Empty(t, candidates)
+
+		candidates, err = r.PlanPrune(ctx, "/input", now)
+		assert.NoError(t, err)
+		assert.Len(t, candidates, 2)
+		for _, c := range candidates {
+			assert.Nil(t, c.Upload)
+			assert.NoError(t, r.Prune(ctx, c))
+		}
+		tasks, err := r.TaskRepo.ListTasks(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, tasks, 2)
+	})
+
+	t.Run("MultipleInputPaths", func(t *testing.T) {
+		inputPaths := []string{"/input", "/other"}
+		var multiIds []int64
+		for i := range 2 {
+			createdAt := now.Add(time.Duration(i-2) * time.Hour)
+			taskId, err := r.TaskRepo.CreateTask(ctx, inputPaths, "/output", "/config",
+				config.AF_TARGZ, config.PROVIDER_AWS, createdAt, createdAt,
+				&file_io.FilesInfo{ContentHash: "multi-hash"})
+			assert.NoError(t, err)
+			assert.NoError(t, r.TaskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED))
+			multiIds = append(multiIds, taskId)
+		}
+		// the policy of /input does not apply to backups of /input and /other
+		candidates, err := r.PlanPrune(ctx, "", now)
+		assert.NoError(t, err)
+		assert.Empty(t, candidates)
+
+		key := model.InputPathsKey(inputPaths)
+		assert.NoError(t, r.RetentionRepo.SetPolicy(ctx, &model.RetentionPolicy{InputPath: key, KeepLast: 1}))
+		candidates, err = r.PlanPrune(ctx, key, now)
+		assert.NoError(t, err)
+		assert.Len(t, candidates, 1)
+		assert.Equal(t, multiIds[0], candidates[0].Task.Id)
+	})
+}
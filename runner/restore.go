@@ -0,0 +1,223 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"glesha/backend"
+	"glesha/database/model"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// RestoreProgress is updated while catalog entries are restored, so
+// callers in the same process can show progress. a nil *RestoreProgress is
+// not updated
+type RestoreProgress struct {
+	entries      atomic.Int64
+	totalEntries atomic.Int64
+	bytes        atomic.Int64
+	totalBytes   atomic.Int64
+	failed       atomic.Int64
+}
+
+// RestoreStats is a snapshot of a RestoreProgress
+type RestoreStats struct {
+	// files and symlinks, directories are not counted
+	Entries      int64
+	TotalEntries int64
+	Bytes        int64
+	TotalBytes   int64
+	Failed       int64
+}
+
+func NewRestoreProgress() *RestoreProgress {
+	return &RestoreProgress{}
+}
+
+func (p *RestoreProgress) Get() RestoreStats {
+	if p == nil {
+		return RestoreStats{}
+	}
+	return RestoreStats{
+		Entries:      p.entries.Load(),
+		TotalEntries: p.totalEntries.Load(),
+		Bytes:        p.bytes.Load(),
+		TotalBytes:   p.totalBytes.Load(),
+		Failed:       p.failed.Load(),
+	}
+}
+
+func (p *RestoreProgress) start(totalEntries int64, totalBytes int64) {
+	if p == nil {
+		return
+	}
+	p.totalEntries.Store(totalEntries)
+	p.totalBytes.Store(totalBytes)
+}
+
+func (p *RestoreProgress) entryDone(failed bool) {
+	if p == nil {
+		return
+	}
+	p.entries.Add(1)
+	if failed {
+		p.failed.Add(1)
+	}
+}
+
+// counts bytes written to restored files
+type restoreWriter struct {
+	p *RestoreProgress
+}
+
+func (w restoreWriter) Write(b []byte) (int, error) {
+	if w.p != nil {
+		w.p.bytes.Add(int64(len(b)))
+	}
+	return len(b), nil
+}
+
+// restores entries "fullPaths" of the catalog of "taskId", with everything
+// under the directories among them, into "destDir" keeping their archived
+// paths. existing files are not overwritten, entries that can not be
+// restored are skipped and their errors are returned joined
+func (r *Runner) RestoreEntries(
+	ctx context.Context,
+	taskId int64,
+	fullPaths []string,
+	destDir string,
+	progress *RestoreProgress,
+) error {
+	rows, err := r.taskCatalog(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	rows = selectEntries(rows, fullPaths)
+	if len(rows) == 0 {
+		return fmt.Errorf("none of the entries to restore are in the catalog of task %d", taskId)
+	}
+	var totalEntries, totalBytes int64
+	for i := range rows {
+		if rows[i].FileType == "dir" {
+			continue
+		}
+		totalEntries++
+		if fs.FileMode(rows[i].Mode)&fs.ModeSymlink == 0 {
+			totalBytes += rows[i].SizeBytes
+		}
+	}
+	progress.start(totalEntries, totalBytes)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("could not create restore directory %s: %w", destDir, err)
+	}
+
+	er := r.NewEntryReader()
+	var errs []error
+	var dirs []*model.FileCatalogRow
+	for i := range rows {
+		row := &rows[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// catalog paths are relative, this keeps a corrupt catalog from
+		// writing outside of destDir
+		if !filepath.IsLocal(row.FullPath) {
+			errs = append(errs, fmt.Errorf("could not restore %s: path is not local", row.FullPath))
+			if row.FileType != "dir" {
+				progress.entryDone(true)
+			}
+			continue
+		}
+		dest := filepath.Join(destDir, row.FullPath)
+		if row.FileType == "dir" {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				errs = append(errs, fmt.Errorf("could not restore %s: %w", row.FullPath, err))
+				continue
+			}
+			dirs = append(dirs, row)
+			continue
+		}
+		err := restoreEntry(ctx, er, row, dest, progress)
+		progress.entryDone(err != nil)
+		if err == nil {
+			continue
+		}
+		// every other entry would fail the same way
+		if errors.Is(err, context.Canceled) || errors.Is(err, backend.ErrResourceArchived) {
+			return fmt.Errorf("could not restore %s: %w", row.FullPath, err)
+		}
+		errs = append(errs, fmt.Errorf("could not restore %s: %w", row.FullPath, err))
+	}
+	// restoring entries changed modification times of their directories,
+	// children come after their parents so they are set in reverse
+	for _, row := range slices.Backward(dirs) {
+		dest := filepath.Join(destDir, row.FullPath)
+		if err := os.Chmod(dest, fs.FileMode(row.Mode).Perm()); err != nil {
+			errs = append(errs, fmt.Errorf("could not restore permissions of %s: %w", row.FullPath, err))
+		}
+		if err := os.Chtimes(dest, row.ModifiedAt, row.ModifiedAt); err != nil {
+			errs = append(errs, fmt.Errorf("could not restore modification time of %s: %w", row.FullPath, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// returns "rows" that are one of "fullPaths" or under one of them
+func selectEntries(rows []model.FileCatalogRow, fullPaths []string) []model.FileCatalogRow {
+	var selected []model.FileCatalogRow
+	for _, row := range rows {
+		for _, p := range fullPaths {
+			if row.FullPath == p || strings.HasPrefix(row.FullPath, p+string(filepath.Separator)) {
+				selected = append(selected, row)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// restores symlink or regular file "row" to "dest", verifying the content
+// of files that were hashed when archived
+func restoreEntry(ctx context.Context, er *EntryReader, row *model.FileCatalogRow, dest string, progress *RestoreProgress) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if fs.FileMode(row.Mode)&fs.ModeSymlink != 0 {
+		target, err := er.Readlink(ctx, row)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dest)
+	}
+
+	rc, err := er.Open(ctx, row, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.FileMode(row.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash, restoreWriter{progress}), rc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && len(row.Sha256) > 0 && hex.EncodeToString(hash.Sum(nil)) != row.Sha256 {
+		err = fmt.Errorf("content does not match the sha256 recorded when it was archived")
+	}
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Chtimes(dest, row.ModifiedAt, row.ModifiedAt)
+}
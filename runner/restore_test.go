@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestRestoreEntries(t *testing.T) {
+	ctx := context.Background()
+	inputPath := filepath.Join(t.TempDir(), "docs")
+	assert.NoError(t, os.MkdirAll(filepath.Join(inputPath, "sub", "deep"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "sub", "deep", "a.txt"), []byte("hello"), 0640))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "sub", "b.txt"), []byte("world!"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "skipped.txt"), []byte("skipped"), 0644))
+	assert.NoError(t, os.Symlink("sub/b.txt", filepath.Join(inputPath, "link")))
+	modifiedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	assert.NoError(t, os.Chtimes(filepath.Join(inputPath, "sub", "b.txt"), modifiedAt, modifiedAt))
+	assert.NoError(t, os.Chtimes(filepath.Join(inputPath, "sub"), modifiedAt, modifiedAt))
+
+	for _, format := range []config.ArchiveFormat{config.AF_TARGZ, config.AF_REPO} {
+		t.Run(string(format), func(t *testing.T) {
+			r := setupTestRunner(t)
+			task := createTestTask(t, r, format, []string{inputPath}, t.TempDir(), "/config")
+			taskId := task.Id
+			var archiver archive.Archiver
+			var err error
+			if format == config.AF_REPO {
+				archiver, err = archive.NewRepoArchiver(task, r.ChunkRepo, "s3://test-bucket")
+			} else {
+				archiver, err = archive.NewTarGzArchiver(task)
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, archiver.Plan(ctx))
+			assert.NoError(t, archiver.Start(ctx, r.FileCatalogRepo, r.TaskRepo))
+
+			destDir := filepath.Join(t.TempDir(), "restored")
+			progress := NewRestoreProgress()
+			err = r.RestoreEntries(ctx, taskId, []string{filepath.Join("docs", "sub"), filepath.Join("docs", "link")},
+				destDir, progress)
+			assert.NoError(t, err)
+			assert.Equal(t, RestoreStats{Entries: 3, TotalEntries: 3, Bytes: 11, TotalBytes: 11}, progress.Get())
+
+			data, err := os.ReadFile(filepath.Join(destDir, "docs", "sub", "deep", "a.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(data))
+			info, err := os.Stat(filepath.Join(destDir, "docs", "sub", "deep", "a.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+			info, err = os.Stat(filepath.Join(destDir, "docs", "sub", "b.txt"))
+			assert.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(modifiedAt))
+			info, err = os.Stat(filepath.Join(destDir, "docs", "sub"))
+			assert.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(modifiedAt))
+			target, err := os.Readlink(filepath.Join(destDir, "docs", "link"))
+			assert.NoError(t, err)
+			assert.Equal(t, "sub/b.txt", target)
+			_, err = os.Stat(filepath.Join(destDir, "docs", "skipped.txt"))
+			assert.True(t, os.IsNotExist(err))
+
+			// existing files are not overwritten
+			assert.NoError(t, os.WriteFile(filepath.Join(destDir, "docs", "sub", "b.txt"), []byte("changed"), 0644))
+			progress = NewRestoreProgress()
+			err = r.RestoreEntries(ctx, taskId, []string{filepath.Join("docs", "sub")}, destDir, progress)
+			assert.ErrorIs(t, err, os.ErrExist)
+			assert.Equal(t, int64(2), progress.Get().Failed)
+			data, err = os.ReadFile(filepath.Join(destDir, "docs", "sub", "b.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, "changed", string(data))
+
+			err = r.RestoreEntries(ctx, taskId, []string{"missing"}, destDir, nil)
+			assert.ErrorContains(t, err, "none of the entries")
+		})
+	}
+}
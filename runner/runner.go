@@ -0,0 +1,500 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/archive"
+	"glesha/backend"
+	"glesha/backend/aws"
+	"glesha/config"
+	"glesha/control"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	L "glesha/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner archives and uploads tasks, it is shared by 'glesha run'
+// and 'glesha daemon'
+type Runner struct {
+	TaskRepo        repository.TaskRepository
+	UploadRepo      repository.UploadRepository
+	UploadBlockRepo repository.UploadBlockRepository
+	FileCatalogRepo repository.FileCatalogRepository
+	ScheduleRepo    repository.ScheduleRepository
+	RetentionRepo   repository.RetentionPolicyRepository
+	ChunkRepo       repository.ChunkRepository
+	HookRunRepo     repository.HookRunRepository
+	// controllers of tasks running in this process, by task id
+	running sync.Map
+}
+
+func NewRunner(db *database.DB) *Runner {
+	return &Runner{
+		TaskRepo:        repository.NewTaskRepository(db),
+		UploadRepo:      repository.NewUploadRepository(db),
+		UploadBlockRepo: repository.NewUploadBlockRepository(db),
+		FileCatalogRepo: repository.NewFileCatalogRepository(db),
+		ScheduleRepo:    repository.NewScheduleRepository(db),
+		RetentionRepo:   repository.NewRetentionPolicyRepository(db),
+		ChunkRepo:       repository.NewChunkRepository(db),
+		HookRunRepo:     repository.NewHookRunRepository(db),
+	}
+}
+
+// config is a global set by config.Parse, tasks running at the same time
+// may use different config files, so parsing it and creating a backend
+// from it must not interleave
+var configMu sync.Mutex
+
+func newStorageBackend(t *model.Task) (backend.StorageBackend, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	err := config.Parse(t.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if t.Provider != config.PROVIDER_AWS {
+		return nil, fmt.Errorf("unsupported provider: %v", t.Provider.String())
+	}
+	var storageBackendFactory backend.StorageFactory = &aws.AWSFactory{}
+	return storageBackendFactory.NewStorageBackend()
+}
+
+// returns a copy of the config of "t", which parsing other configs does not change
+func taskConfig(t *model.Task) (config.Config, error) {
+	return parseConfig(t.ConfigPath)
+}
+
+// returns a copy of the config at "configPath"
+func parseConfig(configPath string) (config.Config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	err := config.Parse(configPath)
+	if err != nil {
+		return config.Config{}, err
+	}
+	return *config.Get(), nil
+}
+
+// parses --jobs, --min-jobs and --max-jobs flags shared by 'glesha run'
+// and 'glesha daemon'
+func ParseUploadOptions(jobs string, minJobs int, maxJobs int) (backend.UploadOptions, error) {
+	if strings.ToLower(jobs) == "auto" {
+		if minJobs < 1 || maxJobs < minJobs {
+			return backend.UploadOptions{}, fmt.Errorf("invalid job bounds: --min-jobs %d --max-jobs %d", minJobs, maxJobs)
+		}
+		return backend.UploadOptions{AutoJobs: true, MinJobs: minJobs, MaxJobs: maxJobs}, nil
+	}
+	n, err := strconv.Atoi(jobs)
+	if err != nil || n < 1 {
+		return backend.UploadOptions{}, fmt.Errorf("invalid value for --jobs: %s, expected a positive number or 'auto'", jobs)
+	}
+	return backend.UploadOptions{Jobs: n}, nil
+}
+
+// runs task "taskId" until its archive is uploaded
+func (r *Runner) RunTask(ctx context.Context, taskId int64, opts backend.UploadOptions) error {
+	t, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	if err != nil {
+		if err == database.ErrDoesNotExist {
+			return fmt.Errorf("task %d does not exist, for more information see 'glesha help add'", taskId)
+		}
+		return err
+	}
+	L.Printf("%s", t)
+	storageBackend, err := newStorageBackend(t)
+	if err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// lets 'glesha pause' and 'glesha resume' reach this task
+	tc := newTaskController(r, t.Id, cancel)
+	controlServer, err := control.Listen(ctx, t.Id, tc)
+	if err != nil {
+		return err
+	}
+	defer controlServer.Close()
+	r.running.Store(t.Id, tc)
+	defer r.running.Delete(t.Id)
+	opts.Progress = tc.uploadProgress
+	err = r.runTask(runCtx, t, tc, storageBackend, opts)
+	if err != nil && tc.IsAborted() && ctx.Err() == nil {
+		return fmt.Errorf("%w: %d", ErrTaskAborted, t.Id)
+	}
+	return err
+}
+
+// returns the progress of task "taskId" if it is running in this process
+func (r *Runner) GetTaskProgress(ctx context.Context, taskId int64) (TaskProgress, bool) {
+	v, ok := r.running.Load(taskId)
+	if !ok {
+		return TaskProgress{}, false
+	}
+	return v.(*taskController).Progress(ctx), true
+}
+
+func (r *Runner) runTask(
+	ctx context.Context,
+	t *model.Task,
+	tc *taskController,
+	storageBackend backend.StorageBackend,
+	opts backend.UploadOptions,
+) error {
+	cfg, err := taskConfig(t)
+	if err != nil {
+		return err
+	}
+	hooks := newTaskHooks(r, t.Id, cfg.Hooks)
+	err = r.runTaskSteps(ctx, t, tc, storageBackend, opts, &cfg, hooks)
+	// a paused task is continued on resume, so it has not failed
+	if err != nil && !tc.IsPaused() {
+		hookErr := hooks.run(context.WithoutCancel(ctx), model.HOOK_ON_FAILURE, err)
+		if hookErr != nil {
+			L.Warn(hookErr)
+		}
+	}
+	return err
+}
+
+func (r *Runner) runTaskSteps(
+	ctx context.Context,
+	t *model.Task,
+	tc *taskController,
+	storageBackend backend.StorageBackend,
+	opts backend.UploadOptions,
+	cfg *config.Config,
+	hooks *taskHooks,
+) error {
+	mustRearchive := false
+	switch t.Status {
+	case model.TASK_STATUS_QUEUED,
+		model.TASK_STATUS_ARCHIVE_RUNNING,
+		model.TASK_STATUS_ARCHIVE_ABORTED,
+		model.TASK_STATUS_ARCHIVE_PAUSED:
+		mustRearchive = true
+	}
+
+	var archiver archive.Archiver
+	var err error
+	switch t.ArchiveFormat {
+	case config.AF_TARGZ:
+		archiver, err = archive.NewTarGzArchiver(t)
+	case config.AF_REPO:
+		archiver, err = archive.NewRepoArchiver(t, r.ChunkRepo, storageBackend.GetResourceContainerId())
+	default:
+		return fmt.Errorf("archive format %s is not supported yet", t.ArchiveFormat.String())
+	}
+	if err != nil {
+		return err
+	}
+	L.Info("Planning archive")
+	err = archiver.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	L.Println("Plan Archive: OK")
+	existingArchivePath := archiver.GetArchiveFilePath(ctx)
+	if t.ArchiveFormat == config.AF_REPO {
+		err = archive.IsValidManifest(ctx, existingArchivePath, storageBackend.GetResourceContainerId(), r.ChunkRepo)
+	} else {
+		err = archive.IsValidTarGz(existingArchivePath)
+	}
+	if err != nil {
+		mustRearchive = true
+		L.Debug(err)
+		L.Debug(fmt.Sprintf("Existing archive %s is not valid, starting fresh", existingArchivePath))
+	}
+	info := archiver.GetInfo(ctx)
+	if int64(info.SizeInBytes) != t.TotalSize {
+		L.Info("Rearchiving because input_path contents have changed since last run")
+		mustRearchive = true
+	}
+
+	if mustRearchive {
+		// a new archive could only be uploaded by overwriting the stored one
+		upload, err := r.UploadRepo.GetUploadByTaskId(ctx, t.Id)
+		if err == nil && upload.Status == model.UPLOAD_STATUS_COMPLETED {
+			return fmt.Errorf("%w, its input paths changed", errUploadCompleted(t))
+		}
+		if err != nil && !errors.Is(err, database.ErrDoesNotExist) {
+			return err
+		}
+		// runs before every new archive, but not when resuming an upload
+		// since that must not change the archive it uploads
+		if len(hooks.command(model.HOOK_PRE_ARCHIVE)) > 0 {
+			err = hooks.run(ctx, model.HOOK_PRE_ARCHIVE, nil)
+			if err != nil {
+				return fmt.Errorf("aborting task %d: %w", t.Id, err)
+			}
+			// the hook may have changed the input paths, e.g. by dumping a db
+			err = archiver.Plan(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		L.Info("Starting fresh because cannot continue from previous state")
+		err = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_RUNNING)
+		if err != nil {
+			return err
+		}
+		snap, err := r.takeSnapshot(ctx, t, cfg.Snapshot, archiver)
+		if err != nil {
+			_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_ABORTED)
+			return err
+		}
+		tc.setArchivePhase(archiver)
+		err = archiver.Start(ctx, r.FileCatalogRepo, r.TaskRepo)
+		releaseSnapshot(ctx, snap)
+		if err != nil {
+			if !tc.IsPaused() {
+				_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_ABORTED)
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			// a paused archive keeps its ARCHIVE_PAUSED status
+			if !tc.IsPaused() {
+				_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_ABORTED)
+			}
+			return fmt.Errorf("kill signal received, exiting")
+		default:
+		}
+		err = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_ARCHIVE_COMPLETED)
+		if err != nil {
+			return err
+		}
+		err = r.TaskRepo.UpdateTaskContentInfo(ctx,
+			t.Id, archiver.GetInfo(ctx))
+		if err != nil {
+			return err
+		}
+		L.Println("Create Archive: OK")
+		hooks.archivePath = archiver.GetArchiveFilePath(ctx)
+		err = hooks.run(ctx, model.HOOK_POST_ARCHIVE, nil)
+		if err != nil {
+			L.Warn(err)
+		}
+	} else {
+		L.Info("Skipping Archiving because input_path contents have not changed since last run")
+	}
+
+	archivePath := archiver.GetArchiveFilePath(ctx)
+	hooks.archivePath = archivePath
+	L.Printf("Archive: %s\n", archivePath)
+
+	// a completed upload is final, uploading it again would overwrite the
+	// stored object, so its status must not change either
+	completedUpload, err := r.UploadRepo.GetUploadByTaskId(ctx, t.Id)
+	if err == nil && completedUpload.Status == model.UPLOAD_STATUS_COMPLETED {
+		reason, err := getStaleUploadReason(ctx, completedUpload, archivePath)
+		if err != nil {
+			return err
+		}
+		if len(reason) > 0 {
+			return fmt.Errorf("%w, %s", errUploadCompleted(t), reason)
+		}
+		L.Printf("Skipping upload because task %d is uploaded already\n", t.Id)
+		return nil
+	}
+	if err != nil && !errors.Is(err, database.ErrDoesNotExist) {
+		return fmt.Errorf("could not get upload for task id %d: %w", t.Id, err)
+	}
+
+	err = storageBackend.CreateResourceContainer(ctx)
+	if err != nil {
+		return err
+	}
+	L.Println("Upload::CreateResourceContainer OK")
+
+	if t.ArchiveFormat == config.AF_REPO {
+		err = r.uploadPacks(ctx, t, tc, storageBackend)
+		if err != nil {
+			return err
+		}
+	}
+
+	existingUpload, err := r.UploadRepo.GetUploadByTaskId(ctx, t.Id)
+	if err == nil {
+		reason, err2 := getStaleUploadReason(ctx, existingUpload, archivePath)
+		if err2 != nil {
+			return err2
+		}
+		if len(reason) > 0 {
+			err2 = r.invalidateUpload(ctx, t, storageBackend, existingUpload, reason)
+			if err2 != nil {
+				return err2
+			}
+			err = database.ErrDoesNotExist
+		}
+	}
+
+	var uploadId int64
+
+	if err != nil && err == database.ErrDoesNotExist {
+		uploadRes, err2 := storageBackend.CreateUploadResource(ctx,
+			t.Key(), archivePath)
+		if err2 != nil {
+			return err2
+		}
+		L.Println("Upload::CreateUploadResource OK")
+		archiveFileInfo, err2 := file_io.GetFileInfo(archivePath)
+		if err2 != nil {
+			return err2
+		}
+
+		blockSizeInBytes := uploadRes.BlockSizeInBytes
+		archiveFileSize := int64(archiveFileInfo.Size)
+		var totalBlocks int64 = 1
+		if blockSizeInBytes > 0 {
+			totalBlocks = (archiveFileSize + blockSizeInBytes - 1) / blockSizeInBytes
+		}
+
+		err2 = storageBackend.IsBlockSizeOK(blockSizeInBytes, archiveFileSize)
+		if err2 != nil {
+			return fmt.Errorf("failed to partition file: %w", err2)
+		}
+		sampleHash, err2 := file_io.ComputeSampledHash(ctx, archivePath)
+		if err2 != nil {
+			return err2
+		}
+		now := time.Now()
+		uploadId, err2 = r.UploadRepo.CreateUpload(
+			ctx,
+			t.Id,
+			uploadRes.Metadata.Json,
+			uploadRes.Metadata.SchemaVersion,
+			archivePath,
+			int64(archiveFileInfo.Size),
+			archiveFileInfo.ModifiedAt,
+			sampleHash,
+			totalBlocks,
+			blockSizeInBytes,
+			now,
+			now,
+		)
+
+		if err2 != nil {
+			return fmt.Errorf("failed to save upload information: %w", err2)
+		}
+		L.Printf("Upload::CreateUploadResource OK (upload_id: %d)\n", uploadId)
+		err = nil
+	} else if err != nil {
+		return fmt.Errorf("could not get upload for task id %d: %w", t.Id, err)
+	} else {
+		L.Info("Skipping creating a new upload because upload already exists for a task")
+		uploadId = existingUpload.Id
+	}
+	L.Println(fmt.Sprintf("Task(%d) now has upload Id: %d", t.Id, uploadId))
+	if err != nil {
+		return err
+	}
+
+	hooks.uploadId = uploadId
+	_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_RUNNING)
+	_ = r.UploadRepo.UpdateStatus(ctx, uploadId, model.UPLOAD_STATUS_RUNNING)
+
+	uploadOptions := opts
+	uploadOptions.Gate = tc.uploadGate
+	tc.setUploadPhase(uploadId)
+	err = storageBackend.UploadResource(
+		ctx,
+		r.TaskRepo,
+		r.UploadRepo,
+		r.UploadBlockRepo,
+		uploadOptions,
+		uploadId,
+	)
+
+	if err != nil {
+		// a paused upload keeps its PAUSED status, so it can be continued later
+		if !tc.IsPaused() {
+			_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_ABORTED)
+			_ = r.UploadRepo.UpdateStatus(ctx, uploadId, model.UPLOAD_STATUS_FAILED)
+		}
+		return err
+	}
+	_ = r.TaskRepo.UpdateTaskStatus(ctx, t.Id, model.TASK_STATUS_UPLOAD_COMPLETED)
+	L.Printf("Upload Archive: OK\n")
+	err = hooks.run(ctx, model.HOOK_POST_UPLOAD, nil)
+	if err != nil {
+		L.Warn(err)
+	}
+	return nil
+}
+
+// returned when the archive of a task changed after it was uploaded. the
+// uploaded object is not overwritten, both to keep the backup it holds and
+// because object lock may reject it midway
+func errUploadCompleted(t *model.Task) error {
+	return fmt.Errorf("task %d was uploaded already, add a new task to back up %s again",
+		t.Id, t.InputPathsKey())
+}
+
+// returns why "upload" can not be continued with the archive at "archivePath",
+// or an empty string if the archive is the same one the upload was created for
+func getStaleUploadReason(ctx context.Context, upload *model.Upload, archivePath string) (string, error) {
+	if upload.FilePath != archivePath {
+		return fmt.Sprintf("archive path changed from %s to %s", upload.FilePath, archivePath), nil
+	}
+	archiveFileInfo, err := file_io.GetFileInfo(archivePath)
+	if err != nil {
+		return "", err
+	}
+	if int64(archiveFileInfo.Size) != upload.FileSize {
+		return fmt.Sprintf("archive size changed from %s to %s",
+			L.HumanReadableBytes(uint64(upload.FileSize), 2),
+			L.HumanReadableBytes(archiveFileInfo.Size, 2)), nil
+	}
+	if database.ToTimeStr(archiveFileInfo.ModifiedAt) != upload.FileLastModifiedAt.Format(database.DateTimeFormat) {
+		return "archive was modified after the upload was created", nil
+	}
+	// uploads created by older versions do not have a sampled hash
+	if len(upload.FileSampleHash) == 0 {
+		return "", nil
+	}
+	sampleHash, err := file_io.ComputeSampledHash(ctx, archivePath)
+	if err != nil {
+		return "", err
+	}
+	if sampleHash != upload.FileSampleHash {
+		return "archive contents changed", nil
+	}
+	return "", nil
+}
+
+// aborts the remote upload resource of "upload" and removes it along with
+// its blocks, so a fresh upload can be created for the task. completed
+// uploads are final and are never discarded
+func (r *Runner) invalidateUpload(
+	ctx context.Context,
+	t *model.Task,
+	storageBackend backend.StorageBackend,
+	upload *model.Upload,
+	reason string,
+) error {
+	if upload.Status == model.UPLOAD_STATUS_COMPLETED {
+		return fmt.Errorf("%w, %s", errUploadCompleted(t), reason)
+	}
+	L.Warn(fmt.Sprintf("Discarding previous upload because %s", reason))
+	err := storageBackend.AbortUploadResource(ctx, t.Key(), backend.StorageMetadata{
+		Json:          upload.StorageBackendMetadataJson,
+		SchemaVersion: upload.StorageBackendMetadataSchemaVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("could not abort previous upload for upload id %d: %w", upload.Id, err)
+	}
+	_, err = r.UploadBlockRepo.RemoveAllBlocks(ctx, upload.Id)
+	if err != nil {
+		return fmt.Errorf("could not remove blocks for upload id %d: %w", upload.Id, err)
+	}
+	return r.UploadRepo.DeleteUpload(ctx, upload.Id)
+}
@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"context"
+	"glesha/backend"
+	"glesha/config"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"glesha/file_io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// returns a runner on a new in-memory database, which is closed when the
+// test ends
+func setupTestRunner(t *testing.T) *Runner {
+	db, err := database.NewDB(":memory:")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Init(context.Background()))
+	t.Cleanup(func() {
+		db.Close(context.Background())
+	})
+	return NewRunner(db)
+}
+
+// creates a queued task of "format" that archives "inputPaths" into
+// "outputPath" with the config at "configPath"
+func createTestTask(
+	t *testing.T,
+	r *Runner,
+	format config.ArchiveFormat,
+	inputPaths []string,
+	outputPath string,
+	configPath string,
+) *model.Task {
+	ctx := context.Background()
+	taskId, err := r.TaskRepo.CreateTask(ctx, inputPaths, outputPath, configPath,
+		format, config.PROVIDER_AWS, time.Now(), time.Now(),
+		&file_io.FilesInfo{ContentHash: "test-hash"})
+	assert.NoError(t, err)
+	task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+	return task
+}
+
+// records AbortUploadResource calls, other methods are not used by invalidateUpload
+type abortRecorder struct {
+	backend.StorageBackend
+	aborted []string
+}
+
+func (a *abortRecorder) AbortUploadResource(ctx context.Context, taskKey string, metadata backend.StorageMetadata) error {
+	a.aborted = append(a.aborted, taskKey)
+	return nil
+}
+
+func TestCompletedUploadIsFinal(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"archive_format": "targz", "provider": "aws"}`), 0644))
+	createTask := func() (*model.Task, *model.Upload) {
+		task := createTestTask(t, r, config.AF_TARGZ, []string{tempDir}, tempDir, configPath)
+		uploadId, err := r.UploadRepo.CreateUpload(ctx, task.Id, "{}", 1, "/output/archive.tar.gz", 2048,
+			time.Now(), "sample-hash", 1, 2048, time.Now(), time.Now())
+		assert.NoError(t, err)
+		upload, err := r.UploadRepo.GetUploadById(ctx, uploadId)
+		assert.NoError(t, err)
+		return task, upload
+	}
+
+	t.Run("Rearchive", func(t *testing.T) {
+		task, upload := createTask()
+		assert.NoError(t, r.UploadRepo.MarkComplete(ctx, upload.Id, "s3://test-bucket/test-key"))
+		assert.NoError(t, r.TaskRepo.UpdateTaskStatus(ctx, task.Id, model.TASK_STATUS_UPLOAD_COMPLETED))
+		task, err := r.TaskRepo.GetTaskById(ctx, task.Id)
+		assert.NoError(t, err)
+
+		// the archive is missing, so the task would be archived again
+		err = r.runTask(ctx, task, newTaskController(r, task.Id, func() {}), nil, backend.UploadOptions{Jobs: 1})
+		assert.ErrorContains(t, err, "was uploaded already, add a new task")
+		upload, err = r.UploadRepo.GetUploadById(ctx, upload.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, model.UPLOAD_STATUS_COMPLETED, upload.Status)
+	})
+
+	t.Run("InvalidateUpload", func(t *testing.T) {
+		storageBackend := &abortRecorder{}
+		task, upload := createTask()
+		assert.NoError(t, r.invalidateUpload(ctx, task, storageBackend, upload, "archive contents changed"))
+		assert.Equal(t, []string{task.Key()}, storageBackend.aborted)
+		_, err := r.UploadRepo.GetUploadByTaskId(ctx, task.Id)
+		assert.Equal(t, database.ErrDoesNotExist, err)
+
+		task, upload = createTask()
+		assert.NoError(t, r.UploadRepo.MarkComplete(ctx, upload.Id, "s3://test-bucket/test-key"))
+		upload, err = r.UploadRepo.GetUploadById(ctx, upload.Id)
+		assert.NoError(t, err)
+		err = r.invalidateUpload(ctx, task, storageBackend, upload, "archive contents changed")
+		assert.ErrorContains(t, err, "was uploaded already, add a new task")
+		assert.Len(t, storageBackend.aborted, 1)
+		_, err = r.UploadRepo.GetUploadById(ctx, upload.Id)
+		assert.NoError(t, err)
+	})
+}
+
+// completes every upload it is asked to upload, and counts them
+type uploadRecorder struct {
+	backend.StorageBackend
+	uploaded []int64
+}
+
+func (u *uploadRecorder) CreateResourceContainer(ctx context.Context) error {
+	return nil
+}
+
+func (u *uploadRecorder) GetResourceContainerId() string {
+	return "test-container"
+}
+
+func (u *uploadRecorder) CreateUploadResource(ctx context.Context, taskKey string, resourceFilePath string) (*backend.CreateUploadResult, error) {
+	return &backend.CreateUploadResult{Metadata: backend.StorageMetadata{Json: "{}", SchemaVersion: 1}, BlockSizeInBytes: 1024}, nil
+}
+
+func (u *uploadRecorder) IsBlockSizeOK(blockSize int64, fileSize int64) error {
+	return nil
+}
+
+func (u *uploadRecorder) UploadResource(
+	ctx context.Context,
+	taskRepo repository.TaskRepository,
+	uploadRepo repository.UploadRepository,
+	uploadBlockRepo repository.UploadBlockRepository,
+	opts backend.UploadOptions,
+	uploadId int64,
+) error {
+	u.uploaded = append(u.uploaded, uploadId)
+	return uploadRepo.MarkComplete(ctx, uploadId, "s3://test-bucket/test-key")
+}
+
+func TestRunTask_CompletedUploadIsNotUploadedAgain(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "file.txt"), []byte("hello"), 0644))
+	configPath := filepath.Join(outputDir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"archive_format": "targz", "provider": "aws"}`), 0644))
+	taskId := createTestTask(t, r, config.AF_TARGZ, []string{inputDir}, outputDir, configPath).Id
+
+	storageBackend := &uploadRecorder{}
+	for range 2 {
+		task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+		assert.NoError(t, err)
+		err = r.runTask(ctx, task, newTaskController(r, taskId, func() {}), storageBackend, backend.UploadOptions{Jobs: 1})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, storageBackend.uploaded, 1)
+	task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TASK_STATUS_UPLOAD_COMPLETED, task.Status)
+	upload, err := r.UploadRepo.GetUploadByTaskId(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.UPLOAD_STATUS_COMPLETED, upload.Status)
+}
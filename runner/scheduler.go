@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/backend"
+	"glesha/control"
+	"glesha/database/model"
+	"glesha/database/repository"
+	L "glesha/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tasks in these states are picked up by the scheduler
+var RUNNABLE_TASK_STATUSES = []model.TaskStatus{
+	model.TASK_STATUS_QUEUED,
+	model.TASK_STATUS_ARCHIVE_ABORTED,
+	model.TASK_STATUS_ARCHIVE_COMPLETED,
+	model.TASK_STATUS_UPLOAD_ABORTED,
+}
+
+// failed tasks are retried after RetryBackoff, doubled with each
+// failed attempt, up to MAX_RETRY_BACKOFF
+const MAX_RETRY_BACKOFF = time.Hour
+
+type SchedulerOptions struct {
+	// number of tasks to run at the same time
+	MaxTasks int
+	// number of blocks uploaded at the same time across all tasks,
+	// 0 means each task only respects its own UploadOptions
+	MaxWorkers int
+	// number of times a failed task is retried before giving up on it
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// how often to look for new runnable tasks, 0 means Run returns
+	// once there is nothing left to run
+	PollInterval  time.Duration
+	UploadOptions backend.UploadOptions
+	// create tasks for due schedules before looking for runnable tasks
+	EvaluateSchedules bool
+}
+
+type retryState struct {
+	attempts      int
+	nextAttemptAt time.Time
+}
+
+type taskResult struct {
+	taskId int64
+	err    error
+}
+
+// Scheduler runs runnable tasks in priority order, retrying failed ones
+type Scheduler struct {
+	taskRepo  repository.TaskRepository
+	run       func(ctx context.Context, taskId int64) error
+	isRunning func(ctx context.Context, taskId int64) bool
+	enqueue   func(ctx context.Context) error
+	opts      SchedulerOptions
+}
+
+func NewScheduler(r *Runner, opts SchedulerOptions) *Scheduler {
+	opts.MaxTasks = max(opts.MaxTasks, 1)
+	uploadOptions := opts.UploadOptions
+	if opts.MaxWorkers > 0 {
+		uploadOptions.Budget = backend.NewWorkerBudget(opts.MaxWorkers)
+	}
+	s := &Scheduler{
+		taskRepo: r.TaskRepo,
+		run: func(ctx context.Context, taskId int64) error {
+			return r.RunTask(ctx, taskId, uploadOptions)
+		},
+		isRunning: control.IsRunning,
+		opts:      opts,
+	}
+	if opts.EvaluateSchedules {
+		s.enqueue = func(ctx context.Context) error {
+			return r.EnqueueDueSchedules(ctx, time.Now())
+		}
+	}
+	return s
+}
+
+// runs tasks until ctx is done, or until there is nothing left to run
+// when PollInterval is 0. returns an error if any task was given up on
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	results := make(chan taskResult)
+	running := map[int64]bool{}
+	retries := map[int64]*retryState{}
+	// tasks that are done for the lifetime of this scheduler
+	succeeded := map[int64]bool{}
+	failed := map[int64]bool{}
+	// aborted by the user, so they are not retried
+	aborted := map[int64]bool{}
+
+	for {
+		pending := 0
+		var nextRetryAt time.Time
+		if ctx.Err() == nil && s.enqueue != nil {
+			err := s.enqueue(ctx)
+			if err != nil {
+				L.Error(err)
+			}
+		}
+		if ctx.Err() == nil {
+			tasks, err := s.taskRepo.ListRunnableTasks(ctx, RUNNABLE_TASK_STATUSES)
+			if err != nil {
+				L.Error(err)
+			}
+			now := time.Now()
+			for _, t := range tasks {
+				if running[t.Id] || succeeded[t.Id] || failed[t.Id] || aborted[t.Id] {
+					continue
+				}
+				if r, ok := retries[t.Id]; ok && now.Before(r.nextAttemptAt) {
+					pending++
+					if nextRetryAt.IsZero() || r.nextAttemptAt.Before(nextRetryAt) {
+						nextRetryAt = r.nextAttemptAt
+					}
+					continue
+				}
+				if len(running) >= s.opts.MaxTasks {
+					pending++
+					continue
+				}
+				if s.isRunning(ctx, t.Id) {
+					L.Debug(fmt.Sprintf("Skipping task %d because it is running in another glesha process", t.Id))
+					continue
+				}
+				L.Info(fmt.Sprintf("Starting task %d (priority: %d)", t.Id, t.Priority))
+				running[t.Id] = true
+				wg.Add(1)
+				go func(taskId int64) {
+					defer wg.Done()
+					results <- taskResult{taskId: taskId, err: s.run(ctx, taskId)}
+				}(t.Id)
+			}
+		}
+
+		if len(running) == 0 && (ctx.Err() != nil || (s.opts.PollInterval == 0 && pending == 0)) {
+			break
+		}
+
+		var wakeup <-chan time.Time
+		if s.opts.PollInterval > 0 {
+			wakeup = time.After(s.opts.PollInterval)
+		}
+		if !nextRetryAt.IsZero() && (s.opts.PollInterval == 0 || time.Until(nextRetryAt) < s.opts.PollInterval) {
+			wakeup = time.After(time.Until(nextRetryAt))
+		}
+		done := ctx.Done()
+		if ctx.Err() != nil {
+			// only wait for running tasks to exit
+			done = nil
+			wakeup = nil
+		}
+
+		select {
+		case res := <-results:
+			delete(running, res.taskId)
+			s.handleResult(ctx, res, retries, succeeded, failed, aborted)
+		case <-wakeup:
+		case <-done:
+			L.Info("Waiting for running tasks to exit")
+		}
+	}
+	wg.Wait()
+
+	L.Info(fmt.Sprintf("Scheduler: %s succeeded, %s failed",
+		L.HumanReadableCount(len(succeeded), "task", "tasks"),
+		L.HumanReadableCount(len(failed), "task", "tasks")))
+	if len(failed) > 0 {
+		ids := make([]string, 0, len(failed))
+		for id := range failed {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		return fmt.Errorf("gave up on %s: %s",
+			L.HumanReadableCount(len(failed), "task", "tasks"), strings.Join(ids, ", "))
+	}
+	return ctx.Err()
+}
+
+func (s *Scheduler) handleResult(
+	ctx context.Context,
+	res taskResult,
+	retries map[int64]*retryState,
+	succeeded map[int64]bool,
+	failed map[int64]bool,
+	aborted map[int64]bool,
+) {
+	if res.err == nil {
+		L.Info(fmt.Sprintf("Task %d: OK", res.taskId))
+		delete(retries, res.taskId)
+		succeeded[res.taskId] = true
+		return
+	}
+	if errors.Is(res.err, ErrTaskAborted) {
+		L.Info(fmt.Sprintf("Task %d was aborted, not retrying it", res.taskId))
+		delete(retries, res.taskId)
+		aborted[res.taskId] = true
+		return
+	}
+	if ctx.Err() != nil {
+		// interrupted, not failed
+		return
+	}
+	r, ok := retries[res.taskId]
+	if !ok {
+		r = &retryState{}
+		retries[res.taskId] = r
+	}
+	r.attempts++
+	if r.attempts > s.opts.MaxRetries {
+		L.Error(fmt.Sprintf("Task %d failed, giving up after %s: %v",
+			res.taskId, L.HumanReadableCount(r.attempts, "attempt", "attempts"), res.err))
+		delete(retries, res.taskId)
+		failed[res.taskId] = true
+		return
+	}
+	backoff := s.opts.RetryBackoff
+	for i := 1; i < r.attempts && backoff < MAX_RETRY_BACKOFF; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, MAX_RETRY_BACKOFF)
+	r.nextAttemptAt = time.Now().Add(backoff)
+	L.Warn(fmt.Sprintf("Task %d failed (attempt %d/%d), retrying in %s: %v",
+		res.taskId, r.attempts, s.opts.MaxRetries+1, L.HumanReadableTime(backoff.Milliseconds()), res.err))
+}
@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/config"
+	"glesha/database/model"
+	"glesha/database/repository"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func setupSchedulerTest(t *testing.T, priorities ...int64) (repository.TaskRepository, []int64) {
+	r := setupTestRunner(t)
+	var ids []int64
+	for _, p := range priorities {
+		task := createTestTask(t, r, config.AF_TARGZ, []string{"/input"}, "/output", "/config")
+		assert.NoError(t, r.TaskRepo.UpdateTaskPriority(context.Background(), task.Id, p))
+		ids = append(ids, task.Id)
+	}
+	return r.TaskRepo, ids
+}
+
+func notRunning(ctx context.Context, taskId int64) bool {
+	return false
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("PriorityOrder", func(t *testing.T) {
+		taskRepo, ids := setupSchedulerTest(t, 0, 5, 1)
+
+		var order []int64
+		s := &Scheduler{
+			taskRepo: taskRepo,
+			run: func(ctx context.Context, taskId int64) error {
+				order = append(order, taskId)
+				return taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED)
+			},
+			isRunning: notRunning,
+			opts:      SchedulerOptions{MaxTasks: 1},
+		}
+		assert.NoError(t, s.Run(context.Background()))
+		assert.Equal(t, []int64{ids[1], ids[2], ids[0]}, order)
+	})
+
+	t.Run("RetryWithBackoff", func(t *testing.T) {
+		taskRepo, ids := setupSchedulerTest(t, 0, 0)
+
+		attempts := map[int64]int{}
+		s := &Scheduler{
+			taskRepo: taskRepo,
+			run: func(ctx context.Context, taskId int64) error {
+				attempts[taskId]++
+				// first task recovers on its second attempt, second one never does
+				if taskId == ids[0] && attempts[taskId] > 1 {
+					return taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED)
+				}
+				_ = taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_ABORTED)
+				return errors.New("upload failed")
+			},
+			isRunning: notRunning,
+			opts:      SchedulerOptions{MaxTasks: 1, MaxRetries: 2, RetryBackoff: 10 * time.Millisecond},
+		}
+		err := s.Run(context.Background())
+		assert.EqualError(t, err, "gave up on 1 task: 2")
+		assert.Equal(t, 2, attempts[ids[0]])
+		assert.Equal(t, 3, attempts[ids[1]])
+	})
+
+	t.Run("AbortedIsNotRetried", func(t *testing.T) {
+		taskRepo, ids := setupSchedulerTest(t, 0)
+
+		attempts := 0
+		s := &Scheduler{
+			taskRepo: taskRepo,
+			run: func(ctx context.Context, taskId int64) error {
+				attempts++
+				_ = taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_ARCHIVE_ABORTED)
+				return fmt.Errorf("%w: %d", ErrTaskAborted, ids[0])
+			},
+			isRunning: notRunning,
+			opts:      SchedulerOptions{MaxTasks: 1, MaxRetries: 2, RetryBackoff: 10 * time.Millisecond},
+		}
+		assert.NoError(t, s.Run(context.Background()))
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("MaxTasks", func(t *testing.T) {
+		taskRepo, _ := setupSchedulerTest(t, 0, 0, 0, 0, 0)
+
+		var mu sync.Mutex
+		active, maxActive := 0, 0
+		s := &Scheduler{
+			taskRepo: taskRepo,
+			run: func(ctx context.Context, taskId int64) error {
+				mu.Lock()
+				active++
+				maxActive = max(maxActive, active)
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED)
+			},
+			isRunning: notRunning,
+			opts:      SchedulerOptions{MaxTasks: 2},
+		}
+		assert.NoError(t, s.Run(context.Background()))
+		assert.Equal(t, 2, maxActive)
+	})
+
+	t.Run("SkipRunningElsewhere", func(t *testing.T) {
+		taskRepo, ids := setupSchedulerTest(t, 0, 0)
+
+		var ran []int64
+		s := &Scheduler{
+			taskRepo: taskRepo,
+			run: func(ctx context.Context, taskId int64) error {
+				ran = append(ran, taskId)
+				return taskRepo.UpdateTaskStatus(ctx, taskId, model.TASK_STATUS_UPLOAD_COMPLETED)
+			},
+			isRunning: func(ctx context.Context, taskId int64) bool {
+				return taskId == ids[0]
+			},
+			opts: SchedulerOptions{MaxTasks: 1},
+		}
+		assert.NoError(t, s.Run(context.Background()))
+		assert.Equal(t, []int64{ids[1]}, ran)
+	})
+}
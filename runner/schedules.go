@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"glesha/cron"
+	"glesha/database"
+	"glesha/database/model"
+	"glesha/file_io"
+	"glesha/filter"
+	L "glesha/logger"
+	"time"
+)
+
+// creates tasks for schedules that are due at "now", and moves each of
+// them to its next run. unchanged trees are skipped using FindSimilarTask
+func (r *Runner) EnqueueDueSchedules(ctx context.Context, now time.Time) error {
+	due, err := r.ScheduleRepo.ListDueSchedules(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, sc := range due {
+		nextRunAt := now.Add(cron.MAX_SEARCH_DURATION)
+		cs, err := cron.Parse(sc.CronExpr)
+		if err != nil {
+			L.Error(fmt.Errorf("schedule %d: %w", sc.Id, err))
+		} else if next := cs.Next(now); !next.IsZero() {
+			nextRunAt = next
+		}
+		taskId, err := r.enqueueSchedule(ctx, sc, now)
+		if err != nil {
+			// still move to the next run, so a broken schedule is not retried every poll
+			L.Error(fmt.Errorf("schedule %d: could not create task for %s: %w", sc.Id, sc.InputPath, err))
+		}
+		err = r.ScheduleRepo.UpdateScheduleRun(ctx, sc.Id, now, nextRunAt, taskId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) enqueueSchedule(ctx context.Context, sc *model.Schedule, now time.Time) (*int64, error) {
+	L.Info(fmt.Sprintf("Schedule %d: checking if files are changed in %s", sc.Id, sc.InputPath))
+	inputPaths := []string{sc.InputPath}
+	ignoredPaths := map[string]bool{sc.OutputPath: true}
+	f, err := filter.New(inputPaths, sc.FilterPatterns, ignoredPaths)
+	if err != nil {
+		return nil, err
+	}
+	filesInfo, err := file_io.ComputeFilesInfo(ctx, inputPaths, f)
+	if err != nil {
+		return nil, err
+	}
+	task, err := r.TaskRepo.FindSimilarTask(ctx, inputPaths, sc.Provider, filesInfo, sc.ArchiveFormat)
+	if err == nil {
+		L.Info(fmt.Sprintf("Schedule %d: skipping because %s has not changed since task %d",
+			sc.Id, sc.InputPath, task.Id))
+		return nil, nil
+	}
+	if err != database.ErrDoesNotExist {
+		return nil, err
+	}
+	taskId, err := r.TaskRepo.CreateTask(ctx,
+		inputPaths,
+		sc.OutputPath,
+		sc.ConfigPath,
+		sc.ArchiveFormat,
+		sc.Provider,
+		now,
+		now,
+		filesInfo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(sc.FilterPatterns) > 0 {
+		err = r.TaskRepo.UpdateTaskFilterPatterns(ctx, taskId, sc.FilterPatterns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sc.Priority != 0 {
+		err = r.TaskRepo.UpdateTaskPriority(ctx, taskId, sc.Priority)
+		if err != nil {
+			return nil, err
+		}
+	}
+	L.Info(fmt.Sprintf("Schedule %d: created task %d", sc.Id, taskId))
+	return &taskId, nil
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"glesha/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestEnqueueDueSchedules(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	inputPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.txt"), []byte("hello"), 0644))
+
+	now := time.Now()
+	scheduleId, err := r.ScheduleRepo.CreateSchedule(ctx, inputPath, t.TempDir(), "/config",
+		config.PROVIDER_AWS, config.AF_TARGZ, "0 2 * * *", 7, 3, now.Add(-time.Minute))
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.EnqueueDueSchedules(ctx, now))
+	sc, err := r.ScheduleRepo.GetScheduleById(ctx, scheduleId)
+	assert.NoError(t, err)
+	assert.NotNil(t, sc.LastTaskId)
+	assert.True(t, sc.NextRunAt.After(sc.LastRunAt))
+	task, err := r.TaskRepo.GetTaskById(ctx, *sc.LastTaskId)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), task.Priority)
+	firstTaskId := task.Id
+
+	// not due again until next_run_at
+	assert.NoError(t, r.EnqueueDueSchedules(ctx, now.Add(time.Second)))
+	tasks, err := r.TaskRepo.ListTasks(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	// unchanged tree does not create a new task
+	later := now.Add(48 * time.Hour)
+	assert.NoError(t, r.EnqueueDueSchedules(ctx, later))
+	tasks, err = r.TaskRepo.ListTasks(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	sc, err = r.ScheduleRepo.GetScheduleById(ctx, scheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, firstTaskId, *sc.LastTaskId)
+
+	// changed tree creates a new task
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "b.txt"), []byte("world"), 0644))
+	assert.NoError(t, r.EnqueueDueSchedules(ctx, later.Add(48*time.Hour)))
+	tasks, err = r.TaskRepo.ListTasks(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+}
+
+func TestEnqueueDueSchedules_FilterPatterns(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	inputPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.txt"), []byte("hello"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "b.log"), []byte("world"), 0644))
+
+	now := time.Now()
+	scheduleId, err := r.ScheduleRepo.CreateSchedule(ctx, inputPath, t.TempDir(), "/config",
+		config.PROVIDER_AWS, config.AF_TARGZ, "0 2 * * *", 0, 0, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	patterns := []string{"*.log"}
+	assert.NoError(t, r.ScheduleRepo.UpdateScheduleFilterPatterns(ctx, scheduleId, patterns))
+
+	assert.NoError(t, r.EnqueueDueSchedules(ctx, now))
+	sc, err := r.ScheduleRepo.GetScheduleById(ctx, scheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, patterns, sc.FilterPatterns)
+	task, err := r.TaskRepo.GetTaskById(ctx, *sc.LastTaskId)
+	assert.NoError(t, err)
+	assert.Equal(t, patterns, task.FilterPatterns)
+	// excluded file is not counted
+	assert.Equal(t, int64(5), task.TotalSize)
+}
@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"glesha/archive"
+	"glesha/config"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/snapshot"
+	"path/filepath"
+)
+
+// takes a snapshot of the input paths of "t" if its config asks for one,
+// and makes "archiver" read files from it. returns nil without a snapshot
+func (r *Runner) takeSnapshot(
+	ctx context.Context,
+	t *model.Task,
+	cfg *config.Snapshot,
+	archiver archive.Archiver,
+) (*snapshot.Snapshot, error) {
+	if cfg == nil {
+		return nil, r.TaskRepo.UpdateTaskSnapshot(ctx, t.Id, "")
+	}
+	L.Info(fmt.Sprintf("Taking %s snapshot of input paths", cfg.Method))
+	snap, err := snapshot.Create(ctx, cfg, t.Id, t.InputPaths, filepath.Join(t.OutputPath, "snapshots"))
+	if err != nil {
+		return nil, fmt.Errorf("could not take snapshot: %w", err)
+	}
+	err = r.TaskRepo.UpdateTaskSnapshot(ctx, t.Id, snap.String())
+	if err != nil {
+		releaseSnapshot(ctx, snap)
+		return nil, err
+	}
+	archiver.SetSourcePaths(snap.Paths)
+	L.Printf("Snapshot: %s\n", snap)
+	return snap, nil
+}
+
+// releases "snap" even if "ctx" was cancelled, a snapshot left behind
+// keeps using space until it is removed
+func releaseSnapshot(ctx context.Context, snap *snapshot.Snapshot) {
+	if snap == nil {
+		return
+	}
+	err := snap.Release(context.WithoutCancel(ctx))
+	if err != nil {
+		L.Warn(fmt.Sprintf("could not release snapshot %s, it needs to be removed manually: %v", snap, err))
+		return
+	}
+	L.Debug(fmt.Sprintf("Released snapshot %s", snap))
+}
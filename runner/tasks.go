@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"glesha/config"
+	"glesha/database"
+	"glesha/file_io"
+	"glesha/filter"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// TaskSpec describes a task to add, like the arguments of 'glesha add'
+type TaskSpec struct {
+	InputPaths []string
+	OutputPath string
+	ConfigPath string
+	// empty means the archive format of the config
+	ArchiveFormat config.ArchiveFormat
+	// gitignore style patterns, after the patterns of the config
+	FilterLines []string
+	Priority    int64
+}
+
+// creates a task for "spec" unless a similar task exists for the same
+// files. returns the id of the created or the similar task, and whether
+// it was created
+func (r *Runner) AddTask(ctx context.Context, spec TaskSpec, now time.Time) (int64, bool, error) {
+	inputPaths, err := file_io.NormalizeInputPaths(spec.InputPaths)
+	if err != nil {
+		return 0, false, err
+	}
+	outputPath, err := filepath.Abs(spec.OutputPath)
+	if err != nil {
+		return 0, false, err
+	}
+	configPath, err := filepath.Abs(spec.ConfigPath)
+	if err != nil {
+		return 0, false, err
+	}
+	cfg, err := parseConfig(configPath)
+	if err != nil {
+		return 0, false, err
+	}
+	archiveFormat := cfg.ArchiveFormat
+	if len(spec.ArchiveFormat) > 0 {
+		archiveFormat = spec.ArchiveFormat
+	}
+	switch archiveFormat {
+	case config.AF_TARGZ, config.AF_REPO:
+	default:
+		return 0, false, fmt.Errorf("invalid archive format: %s", archiveFormat)
+	}
+	filterLines := append(filter.Lines(slices.Clone(cfg.Exclude), slices.Clone(cfg.Include)), spec.FilterLines...)
+	f, err := filter.New(inputPaths, filterLines, map[string]bool{outputPath: true})
+	if err != nil {
+		return 0, false, err
+	}
+	filesInfo, err := file_io.ComputeFilesInfo(ctx, inputPaths, f)
+	if err != nil {
+		return 0, false, err
+	}
+	task, err := r.TaskRepo.FindSimilarTask(ctx, inputPaths, cfg.Provider, filesInfo, archiveFormat)
+	if err == nil {
+		return task.Id, false, nil
+	}
+	if err != database.ErrDoesNotExist {
+		return 0, false, err
+	}
+	taskId, err := r.TaskRepo.CreateTask(ctx,
+		inputPaths,
+		outputPath,
+		configPath,
+		archiveFormat,
+		cfg.Provider,
+		now,
+		now,
+		filesInfo,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(filterLines) > 0 {
+		err = r.TaskRepo.UpdateTaskFilterPatterns(ctx, taskId, filterLines)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	if spec.Priority != 0 {
+		err = r.TaskRepo.UpdateTaskPriority(ctx, taskId, spec.Priority)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	return taskId, true, nil
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"context"
+	"glesha/archive"
+	"glesha/config"
+	"glesha/database"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestAddAndDeleteTask(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	ctx := context.Background()
+	r := setupTestRunner(t)
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "docs")
+	assert.NoError(t, os.MkdirAll(inputPath, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.txt"), []byte("hello"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputPath, "a.log"), []byte("debug"), 0644))
+	configPath := filepath.Join(tempDir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{
+		"archive_format": "targz",
+		"provider": "aws",
+		"exclude": ["*.log"]
+	}`), 0644))
+	spec := TaskSpec{
+		InputPaths:  []string{inputPath},
+		OutputPath:  filepath.Join(tempDir, "out"),
+		ConfigPath:  configPath,
+		FilterLines: []string{"!keep.log"},
+		Priority:    3,
+	}
+
+	taskId, created, err := r.AddTask(ctx, spec, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, created)
+	task, err := r.TaskRepo.GetTaskById(ctx, taskId)
+	assert.NoError(t, err)
+	assert.Equal(t, config.AF_TARGZ, task.ArchiveFormat)
+	assert.Equal(t, []string{"*.log", "!keep.log"}, task.FilterPatterns)
+	assert.Equal(t, int64(3), task.Priority)
+	// the excluded file is not counted
+	assert.Equal(t, int64(5), task.TotalSize)
+
+	t.Run("SimilarTask", func(t *testing.T) {
+		similarId, created, err := r.AddTask(ctx, spec, time.Now())
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, taskId, similarId)
+
+		repoSpec := spec
+		repoSpec.ArchiveFormat = config.AF_REPO
+		repoId, created, err := r.AddTask(ctx, repoSpec, time.Now())
+		assert.NoError(t, err)
+		assert.True(t, created)
+		assert.NotEqual(t, taskId, repoId)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		archivePath := archive.ArchiveFilePath(task)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(archivePath), 0755))
+		assert.NoError(t, os.WriteFile(archivePath, []byte("archive"), 0644))
+
+		assert.NoError(t, r.DeleteTask(ctx, taskId, time.Now()))
+		_, err := r.TaskRepo.GetTaskById(ctx, taskId)
+		assert.ErrorIs(t, err, database.ErrDoesNotExist)
+		assert.NoFileExists(t, archivePath)
+	})
+}
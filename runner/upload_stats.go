@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"glesha/database/model"
+	"sort"
+	"time"
+)
+
+// WorkerStats describes an upload worker, computed from the blocks it
+// uploaded, so it works for uploads run by other glesha processes
+type WorkerStats struct {
+	WorkerId int64
+	// block being uploaded, 0 if the worker is idle
+	CurrentBlockId  int64
+	CompletedBlocks int
+	// bytes per second while uploading blocks completed in the window
+	Rate float64
+}
+
+// UploadStats summarizes the blocks of an upload
+type UploadStats struct {
+	Queued    int
+	Running   int
+	Completed int
+	Failed    int
+	// size of completed blocks
+	CompletedBytes int64
+	// sorted by worker id
+	Workers []WorkerStats
+	// blocks that failed at least once, most recently failed first
+	Errors []model.UploadBlock
+}
+
+// blocks are claimed in batches before a worker starts them, only blocks
+// started by a worker count as running
+func IsBlockRunning(b *model.UploadBlock) bool {
+	return b.Status == model.UB_STATUS_RUNNING && b.StartedAt != nil
+}
+
+// computes stats of "blocks", worker rates only count blocks completed
+// within "window" before "now"
+func GetUploadStats(blocks []model.UploadBlock, now time.Time, window time.Duration) *UploadStats {
+	stats := &UploadStats{}
+	workers := make(map[int64]*WorkerStats)
+	busy := make(map[int64]time.Duration)
+	sent := make(map[int64]int64)
+	worker := func(id int64) *WorkerStats {
+		w, ok := workers[id]
+		if !ok {
+			w = &WorkerStats{WorkerId: id}
+			workers[id] = w
+		}
+		return w
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		switch {
+		case b.Status == model.UB_STATUS_COMPLETE:
+			stats.Completed++
+			stats.CompletedBytes += b.Size
+		case b.Status == model.UB_STATUS_ERROR:
+			stats.Failed++
+		case IsBlockRunning(b):
+			stats.Running++
+		default:
+			stats.Queued++
+		}
+		if b.ErrorCount > 0 {
+			stats.Errors = append(stats.Errors, *b)
+		}
+		if b.WorkerId <= 0 {
+			continue
+		}
+		w := worker(b.WorkerId)
+		if IsBlockRunning(b) {
+			w.CurrentBlockId = b.Id
+		}
+		if b.Status != model.UB_STATUS_COMPLETE {
+			continue
+		}
+		w.CompletedBlocks++
+		if b.UploadedAt == nil || b.StartedAt == nil || now.Sub(*b.UploadedAt) > window {
+			continue
+		}
+		// times are stored with a precision of a second
+		busy[b.WorkerId] += max(b.UploadedAt.Sub(*b.StartedAt), time.Second)
+		sent[b.WorkerId] += b.Size
+	}
+	for id, w := range workers {
+		if busy[id] > 0 {
+			w.Rate = float64(sent[id]) / busy[id].Seconds()
+		}
+		stats.Workers = append(stats.Workers, *w)
+	}
+	sort.Slice(stats.Workers, func(i, j int) bool {
+		return stats.Workers[i].WorkerId < stats.Workers[j].WorkerId
+	})
+	sort.SliceStable(stats.Errors, func(i, j int) bool {
+		return stats.Errors[i].UpdatedAt.After(stats.Errors[j].UpdatedAt)
+	})
+	return stats
+}
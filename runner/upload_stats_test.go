@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"glesha/database/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUploadStats(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+	blocks := []model.UploadBlock{
+		// worker 1 sent 20MB in 4s within the window
+		{Id: 1, Size: 10 << 20, Status: model.UB_STATUS_COMPLETE, WorkerId: 1,
+			StartedAt: at(-10 * time.Second), UploadedAt: at(-8 * time.Second)},
+		{Id: 2, Size: 10 << 20, Status: model.UB_STATUS_COMPLETE, WorkerId: 1,
+			StartedAt: at(-6 * time.Second), UploadedAt: at(-4 * time.Second)},
+		// too old to count for the rate
+		{Id: 3, Size: 10 << 20, Status: model.UB_STATUS_COMPLETE, WorkerId: 2,
+			StartedAt: at(-10 * time.Minute), UploadedAt: at(-9 * time.Minute)},
+		{Id: 4, Size: 10 << 20, Status: model.UB_STATUS_RUNNING, WorkerId: 2, StartedAt: at(-time.Second)},
+		// claimed, not started yet
+		{Id: 5, Size: 10 << 20, Status: model.UB_STATUS_RUNNING},
+		{Id: 6, Size: 10 << 20, Status: model.UB_STATUS_ERROR, WorkerId: 1, StartedAt: at(-3 * time.Second),
+			ErrorCount: 2, ErrorMessage: "timeout", UpdatedAt: now.Add(-2 * time.Second)},
+		{Id: 7, Size: 10 << 20, Status: model.UB_STATUS_COMPLETE, WorkerId: 2,
+			StartedAt: at(-20 * time.Second), UploadedAt: at(-15 * time.Second),
+			ErrorCount: 1, ErrorMessage: "reset", UpdatedAt: now.Add(-30 * time.Second)},
+		{Id: 8, Size: 10 << 20, Status: model.UB_STATUS_QUEUED},
+	}
+
+	stats := GetUploadStats(blocks, now, time.Minute)
+	assert.Equal(t, 2, stats.Queued)
+	assert.Equal(t, 1, stats.Running)
+	assert.Equal(t, 4, stats.Completed)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, int64(40<<20), stats.CompletedBytes)
+
+	assert.Len(t, stats.Workers, 2)
+	assert.Equal(t, int64(1), stats.Workers[0].WorkerId)
+	assert.Equal(t, int64(0), stats.Workers[0].CurrentBlockId)
+	assert.Equal(t, 2, stats.Workers[0].CompletedBlocks)
+	assert.InDelta(t, float64(5<<20), stats.Workers[0].Rate, 1)
+	assert.Equal(t, int64(4), stats.Workers[1].CurrentBlockId)
+	assert.Equal(t, 2, stats.Workers[1].CompletedBlocks)
+	assert.InDelta(t, float64(2<<20), stats.Workers[1].Rate, 1)
+
+	assert.Len(t, stats.Errors, 2)
+	assert.Equal(t, int64(6), stats.Errors[0].Id)
+	assert.Equal(t, int64(7), stats.Errors[1].Id)
+}
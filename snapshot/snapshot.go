@@ -0,0 +1,227 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"glesha/config"
+	L "glesha/logger"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Snapshot is a point in time view of the input paths of a task, files are
+// archived from it so files written while archiving stay consistent
+type Snapshot struct {
+	Method string
+	// maps each input path to the path it is read from
+	Paths map[string]string
+	// what was snapshotted, recorded in the task
+	names []string
+	// undo steps, run in reverse order by Release
+	cleanups []func(ctx context.Context) error
+}
+
+// runs command "name" and returns its stdout, replaced in tests
+var run = func(ctx context.Context, env []string, name string, args ...string) (string, error) {
+	L.Debug(fmt.Sprintf("snapshot: running %s %s", name, strings.Join(args, " ")))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %w: %s",
+			name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// takes a snapshot of "inputPaths" for task "taskId" using "cfg". mount
+// points and copies are created under "workDir". snapshots left behind by
+// an earlier run of the same task are removed first
+func Create(
+	ctx context.Context,
+	cfg *config.Snapshot,
+	taskId int64,
+	inputPaths []string,
+	workDir string,
+) (*Snapshot, error) {
+	s := &Snapshot{Method: cfg.Method, Paths: make(map[string]string, len(inputPaths))}
+	var err error
+	switch cfg.Method {
+	case config.SNAPSHOT_BTRFS:
+		err = s.snapshotVolumes(ctx, inputPaths, btrfsVolume, func(ctx context.Context, v volume, n int) (string, error) {
+			return s.takeBtrfs(ctx, v, taskId, n)
+		})
+	case config.SNAPSHOT_ZFS:
+		err = s.snapshotVolumes(ctx, inputPaths, zfsVolume, func(ctx context.Context, v volume, n int) (string, error) {
+			return s.takeZfs(ctx, v, taskId)
+		})
+	case config.SNAPSHOT_LVM:
+		err = s.snapshotVolumes(ctx, inputPaths, lvmVolume, func(ctx context.Context, v volume, n int) (string, error) {
+			return s.takeLvm(ctx, v, cfg.LvmSize, taskId, n, workDir)
+		})
+	case config.SNAPSHOT_REFLINK:
+		err = s.copyReflink(ctx, inputPaths, taskId, workDir)
+	case config.SNAPSHOT_COMMAND:
+		err = s.runCommand(ctx, cfg, taskId, inputPaths)
+	default:
+		err = fmt.Errorf("unsupported snapshot method: %s", cfg.Method)
+	}
+	if err != nil {
+		// undo the parts that were already created
+		releaseErr := s.Release(context.WithoutCancel(ctx))
+		if releaseErr != nil {
+			L.Warn(fmt.Sprintf("snapshot: could not clean up after failed snapshot: %v", releaseErr))
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// removes the snapshot, it is safe to call more than once
+func (s *Snapshot) Release(ctx context.Context) error {
+	var errs []error
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		err := s.cleanups[i](ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.cleanups = nil
+	return errors.Join(errs...)
+}
+
+func (s *Snapshot) String() string {
+	if len(s.names) == 0 {
+		return s.Method
+	}
+	return fmt.Sprintf("%s %s", s.Method, strings.Join(s.names, ", "))
+}
+
+// a filesystem or volume snapshots are taken of
+type volume struct {
+	// where the volume is mounted
+	root string
+	// name of the volume for the snapshot tool, e.g. zfs dataset
+	name string
+	// filesystem type, only known for lvm
+	fsType string
+}
+
+// snapshots each volume the input paths are on once, "take" returns where
+// the root of the volume is found in its snapshot
+func (s *Snapshot) snapshotVolumes(
+	ctx context.Context,
+	inputPaths []string,
+	volumeOf func(ctx context.Context, path string) (volume, error),
+	take func(ctx context.Context, v volume, n int) (string, error),
+) error {
+	taken := make(map[string]string)
+	for _, inputPath := range inputPaths {
+		v, err := volumeOf(ctx, inputPath)
+		if err != nil {
+			return err
+		}
+		snapRoot, ok := taken[v.root]
+		if !ok {
+			snapRoot, err = take(ctx, v, len(taken))
+			if err != nil {
+				return err
+			}
+			taken[v.root] = snapRoot
+		}
+		rel, err := filepath.Rel(v.root, inputPath)
+		if err != nil {
+			return err
+		}
+		s.Paths[inputPath] = filepath.Join(snapRoot, rel)
+	}
+	return nil
+}
+
+// copies each input path with "cp --reflink=always", which only shares
+// blocks with the original and fails instead of making a full copy
+func (s *Snapshot) copyReflink(ctx context.Context, inputPaths []string, taskId int64, workDir string) error {
+	snapDir := filepath.Join(workDir, fmt.Sprintf("glesha-%d", taskId))
+	// cp would copy the snapshot into itself until the disk is full
+	for _, inputPath := range inputPaths {
+		if isInside(inputPath, snapDir) {
+			return fmt.Errorf("cannot take a reflink snapshot of %s into %s inside it, move output_path out of the input paths",
+				inputPath, snapDir)
+		}
+	}
+	err := os.RemoveAll(snapDir)
+	if err != nil {
+		return fmt.Errorf("could not remove stale snapshot %s: %w", snapDir, err)
+	}
+	s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+		return os.RemoveAll(snapDir)
+	})
+	s.names = append(s.names, snapDir)
+	for i, inputPath := range inputPaths {
+		// input paths may share a base name
+		dest := filepath.Join(snapDir, strconv.Itoa(i), filepath.Base(inputPath))
+		err = os.MkdirAll(filepath.Dir(dest), 0700)
+		if err != nil {
+			return fmt.Errorf("could not create snapshot dir: %w", err)
+		}
+		_, err = run(ctx, nil, "cp", "-a", "--reflink=always", inputPath, dest)
+		if err != nil {
+			return fmt.Errorf("could not copy %s with reflinks: %w", inputPath, err)
+		}
+		s.Paths[inputPath] = dest
+	}
+	return nil
+}
+
+// runs the pre command of "cfg", which may print one path per input path
+// to archive from instead. the post command runs on release, even if the
+// pre command failed, so e.g. a frozen filesystem is always thawed
+func (s *Snapshot) runCommand(ctx context.Context, cfg *config.Snapshot, taskId int64, inputPaths []string) error {
+	env := []string{
+		fmt.Sprintf("GLESHA_TASK_ID=%d", taskId),
+		"GLESHA_INPUT_PATHS=" + strings.Join(inputPaths, "\n"),
+	}
+	if len(cfg.PostCommand) > 0 {
+		s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+			_, err := run(ctx, env, "sh", "-c", cfg.PostCommand)
+			return err
+		})
+	}
+	out, err := run(ctx, env, "sh", "-c", cfg.PreCommand)
+	if err != nil {
+		return fmt.Errorf("snapshot pre_command failed: %w", err)
+	}
+	var paths []string
+	for line := range strings.Lines(out) {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			paths = append(paths, line)
+		}
+	}
+	if len(paths) == 0 {
+		for _, inputPath := range inputPaths {
+			s.Paths[inputPath] = inputPath
+		}
+		return nil
+	}
+	if len(paths) != len(inputPaths) {
+		return fmt.Errorf("snapshot pre_command printed %d paths, expected one for each of the %d input paths",
+			len(paths), len(inputPaths))
+	}
+	for i, inputPath := range inputPaths {
+		if !filepath.IsAbs(paths[i]) {
+			return fmt.Errorf("snapshot pre_command printed a relative path: %s", paths[i])
+		}
+		s.Paths[inputPath] = filepath.Clean(paths[i])
+	}
+	s.names = paths
+	return nil
+}
@@ -0,0 +1,137 @@
+package snapshot
+
+import (
+	"context"
+	"glesha/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replaces external commands with "fake" for the duration of the test,
+// and returns the commands that were run
+func fakeRun(t *testing.T, fake func(cmd string) (string, error)) *[]string {
+	var cmds []string
+	original := run
+	run = func(ctx context.Context, env []string, name string, args ...string) (string, error) {
+		cmd := strings.Join(append([]string{name}, args...), " ")
+		cmds = append(cmds, cmd)
+		return fake(cmd)
+	}
+	t.Cleanup(func() { run = original })
+	return &cmds
+}
+
+func TestCreate_Zfs(t *testing.T) {
+	cmds := fakeRun(t, func(cmd string) (string, error) {
+		if strings.HasPrefix(cmd, "zfs list") {
+			return "tank\t/tank\ntank/home\t/tank/home\ntank/vol\tnone\n", nil
+		}
+		return "", nil
+	})
+	cfg := &config.Snapshot{Method: config.SNAPSHOT_ZFS}
+	snap, err := Create(context.Background(), cfg, 7, []string{"/tank/home/docs", "/tank/home/photos", "/tank/media"}, t.TempDir())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/tank/home/docs":   "/tank/home/.zfs/snapshot/glesha-7/docs",
+		"/tank/home/photos": "/tank/home/.zfs/snapshot/glesha-7/photos",
+		"/tank/media":       "/tank/.zfs/snapshot/glesha-7/media",
+	}, snap.Paths)
+	assert.Equal(t, "zfs tank/home@glesha-7, tank@glesha-7", snap.String())
+
+	*cmds = nil
+	assert.NoError(t, snap.Release(context.Background()))
+	assert.Equal(t, []string{"zfs destroy tank@glesha-7", "zfs destroy tank/home@glesha-7"}, *cmds)
+	// releasing twice does nothing
+	*cmds = nil
+	assert.NoError(t, snap.Release(context.Background()))
+	assert.Empty(t, *cmds)
+}
+
+func TestCreate_LvmCleansUpOnFailure(t *testing.T) {
+	cmds := fakeRun(t, func(cmd string) (string, error) {
+		switch {
+		case strings.HasPrefix(cmd, "findmnt"):
+			return "/dev/mapper/vg-data /srv\\x20data xfs\n", nil
+		case strings.HasPrefix(cmd, "lvs"):
+			return "  vg data\n", nil
+		case strings.HasPrefix(cmd, "mount"):
+			return "", assert.AnError
+		}
+		return "", nil
+	})
+	workDir := t.TempDir()
+	cfg := &config.Snapshot{Method: config.SNAPSHOT_LVM, LvmSize: "1G"}
+	_, err := Create(context.Background(), cfg, 3, []string{"/srv data/www"}, workDir)
+	assert.Error(t, err)
+	mountDir := filepath.Join(workDir, "glesha-3-0")
+	assert.Equal(t, []string{
+		"findmnt -n -r -o SOURCE,TARGET,FSTYPE -T /srv data/www",
+		"lvs --noheadings -o vg_name,lv_name /dev/mapper/vg-data",
+		"umount " + mountDir,
+		"lvremove -f vg/glesha-3-0",
+		"lvcreate --snapshot --size 1G --name glesha-3-0 vg/data",
+		"mount -o ro,nouuid /dev/vg/glesha-3-0 " + mountDir,
+		// the volume created before mounting failed is removed
+		"lvremove -f vg/glesha-3-0",
+	}, *cmds)
+}
+
+func TestCreate_Command(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input")
+	marker := filepath.Join(tempDir, "released")
+	cfg := &config.Snapshot{
+		Method:      config.SNAPSHOT_COMMAND,
+		PreCommand:  `test "$GLESHA_TASK_ID" = 5 && echo "$GLESHA_INPUT_PATHS.snap"`,
+		PostCommand: `touch "` + marker + `"`,
+	}
+	snap, err := Create(context.Background(), cfg, 5, []string{inputPath}, tempDir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{inputPath: inputPath + ".snap"}, snap.Paths)
+	assert.NoFileExists(t, marker)
+	assert.NoError(t, snap.Release(context.Background()))
+	assert.FileExists(t, marker)
+
+	// without output, input paths are archived as they are
+	cfg.PreCommand = "true"
+	snap, err = Create(context.Background(), cfg, 5, []string{inputPath}, tempDir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{inputPath: inputPath}, snap.Paths)
+
+	// the post command runs even if the pre command fails
+	assert.NoError(t, os.Remove(marker))
+	cfg.PreCommand = "exit 1"
+	_, err = Create(context.Background(), cfg, 5, []string{inputPath}, tempDir)
+	assert.Error(t, err)
+	assert.FileExists(t, marker)
+}
+
+func TestCreate_ReflinkRejectsNestedWorkDir(t *testing.T) {
+	cmds := fakeRun(t, func(cmd string) (string, error) {
+		return "", nil
+	})
+	inputPath := t.TempDir()
+	cfg := &config.Snapshot{Method: config.SNAPSHOT_REFLINK}
+	_, err := Create(context.Background(), cfg, 4, []string{"/other", inputPath}, filepath.Join(inputPath, "out", "snapshots"))
+	assert.ErrorContains(t, err, "move output_path out of the input paths")
+	assert.Empty(t, *cmds)
+	assert.NoDirExists(t, filepath.Join(inputPath, "out"))
+
+	workDir := t.TempDir()
+	snap, err := Create(context.Background(), cfg, 4, []string{inputPath}, workDir)
+	assert.NoError(t, err)
+	dest := filepath.Join(workDir, "glesha-4", "0", filepath.Base(inputPath))
+	assert.Equal(t, map[string]string{inputPath: dest}, snap.Paths)
+	assert.Equal(t, []string{"cp -a --reflink=always " + inputPath + " " + dest}, *cmds)
+	assert.NoError(t, snap.Release(context.Background()))
+	assert.NoDirExists(t, filepath.Join(workDir, "glesha-4"))
+}
+
+func TestUnescapeFindmnt(t *testing.T) {
+	assert.Equal(t, "/mnt/my disk", unescapeFindmnt(`/mnt/my\x20disk`))
+	assert.Equal(t, `/mnt/a\x`, unescapeFindmnt(`/mnt/a\x`))
+}
@@ -0,0 +1,205 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"glesha/file_io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inode number of the root directory of every btrfs subvolume
+const BTRFS_SUBVOLUME_INODE uint64 = 256
+
+// returns the subvolume "path" is on
+func btrfsVolume(ctx context.Context, path string) (volume, error) {
+	dir := path
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return volume{}, err
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		info, err = os.Stat(dir)
+		if err != nil {
+			return volume{}, err
+		}
+		if file_io.GetFileMetadata(info).Ino == BTRFS_SUBVOLUME_INODE {
+			// other filesystems can have a directory with the same inode
+			_, err = run(ctx, nil, "btrfs", "subvolume", "show", dir)
+			if err == nil {
+				return volume{root: dir, name: dir}, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return volume{}, fmt.Errorf("%s is not on a btrfs subvolume", path)
+		}
+		dir = parent
+	}
+}
+
+// takes a read only snapshot inside the subvolume, so it is on the same filesystem
+func (s *Snapshot) takeBtrfs(ctx context.Context, v volume, taskId int64, n int) (string, error) {
+	dest := filepath.Join(v.root, fmt.Sprintf(".glesha-snapshot-%d-%d", taskId, n))
+	if _, err := os.Lstat(dest); err == nil {
+		_, err = run(ctx, nil, "btrfs", "subvolume", "delete", dest)
+		if err != nil {
+			return "", fmt.Errorf("could not remove stale snapshot %s: %w", dest, err)
+		}
+	}
+	_, err := run(ctx, nil, "btrfs", "subvolume", "snapshot", "-r", v.root, dest)
+	if err != nil {
+		return "", fmt.Errorf("could not snapshot %s: %w", v.root, err)
+	}
+	s.names = append(s.names, dest)
+	s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+		_, err := run(ctx, nil, "btrfs", "subvolume", "delete", dest)
+		return err
+	})
+	return dest, nil
+}
+
+// returns the mounted dataset with the longest mountpoint containing "path"
+func zfsVolume(ctx context.Context, path string) (volume, error) {
+	out, err := run(ctx, nil, "zfs", "list", "-H", "-t", "filesystem", "-o", "name,mountpoint")
+	if err != nil {
+		return volume{}, fmt.Errorf("could not list zfs datasets: %w", err)
+	}
+	var best volume
+	for line := range strings.Lines(out) {
+		name, mountpoint, ok := strings.Cut(strings.TrimRight(line, "\n"), "\t")
+		if !ok || !filepath.IsAbs(mountpoint) {
+			// "none", "legacy" and "-" are not mounted by zfs
+			continue
+		}
+		if !isInside(mountpoint, path) || len(mountpoint) <= len(best.root) {
+			continue
+		}
+		best = volume{root: mountpoint, name: name}
+	}
+	if len(best.root) == 0 {
+		return volume{}, fmt.Errorf("%s is not on a mounted zfs dataset", path)
+	}
+	return best, nil
+}
+
+// snapshots are reachable through the hidden .zfs directory of the dataset
+func (s *Snapshot) takeZfs(ctx context.Context, v volume, taskId int64) (string, error) {
+	snapName := fmt.Sprintf("glesha-%d", taskId)
+	fullName := v.name + "@" + snapName
+	// a stale snapshot may not exist, so errors are ignored
+	_, _ = run(ctx, nil, "zfs", "destroy", fullName)
+	_, err := run(ctx, nil, "zfs", "snapshot", fullName)
+	if err != nil {
+		return "", fmt.Errorf("could not snapshot %s: %w", v.name, err)
+	}
+	s.names = append(s.names, fullName)
+	s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+		_, err := run(ctx, nil, "zfs", "destroy", fullName)
+		return err
+	})
+	return filepath.Join(v.root, ".zfs", "snapshot", snapName), nil
+}
+
+// returns the logical volume mounted at the mountpoint containing "path"
+func lvmVolume(ctx context.Context, path string) (volume, error) {
+	out, err := run(ctx, nil, "findmnt", "-n", "-r", "-o", "SOURCE,TARGET,FSTYPE", "-T", path)
+	if err != nil {
+		return volume{}, fmt.Errorf("could not find mountpoint of %s: %w", path, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 3 {
+		return volume{}, fmt.Errorf("unexpected findmnt output for %s: %s", path, out)
+	}
+	source := unescapeFindmnt(fields[0])
+	out, err = run(ctx, nil, "lvs", "--noheadings", "-o", "vg_name,lv_name", source)
+	if err != nil {
+		return volume{}, fmt.Errorf("%s is not on an lvm logical volume: %w", path, err)
+	}
+	names := strings.Fields(out)
+	if len(names) != 2 {
+		return volume{}, fmt.Errorf("unexpected lvs output for %s: %s", source, out)
+	}
+	return volume{
+		root:   unescapeFindmnt(fields[1]),
+		name:   names[0] + "/" + names[1],
+		fsType: fields[2],
+	}, nil
+}
+
+// creates a snapshot volume of "size" and mounts it read only in "workDir"
+func (s *Snapshot) takeLvm(
+	ctx context.Context,
+	v volume,
+	size string,
+	taskId int64,
+	n int,
+	workDir string,
+) (string, error) {
+	vg, _, _ := strings.Cut(v.name, "/")
+	snapName := fmt.Sprintf("glesha-%d-%d", taskId, n)
+	snapVolume := vg + "/" + snapName
+	mountDir := filepath.Join(workDir, snapName)
+	// stale mounts and volumes may not exist, so errors are ignored
+	_, _ = run(ctx, nil, "umount", mountDir)
+	_, _ = run(ctx, nil, "lvremove", "-f", snapVolume)
+
+	_, err := run(ctx, nil, "lvcreate", "--snapshot", "--size", size, "--name", snapName, v.name)
+	if err != nil {
+		return "", fmt.Errorf("could not snapshot %s: %w", v.name, err)
+	}
+	s.names = append(s.names, snapVolume)
+	s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+		_, err := run(ctx, nil, "lvremove", "-f", snapVolume)
+		return err
+	})
+
+	err = os.MkdirAll(mountDir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("could not create mountpoint for snapshot: %w", err)
+	}
+	options := "ro"
+	if v.fsType == "xfs" {
+		// the snapshot has the same uuid as the mounted original
+		options += ",nouuid"
+	}
+	_, err = run(ctx, nil, "mount", "-o", options, "/dev/"+snapVolume, mountDir)
+	if err != nil {
+		return "", fmt.Errorf("could not mount snapshot %s: %w", snapVolume, err)
+	}
+	s.cleanups = append(s.cleanups, func(ctx context.Context) error {
+		_, err := run(ctx, nil, "umount", mountDir)
+		if err != nil {
+			return err
+		}
+		return os.Remove(mountDir)
+	})
+	return mountDir, nil
+}
+
+// findmnt -r escapes spaces and other special characters as \xNN
+func unescapeFindmnt(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			var c byte
+			_, err := fmt.Sscanf(s[i+2:i+4], "%02x", &c)
+			if err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isInside(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
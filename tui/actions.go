@@ -0,0 +1,161 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"glesha/backend"
+	"glesha/control"
+	"glesha/database/model"
+	"glesha/runner"
+	"glesha/tui/components"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tasks run by the tui upload with as many workers as 'glesha run'
+var tuiUploadOptions = backend.UploadOptions{Jobs: 1}
+
+// how often progress of tasks run by the tui is refreshed
+const PROGRESS_INTERVAL = 250 * time.Millisecond
+
+type progressTickMsg struct{}
+
+func progressTick() tea.Cmd {
+	return tea.Tick(PROGRESS_INTERVAL, func(t time.Time) tea.Msg {
+		return progressTickMsg{}
+	})
+}
+
+// sent when a task run by the tui returns
+type taskDoneMsg struct {
+	taskId int64
+	err    error
+}
+
+// result of an action, shown in the footer
+type noticeMsg struct {
+	text string
+	err  error
+}
+
+type taskAddedMsg struct {
+	taskId  int64
+	created bool
+	err     error
+}
+
+// asks for confirmation before running "onYes"
+type confirmation struct {
+	prompt string
+	onYes  tea.Cmd
+}
+
+func (m *modelTui) selectedTask() *components.TaskInfo {
+	for i := range m.tasks {
+		if m.tasks[i].Task.Id == m.selectedTaskId {
+			return &m.tasks[i]
+		}
+	}
+	return nil
+}
+
+// runs task "taskId" in the background until it is uploaded or aborted
+func (m *modelTui) runTask(taskId int64) tea.Cmd {
+	if m.localRuns[taskId] {
+		return notice(fmt.Sprintf("task #%d is already running", taskId), nil)
+	}
+	m.localRuns[taskId] = true
+	m.runs.Add(1)
+	r, ctx, runs := m.runner, m.runCtx, m.runs
+	run := func() tea.Msg {
+		defer runs.Done()
+		return taskDoneMsg{taskId: taskId, err: r.RunTask(ctx, taskId, tuiUploadOptions)}
+	}
+	cmds := []tea.Cmd{run, notice(fmt.Sprintf("Running task #%d", taskId), nil)}
+	if !m.progressTicking {
+		m.progressTicking = true
+		cmds = append(cmds, progressTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// pauses a running task, or resumes it if it is paused. works for tasks
+// run by other glesha processes as well
+func (m *modelTui) togglePause(info *components.TaskInfo) tea.Cmd {
+	ctx, taskId := m.ctx, info.Task.Id
+	action := control.ACTION_PAUSE
+	switch info.Task.Status {
+	case model.TASK_STATUS_ARCHIVE_PAUSED, model.TASK_STATUS_UPLOAD_PAUSED:
+		action = control.ACTION_RESUME
+	}
+	if info.Progress != nil {
+		action = control.ACTION_PAUSE
+		if info.Progress.Paused {
+			action = control.ACTION_RESUME
+		}
+	}
+	return func() tea.Msg {
+		res, err := control.Send(ctx, taskId, action)
+		if errors.Is(err, control.ErrNotRunning) {
+			return noticeMsg{err: fmt.Errorf("task #%d is not running, press r to run it", taskId)}
+		}
+		if err != nil {
+			return noticeMsg{err: err}
+		}
+		if res.Paused {
+			return noticeMsg{text: fmt.Sprintf("Paused %s of task #%d", res.Phase, taskId)}
+		}
+		return noticeMsg{text: fmt.Sprintf("Resumed %s of task #%d", res.Phase, taskId)}
+	}
+}
+
+func (m *modelTui) abortTask(taskId int64) tea.Cmd {
+	ctx := m.ctx
+	return func() tea.Msg {
+		_, err := control.Send(ctx, taskId, control.ACTION_ABORT)
+		if errors.Is(err, control.ErrNotRunning) {
+			return noticeMsg{err: fmt.Errorf("task #%d is not running", taskId)}
+		}
+		if err != nil {
+			return noticeMsg{err: err}
+		}
+		return noticeMsg{text: fmt.Sprintf("Aborting task #%d", taskId)}
+	}
+}
+
+func (m *modelTui) deleteTask(taskId int64) tea.Cmd {
+	ctx, r := m.ctx, m.runner
+	return func() tea.Msg {
+		err := r.DeleteTask(ctx, taskId, time.Now())
+		if err != nil {
+			return noticeMsg{err: err}
+		}
+		return noticeMsg{text: fmt.Sprintf("Deleted task #%d", taskId)}
+	}
+}
+
+func (m *modelTui) addTask(spec runner.TaskSpec) tea.Cmd {
+	ctx, r := m.ctx, m.runner
+	return func() tea.Msg {
+		taskId, created, err := r.AddTask(ctx, spec, time.Now())
+		return taskAddedMsg{taskId: taskId, created: created, err: err}
+	}
+}
+
+// attaches progress of tasks run by the tui to "m.tasks"
+func (m *modelTui) updateProgress() {
+	for i := range m.tasks {
+		m.tasks[i].Progress = nil
+		p, ok := m.runner.GetTaskProgress(m.ctx, m.tasks[i].Task.Id)
+		if ok {
+			m.tasks[i].Progress = &p
+		}
+	}
+}
+
+func notice(text string, err error) tea.Cmd {
+	return func() tea.Msg {
+		return noticeMsg{text: text, err: err}
+	}
+}
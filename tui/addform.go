@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"glesha/config"
+	"glesha/file_io"
+	"glesha/runner"
+	"glesha/tui/components"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	fieldInputPath = iota
+	fieldOutputPath
+	fieldConfigPath
+	fieldArchiveFormat
+	fieldCount
+)
+
+// an empty archive format uses the one in the config
+var archiveFormatChoices = []config.ArchiveFormat{"", config.AF_TARGZ, config.AF_REPO}
+
+// addForm collects the arguments of 'glesha add'
+type addForm struct {
+	// values of fields other than the input path
+	values    [fieldCount]string
+	inputPath *pathPicker
+	focused   int
+	errMsg    string
+	busy      bool
+}
+
+func newAddForm() *addForm {
+	f := &addForm{}
+	inputPath := ""
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		inputPath = homeDir + string(filepath.Separator)
+	}
+	f.inputPath = newPathPicker(inputPath, false)
+	workDir, err := file_io.GetGlobalWorkDir()
+	if err == nil {
+		f.values[fieldOutputPath] = workDir
+	}
+	configPath, err := config.GetDefaultConfigPath()
+	if err == nil {
+		f.values[fieldConfigPath] = configPath
+	}
+	return f
+}
+
+func (f *addForm) spec() runner.TaskSpec {
+	return runner.TaskSpec{
+		InputPaths:    []string{expandHome(f.inputPath.value)},
+		OutputPath:    expandHome(f.values[fieldOutputPath]),
+		ConfigPath:    expandHome(f.values[fieldConfigPath]),
+		ArchiveFormat: config.ArchiveFormat(f.values[fieldArchiveFormat]),
+	}
+}
+
+// handles a key, returns true when the form should be submitted
+func (f *addForm) handleKey(msg tea.KeyMsg) bool {
+	f.errMsg = ""
+	switch msg.String() {
+	case "enter":
+		return true
+	case "tab":
+		f.focused = (f.focused + 1) % fieldCount
+		return false
+	case "shift+tab":
+		f.focused = (f.focused + fieldCount - 1) % fieldCount
+		return false
+	}
+	switch f.focused {
+	case fieldInputPath:
+		f.inputPath.handleKey(msg)
+	case fieldArchiveFormat:
+		switch {
+		case msg.String() == "right" || msg.Type == tea.KeySpace:
+			f.cycleArchiveFormat(1)
+		case msg.String() == "left":
+			f.cycleArchiveFormat(-1)
+		}
+	default:
+		editText(&f.values[f.focused], msg)
+	}
+	return false
+}
+
+func (f *addForm) cycleArchiveFormat(delta int) {
+	i := 0
+	for j, af := range archiveFormatChoices {
+		if string(af) == f.values[fieldArchiveFormat] {
+			i = j
+		}
+	}
+	i = (i + delta + len(archiveFormatChoices)) % len(archiveFormatChoices)
+	f.values[fieldArchiveFormat] = string(archiveFormatChoices[i])
+}
+
+func (f *addForm) render(width int, height int) string {
+	fields := []components.FormField{
+		{Label: "Input path", Value: f.inputPath.value},
+		{Label: "Output path", Value: f.values[fieldOutputPath]},
+		{Label: "Config", Value: f.values[fieldConfigPath]},
+		{Label: "Archive format", Value: f.values[fieldArchiveFormat], Placeholder: "from config"},
+	}
+	return components.RenderAddForm(fields, f.focused, f.inputPath.entries, f.inputPath.cursor, f.errMsg, f.busy, width, height)
+}
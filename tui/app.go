@@ -2,12 +2,18 @@ package tui
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"glesha/config"
 	"glesha/database"
 	"glesha/database/model"
 	"glesha/database/repository"
 	L "glesha/logger"
+	"glesha/runner"
 	"glesha/tui/components"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -25,6 +31,7 @@ type tabId int
 const (
 	tabStatus tabId = iota
 	tabFiles
+	tabUpload
 )
 
 type tickMsg struct{}
@@ -36,13 +43,40 @@ func tick() tea.Cmd {
 }
 
 type modelTui struct {
-	ctx            context.Context
-	db             *database.DB
-	taskRepo       repository.TaskRepository
-	uploadRepo     repository.UploadRepository
-	catalogRepo    repository.FileCatalogRepository
-	tasks          []components.TaskInfo
-	files          []model.FileCatalogRow
+	ctx         context.Context
+	db          *database.DB
+	taskRepo    repository.TaskRepository
+	uploadRepo  repository.UploadRepository
+	catalogRepo repository.FileCatalogRepository
+	runner      *runner.Runner
+	// tasks run by the tui use runCtx, so quitting aborts them
+	runCtx          context.Context
+	cancelRuns      context.CancelFunc
+	runs            *sync.WaitGroup
+	localRuns       map[int64]bool
+	progressTicking bool
+	notice          string
+	noticeIsError   bool
+	confirm         *confirmation
+	form            *addForm
+	restoreForm     *restoreForm
+	configForm      *configForm
+	restores        []*restoreJob
+	restoreMu       *sync.Mutex
+	// full paths of entries of the selected task marked for restoring
+	marked   map[string]bool
+	tasks    []components.TaskInfo
+	files    []model.FileCatalogRow
+	dirSizes map[string]int64
+	fileSort fileSort
+	sizeView bool
+	search   *fileSearch
+	// entry to select once its directory is fetched
+	selectPath     string
+	uploadId       int64
+	uploadBlocks   []model.UploadBlock
+	uploadStats    *runner.UploadStats
+	uploadRate     *rateMeter
 	sidebarCursor  int
 	contentCursor  int
 	contentOffset  int
@@ -55,18 +89,33 @@ type modelTui struct {
 }
 
 func NewApp(ctx context.Context, db *database.DB) *modelTui {
+	runCtx, cancelRuns := context.WithCancel(ctx)
 	return &modelTui{
 		ctx:         ctx,
 		db:          db,
 		taskRepo:    repository.NewTaskRepository(db),
 		uploadRepo:  repository.NewUploadRepository(db),
 		catalogRepo: repository.NewFileCatalogRepository(db),
+		runner:      runner.NewRunner(db),
+		runCtx:      runCtx,
+		cancelRuns:  cancelRuns,
+		runs:        &sync.WaitGroup{},
+		localRuns:   map[int64]bool{},
+		uploadRate:  &rateMeter{},
+		restoreMu:   &sync.Mutex{},
+		marked:      map[string]bool{},
 		currentDir:  ".",
 		focus:       focusSidebar,
 		activeTab:   tabStatus,
 	}
 }
 
+// aborts tasks run by the tui and waits for them to exit
+func (m *modelTui) Close() {
+	m.cancelRuns()
+	m.runs.Wait()
+}
+
 func (m modelTui) Init() tea.Cmd {
 	return tea.Batch(m.fetchTasks, tick())
 }
@@ -91,22 +140,12 @@ func (m modelTui) fetchTasks() tea.Msg {
 	return taskInfos
 }
 
-func (m modelTui) fetchFiles() tea.Msg {
-	if m.selectedTaskId == 0 {
-		return nil
-	}
-	files, err := m.catalogRepo.GetByParentPath(m.ctx, m.selectedTaskId, m.currentDir)
-	if err != nil {
-		L.Error("tui: failed to fetch files for task %d: %v", m.selectedTaskId, err)
-		return []model.FileCatalogRow{}
-	}
-	return files
-}
-
 func (m *modelTui) goBack() {
 	if m.currentDir != "." {
+		m.selectPath = m.currentDir
 		m.currentDir = filepath.Dir(m.currentDir)
 		m.contentCursor = 0
+		m.contentOffset = 0
 	}
 }
 
@@ -117,23 +156,202 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 
 	case tickMsg:
-		return m, tea.Batch(m.fetchTasks, tick())
+		return m, tea.Batch(m.fetchTasks, m.refreshUpload(), tick())
+
+	case uploadBlocksMsg:
+		m.setUploadBlocks(msg)
+
+	case progressTickMsg:
+		m.updateProgress()
+		if len(m.localRuns) == 0 && len(m.restores) == 0 {
+			m.progressTicking = false
+			return m, nil
+		}
+		return m, progressTick()
+
+	case taskDoneMsg:
+		delete(m.localRuns, msg.taskId)
+		switch {
+		case msg.err == nil:
+			m.setNotice(fmt.Sprintf("Task #%d uploaded", msg.taskId), nil)
+		case errors.Is(msg.err, runner.ErrTaskAborted):
+			m.setNotice(fmt.Sprintf("Task #%d aborted", msg.taskId), nil)
+		default:
+			m.setNotice("", fmt.Errorf("task #%d failed: %w", msg.taskId, msg.err))
+		}
+		return m, m.fetchTasks
+
+	case configSavedMsg:
+		if m.configForm == nil {
+			return m, nil
+		}
+		m.configForm.busy = false
+		if msg.err != nil {
+			m.configForm.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.configForm = nil
+		m.setNotice(fmt.Sprintf("Saved config to %s", msg.path), nil)
+		return m, nil
+
+	case connectionCheckedMsg:
+		if m.configForm == nil {
+			return m, nil
+		}
+		m.configForm.busy = false
+		m.configForm.statusIsError = msg.err != nil
+		m.configForm.status = "Connected, the bucket can be accessed"
+		if msg.err != nil {
+			m.configForm.status = msg.err.Error()
+		}
+		return m, nil
+
+	case restoreDoneMsg:
+		m.finishRestore(msg)
+		return m, nil
+
+	case noticeMsg:
+		m.setNotice(msg.text, msg.err)
+		return m, m.fetchTasks
+
+	case taskAddedMsg:
+		if msg.err != nil {
+			if m.form != nil {
+				m.form.busy = false
+				m.form.errMsg = msg.err.Error()
+			} else {
+				m.setNotice("", msg.err)
+			}
+			return m, nil
+		}
+		m.form = nil
+		if msg.created {
+			m.setNotice(fmt.Sprintf("Task #%d added, press r to run it", msg.taskId), nil)
+		} else {
+			m.setNotice(fmt.Sprintf("Files are unchanged since task #%d", msg.taskId), nil)
+		}
+		m.selectedTaskId = msg.taskId
+		return m, m.fetchTasks
 
 	case []components.TaskInfo:
 		m.tasks = msg
-		if m.selectedTaskId == 0 && len(m.tasks) > 0 {
-			m.selectedTaskId = m.tasks[0].Task.Id
-			return m, m.fetchFiles
+		m.updateProgress()
+		if len(m.tasks) == 0 {
+			m.selectedTaskId = 0
+			return m, nil
 		}
+		// keep the selected task selected when tasks are added or deleted
+		for i, t := range m.tasks {
+			if t.Task.Id == m.selectedTaskId {
+				m.sidebarCursor = i
+				return m, nil
+			}
+		}
+		m.sidebarCursor = min(m.sidebarCursor, len(m.tasks)-1)
+		m.selectedTaskId = m.tasks[m.sidebarCursor].Task.Id
+		m.contentCursor = 0
+		m.contentOffset = 0
+		m.currentDir = "."
+		m.search = nil
+		m.marked = map[string]bool{}
+		return m, m.fetchFiles
 
-	case []model.FileCatalogRow:
-		m.files = msg
+	case filesMsg:
+		m.setFiles(msg)
+
+	case fileSearchMsg:
+		m.setSearchResults(msg)
 
 	case tea.KeyMsg:
+		if m.confirm != nil {
+			c := m.confirm
+			m.confirm = nil
+			if msg.String() == "y" || msg.String() == "Y" {
+				return m, c.onYes
+			}
+			m.setNotice("Cancelled", nil)
+			return m, nil
+		}
+		if m.form != nil {
+			return m, m.updateForm(msg)
+		}
+		if m.restoreForm != nil {
+			return m, m.updateRestoreForm(msg)
+		}
+		if m.configForm != nil {
+			return m, m.updateConfigForm(msg)
+		}
+		m.notice = ""
+		if m.search != nil && m.focus == focusContent && m.activeTab == tabFiles {
+			if cmd, ok := m.updateSearch(msg); ok {
+				return m, cmd
+			}
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
+			var running []string
+			if len(m.localRuns) > 0 {
+				running = append(running, L.HumanReadableCount(len(m.localRuns), "running task", "running tasks"))
+			}
+			if len(m.restores) > 0 {
+				running = append(running, L.HumanReadableCount(len(m.restores), "restore", "restores"))
+			}
+			if len(running) > 0 {
+				m.confirm = &confirmation{
+					prompt: fmt.Sprintf("Quit and abort %s? (y/n)", strings.Join(running, " and ")),
+					onYes:  tea.Quit,
+				}
+				return m, nil
+			}
 			return m, tea.Quit
 
+		case "r":
+			info := m.selectedTask()
+			if info == nil {
+				return m, nil
+			}
+			if info.Task.Status == model.TASK_STATUS_UPLOAD_COMPLETED {
+				m.setNotice(fmt.Sprintf("Task #%d is already uploaded", info.Task.Id), nil)
+				return m, nil
+			}
+			return m, m.runTask(info.Task.Id)
+
+		case "p":
+			if info := m.selectedTask(); info != nil {
+				return m, m.togglePause(info)
+			}
+
+		case "x":
+			if info := m.selectedTask(); info != nil {
+				return m, m.abortTask(info.Task.Id)
+			}
+
+		case "d":
+			info := m.selectedTask()
+			if info == nil {
+				return m, nil
+			}
+			m.confirm = &confirmation{
+				prompt: fmt.Sprintf("Delete task #%d with its local archive and uploaded backup? (y/n)", info.Task.Id),
+				onYes:  m.deleteTask(info.Task.Id),
+			}
+
+		case "a":
+			m.form = newAddForm()
+
+		case "c":
+			// the config of the selected task, or the default one
+			if info := m.selectedTask(); info != nil {
+				m.configForm = newConfigForm(info.Task.ConfigPath)
+				return m, nil
+			}
+			configPath, err := config.GetDefaultConfigPath()
+			if err != nil {
+				m.setNotice("", err)
+				return m, nil
+			}
+			m.configForm = newConfigForm(configPath)
+
 		case "1":
 			m.focus = focusSidebar
 
@@ -158,6 +376,12 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, m.fetchFiles
 			}
 
+		case "5", "u", "U":
+			if m.focus == focusContent {
+				m.activeTab = tabUpload
+				return m, m.refreshUpload()
+			}
+
 		case "up", "k":
 			if m.focus == focusSidebar {
 				if m.sidebarCursor > 0 {
@@ -165,15 +389,12 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.selectedTaskId = m.tasks[m.sidebarCursor].Task.Id
 					m.contentCursor = 0
 					m.contentOffset = 0
-					return m, m.fetchFiles
+					m.search = nil
+					m.marked = map[string]bool{}
+					return m, tea.Batch(m.fetchFiles, m.refreshUpload())
 				}
 			} else if m.activeTab == tabFiles {
-				if m.contentCursor > 0 {
-					m.contentCursor--
-					if m.contentCursor < m.contentOffset {
-						m.contentOffset = m.contentCursor
-					}
-				}
+				m.setContentCursor(m.contentCursor - 1)
 			}
 
 		case "down", "j":
@@ -183,17 +404,12 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.selectedTaskId = m.tasks[m.sidebarCursor].Task.Id
 					m.contentCursor = 0
 					m.contentOffset = 0
-					return m, m.fetchFiles
+					m.search = nil
+					m.marked = map[string]bool{}
+					return m, tea.Batch(m.fetchFiles, m.refreshUpload())
 				}
 			} else if m.activeTab == tabFiles {
-				if m.contentCursor < len(m.files) {
-					m.contentCursor++
-					// handwaving space for file list
-					maxVisible := m.height - 15
-					if m.contentCursor >= m.contentOffset+maxVisible {
-						m.contentOffset = m.contentCursor - maxVisible + 1
-					}
-				}
+				m.setContentCursor(m.contentCursor + 1)
 			}
 
 		case "enter", "l", "right":
@@ -206,6 +422,7 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if f.FileType == "dir" {
 						m.currentDir = f.FullPath
 						m.contentCursor = 0
+						m.contentOffset = 0
 						return m, m.fetchFiles
 					}
 				}
@@ -216,8 +433,67 @@ func (m *modelTui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.goBack()
 				return m, m.fetchFiles
 			}
+
+		case "/":
+			if m.focus == focusContent && m.activeTab == tabFiles {
+				m.search = &fileSearch{editing: true}
+				m.contentCursor = 0
+				m.contentOffset = 0
+			}
+
+		case "o":
+			if m.focus == focusContent && m.activeTab == tabFiles {
+				m.cycleFileSort()
+			}
+
+		case " ":
+			if m.focus == focusContent && m.activeTab == tabFiles {
+				m.toggleMark()
+			}
+
+		case "R":
+			if m.focus == focusContent && m.activeTab == tabFiles {
+				m.openRestoreForm()
+			}
+
+		case "v":
+			if m.focus == focusContent && m.activeTab == tabFiles {
+				// like ncdu, sizes are easiest to compare largest first
+				m.sizeView = !m.sizeView
+				if m.sizeView && m.fileSort != sortBySize {
+					m.fileSort = sortBySize
+					sortFiles(m.files, m.dirSizes, m.fileSort)
+				}
+			}
 		}
 	}
 
 	return m, nil
 }
+
+func (m *modelTui) updateForm(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		// a task being added is still added, its result is shown as a notice
+		m.form = nil
+		return nil
+	}
+	if m.form.busy || !m.form.handleKey(msg) {
+		return nil
+	}
+	spec := m.form.spec()
+	if len(spec.InputPaths[0]) == 0 {
+		m.form.errMsg = "input path is required"
+		return nil
+	}
+	m.form.busy = true
+	return m.addTask(spec)
+}
+
+func (m *modelTui) setNotice(text string, err error) {
+	m.notice = text
+	m.noticeIsError = err != nil
+	if err != nil {
+		m.notice = err.Error()
+	}
+}
@@ -0,0 +1,93 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+type FormField struct {
+	Label string
+	Value string
+	// shown after the value when it is empty
+	Placeholder string
+	// shown below the value when it is invalid
+	Error string
+}
+
+// an entry of the path picker shown below the input path
+type PathEntry struct {
+	Name  string
+	IsDir bool
+}
+
+// renders the add task form, "entries" are completions of the input path
+func RenderAddForm(
+	fields []FormField,
+	focused int,
+	entries []PathEntry,
+	entryCursor int,
+	errMsg string,
+	busy bool,
+	width int,
+	height int,
+) string {
+	var sb strings.Builder
+	sb.WriteString(tableTitleStyle.Render("ADD TASK") + "\n\n")
+
+	labelStyle := lipgloss.NewStyle().Width(16).Foreground(ColorGrey)
+	valueWidth := max(width-20, 10)
+	for i, f := range fields {
+		value := f.Value
+		if i == focused && !busy {
+			value += "█"
+		}
+		if len(f.Value) == 0 && len(f.Placeholder) > 0 {
+			value += DimStyle.Render(f.Placeholder)
+		}
+		label := labelStyle.Render(f.Label)
+		if i == focused {
+			label = labelStyle.Foreground(ColorGreen).Bold(true).Render(f.Label)
+		}
+		sb.WriteString(label + lipgloss.NewStyle().Width(valueWidth).Render(value) + "\n")
+		if i == 0 && focused == 0 {
+			sb.WriteString(renderPathPicker(entries, entryCursor, valueWidth, max(height-20, 3)))
+		}
+	}
+
+	sb.WriteString("\n")
+	switch {
+	case busy:
+		sb.WriteString(YellowStyle.Render("Checking files, this may take a while...") + "\n")
+	case len(errMsg) > 0:
+		sb.WriteString(RedStyle.Render(errMsg) + "\n")
+	}
+	sb.WriteString(HelpStyle.Render("Tab:Next field | ↑/↓:Pick path | →:Open dir | ←:Parent dir | Enter:Add | Esc:Cancel"))
+	return sb.String()
+}
+
+func renderPathPicker(entries []PathEntry, cursor int, width int, maxVisible int) string {
+	indent := strings.Repeat(" ", 16)
+	if len(entries) == 0 {
+		return indent + DimStyle.Render("no matching files") + "\n"
+	}
+	// keep the cursor in view
+	offset := max(cursor-maxVisible+1, 0)
+	var sb strings.Builder
+	for i := offset; i < len(entries) && i < offset+maxVisible; i++ {
+		name := entries[i].Name
+		if entries[i].IsDir {
+			name += "/"
+		}
+		if i == cursor {
+			sb.WriteString(indent + selectedItemStyle.Render(name) + "\n")
+		} else {
+			sb.WriteString(indent + DimStyle.Render(name) + "\n")
+		}
+	}
+	if len(entries) > offset+maxVisible {
+		sb.WriteString(indent + DimStyle.Render(fmt.Sprintf("... %d more", len(entries)-offset-maxVisible)) + "\n")
+	}
+	return sb.String()
+}
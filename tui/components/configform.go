@@ -0,0 +1,52 @@
+package components
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// renders the config editor, fields with an Error are shown with it
+func RenderConfigForm(
+	fields []FormField,
+	focused int,
+	status string,
+	statusIsError bool,
+	errMsg string,
+	busy bool,
+	width int,
+) string {
+	var sb strings.Builder
+	sb.WriteString(tableTitleStyle.Render("CONFIG") + "\n\n")
+
+	labelStyle := lipgloss.NewStyle().Width(16).Foreground(ColorGrey)
+	valueWidth := max(width-20, 10)
+	for i, f := range fields {
+		value := f.Value
+		if i == focused && !busy {
+			value += "█"
+		}
+		label := labelStyle.Render(f.Label)
+		if i == focused {
+			label = labelStyle.Foreground(ColorGreen).Bold(true).Render(f.Label)
+		}
+		sb.WriteString(label + lipgloss.NewStyle().Width(valueWidth).Render(value) + "\n")
+		if len(f.Error) > 0 {
+			sb.WriteString(labelStyle.Render("") + RedStyle.Width(valueWidth).Render(f.Error) + "\n")
+		}
+	}
+
+	sb.WriteString("\n")
+	switch {
+	case busy:
+		sb.WriteString(YellowStyle.Render("Working...") + "\n")
+	case len(errMsg) > 0:
+		sb.WriteString(RedStyle.Render(errMsg) + "\n")
+	case len(status) > 0 && statusIsError:
+		sb.WriteString(RedStyle.Render(status) + "\n")
+	case len(status) > 0:
+		sb.WriteString(GreenStyle.Render(status) + "\n")
+	}
+	sb.WriteString(HelpStyle.Render("Tab/↑/↓:Field | ←/→:Choose | Ctrl+T:Test connection | Ctrl+S:Save | Esc:Close"))
+	return sb.String()
+}
@@ -10,10 +10,57 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-// renders minimal file browser based on file catalog metadata we store for each task
+// width of the bars of the size view
+const SIZE_BAR_WIDTH = 20
+
+type fileRow struct {
+	name, size, mod string
+	bytes           int64
+}
+
+// returns the size of a file, or the total size of files under a
+// directory, -1 if it is not known
+func EntrySize(f *model.FileCatalogRow, dirSizes map[string]int64) int64 {
+	if f.FileType != "dir" {
+		return f.SizeBytes
+	}
+	if size, ok := dirSizes[f.FullPath]; ok {
+		return size
+	}
+	return -1
+}
+
+func newFileRow(f *model.FileCatalogRow, name string, dirSizes map[string]int64, marked map[string]bool) fileRow {
+	if f.FileType == "dir" {
+		name = name + "/"
+	}
+	if marked[f.FullPath] {
+		name = "* " + name
+	} else {
+		name = "  " + name
+	}
+	row := fileRow{
+		name:  name,
+		bytes: EntrySize(f, dirSizes),
+		mod:   f.ModifiedAt.Format("2006-01-02 15:04"),
+	}
+	if row.bytes >= 0 {
+		row.size = L.HumanReadableBytes(uint64(row.bytes), 1)
+	}
+	return row
+}
+
+// renders minimal file browser based on file catalog metadata we store for
+// each task, "dirSizes" has the total size of files under each directory.
+// the size view shows how much of the directory each entry takes, like
+// ncdu. entries in "marked" are shown with a *
 func RenderFilesView(
 	files []model.FileCatalogRow,
+	dirSizes map[string]int64,
+	marked map[string]bool,
 	currentDir string,
+	sortBy string,
+	sizeView bool,
 	contentCursor int,
 	contentOffset int,
 	focusOnContent bool,
@@ -28,68 +75,131 @@ func RenderFilesView(
 	var sb strings.Builder
 
 	sb.WriteString(DimStyle.Render("Files in "))
-
-	sb.WriteString(GreenStyle.Render("./"+currentDir) + "\n")
-	rows := []struct {
-		name, size, mod string
-	}{
-		{name: "../", size: "", mod: ""},
+	sb.WriteString(GreenStyle.Render("./" + currentDir))
+
+	rows := []fileRow{{name: "  ../", bytes: -1}}
+	var total int64
+	for i := range files {
+		row := newFileRow(&files[i], files[i].Name, dirSizes, marked)
+		total += max(row.bytes, 0)
+		rows = append(rows, row)
 	}
+	sb.WriteString(DimStyle.Render(fmt.Sprintf(" %s, sorted by %s", L.HumanReadableBytes(uint64(total), 1), sortBy)))
+	sb.WriteString(renderMarkCount(marked) + "\n")
 
-	for _, f := range files {
-		name := f.Name
-		if f.FileType == "dir" {
-			name = name + "/"
-		}
-		size := ""
-		if f.FileType == "file" {
-			size = L.HumanReadableBytes(uint64(f.SizeBytes), 1)
-		}
+	sb.WriteString(renderFileRows(rows, total, sizeView, contentCursor, contentOffset, focusOnContent, width, height))
+	return sb.String()
+}
 
-		rows = append(rows, struct {
-			name, size, mod string
-		}{
-			name: name,
-			size: size,
-			mod:  f.ModifiedAt.Format("2006-01-02 15:04"),
-		})
+// renders results of a search of the catalog of a task
+func RenderFileSearch(
+	query string,
+	editing bool,
+	results []model.FileCatalogRow,
+	marked map[string]bool,
+	sortBy string,
+	contentCursor int,
+	contentOffset int,
+	focusOnContent bool,
+	width int,
+	height int,
+) string {
+	var sb strings.Builder
+	sb.WriteString(BlueStyle.Render("/") + query)
+	if editing {
+		sb.WriteString(InvertedGreenStyle.Render(" "))
 	}
+	sb.WriteString(DimStyle.Render(fmt.Sprintf("  %s, sorted by %s",
+		L.HumanReadableCount(len(results), "match", "matches"), sortBy)))
+	sb.WriteString(renderMarkCount(marked) + "\n")
 
+	var rows []fileRow
+	for i := range results {
+		rows = append(rows, newFileRow(&results[i], results[i].FullPath, nil, marked))
+	}
+	if !editing {
+		// the cursor is only shown once results can be opened
+		sb.WriteString(renderFileRows(rows, 0, false, contentCursor, contentOffset, focusOnContent, width, height))
+	} else {
+		sb.WriteString(renderFileRows(rows, 0, false, -1, contentOffset, focusOnContent, width, height))
+	}
+	return sb.String()
+}
+
+func renderFileRows(
+	rows []fileRow,
+	total int64,
+	sizeView bool,
+	contentCursor int,
+	contentOffset int,
+	focusOnContent bool,
+	width int,
+	height int,
+) string {
+	var sb strings.Builder
 	maxVisible := max(height-18, 1)
 
 	sizeWidth := 10
 	modWidth := 16
-	nameWidth := width - sizeWidth - modWidth - 5
+	barWidth := 0
+	if sizeView {
+		// percent and bar instead of the modification time
+		modWidth = 0
+		barWidth = SIZE_BAR_WIDTH + 10
+	}
+	nameWidth := width - sizeWidth - modWidth - barWidth - 5
 
 	nameColHeaderStyle := lipgloss.NewStyle().Foreground(ColorBlue).Bold(true).Width(nameWidth)
 	sizeColHeaderStyle := lipgloss.NewStyle().Foreground(ColorBlue).Bold(true).Width(sizeWidth)
 	modColHeaderStyle := lipgloss.NewStyle().Foreground(ColorBlue).Bold(true).Width(modWidth)
+	barColHeaderStyle := lipgloss.NewStyle().Foreground(ColorBlue).Bold(true).Width(barWidth)
 
 	nameRowStyle := lipgloss.NewStyle().Width(nameWidth)
 	sizeRowStyle := lipgloss.NewStyle().Width(sizeWidth)
 	modRowStyle := lipgloss.NewStyle().Width(modWidth)
+	barRowStyle := lipgloss.NewStyle().Width(barWidth)
 
-	headerLine := lipgloss.JoinHorizontal(lipgloss.Top,
-		nameColHeaderStyle.Render("NAME"),
-		sizeColHeaderStyle.Render("SIZE"),
-		modColHeaderStyle.Render("MODIFIED AT"),
-	)
+	var largest int64
+	for _, row := range rows {
+		largest = max(largest, row.bytes)
+	}
+
+	var headerLine string
+	if sizeView {
+		headerLine = lipgloss.JoinHorizontal(lipgloss.Top,
+			sizeColHeaderStyle.Render("SIZE"),
+			barColHeaderStyle.Render("USAGE"),
+			nameColHeaderStyle.Render("NAME"),
+		)
+	} else {
+		headerLine = lipgloss.JoinHorizontal(lipgloss.Top,
+			nameColHeaderStyle.Render("NAME"),
+			sizeColHeaderStyle.Render("SIZE"),
+			modColHeaderStyle.Render("MODIFIED AT"),
+		)
+	}
 	sb.WriteString(headerLine + "\n")
 
 	end := contentOffset + maxVisible
 	for i := contentOffset; i < len(rows) && i < end; i++ {
 		row := rows[i]
 
-		nameStr := row.name
-		if len(nameStr) > nameWidth {
-			nameStr = nameStr[:nameWidth-1] + "..."
-		}
+		nameStr := L.TruncateString(row.name, nameWidth-1, L.TRUNC_CENTER)
 
-		line := lipgloss.JoinHorizontal(lipgloss.Top,
-			nameRowStyle.Render(nameStr),
-			sizeRowStyle.Render(row.size),
-			modRowStyle.Render(row.mod),
-		)
+		var line string
+		if sizeView {
+			line = lipgloss.JoinHorizontal(lipgloss.Top,
+				sizeRowStyle.Render(row.size),
+				barRowStyle.Render(renderSizeBar(row.bytes, total, largest)),
+				nameRowStyle.Render(nameStr),
+			)
+		} else {
+			line = lipgloss.JoinHorizontal(lipgloss.Top,
+				nameRowStyle.Render(nameStr),
+				sizeRowStyle.Render(row.size),
+				modRowStyle.Render(row.mod),
+			)
+		}
 
 		if i == contentCursor && focusOnContent {
 			sb.WriteString(selectedItemStyle.Width(width - 2).Render(line))
@@ -105,3 +215,28 @@ func RenderFilesView(
 
 	return sb.String()
 }
+
+// renders the percentage of "total" taken by "size", with a bar relative to
+// the "largest" entry
+func renderSizeBar(size int64, total int64, largest int64) string {
+	if size < 0 {
+		return ""
+	}
+	percent := 0.0
+	if total > 0 {
+		percent = float64(size) * 100 / float64(total)
+	}
+	filled := 0
+	if largest > 0 {
+		filled = int(size * SIZE_BAR_WIDTH / largest)
+	}
+	return fmt.Sprintf("%5.1f%% [%s%s]", percent,
+		strings.Repeat("#", filled), strings.Repeat(" ", SIZE_BAR_WIDTH-filled))
+}
+
+func renderMarkCount(marked map[string]bool) string {
+	if len(marked) == 0 {
+		return ""
+	}
+	return YellowStyle.Render(fmt.Sprintf(", %d marked", len(marked)))
+}
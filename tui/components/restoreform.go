@@ -0,0 +1,90 @@
+package components
+
+import (
+	"fmt"
+	"glesha/runner"
+	"strings"
+
+	L "glesha/logger"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// at most this many entries to restore are listed
+const MAX_RESTORE_PATHS = 5
+
+// RestoreInfo is a restore run by the tui
+type RestoreInfo struct {
+	TaskId  int64
+	DestDir string
+	// restores wait for the ones started before them
+	Started bool
+	Stats   runner.RestoreStats
+}
+
+// renders the form asking where "paths" of task "taskId" are restored to,
+// "entries" are completions of the restore directory
+func RenderRestoreForm(
+	taskId int64,
+	paths []string,
+	destDir string,
+	entries []PathEntry,
+	entryCursor int,
+	errMsg string,
+	width int,
+	height int,
+) string {
+	var sb strings.Builder
+	sb.WriteString(tableTitleStyle.Render(fmt.Sprintf("RESTORE FROM TASK #%d", taskId)) + "\n\n")
+
+	labelStyle := lipgloss.NewStyle().Width(16).Foreground(ColorGrey)
+	valueWidth := max(width-20, 10)
+	for i, p := range paths {
+		label := ""
+		if i == 0 {
+			label = "Entries"
+		}
+		if i == MAX_RESTORE_PATHS {
+			sb.WriteString(labelStyle.Render("") + DimStyle.Render(fmt.Sprintf("... %d more", len(paths)-i)) + "\n")
+			break
+		}
+		sb.WriteString(labelStyle.Render(label) + L.TruncateString(p, valueWidth, L.TRUNC_CENTER) + "\n")
+	}
+	sb.WriteString(labelStyle.Foreground(ColorGreen).Bold(true).Render("Restore to") +
+		lipgloss.NewStyle().Width(valueWidth).Render(destDir+"█") + "\n")
+	sb.WriteString(renderPathPicker(entries, entryCursor, valueWidth, max(height-20, 3)))
+
+	sb.WriteString("\n")
+	if len(errMsg) > 0 {
+		sb.WriteString(RedStyle.Render(errMsg) + "\n")
+	}
+	sb.WriteString(DimStyle.Render("Entries are restored under their archived path, existing files are kept") + "\n")
+	sb.WriteString(HelpStyle.Render("↑/↓:Pick dir | →:Open dir | ←:Parent dir | Enter:Restore | Esc:Cancel"))
+	return sb.String()
+}
+
+// renders one line per restore run by the tui
+func RenderRestores(restores []RestoreInfo, width int) string {
+	var sb strings.Builder
+	for _, r := range restores {
+		var line string
+		if !r.Started {
+			line = DimStyle.Render(fmt.Sprintf("Restore of task #%d to %s is queued", r.TaskId, r.DestDir))
+		} else {
+			s := r.Stats
+			line = YellowStyle.Render(fmt.Sprintf("Restoring task #%d: %d/%d files, %s/%s to %s",
+				r.TaskId,
+				s.Entries,
+				s.TotalEntries,
+				L.HumanReadableBytes(uint64(s.Bytes), 1),
+				L.HumanReadableBytes(uint64(s.TotalBytes), 1),
+				r.DestDir,
+			))
+			if s.Failed > 0 {
+				line += RedStyle.Render(fmt.Sprintf(" (%d failed)", s.Failed))
+			}
+		}
+		sb.WriteString(lipgloss.NewStyle().MaxWidth(width).Render(line) + "\n")
+	}
+	return sb.String()
+}
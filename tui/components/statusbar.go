@@ -3,6 +3,7 @@ package components
 import (
 	"fmt"
 	"glesha/database/model"
+	"glesha/runner"
 	"strings"
 
 	L "glesha/logger"
@@ -15,6 +16,9 @@ func RenderStatusBar(
 	if info.Task == nil {
 		return ""
 	}
+	if info.Progress != nil {
+		return renderLiveStatus(info.Progress, width)
+	}
 	t := info.Task
 	var sb strings.Builder
 
@@ -57,3 +61,27 @@ func RenderStatusBar(
 
 	return sb.String()
 }
+
+// renders progress reported by the archiver and uploader of a task run
+// by this tui, which is more recent than the task in the database
+func renderLiveStatus(p *runner.TaskProgress, width int) string {
+	var pct float64
+	if p.Total > 0 {
+		pct = float64(p.Done) * 100.0 / float64(p.Total)
+	}
+	switch {
+	case p.Paused:
+		return YellowStyle.Render(fmt.Sprintf("Status | %s PAUSED %3.2f%%", strings.ToUpper(p.Phase), pct))
+	case p.Phase == runner.PHASE_ARCHIVE:
+		return fmt.Sprintf("Status | ARCHIVING %s %3.2f%% (%d/%d files)",
+			L.ProgressBar(pct, width-50), pct, p.Done, p.Total)
+	case p.Phase == runner.PHASE_PACKS:
+		return fmt.Sprintf("Status | UPLOADING PACKS %s %3.2f%% (%s)",
+			L.ProgressBar(pct, width-50), pct, L.HumanReadableBytes(uint64(p.Done), 1))
+	case p.Phase == runner.PHASE_UPLOAD:
+		return fmt.Sprintf("Status | UPLOADING %s %3.2f%% (%s)",
+			L.ProgressBar(pct, width-50), pct, L.HumanReadableBytes(uint64(p.Done), 1))
+	default:
+		return DimStyle.Render("Status | STARTING")
+	}
+}
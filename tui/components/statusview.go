@@ -55,7 +55,7 @@ func RenderStatusView(
 
 	taskRows := []Row{
 		{"ID:", fmt.Sprintf("%d", t.Id)},
-		{"Input Path:", t.InputPath},
+		{"Input Path:", strings.Join(t.InputPaths, ", ")},
 		{"Config:", t.ConfigPath},
 		{"Status:", string(t.Status)},
 		{"Provider:", t.Provider.String()},
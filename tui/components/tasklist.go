@@ -3,12 +3,15 @@ package components
 import (
 	"fmt"
 	"glesha/database/model"
+	"glesha/runner"
 	"strings"
 )
 
 type TaskInfo struct {
 	Task   *model.Task
 	Upload *model.Upload
+	// set while the task is run by this tui
+	Progress *runner.TaskProgress
 }
 
 func RenderTaskList(
@@ -42,6 +45,9 @@ func RenderTaskList(
 			status = "DONE"
 		}
 
+		if info.Progress != nil && !info.Progress.Paused {
+			status += " ▶"
+		}
 		msg := fmt.Sprintf("task #%d\n• %s", t.Id, status)
 
 		style := sidebarItemStyle
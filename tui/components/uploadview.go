@@ -0,0 +1,147 @@
+package components
+
+import (
+	"fmt"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/runner"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// rows of the block map, larger uploads show many blocks per cell
+const BLOCK_MAP_ROWS = 8
+
+// at most this many block errors are shown
+const MAX_BLOCK_ERRORS = 5
+
+const blockCell = "■"
+
+type cellState int
+
+// ordered by priority, a cell of many blocks shows the highest state
+const (
+	cellComplete cellState = iota
+	cellQueued
+	cellRunning
+	cellError
+)
+
+var cellStyles = map[cellState]lipgloss.Style{
+	cellComplete: GreenStyle,
+	cellQueued:   DimStyle,
+	cellRunning:  YellowStyle,
+	cellError:    RedStyle,
+}
+
+func blockState(b *model.UploadBlock) cellState {
+	switch {
+	case b.Status == model.UB_STATUS_COMPLETE:
+		return cellComplete
+	case b.Status == model.UB_STATUS_ERROR:
+		return cellError
+	case runner.IsBlockRunning(b):
+		return cellRunning
+	default:
+		return cellQueued
+	}
+}
+
+// renders blocks of the task's upload, "rate" is the moving average upload
+// rate in bytes per second
+func RenderUploadView(
+	info TaskInfo,
+	blocks []model.UploadBlock,
+	stats *runner.UploadStats,
+	rate float64,
+	width int,
+) string {
+	if info.Task == nil {
+		return "No task selected"
+	}
+	if info.Upload == nil {
+		return DimStyle.Render("Task has not been uploaded yet")
+	}
+	if stats == nil || len(blocks) == 0 {
+		return DimStyle.Render("No blocks to show yet")
+	}
+	up := info.Upload
+	var sb strings.Builder
+
+	percent := 0.0
+	if up.FileSize > 0 {
+		percent = float64(stats.CompletedBytes) * 100 / float64(up.FileSize)
+	}
+	eta := "--"
+	if stats.CompletedBytes >= up.FileSize {
+		eta = "0s"
+	} else if rate > 0 {
+		eta = L.HumanReadableTime(int64(float64(up.FileSize-stats.CompletedBytes)/rate) * 1000)
+	}
+	sb.WriteString(tableTitleStyle.Render(fmt.Sprintf("UPLOAD #%d", up.Id)) + " " +
+		DimStyle.Render(string(up.Status)) + "\n")
+	sb.WriteString(fmt.Sprintf("%s / %s (%.1f%%)  %s/s  ETA %s\n",
+		L.HumanReadableBytes(uint64(stats.CompletedBytes), 2),
+		L.HumanReadableBytes(uint64(up.FileSize), 2),
+		percent,
+		L.HumanReadableBytes(uint64(rate), 1),
+		eta,
+	))
+
+	cols := max(width-2, 1)
+	perCell := (len(blocks) + cols*BLOCK_MAP_ROWS - 1) / (cols * BLOCK_MAP_ROWS)
+	legend := fmt.Sprintf("%s %d queued  %s %d running  %s %d complete  %s %d error",
+		cellStyles[cellQueued].Render(blockCell), stats.Queued,
+		cellStyles[cellRunning].Render(blockCell), stats.Running,
+		cellStyles[cellComplete].Render(blockCell), stats.Completed,
+		cellStyles[cellError].Render(blockCell), stats.Failed,
+	)
+	if perCell > 1 {
+		legend += DimStyle.Render(fmt.Sprintf("  (%d blocks per cell)", perCell))
+	}
+	sb.WriteString("\n" + tableTitleStyle.Render("BLOCKS") + "\n" + legend + "\n")
+	var cells []string
+	for i := 0; i < len(blocks); i += perCell {
+		state := cellComplete
+		for j := i; j < min(i+perCell, len(blocks)); j++ {
+			state = max(state, blockState(&blocks[j]))
+		}
+		cells = append(cells, cellStyles[state].Render(blockCell))
+	}
+	for i := 0; i < len(cells); i += cols {
+		sb.WriteString(strings.Join(cells[i:min(i+cols, len(cells))], "") + "\n")
+	}
+
+	sb.WriteString("\n" + tableTitleStyle.Render("WORKERS") + "\n")
+	if len(stats.Workers) == 0 {
+		sb.WriteString(DimStyle.Render("No block has been started yet") + "\n")
+	}
+	for _, w := range stats.Workers {
+		current := DimStyle.Render("idle")
+		if w.CurrentBlockId > 0 {
+			current = YellowStyle.Render(fmt.Sprintf("block #%d", w.CurrentBlockId))
+		}
+		sb.WriteString(fmt.Sprintf("[CN%d: %s/s] %s, %s\n",
+			w.WorkerId,
+			L.HumanReadableBytes(uint64(w.Rate), 1),
+			current,
+			L.HumanReadableCount(w.CompletedBlocks, "block done", "blocks done"),
+		))
+	}
+
+	if len(stats.Errors) > 0 {
+		sb.WriteString("\n" + tableTitleStyle.Render("RECENT BLOCK ERRORS") + "\n")
+		for _, b := range stats.Errors[:min(len(stats.Errors), MAX_BLOCK_ERRORS)] {
+			prefix := fmt.Sprintf("#%d %s (%s) ",
+				b.Id,
+				b.UpdatedAt.Local().Format("15:04:05"),
+				L.HumanReadableCount(int(b.ErrorCount), "failure", "failures"),
+			)
+			msg := strings.ReplaceAll(b.ErrorMessage, "\n", " ")
+			sb.WriteString(prefix + RedStyle.Render(L.TruncateString(msg, max(width-len(prefix)-2, 10), L.TRUNC_RIGHT)) + "\n")
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,272 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"glesha/backend/aws"
+	"glesha/config"
+	"glesha/tui/components"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	configFieldPath = iota
+	configFieldArchiveFormat
+	configFieldProvider
+	configFieldAccessKey
+	configFieldSecretKey
+	configFieldAccountId
+	configFieldRegion
+	configFieldBucketName
+	configFieldStorageClass
+	configFieldCount
+)
+
+// choices of fields picked with left and right
+var configFieldChoices = map[int][]string{
+	configFieldArchiveFormat: {string(config.AF_TARGZ), string(config.AF_REPO)},
+	configFieldProvider:      {string(config.PROVIDER_AWS)},
+	configFieldStorageClass:  storageClassChoices(),
+}
+
+func storageClassChoices() []string {
+	var choices []string
+	for _, sc := range aws.GetAwsStorageClasses() {
+		choices = append(choices, string(sc))
+	}
+	return choices
+}
+
+// configForm creates or edits a config file, keys without a field are
+// saved as they were loaded
+type configForm struct {
+	values  [configFieldCount]string
+	focused int
+	// path "base" was loaded from
+	loadedPath string
+	base       config.Config
+	errMsg     string
+	// result of the last connection test
+	status        string
+	statusIsError bool
+	busy          bool
+}
+
+type configSavedMsg struct {
+	path string
+	err  error
+}
+
+type connectionCheckedMsg struct {
+	err error
+}
+
+func newConfigForm(path string) *configForm {
+	f := &configForm{}
+	f.values[configFieldPath] = path
+	f.load()
+	return f
+}
+
+// fills the form from the config file at the path field. when it does not
+// exist the values being edited are kept, so they can be saved there
+func (f *configForm) load() {
+	path := expandHome(f.values[configFieldPath])
+	firstLoad := len(f.loadedPath) == 0
+	f.loadedPath = path
+	f.status = ""
+	c, err := config.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !firstLoad {
+		f.errMsg = "Config does not exist yet, it is created when saved"
+		return
+	}
+	if err != nil {
+		c = &config.Config{ArchiveFormat: config.AF_TARGZ, Provider: config.PROVIDER_AWS}
+		if errors.Is(err, fs.ErrNotExist) {
+			f.errMsg = "Config does not exist yet, it is created when saved"
+		} else {
+			f.errMsg = err.Error()
+		}
+	}
+	f.base = *c
+	f.values[configFieldArchiveFormat] = string(c.ArchiveFormat)
+	f.values[configFieldProvider] = string(c.Provider)
+	cfgAws := c.Aws
+	if cfgAws == nil {
+		cfgAws = &config.Aws{StorageClass: string(aws.AWS_SC_STANDARD)}
+	}
+	f.values[configFieldAccessKey] = cfgAws.AccessKey
+	f.values[configFieldSecretKey] = cfgAws.SecretKey
+	f.values[configFieldAccountId] = ""
+	if cfgAws.AccountId > 0 {
+		f.values[configFieldAccountId] = strconv.FormatUint(cfgAws.AccountId, 10)
+	}
+	f.values[configFieldRegion] = cfgAws.Region
+	f.values[configFieldBucketName] = cfgAws.BucketName
+	f.values[configFieldStorageClass] = cfgAws.StorageClass
+}
+
+// validates a field with the checks the backend runs before uploading
+func (f *configForm) fieldError(field int) error {
+	validator := aws.AwsValidator{}
+	value := f.values[field]
+	switch field {
+	case configFieldPath:
+		if len(value) == 0 {
+			return fmt.Errorf("path is required")
+		}
+	case configFieldAccessKey, configFieldSecretKey:
+		if len(value) == 0 {
+			return fmt.Errorf("required")
+		}
+	case configFieldAccountId:
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("aws: account_id must have exactly 12 digits")
+		}
+		return validator.ValidateAccountId(id)
+	case configFieldRegion:
+		return validator.ValidateRegion(value)
+	case configFieldBucketName:
+		return validator.ValidateBucketName(value)
+	case configFieldStorageClass:
+		return validator.ValidateStorageClass(value)
+	}
+	return nil
+}
+
+// returns the config being edited, or the first invalid field
+func (f *configForm) config() (*config.Config, error) {
+	for field := range configFieldCount {
+		if err := f.fieldError(field); err != nil {
+			f.focused = field
+			return nil, err
+		}
+	}
+	c := f.base
+	c.ArchiveFormat = config.ArchiveFormat(f.values[configFieldArchiveFormat])
+	c.Provider = config.Provider(f.values[configFieldProvider])
+	cfgAws := config.Aws{}
+	if f.base.Aws != nil {
+		cfgAws = *f.base.Aws
+	}
+	cfgAws.AccessKey = f.values[configFieldAccessKey]
+	cfgAws.SecretKey = f.values[configFieldSecretKey]
+	cfgAws.AccountId, _ = strconv.ParseUint(f.values[configFieldAccountId], 10, 64)
+	cfgAws.Region = f.values[configFieldRegion]
+	cfgAws.BucketName = f.values[configFieldBucketName]
+	cfgAws.StorageClass = f.values[configFieldStorageClass]
+	c.Aws = &cfgAws
+	return &c, nil
+}
+
+func (f *configForm) focus(field int) {
+	// a changed path loads the config there, or starts a new one
+	if f.focused == configFieldPath && expandHome(f.values[configFieldPath]) != f.loadedPath {
+		f.load()
+	}
+	f.focused = field
+}
+
+func (f *configForm) cycle(delta int) {
+	choices := configFieldChoices[f.focused]
+	i := slices.Index(choices, f.values[f.focused])
+	if i < 0 {
+		i = 0
+	} else {
+		i = (i + delta + len(choices)) % len(choices)
+	}
+	f.values[f.focused] = choices[i]
+}
+
+func (m *modelTui) updateConfigForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.configForm
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		m.configForm = nil
+		return nil
+	}
+	if f.busy {
+		return nil
+	}
+	f.errMsg = ""
+	switch msg.String() {
+	case "tab", "down", "enter":
+		f.focus((f.focused + 1) % configFieldCount)
+	case "shift+tab", "up":
+		f.focus((f.focused + configFieldCount - 1) % configFieldCount)
+	case "ctrl+s":
+		c, err := f.config()
+		if err != nil {
+			f.errMsg = err.Error()
+			return nil
+		}
+		f.busy = true
+		return saveConfig(expandHome(f.values[configFieldPath]), c)
+	case "ctrl+t":
+		c, err := f.config()
+		if err != nil {
+			f.errMsg = err.Error()
+			return nil
+		}
+		f.busy = true
+		f.status = ""
+		return m.checkConnection(c)
+	default:
+		if _, ok := configFieldChoices[f.focused]; ok {
+			switch {
+			case msg.String() == "right" || msg.Type == tea.KeySpace:
+				f.cycle(1)
+			case msg.String() == "left":
+				f.cycle(-1)
+			}
+			return nil
+		}
+		editText(&f.values[f.focused], msg)
+	}
+	return nil
+}
+
+func saveConfig(path string, c *config.Config) tea.Cmd {
+	return func() tea.Msg {
+		return configSavedMsg{path: path, err: config.Save(path, c)}
+	}
+}
+
+func (m *modelTui) checkConnection(c *config.Config) tea.Cmd {
+	ctx := m.ctx
+	return func() tea.Msg {
+		return connectionCheckedMsg{err: aws.CheckConnection(ctx, c.Aws)}
+	}
+}
+
+func (f *configForm) render(width int) string {
+	labels := [configFieldCount]string{
+		"Config file", "Archive format", "Provider", "Access key", "Secret key",
+		"Account id", "Region", "Bucket", "Storage class",
+	}
+	var fields []components.FormField
+	for i, label := range labels {
+		field := components.FormField{Label: label, Value: f.values[i]}
+		if i == configFieldSecretKey {
+			field.Value = maskSecret(field.Value)
+		}
+		if err := f.fieldError(i); err != nil {
+			field.Error = err.Error()
+		}
+		fields = append(fields, field)
+	}
+	return components.RenderConfigForm(fields, f.focused, f.status, f.statusIsError, f.errMsg, f.busy, width)
+}
+
+// shows the last characters of a secret, enough to tell keys apart
+func maskSecret(secret string) string {
+	runes := []rune(secret)
+	visible := min(4, len(runes)/4)
+	return strings.Repeat("•", len(runes)-visible) + string(runes[len(runes)-visible:])
+}
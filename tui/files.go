@@ -0,0 +1,256 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/tui/components"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// searches stop after this many results
+const MAX_SEARCH_RESULTS = 1000
+
+type fileSort int
+
+const (
+	sortByName fileSort = iota
+	sortBySize
+	sortByModified
+)
+
+func (s fileSort) String() string {
+	switch s {
+	case sortBySize:
+		return "size"
+	case sortByModified:
+		return "modified"
+	default:
+		return "name"
+	}
+}
+
+// entries of a directory of a task, with the total size of files under
+// each subdirectory
+type filesMsg struct {
+	taskId   int64
+	dir      string
+	files    []model.FileCatalogRow
+	dirSizes map[string]int64
+}
+
+// incremental search over the catalog of the selected task
+type fileSearch struct {
+	query string
+	// keys edit the query until enter is pressed
+	editing bool
+	results []model.FileCatalogRow
+}
+
+type fileSearchMsg struct {
+	taskId  int64
+	query   string
+	results []model.FileCatalogRow
+}
+
+func (m modelTui) fetchFiles() tea.Msg {
+	if m.selectedTaskId == 0 {
+		return nil
+	}
+	files, err := m.catalogRepo.GetByParentPath(m.ctx, m.selectedTaskId, m.currentDir)
+	if err != nil {
+		L.Error(fmt.Errorf("tui: failed to fetch files for task %d: %w", m.selectedTaskId, err))
+	}
+	dirSizes, err := m.catalogRepo.GetDirSizes(m.ctx, m.selectedTaskId, m.currentDir)
+	if err != nil {
+		L.Error(fmt.Errorf("tui: failed to fetch directory sizes for task %d: %w", m.selectedTaskId, err))
+	}
+	return filesMsg{taskId: m.selectedTaskId, dir: m.currentDir, files: files, dirSizes: dirSizes}
+}
+
+func (m modelTui) searchFiles(query string) tea.Cmd {
+	taskId := m.selectedTaskId
+	return func() tea.Msg {
+		if len(query) == 0 || taskId == 0 {
+			return fileSearchMsg{taskId: taskId, query: query}
+		}
+		lower := strings.ToLower(query)
+		hits, err := m.catalogRepo.Search(m.ctx, &model.CatalogSearch{
+			TaskId:    taskId,
+			Substring: query,
+			// the trigram index only narrows down queries of 3 or more
+			// characters
+			Match: func(fullPath string) bool {
+				return strings.Contains(strings.ToLower(fullPath), lower)
+			},
+			MinSize: -1,
+			MaxSize: -1,
+			Limit:   MAX_SEARCH_RESULTS,
+		})
+		if err != nil {
+			L.Error(fmt.Errorf("tui: failed to search files of task %d: %w", taskId, err))
+		}
+		results := make([]model.FileCatalogRow, 0, len(hits))
+		for _, h := range hits {
+			results = append(results, h.FileCatalogRow)
+		}
+		return fileSearchMsg{taskId: taskId, query: query, results: results}
+	}
+}
+
+func (m *modelTui) setFiles(msg filesMsg) {
+	if msg.taskId != m.selectedTaskId || msg.dir != m.currentDir {
+		return
+	}
+	m.files = msg.files
+	m.dirSizes = msg.dirSizes
+	sortFiles(m.files, m.dirSizes, m.fileSort)
+	if len(m.selectPath) == 0 {
+		return
+	}
+	// row 0 is the parent directory
+	for i, f := range m.files {
+		if f.FullPath == m.selectPath {
+			m.setContentCursor(i + 1)
+			break
+		}
+	}
+	m.selectPath = ""
+}
+
+func (m *modelTui) setSearchResults(msg fileSearchMsg) {
+	if m.search == nil || msg.taskId != m.selectedTaskId || msg.query != m.search.query {
+		// a newer query is being searched
+		return
+	}
+	m.search.results = msg.results
+	sortFiles(m.search.results, nil, m.fileSort)
+	m.contentCursor = 0
+	m.contentOffset = 0
+}
+
+// orders directories first by name, the largest or most recently
+// modified entries first otherwise
+func sortFiles(files []model.FileCatalogRow, dirSizes map[string]int64, by fileSort) {
+	slices.SortStableFunc(files, func(a, b model.FileCatalogRow) int {
+		switch by {
+		case sortBySize:
+			if c := cmp.Compare(components.EntrySize(&b, dirSizes), components.EntrySize(&a, dirSizes)); c != 0 {
+				return c
+			}
+		case sortByModified:
+			if c := b.ModifiedAt.Compare(a.ModifiedAt); c != 0 {
+				return c
+			}
+		default:
+			if a.FileType != b.FileType {
+				return cmp.Compare(b.FileType, a.FileType)
+			}
+		}
+		return cmp.Compare(a.FullPath, b.FullPath)
+	})
+}
+
+// rows of the files tab, directory listings start with the parent directory
+func (m *modelTui) contentRows() int {
+	if m.search != nil {
+		return len(m.search.results)
+	}
+	return len(m.files) + 1
+}
+
+func (m *modelTui) setContentCursor(cursor int) {
+	m.contentCursor = max(min(cursor, m.contentRows()-1), 0)
+	if m.contentCursor < m.contentOffset {
+		m.contentOffset = m.contentCursor
+	}
+	// handwaving space for file list
+	maxVisible := max(m.height-15, 1)
+	if m.contentCursor >= m.contentOffset+maxVisible {
+		m.contentOffset = m.contentCursor - maxVisible + 1
+	}
+}
+
+func (m *modelTui) cycleFileSort() {
+	m.fileSort = (m.fileSort + 1) % (sortByModified + 1)
+	sortFiles(m.files, m.dirSizes, m.fileSort)
+	if m.search != nil {
+		sortFiles(m.search.results, nil, m.fileSort)
+	}
+}
+
+// handles keys of the files tab while a search is shown, returns false
+// for keys it does not handle
+func (m *modelTui) updateSearch(msg tea.KeyMsg) (tea.Cmd, bool) {
+	s := m.search
+	switch msg.String() {
+	case "esc":
+		m.search = nil
+		m.contentCursor = 0
+		m.contentOffset = 0
+		return nil, true
+	case "up":
+		m.setContentCursor(m.contentCursor - 1)
+		return nil, true
+	case "down":
+		m.setContentCursor(m.contentCursor + 1)
+		return nil, true
+	case "enter":
+		if s.editing {
+			s.editing = false
+			return nil, true
+		}
+		return m.openSearchResult(), true
+	}
+	if !s.editing {
+		switch msg.String() {
+		case "/":
+			s.editing = true
+			return nil, true
+		case "k":
+			m.setContentCursor(m.contentCursor - 1)
+			return nil, true
+		case "j":
+			m.setContentCursor(m.contentCursor + 1)
+			return nil, true
+		case "l", "right":
+			return m.openSearchResult(), true
+		}
+		return nil, false
+	}
+	switch msg.Type {
+	case tea.KeyBackspace:
+		if len(s.query) == 0 {
+			return nil, true
+		}
+		runes := []rune(s.query)
+		s.query = string(runes[:len(runes)-1])
+	case tea.KeyRunes, tea.KeySpace:
+		s.query += string(msg.Runes)
+	default:
+		return nil, true
+	}
+	return m.searchFiles(s.query), true
+}
+
+// shows the directory of the selected search result
+func (m *modelTui) openSearchResult() tea.Cmd {
+	if m.contentCursor >= len(m.search.results) {
+		return nil
+	}
+	f := m.search.results[m.contentCursor]
+	m.search = nil
+	m.contentCursor = 0
+	m.contentOffset = 0
+	if f.FileType == "dir" {
+		m.currentDir = f.FullPath
+	} else {
+		m.currentDir = f.ParentPath
+		m.selectPath = f.FullPath
+	}
+	return m.fetchFiles
+}
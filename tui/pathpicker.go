@@ -0,0 +1,154 @@
+package tui
+
+import (
+	"glesha/tui/components"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pathPicker is a path input listing entries of the directory being typed
+type pathPicker struct {
+	value   string
+	entries []components.PathEntry
+	cursor  int
+	// only directories are listed
+	dirsOnly bool
+}
+
+func newPathPicker(value string, dirsOnly bool) *pathPicker {
+	p := &pathPicker{dirsOnly: dirsOnly}
+	p.setValue(value)
+	return p
+}
+
+func (p *pathPicker) handleKey(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "up":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down":
+		if p.cursor < len(p.entries)-1 {
+			p.cursor++
+		}
+	case "right":
+		p.openEntry()
+	case "left":
+		p.openParent()
+	default:
+		value := p.value
+		if editText(&value, msg) {
+			p.setValue(value)
+		}
+	}
+}
+
+func (p *pathPicker) setValue(value string) {
+	p.value = value
+	p.refreshEntries()
+}
+
+// completes the path with the selected entry
+func (p *pathPicker) openEntry() {
+	if p.cursor >= len(p.entries) {
+		return
+	}
+	dir, _ := splitPathPrefix(p.value)
+	e := p.entries[p.cursor]
+	value := filepath.Join(dir, e.Name)
+	if e.IsDir {
+		value += string(filepath.Separator)
+	}
+	p.setValue(value)
+}
+
+func (p *pathPicker) openParent() {
+	value := strings.TrimSuffix(p.value, string(filepath.Separator))
+	if len(value) == 0 {
+		return
+	}
+	parent := filepath.Dir(value)
+	if !strings.HasSuffix(parent, string(filepath.Separator)) {
+		parent += string(filepath.Separator)
+	}
+	p.setValue(parent)
+}
+
+// lists entries of the directory being typed that start with the
+// partially typed name, hidden ones only once a "." is typed
+func (p *pathPicker) refreshEntries() {
+	p.entries = nil
+	p.cursor = 0
+	dir, prefix := splitPathPrefix(p.value)
+	if len(dir) == 0 {
+		return
+	}
+	dirEntries, err := os.ReadDir(expandHome(dir))
+	if err != nil {
+		return
+	}
+	for _, e := range dirEntries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(filepath.Join(expandHome(dir), name))
+			isDir = err == nil && info.IsDir()
+		}
+		if p.dirsOnly && !isDir {
+			continue
+		}
+		p.entries = append(p.entries, components.PathEntry{Name: name, IsDir: isDir})
+	}
+	// directories first, they are picked more often
+	sort.SliceStable(p.entries, func(i, j int) bool {
+		return p.entries[i].IsDir && !p.entries[j].IsDir
+	})
+}
+
+// edits a text field, returns true if "value" changed
+func editText(value *string, msg tea.KeyMsg) bool {
+	switch {
+	case msg.String() == "backspace":
+		runes := []rune(*value)
+		if len(runes) == 0 {
+			return false
+		}
+		*value = string(runes[:len(runes)-1])
+	case msg.String() == "ctrl+u":
+		*value = ""
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		*value += string(msg.Runes)
+	default:
+		return false
+	}
+	return true
+}
+
+// splits a partially typed path into the directory and the start of a name
+func splitPathPrefix(path string) (string, string) {
+	if len(path) == 0 {
+		return "", ""
+	}
+	if strings.HasSuffix(path, string(filepath.Separator)) {
+		return path, ""
+	}
+	return filepath.Dir(path), filepath.Base(path)
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
@@ -0,0 +1,185 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/runner"
+	"glesha/tui/components"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// restoreForm asks where entries of a task are restored to
+type restoreForm struct {
+	taskId  int64
+	paths   []string
+	destDir *pathPicker
+	errMsg  string
+}
+
+// a restore run by the tui, restores run one at a time in the order they
+// were started
+type restoreJob struct {
+	taskId   int64
+	paths    []string
+	destDir  string
+	progress *runner.RestoreProgress
+	started  atomic.Bool
+}
+
+type restoreDoneMsg struct {
+	job *restoreJob
+	err error
+}
+
+func newRestoreForm(taskId int64, paths []string) *restoreForm {
+	destDir := fmt.Sprintf("glesha-restore-%d", taskId)
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		destDir = filepath.Join(homeDir, destDir)
+	}
+	return &restoreForm{taskId: taskId, paths: paths, destDir: newPathPicker(destDir, true)}
+}
+
+func (f *restoreForm) render(width int, height int) string {
+	return components.RenderRestoreForm(f.taskId, f.paths, f.destDir.value, f.destDir.entries,
+		f.destDir.cursor, f.errMsg, width, height)
+}
+
+// returns the entry under the cursor of the files tab
+func (m *modelTui) cursorEntry() *model.FileCatalogRow {
+	if m.search != nil {
+		if m.contentCursor < len(m.search.results) {
+			return &m.search.results[m.contentCursor]
+		}
+		return nil
+	}
+	// row 0 is the parent directory
+	if m.contentCursor > 0 && m.contentCursor <= len(m.files) {
+		return &m.files[m.contentCursor-1]
+	}
+	return nil
+}
+
+func (m *modelTui) toggleMark() {
+	e := m.cursorEntry()
+	if e == nil {
+		return
+	}
+	if m.marked[e.FullPath] {
+		delete(m.marked, e.FullPath)
+	} else {
+		m.marked[e.FullPath] = true
+	}
+	m.setContentCursor(m.contentCursor + 1)
+}
+
+// asks where to restore marked entries, or the entry under the cursor
+// when none are marked
+func (m *modelTui) openRestoreForm() {
+	if m.selectedTaskId == 0 {
+		return
+	}
+	var paths []string
+	for p := range m.marked {
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		e := m.cursorEntry()
+		if e == nil {
+			m.setNotice("Mark files with space to restore them", nil)
+			return
+		}
+		paths = append(paths, e.FullPath)
+	}
+	slices.Sort(paths)
+	m.restoreForm = newRestoreForm(m.selectedTaskId, paths)
+}
+
+func (m *modelTui) updateRestoreForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.restoreForm
+	f.errMsg = ""
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		m.restoreForm = nil
+		return nil
+	case "enter":
+		destDir := expandHome(f.destDir.value)
+		if len(destDir) == 0 {
+			f.errMsg = "restore directory is required"
+			return nil
+		}
+		m.restoreForm = nil
+		m.marked = map[string]bool{}
+		return m.startRestore(f.taskId, f.paths, destDir)
+	}
+	f.destDir.handleKey(msg)
+	return nil
+}
+
+// restores "paths" of task "taskId" in the background, after restores
+// started before it
+func (m *modelTui) startRestore(taskId int64, paths []string, destDir string) tea.Cmd {
+	job := &restoreJob{taskId: taskId, paths: paths, destDir: destDir, progress: runner.NewRestoreProgress()}
+	m.restores = append(m.restores, job)
+	m.runs.Add(1)
+	r, ctx, runs, restoreMu := m.runner, m.runCtx, m.runs, m.restoreMu
+	run := func() tea.Msg {
+		defer runs.Done()
+		restoreMu.Lock()
+		defer restoreMu.Unlock()
+		job.started.Store(true)
+		err := r.RestoreEntries(ctx, taskId, paths, destDir, job.progress)
+		if err != nil {
+			L.Error(fmt.Errorf("tui: restore of task %d to %s failed: %w", taskId, destDir, err))
+		}
+		return restoreDoneMsg{job: job, err: err}
+	}
+	// set right away, a notice command could arrive after a quick restore is done
+	m.setNotice(fmt.Sprintf("Restoring %s of task #%d to %s",
+		L.HumanReadableCount(len(paths), "entry", "entries"), taskId, destDir), nil)
+	cmds := []tea.Cmd{run}
+	if !m.progressTicking {
+		m.progressTicking = true
+		cmds = append(cmds, progressTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m *modelTui) finishRestore(msg restoreDoneMsg) {
+	m.restores = slices.DeleteFunc(m.restores, func(j *restoreJob) bool { return j == msg.job })
+	stats := msg.job.progress.Get()
+	switch {
+	case msg.err == nil:
+		m.setNotice(fmt.Sprintf("Restored %s of task #%d to %s",
+			L.HumanReadableCount(int(stats.Entries), "file", "files"), msg.job.taskId, msg.job.destDir), nil)
+	case errors.Is(msg.err, context.Canceled):
+		m.setNotice(fmt.Sprintf("Restore of task #%d aborted", msg.job.taskId), nil)
+	case stats.Failed > 0:
+		// every failed entry is in the log
+		m.setNotice("", fmt.Errorf("%s of task #%d could not be restored, see tui.log",
+			L.HumanReadableCount(int(stats.Failed), "file", "files"), msg.job.taskId))
+	default:
+		m.setNotice("", fmt.Errorf("restore of task #%d failed: %w", msg.job.taskId, msg.err))
+	}
+}
+
+func (m *modelTui) restoreInfos() []components.RestoreInfo {
+	var infos []components.RestoreInfo
+	for _, j := range m.restores {
+		infos = append(infos, components.RestoreInfo{
+			TaskId:  j.taskId,
+			DestDir: j.destDir,
+			Started: j.started.Load(),
+			Stats:   j.progress.Get(),
+		})
+	}
+	return infos
+}
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"glesha/database/model"
+	L "glesha/logger"
+	"glesha/runner"
+	"glesha/tui/components"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rates are averaged over this window
+const RATE_WINDOW = 30 * time.Second
+
+type uploadBlocksMsg struct {
+	uploadId int64
+	blocks   []model.UploadBlock
+	at       time.Time
+}
+
+type rateSample struct {
+	at   time.Time
+	sent int64
+}
+
+// moving average upload rate of one upload, computed from the bytes of
+// completed blocks as seen in the database
+type rateMeter struct {
+	uploadId int64
+	samples  []rateSample
+}
+
+func (rm *rateMeter) add(uploadId int64, at time.Time, sent int64) {
+	if rm.uploadId != uploadId {
+		rm.uploadId = uploadId
+		rm.samples = nil
+	}
+	rm.samples = append(rm.samples, rateSample{at: at, sent: sent})
+	i := 0
+	for i < len(rm.samples)-1 && at.Sub(rm.samples[i].at) > RATE_WINDOW {
+		i++
+	}
+	rm.samples = rm.samples[i:]
+}
+
+// bytes per second, 0 until there are two samples
+func (rm *rateMeter) rate() float64 {
+	if len(rm.samples) < 2 {
+		return 0
+	}
+	first, last := rm.samples[0], rm.samples[len(rm.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 || last.sent < first.sent {
+		return 0
+	}
+	return float64(last.sent-first.sent) / elapsed
+}
+
+// reads blocks of the upload from the database, so uploads run by other
+// processes are shown as well
+func (m modelTui) fetchUploadBlocks(uploadId int64) tea.Cmd {
+	return func() tea.Msg {
+		blocks, err := m.runner.UploadBlockRepo.GetBlocksForUploadId(m.ctx, uploadId)
+		if err != nil {
+			L.Error(fmt.Errorf("tui: failed to fetch blocks of upload %d: %w", uploadId, err))
+			return nil
+		}
+		return uploadBlocksMsg{uploadId: uploadId, blocks: blocks, at: time.Now()}
+	}
+}
+
+// fetches blocks of the selected task when the upload tab is shown
+func (m *modelTui) refreshUpload() tea.Cmd {
+	if m.activeTab != tabUpload {
+		return nil
+	}
+	info := m.selectedTask()
+	if info == nil || info.Upload == nil {
+		return nil
+	}
+	return m.fetchUploadBlocks(info.Upload.Id)
+}
+
+func (m *modelTui) setUploadBlocks(msg uploadBlocksMsg) {
+	info := m.selectedTask()
+	if info == nil || info.Upload == nil || info.Upload.Id != msg.uploadId {
+		// selection changed while fetching
+		return
+	}
+	m.uploadId = msg.uploadId
+	m.uploadBlocks = msg.blocks
+	m.uploadStats = runner.GetUploadStats(msg.blocks, msg.at, RATE_WINDOW)
+	m.uploadRate.add(msg.uploadId, msg.at, m.uploadStats.CompletedBytes)
+}
+
+// blocks are shown only once they are fetched for the selected task
+func (m modelTui) uploadViewData(info components.TaskInfo) ([]model.UploadBlock, *runner.UploadStats, float64) {
+	if info.Upload == nil || info.Upload.Id != m.uploadId {
+		return nil, nil, 0
+	}
+	return m.uploadBlocks, m.uploadStats, m.uploadRate.rate()
+}
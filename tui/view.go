@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"fmt"
 	"glesha/database/model"
 	"glesha/tui/components"
 	"strings"
@@ -37,25 +38,29 @@ func (m modelTui) View() string {
 
 	var cb strings.Builder
 
-	statusLabel := "Status"
-	filesLabel := "Files"
-	var statusTab, filesTab string
-
-	if m.focus == focusContent {
-		statusLabel = "[3] Status"
-		filesLabel = "[4] Files"
-		if m.activeTab == tabStatus {
-			statusTab = activeTabStyle.Render(statusLabel)
-			filesTab = tabStyle.Foreground(components.ColorGrey).Render(filesLabel)
+	tabs := []struct {
+		id    tabId
+		key   string
+		label string
+	}{
+		{tabStatus, "3", "Status"},
+		{tabFiles, "4", "Files"},
+		{tabUpload, "5", "Upload"},
+	}
+	var tabLabels []string
+	for _, t := range tabs {
+		if m.focus != focusContent {
+			tabLabels = append(tabLabels, tabStyle.Foreground(components.ColorGrey).Render(t.label))
+			continue
+		}
+		label := fmt.Sprintf("[%s] %s", t.key, t.label)
+		if m.activeTab == t.id {
+			tabLabels = append(tabLabels, activeTabStyle.Render(label))
 		} else {
-			statusTab = tabStyle.Foreground(components.ColorGrey).Render(statusLabel)
-			filesTab = activeTabStyle.Render(filesLabel)
+			tabLabels = append(tabLabels, tabStyle.Foreground(components.ColorGrey).Render(label))
 		}
-	} else {
-		statusTab = tabStyle.Foreground(components.ColorGrey).Render(statusLabel)
-		filesTab = tabStyle.Foreground(components.ColorGrey).Render(filesLabel)
 	}
-	cb.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, statusTab, filesTab) + "\n")
+	cb.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabLabels...) + "\n")
 
 	var currentTask components.TaskInfo
 	for _, t := range m.tasks {
@@ -65,29 +70,64 @@ func (m modelTui) View() string {
 		}
 	}
 
-	if m.activeTab == tabStatus {
+	if m.form != nil {
+		cb.WriteString(m.form.render(contentWidth, m.height))
+	} else if m.restoreForm != nil {
+		cb.WriteString(m.restoreForm.render(contentWidth, m.height))
+	} else if m.configForm != nil {
+		cb.WriteString(m.configForm.render(contentWidth))
+	} else if m.activeTab == tabStatus {
 		statusContent := components.RenderStatusView(
 			m.ctx,
 			currentTask,
 			contentWidth,
 		)
 		cb.WriteString(statusContent)
+	} else if m.activeTab == tabUpload {
+		blocks, stats, rate := m.uploadViewData(currentTask)
+		cb.WriteString(components.RenderUploadView(
+			currentTask,
+			blocks,
+			stats,
+			rate,
+			contentWidth,
+		))
 	} else {
 		var currentTaskModel *model.Task
 		if currentTask.Task != nil {
 			currentTaskModel = currentTask.Task
 		}
 
-		filesContent := components.RenderFilesView(
-			m.files,
-			m.currentDir,
-			m.contentCursor,
-			m.contentOffset,
-			m.focus == focusContent,
-			contentWidth,
-			m.height,
-			currentTaskModel,
-		)
+		filesContent := components.RenderRestores(m.restoreInfos(), contentWidth)
+		if m.search != nil {
+			filesContent += components.RenderFileSearch(
+				m.search.query,
+				m.search.editing,
+				m.search.results,
+				m.marked,
+				m.fileSort.String(),
+				m.contentCursor,
+				m.contentOffset,
+				m.focus == focusContent,
+				contentWidth,
+				m.height,
+			)
+		} else {
+			filesContent += components.RenderFilesView(
+				m.files,
+				m.dirSizes,
+				m.marked,
+				m.currentDir,
+				m.fileSort.String(),
+				m.sizeView,
+				m.contentCursor,
+				m.contentOffset,
+				m.focus == focusContent,
+				contentWidth,
+				m.height,
+				currentTaskModel,
+			)
+		}
 		cb.WriteString(filesContent)
 	}
 
@@ -106,7 +146,20 @@ func (m modelTui) View() string {
 	}
 	contentBox := renderBoxWithTitle(contentTitle, cb.String(), contentWidth, mainHeight, contentBorderStyle, contentTitleStyle, true)
 
-	footer := components.HelpStyle.Width(m.width).Align(lipgloss.Center).Render("1:Tasks | 2:Content | Tab:Toggle | 3/s:Status | 4/f:Files | j/k/arrow keys:Navigate | q:Quit")
+	footerStyle := components.HelpStyle
+	footerText := "1:Tasks | 2:Content | Tab:Toggle | 3/s:Status | 4/f:Files | 5/u:Upload | /:Search | o:Sort | v:Sizes | Space:Mark | R:Restore | j/k:Navigate | r:Run | p:Pause/Resume | x:Abort | d:Delete | a:Add | c:Config | q:Quit"
+	switch {
+	case m.confirm != nil:
+		footerStyle = components.YellowStyle
+		footerText = m.confirm.prompt
+	case len(m.notice) > 0 && m.noticeIsError:
+		footerStyle = components.RedStyle
+		footerText = m.notice
+	case len(m.notice) > 0:
+		footerStyle = components.GreenStyle
+		footerText = m.notice
+	}
+	footer := footerStyle.Width(m.width).MaxHeight(1).Align(lipgloss.Center).Render(footerText)
 
 	return lipgloss.JoinVertical(lipgloss.Left,
 		lipgloss.JoinHorizontal(lipgloss.Top, sidebarBox, contentBox),